@@ -4,29 +4,32 @@ package main
 import (
 	"context"
 	"fmt"
+
 	"github.com/duclek15/go-abac-library/abac"
 )
 
 // UserRepo là một PIP, triển khai SubjectFetcher.
 type UserRepo struct{}
 
-func (ur *UserRepo) GetSubjectAttributes(ctx *context.Context, subjectID interface{}, subjectType *interface{}) (abac.Attributes, error) {
-	fmt.Printf("PIP: Fetching attributes for subject '%s'\n", subjectID)
-	// Mock data người dùng trong môi trường multi-tenant
+func (ur *UserRepo) GetSubjectAttributes(ctx *context.Context, subjectID interface{}) (abac.Attributes, error) {
+	fmt.Printf("PIP: Fetching attributes for subject '%v'\n", subjectID)
+	// Mock data người dùng trong môi trường multi-tenant (cấu trúc mà hasGlobalRole/hasTenantRole đọc)
 	users := map[string]abac.Attributes{
+		"root_user": {"id": "root_user", "global_roles": []interface{}{"root"}},
+
 		// Tenant 1
-		"t1_root":        {"id": "t1_root", "role": "root", "tenant": "tenant1"},
-		"t1_hr_manager":  {"id": "t1_hr_manager", "role": "hr_manager", "department": "hr", "tenant": "tenant1"},
-		"t1_eng_manager": {"id": "t1_eng_manager", "role": "manager", "department": "engineering", "tenant": "tenant1"},
-		"t1_eng_staff":   {"id": "t1_eng_staff", "role": "staff", "department": "engineering", "tenant": "tenant1"},
+		"t1_hr_manager": {"id": "t1_hr_manager", "department": "hr", "tenants": []interface{}{
+			map[string]interface{}{"id": "tenant1", "role": "hr_manager"},
+		}},
+		"t1_eng_staff": {"id": "t1_eng_staff", "department": "engineering", "tenants": []interface{}{
+			map[string]interface{}{"id": "tenant1", "role": "staff"},
+		}},
 
 		// Tenant 2
-		"t2_root":        {"id": "t2_root", "role": "root", "tenant": "tenant2"},
-		"t2_hr_manager":  {"id": "t2_hr_manager", "role": "hr_manager", "department": "hr", "tenant": "tenant2"},
-		"t2_hr_staff":    {"id": "t2_hr_staff", "role": "staff", "department": "hr", "tenant": "tenant2"},
-		"t2_sales_staff": {"id": "t2_sales_staff", "role": "staff", "department": "sales", "tenant": "tenant2"},
+		"t2_hr_manager": {"id": "t2_hr_manager", "department": "hr", "tenants": []interface{}{
+			map[string]interface{}{"id": "tenant2", "role": "hr_manager"},
+		}},
 	}
-	//convert subjectID to string
 	subjectIDStr, ok := subjectID.(string)
 	if !ok {
 		return nil, abac.ErrSubjectNotFound
@@ -40,24 +43,23 @@ func (ur *UserRepo) GetSubjectAttributes(ctx *context.Context, subjectID interfa
 // DocumentRepo là một PIP, triển khai ResourceFetcher.
 type DocumentRepo struct{}
 
-func (dr *DocumentRepo) GetResourceAttributes(ctx *context.Context, resourceID interface{}, resourceType *interface{}) (abac.Attributes, error) {
-	fmt.Printf("PIP: Fetching attributes for resource '%s'\n", resourceID)
-	// Mock data tài nguyên (đơn từ)
+func (dr *DocumentRepo) GetResourceAttributes(ctx *context.Context, resourceID interface{}) ([]abac.Attributes, error) {
+	fmt.Printf("PIP: Fetching attributes for resource '%v'\n", resourceID)
+	// Mock data tài nguyên (đơn từ), khóa theo request_id trong đường dẫn
 	requests := map[string]abac.Attributes{
 		// Đơn từ của Tenant 1
-		"/requests/t1_eng_leave_001": {"id": "/requests/t1_eng_leave_001", "type": "leave_request", "department": "engineering", "tenant": "tenant1", "level": 2},
+		"t1_eng_leave_001": {"id": "t1_eng_leave_001", "type": "leave_request", "department": "engineering", "tenant": "tenant1", "level": 2},
 
 		// Đơn từ của Tenant 2
-		"/requests/t2_hr_leave_001": {"id": "/requests/t2_hr_leave_001", "type": "leave_request", "department": "hr", "tenant": "tenant2", "level": 2},
-		"/requests/t2_sales_ot_002": {"id": "/requests/t2_sales_ot_002", "type": "overtime_request", "department": "sales", "tenant": "tenant2", "level": 2},
+		"t2_hr_leave_001": {"id": "t2_hr_leave_001", "type": "leave_request", "department": "hr", "tenant": "tenant2", "level": 2},
+		"t2_sales_ot_002": {"id": "t2_sales_ot_002", "type": "overtime_request", "department": "sales", "tenant": "tenant2", "level": 2},
 	}
-	//convert resourceID to string
 	resourceIDStr, ok := resourceID.(string)
 	if !ok {
 		return nil, abac.ErrResourceNotFound
 	}
 	if req, ok := requests[resourceIDStr]; ok {
-		return req, nil
+		return []abac.Attributes{req}, nil
 	}
 	return nil, abac.ErrResourceNotFound
 }
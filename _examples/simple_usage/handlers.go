@@ -2,21 +2,26 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/gin-gonic/gin"
 	"log"
 	"net/http"
 )
 
-// === Handlers cho nghiệp vụ "Đơn từ" ===
+// writeJSON ghi body JSON với status cho trước.
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
 
-func (app *App) approveRequestHandler(c *gin.Context) {
-	// Lấy ID từ path parameter của Gin
-	requestID := c.Param("request_id")
-	fullResourceID := "/requests/" + requestID
+// === Handlers cho nghiệp vụ "Đơn từ" ===
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("Action Succeeded: Request '%s' has been approved.", fullResourceID),
+func (app *App) approveRequestHandler(w http.ResponseWriter, r *http.Request) {
+	// Middleware đã kiểm tra quyền; request_id lấy từ wildcard của pattern http.ServeMux
+	requestID := r.PathValue("request_id")
+	writeJSON(w, http.StatusOK, map[string]string{
+		"message": fmt.Sprintf("Action Succeeded: Request '%s' has been approved.", requestID),
 	})
 }
 
@@ -26,30 +31,29 @@ type policyRequest struct {
 	Rules [][]string `json:"rules"`
 }
 
-func (app *App) addPoliciesHandler(c *gin.Context) {
+func (app *App) addPoliciesHandler(w http.ResponseWriter, r *http.Request) {
 	var req policyRequest
-	// Dùng ShouldBindJSON để parse body request
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
 		return
 	}
 
 	log.Printf("ADMIN API: Adding %d policies", len(req.Rules))
 	ok, err := app.PolicyManager.AddPolicies(req.Rules)
 	if err != nil || !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add policies"})
+		log.Printf("ADMIN API: Failed to add policies: %v", err)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "Failed to add policies"})
 		return
 	}
-
-	c.JSON(http.StatusCreated, gin.H{"message": "Policies added successfully."})
+	writeJSON(w, http.StatusCreated, map[string]string{"message": "Policies added successfully."})
 }
 
-func (app *App) getPoliciesHandler(c *gin.Context) {
-	policies, err := app.PolicyManager.GetPolicies()
+func (app *App) getPoliciesHandler(w http.ResponseWriter, r *http.Request) {
+	policies, err := app.PolicyManager.ListPolicies("")
 	if err != nil {
 		log.Printf("ADMIN API: Failed to get policies: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve policies"})
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "Failed to retrieve policies"})
 		return
 	}
-	c.JSON(http.StatusOK, policies)
+	writeJSON(w, http.StatusOK, policies)
 }
@@ -2,12 +2,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
-	"strings"
 
 	"github.com/duclek15/go-abac-library/abac"
-	"github.com/gin-gonic/gin"
+	"github.com/duclek15/go-abac-library/abac/httpmw"
 )
 
 type App struct {
@@ -15,37 +16,24 @@ type App struct {
 	PolicyManager *abac.PolicyManager
 }
 
-// authMiddleware được viết lại theo chuẩn của Gin.
-func (app *App) authMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			return
-		}
-		subjectID := strings.TrimPrefix(authHeader, "Bearer ")
-
-		// Lấy resource và action từ context của Gin
-		requestID := c.Param("request_id")
-		resourceID := "/requests/" + requestID
-		action := "approve_level_2" // Mặc định cho route này
-
-		log.Printf("PEP: Check(Subject: %s, Resource: %s, Action: %s)", subjectID, resourceID, action)
-		envAtt := abac.Attributes{}
-		isAllowed, err := app.Authorizer.Check("*", subjectID, resourceID, action, envAtt)
-		if err != nil || !isAllowed {
-			log.Printf("PEP: DENIED. Reason: %v", err)
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
-			return
-		}
-
-		log.Println("PEP: PERMITTED.")
-		c.Next() // Cho phép request đi tiếp vào handler
+// demoTokens thay cho việc xác thực JWT: mỗi token ứng với claims của một người dùng.
+// Ứng dụng thật kiểm tra chữ ký token trong TokenVerifier.
+var demoTokens = map[string]map[string]interface{}{
+	"t1-hr-token":    {"sub": "t1_hr_manager", "tenant": "tenant1"},
+	"t1-staff-token": {"sub": "t1_eng_staff", "tenant": "tenant1"},
+	"t2-hr-token":    {"sub": "t2_hr_manager", "tenant": "tenant2"},
+}
+
+func verifyDemoToken(ctx context.Context, token string) (map[string]interface{}, error) {
+	if claims, ok := demoTokens[token]; ok {
+		return claims, nil
 	}
+	return nil, errors.New("unknown token")
 }
 
 func main() {
-	// --- Khởi tạo các thành phần (giữ nguyên) ---
+	// --- Khởi tạo các thành phần ---
+	// Chạy từ thư mục gốc của repo: go run ./_examples/simple_usage
 	userRepo := &UserRepo{}
 	docRepo := &DocumentRepo{}
 	authorizer, policyManager, err := abac.NewABACSystemFromFile(
@@ -53,6 +41,7 @@ func main() {
 		"casbin_config/abac_policy.csv",
 		userRepo,
 		docRepo,
+		nil,
 	)
 	if err != nil {
 		log.Fatalf("FATAL: Could not create ABAC system: %v", err)
@@ -62,59 +51,56 @@ func main() {
 		PolicyManager: policyManager,
 	}
 
-	// --- Thiết lập Router với Gin ---
-	router := gin.Default()
+	// PEP: subject và tenant lấy từ claims của token đã xác thực, resource từ wildcard của route.
+	approve := httpmw.Middleware(authorizer,
+		httpmw.WithTokenVerifier(verifyDemoToken),
+		httpmw.WithTenant(httpmw.TenantFromClaim("tenant")),
+		httpmw.WithSubject(httpmw.SubjectFromClaim("sub")),
+		httpmw.WithResource(httpmw.ResourceFromPathValue("request_id")),
+		httpmw.WithAction(httpmw.StaticAction("approve_level_2")),
+	)
 
-	// Nhóm các API quản lý policy
-	adminAPI := router.Group("/admin")
-	{
-		adminAPI.POST("/policies", app.addPoliciesHandler)
-		adminAPI.GET("/policies", app.getPoliciesHandler)
-		adminAPI.DELETE("/policies", app.getPoliciesHandler)
-	}
+	mux := http.NewServeMux()
 
-	// Nhóm các API nghiệp vụ "Đơn từ"
-	requestAPI := router.Group("/requests")
-	// Áp dụng middleware (PEP) cho group này
-	requestAPI.Use(app.authMiddleware())
-	{
-		// Sử dụng path parameter :request_id
-		requestAPI.POST("/:request_id/approve", app.approveRequestHandler)
-	}
+	// Các API quản lý policy (demo: không kiểm tra quyền)
+	mux.HandleFunc("POST /admin/policies", app.addPoliciesHandler)
+	mux.HandleFunc("GET /admin/policies", app.getPoliciesHandler)
+
+	// API nghiệp vụ "Đơn từ", được bảo vệ bởi middleware
+	mux.Handle("POST /requests/{request_id}/approve", approve(http.HandlerFunc(app.approveRequestHandler)))
 
 	// --- Hướng dẫn sử dụng ---
 	printInstructions()
 
-	// --- Khởi động server Gin ---
-	log.Println("Gin server starting on :8080...")
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Gin server failed to start: %v", err)
+	// --- Khởi động server ---
+	log.Println("HTTP server starting on :8080...")
+	if err := http.ListenAndServe(":8080", mux); err != nil {
+		log.Fatalf("HTTP server failed to start: %v", err)
 	}
 }
 
 func printInstructions() {
-	log.Println("\n--- 🚀 Step 1: Bootstrap Policies via API ---")
-	log.Println("Run this command in a new terminal to add business rules:")
+	log.Println("\n--- ✅ Step 1: Test Successful Scenarios ---")
+	log.Println("  - [PASS] T1 HR Manager approves a request from Engineering dept in T1:")
+	log.Println(`    curl -i -X POST -H "Authorization: Bearer t1-hr-token" http://localhost:8080/requests/t1_eng_leave_001/approve`)
+	log.Println("  - [PASS] T2 HR Manager approves a request from HR department in T2:")
+	log.Println(`    curl -i -X POST -H "Authorization: Bearer t2-hr-token" http://localhost:8080/requests/t2_hr_leave_001/approve`)
+
+	log.Println("\n--- ❌ Step 2: Test Failed Scenarios ---")
+	log.Println("  - [FAIL] T2 HR Manager CANNOT approve a request from Sales department in T2:")
+	log.Println(`    curl -i -X POST -H "Authorization: Bearer t2-hr-token" http://localhost:8080/requests/t2_sales_ot_002/approve`)
+	log.Println("  - [FAIL] T1 staff CANNOT approve requests:")
+	log.Println(`    curl -i -X POST -H "Authorization: Bearer t1-staff-token" http://localhost:8080/requests/t1_eng_leave_001/approve`)
+
+	log.Println("\n--- 🔧 Step 3: Add a policy via API, then retry the staff request ---")
 	log.Println(`
 curl -X POST -H "Content-Type: application/json" -d '{
   "rules": [
-    ["Action == \"approve_level_2\" && Subject.role == \"hr_manager\" && Subject.tenant == \"tenant1\" && Subject.tenant == Resource.tenant", "allow"],
-    ["Action == \"approve_level_2\" && Subject.role == \"hr_manager\" && Subject.tenant == \"tenant2\" && Subject.tenant == Resource.tenant && Resource.department == \"hr\"", "allow"]
+    ["tenant1", "Action == \"approve_level_2\" && hasTenantRole(Subject, \"tenant1\", \"staff\")", "allow"]
   ]
 }' http://localhost:8080/admin/policies
 	`)
 
-	log.Println("\n--- ✅ Step 2: Test Successful Scenarios ---")
-	log.Println("  - [PASS] T1 HR Manager approves a request from Engineering dept in T1:")
-	log.Println(`    curl -i -X POST -H "Authorization: Bearer t1_hr_manager" http://localhost:8080/requests/t1_eng_leave_001/approve`)
-	log.Println("  - [PASS] T2 HR Manager approves a request from HR department in T2:")
-	log.Println(`    curl -i -X POST -H "Authorization: Bearer t2_hr_manager" http://localhost:8080/requests/t2_hr_leave_001/approve`)
-
-	log.Println("\n--- ❌ Step 3: Test Failed Scenarios ---")
-	log.Println("  - [FAIL] T2 HR Manager CANNOT approve a request from Sales department in T2:")
-	log.Println(`    curl -i -X POST -H "Authorization: Bearer t2_hr_manager" http://localhost:8080/requests/t2_sales_ot_002/approve`)
-
 	log.Println("\n--- 🔍 (Optional) Step 4: View all current policies ---")
-	log.Println("  - See all policies currently in memory:")
 	log.Println(`    curl http://localhost:8080/admin/policies | jq .`)
 }
@@ -0,0 +1,164 @@
+package abac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// AllowedActions trả về các action mà subject được phép thực hiện trên resource.
+// Thuộc tính của subject và resource chỉ được lấy một lần; tập action ứng viên được suy ra
+// từ các so sánh Action == '...' và Action in (...) trong policy của tenant, nên action
+// không xuất hiện trong bất kỳ policy nào sẽ không được liệt kê. Như Check, action có Permit kèm
+// obligation bắt buộc không được liệt kê.
+//
+// Lỗi khi lấy thuộc tính dừng truy vấn (kết quả nil). Lỗi rule của một action không làm hỏng các
+// action khác: action đó không được liệt kê, các action còn lại vẫn được trả về cùng errors.Join
+// của các lỗi này (mỗi lỗi có dạng "action <tên>: ..."), giống SubjectsAllowed.
+func (a *Authorizer) AllowedActions(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, envAttrsInput *Attributes) ([]string, error) {
+	actions, _, err := a.allowedActions(ctx, tenantID, subject, resource, envAttrsInput, false)
+	return actions, err
+}
+
+// AllowedActionsWithTrace giống AllowedActions và trả thêm DecisionTrace cho từng action ứng viên.
+func (a *Authorizer) AllowedActionsWithTrace(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, envAttrsInput *Attributes, opts ...TraceOption) ([]string, map[string]*DecisionTrace, error) {
+	return a.allowedActions(ctx, tenantID, subject, resource, envAttrsInput, true, opts...)
+}
+
+func (a *Authorizer) allowedActions(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, envAttrsInput *Attributes, withTrace bool, opts ...TraceOption) ([]string, map[string]*DecisionTrace, error) {
+	subAttrs, err := a.subjectFetcher.GetSubjectAttributes(ctx, subject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("subject attributes error: %w", err)
+	}
+	envAttrs := make(Attributes)
+	if envAttrsInput != nil {
+		envAttrs = *envAttrsInput
+	}
+	listResAttrs, err := a.resourceFetcher.GetResourceAttributes(ctx, resource)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resource attributes error: %w", err)
+	}
+	if len(listResAttrs) == 0 {
+		listResAttrs = []Attributes{{}}
+	}
+
+	var traces map[string]*DecisionTrace
+	if withTrace {
+		traces = make(map[string]*DecisionTrace)
+	}
+	allowed := make([]string, 0)
+	var errs []error
+	for _, action := range a.candidateActions(tenantID) {
+		var collector *traceCollector
+		var trace *DecisionTrace
+		var cfg *traceConfig
+		if withTrace {
+			collector, trace, cfg = newTraceCollector(opts...)
+			traces[action] = trace
+		}
+		start := time.Now()
+		ok := true
+		for i, resAttrs := range listResAttrs {
+			req := &AuthorizationRequest{
+				Subject:  subAttrs,
+				Resource: resAttrs,
+				Action:   action,
+				Env:      envAttrs,
+
+				resourceIndex: i,
+			}
+			if withTrace {
+				req.Trace, req.TraceCfg = collector, cfg
+				trace.requests = append(trace.requests, req)
+			}
+			res, err := a.engine.enforce(tenantID, req)
+			if err != nil {
+				// Lỗi của một action không làm hỏng kết quả của các action khác.
+				if trace != nil {
+					trace.Error = err.Error()
+				}
+				errs = append(errs, fmt.Errorf("action %s: %w", action, err))
+				ok = false
+				break
+			}
+			if !res {
+				ok = false
+				break
+			}
+		}
+		if trace != nil {
+			trace.EvaluationMs = time.Since(start).Milliseconds()
+		}
+		if ok {
+			allowed = append(allowed, action)
+		}
+	}
+	return allowed, traces, errors.Join(errs...)
+}
+
+// candidateActions thu thập các action được so sánh trực tiếp trong policy áp dụng cho tenant.
+func (a *Authorizer) candidateActions(tenantID string) []string {
+	seen := make(map[string]bool)
+	for _, p := range a.engine.current().policies {
+		if !p.appliesTo(tenantID) {
+			continue
+		}
+		ast, err := p.syntax(a.engine.evaluator.functions)
+		if err != nil {
+			continue
+		}
+		for _, action := range ast.actionLiterals() {
+			seen[action] = true
+		}
+	}
+	actions := make([]string, 0, len(seen))
+	for action := range seen {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// actionLiterals trả về các chuỗi được so sánh với Action bằng == hoặc in trong rule.
+func (a *ruleAST) actionLiterals() []string {
+	var out []string
+	isAction := func(n *exprNode) bool {
+		return n.kind == exprVariable && len(n.path) == 1 && n.path[0] == "Action"
+	}
+	addLiteral := func(n *exprNode) {
+		if n.kind != exprLiteral {
+			return
+		}
+		if s, ok := n.value.(string); ok {
+			out = append(out, s)
+		}
+	}
+	a.root.walk(func(n *exprNode) {
+		if n.kind != exprComparison {
+			return
+		}
+		left, right := n.children[0], n.children[1]
+		switch n.op {
+		case "==":
+			if isAction(left) {
+				addLiteral(right)
+			} else if isAction(right) {
+				addLiteral(left)
+			}
+		case "in":
+			if !isAction(left) {
+				return
+			}
+			if right.kind == exprList {
+				for _, item := range right.children {
+					addLiteral(item)
+				}
+			} else {
+				addLiteral(right)
+			}
+		}
+	})
+	return out
+}
@@ -0,0 +1,89 @@
+package abac_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizer_AllowedActions(t *testing.T) {
+	policies := `
+p, *, "Action in ('read', 'comment') && Subject.id != ''", allow, read_comment
+p, tenant2, "'approve' == Action && hasTenantRole(Subject, 'tenant2', 'hr_manager') && Resource.department == 'hr'", allow, approve_hr
+p, *, "(Action == 'delete' || Action == 'archive') && hasGlobalRole(Subject, 'root')", allow, root_delete
+p, *, "Action == 'comment' && Resource.department == 'sales'", deny, no_comment_sales
+p, tenant1, "Action == 'export'", allow, other_tenant`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	actions, err := authorizer.AllowedActions(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"approve", "comment", "read"}, actions)
+
+	actions, err = authorizer.AllowedActions(&ctx, "tenant2", "t2_hr_manager", "t2_sales_request", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read"}, actions)
+
+	actions, err = authorizer.AllowedActions(&ctx, "tenant2", "root_user", "t2_sales_request", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"archive", "delete", "read"}, actions)
+
+	// Kết quả phải khớp với Check cho từng action ứng viên.
+	for _, action := range []string{"approve", "archive", "comment", "delete", "read", "export"} {
+		allowed, err := authorizer.Check(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", action, nil)
+		require.NoError(t, err)
+		actions, _ := authorizer.AllowedActions(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", nil)
+		assert.Equal(t, allowed, contains(actions, action), action)
+	}
+
+	_, err = authorizer.AllowedActions(&ctx, "tenant2", "unknown_user", "t2_hr_request", nil)
+	assert.ErrorIs(t, err, abac.ErrSubjectNotFound)
+}
+
+func TestAuthorizer_AllowedActions_RuleErrors(t *testing.T) {
+	policies := `
+p, *, "Action == 'read'", allow, read_all
+p, *, "Action == 'approve' && Subject.level > 3", allow, level_approve`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Rule lỗi của một action không làm hỏng các action khác, lỗi được trả về như SubjectsAllowed.
+	actions, err := authorizer.AllowedActions(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", nil)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "action approve:")
+	assert.Equal(t, []string{"read"}, actions)
+}
+
+func TestAuthorizer_AllowedActionsWithTrace(t *testing.T) {
+	authorizer := setupAuthorizer(t)
+	ctx := context.Background()
+
+	actions, traces, err := authorizer.AllowedActionsWithTrace(&ctx, "tenant2", "t2_hr_manager", "t2_sales_request", nil)
+	require.NoError(t, err)
+	assert.Empty(t, actions)
+	require.Contains(t, traces, "approve_level_2")
+	trace := traces["approve_level_2"]
+	assert.Equal(t, "deny", trace.Decision)
+
+	ex, err := authorizer.Explain(trace)
+	require.NoError(t, err)
+	require.NotEmpty(t, ex.ClosestAllowRules)
+	assert.Equal(t, "t2_hr_manager_approve_hr_level_2", ex.ClosestAllowRules[0].PolicyID)
+}
+
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
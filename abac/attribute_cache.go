@@ -0,0 +1,341 @@
+package abac
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultCacheTTL         = time.Minute
+	defaultCacheMaxEntries  = 10000
+	defaultNegativeCacheTTL = 10 * time.Second
+)
+
+// CacheStats là số liệu thống kê của một cache.
+type CacheStats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+}
+
+// cacheConfig chứa tùy chọn của cache thuộc tính.
+type cacheConfig struct {
+	ttl         time.Duration
+	maxEntries  int
+	negativeTTL time.Duration
+	keyFunc     func(v interface{}) string
+	envInclude  map[string]bool // chỉ dùng cho decision cache
+	envExclude  map[string]bool // chỉ dùng cho decision cache
+}
+
+// CacheOption là tùy chọn của cache thuộc tính (WithSubjectCache, NewCachingSubjectFetcher...)
+// và của decision cache (WithDecisionCache).
+type CacheOption interface{ apply(*cacheConfig) }
+
+type cacheOptFunc func(*cacheConfig)
+
+func (f cacheOptFunc) apply(c *cacheConfig) { f(c) }
+
+// WithCacheTTL đặt thời gian sống của một entry (mặc định: 1 phút).
+func WithCacheTTL(ttl time.Duration) CacheOption {
+	return cacheOptFunc(func(c *cacheConfig) {
+		if ttl > 0 {
+			c.ttl = ttl
+		}
+	})
+}
+
+// WithCacheMaxEntries giới hạn số entry; entry ít được dùng gần đây nhất bị loại trước (mặc định: 10000).
+func WithCacheMaxEntries(n int) CacheOption {
+	return cacheOptFunc(func(c *cacheConfig) {
+		if n > 0 {
+			c.maxEntries = n
+		}
+	})
+}
+
+// WithNegativeCacheTTL đặt thời gian ghi nhớ kết quả ErrSubjectNotFound/ErrResourceNotFound
+// (mặc định: 10 giây). Giá trị <= 0 tắt negative caching.
+func WithNegativeCacheTTL(ttl time.Duration) CacheOption {
+	return cacheOptFunc(func(c *cacheConfig) { c.negativeTTL = ttl })
+}
+
+// WithCacheKeyFunc chỉ định cách tạo khóa cache từ subject/resource truyền vào Check.
+// Mặc định: chuỗi giữ nguyên, fmt.Stringer dùng String(), kiểu khác dùng %#v.
+func WithCacheKeyFunc(fn func(v interface{}) string) CacheOption {
+	return cacheOptFunc(func(c *cacheConfig) {
+		if fn != nil {
+			c.keyFunc = fn
+		}
+	})
+}
+
+func newCacheConfig(opts []CacheOption) cacheConfig {
+	cfg := cacheConfig{
+		ttl:         defaultCacheTTL,
+		maxEntries:  defaultCacheMaxEntries,
+		negativeTTL: defaultNegativeCacheTTL,
+		keyFunc:     defaultCacheKey,
+	}
+	for _, o := range opts {
+		if o != nil {
+			o.apply(&cfg)
+		}
+	}
+	return cfg
+}
+
+func defaultCacheKey(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return x
+	case fmt.Stringer:
+		return x.String()
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
+// =========================================================================
+// == Cache LRU + TTL dùng chung
+// =========================================================================
+
+type cacheEntry[V any] struct {
+	key     string
+	value   V
+	err     error
+	expires time.Time
+}
+
+// ttlCache là cache LRU có TTL, negative caching và gộp các lần lấy đồng thời cùng khóa.
+type ttlCache[V any] struct {
+	cfg      cacheConfig
+	notFound error
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+	// generation tăng mỗi lần invalidate để kết quả của lần lấy đang chạy (bắt đầu trước
+	// khi invalidate) không được ghi đè vào cache.
+	generation uint64
+	group      singleflight.Group
+	now        func() time.Time
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+func newTTLCache[V any](cfg cacheConfig, notFound error) *ttlCache[V] {
+	return &ttlCache[V]{
+		cfg:      cfg,
+		notFound: notFound,
+		items:    make(map[string]*list.Element),
+		lru:      list.New(),
+		now:      time.Now,
+	}
+}
+
+// get trả về giá trị của key, gọi fetch khi chưa có trong cache. Các lần lấy đồng thời cùng key
+// dùng chung một lần fetch; lần fetch này chạy với context.WithoutCancel(ctx) để việc một caller
+// bị hủy không làm hỏng kết quả của các caller khác, còn mỗi caller ngừng chờ khi ctx của chính
+// nó bị hủy.
+func (c *ttlCache[V]) get(ctx context.Context, key string, fetch func(context.Context) (V, error)) (V, error) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*cacheEntry[V])
+		if c.now().Before(entry.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			return entry.value, entry.err
+		}
+		c.removeElement(el)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	fetchCtx := context.WithoutCancel(ctx)
+	ch := c.group.DoChan(key, func() (interface{}, error) {
+		value, err := fetch(fetchCtx)
+		c.store(key, generation, value, err)
+		return value, err
+	})
+	select {
+	case res := <-ch:
+		value, _ := res.Val.(V)
+		return value, res.Err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (c *ttlCache[V]) store(key string, generation uint64, value V, err error) {
+	ttl := c.cfg.ttl
+	if err != nil {
+		if c.cfg.negativeTTL <= 0 || !errors.Is(err, c.notFound) {
+			return
+		}
+		ttl = c.cfg.negativeTTL
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return
+	}
+	entry := &cacheEntry[V]{key: key, value: value, err: err, expires: c.now().Add(ttl)}
+	if el, ok := c.items[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+	} else {
+		c.items[key] = c.lru.PushFront(entry)
+	}
+	for c.lru.Len() > c.cfg.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+func (c *ttlCache[V]) removeElement(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.items, el.Value.(*cacheEntry[V]).key)
+}
+
+func (c *ttlCache[V]) invalidate(key string) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+	c.generation++
+	c.mu.Unlock()
+	c.group.Forget(key)
+}
+
+func (c *ttlCache[V]) invalidateAll() {
+	c.mu.Lock()
+	c.items = make(map[string]*list.Element)
+	c.lru.Init()
+	c.generation++
+	c.mu.Unlock()
+}
+
+func (c *ttlCache[V]) stats() CacheStats {
+	c.mu.Lock()
+	entries := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Entries: entries}
+}
+
+// =========================================================================
+// == Decorator cho SubjectFetcher / ResourceFetcher
+// =========================================================================
+
+// contextOf trả về context mà ctx trỏ tới, context.Background() nếu ctx nil.
+func contextOf(ctx *context.Context) context.Context {
+	if ctx == nil || *ctx == nil {
+		return context.Background()
+	}
+	return *ctx
+}
+
+// CachingSubjectFetcher là SubjectFetcher có cache phía trước một SubjectFetcher khác.
+// Attributes trả về được dùng chung giữa các request và không được phép sửa đổi.
+type CachingSubjectFetcher struct {
+	inner SubjectFetcher
+	cache *ttlCache[Attributes]
+}
+
+// NewCachingSubjectFetcher bọc inner bằng cache LRU có TTL.
+func NewCachingSubjectFetcher(inner SubjectFetcher, opts ...CacheOption) *CachingSubjectFetcher {
+	return &CachingSubjectFetcher{
+		inner: inner,
+		cache: newTTLCache[Attributes](newCacheConfig(opts), ErrSubjectNotFound),
+	}
+}
+
+func (f *CachingSubjectFetcher) GetSubjectAttributes(ctx *context.Context, subject interface{}) (Attributes, error) {
+	return f.cache.get(contextOf(ctx), f.cache.cfg.keyFunc(subject), func(fetchCtx context.Context) (Attributes, error) {
+		return f.inner.GetSubjectAttributes(&fetchCtx, subject)
+	})
+}
+
+// Invalidate xóa thuộc tính đã cache của subject.
+func (f *CachingSubjectFetcher) Invalidate(subject interface{}) {
+	f.cache.invalidate(f.cache.cfg.keyFunc(subject))
+}
+
+// InvalidateAll xóa toàn bộ cache.
+func (f *CachingSubjectFetcher) InvalidateAll() { f.cache.invalidateAll() }
+
+// Stats trả về số liệu hit/miss của cache.
+func (f *CachingSubjectFetcher) Stats() CacheStats { return f.cache.stats() }
+
+// CachingResourceFetcher là ResourceFetcher có cache phía trước một ResourceFetcher khác.
+// Attributes trả về được dùng chung giữa các request và không được phép sửa đổi.
+type CachingResourceFetcher struct {
+	inner ResourceFetcher
+	cache *ttlCache[[]Attributes]
+}
+
+// NewCachingResourceFetcher bọc inner bằng cache LRU có TTL.
+func NewCachingResourceFetcher(inner ResourceFetcher, opts ...CacheOption) *CachingResourceFetcher {
+	return &CachingResourceFetcher{
+		inner: inner,
+		cache: newTTLCache[[]Attributes](newCacheConfig(opts), ErrResourceNotFound),
+	}
+}
+
+func (f *CachingResourceFetcher) GetResourceAttributes(ctx *context.Context, resource interface{}) ([]Attributes, error) {
+	cached, err := f.cache.get(contextOf(ctx), f.cache.cfg.keyFunc(resource), func(fetchCtx context.Context) ([]Attributes, error) {
+		return f.inner.GetResourceAttributes(&fetchCtx, resource)
+	})
+	if cached == nil {
+		return nil, err
+	}
+	// Trả về bản sao của slice để caller không làm thay đổi entry trong cache.
+	return append([]Attributes(nil), cached...), err
+}
+
+// Invalidate xóa thuộc tính đã cache của resource.
+func (f *CachingResourceFetcher) Invalidate(resource interface{}) {
+	f.cache.invalidate(f.cache.cfg.keyFunc(resource))
+}
+
+// InvalidateAll xóa toàn bộ cache.
+func (f *CachingResourceFetcher) InvalidateAll() { f.cache.invalidateAll() }
+
+// Stats trả về số liệu hit/miss của cache.
+func (f *CachingResourceFetcher) Stats() CacheStats { return f.cache.stats() }
+
+// InvalidateSubjectAttributes xóa thuộc tính đã cache của subject (khi bật WithSubjectCache).
+func (a *Authorizer) InvalidateSubjectAttributes(subject interface{}) {
+	if f, ok := a.subjectFetcher.(*CachingSubjectFetcher); ok {
+		f.Invalidate(subject)
+	}
+}
+
+// InvalidateResourceAttributes xóa thuộc tính đã cache của resource (khi bật WithResourceCache).
+func (a *Authorizer) InvalidateResourceAttributes(resource interface{}) {
+	if f, ok := a.resourceFetcher.(*CachingResourceFetcher); ok {
+		f.Invalidate(resource)
+	}
+}
+
+// AttributeCacheStats trả về số liệu của cache thuộc tính subject và resource
+// (giá trị rỗng nếu cache tương ứng không được bật).
+func (a *Authorizer) AttributeCacheStats() (subject CacheStats, resource CacheStats) {
+	if f, ok := a.subjectFetcher.(*CachingSubjectFetcher); ok {
+		subject = f.Stats()
+	}
+	if f, ok := a.resourceFetcher.(*CachingResourceFetcher); ok {
+		resource = f.Stats()
+	}
+	return subject, resource
+}
@@ -0,0 +1,261 @@
+package abac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowSubjectFetcher đếm số lần gọi; subject "missing" trả về ErrSubjectNotFound,
+// ctx đã bị hủy thì trả về lỗi của ctx.
+type slowSubjectFetcher struct {
+	calls   atomic.Int32
+	delay   time.Duration
+	release chan struct{}
+}
+
+func (f *slowSubjectFetcher) GetSubjectAttributes(ctx *context.Context, subject interface{}) (Attributes, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	time.Sleep(f.delay)
+	if err := (*ctx).Err(); err != nil {
+		return nil, err
+	}
+	id := fmt.Sprint(subject)
+	switch id {
+	case "missing":
+		return nil, ErrSubjectNotFound
+	case "broken":
+		return nil, errors.New("user store unavailable")
+	}
+	return Attributes{"id": id}, nil
+}
+
+func TestCachingSubjectFetcher_TTLAndInvalidation(t *testing.T) {
+	inner := &slowSubjectFetcher{}
+	f := NewCachingSubjectFetcher(inner, WithCacheTTL(time.Minute))
+	clock := time.Now()
+	f.cache.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		attrs, err := f.GetSubjectAttributes(&ctx, "u1")
+		if err != nil || attrs["id"] != "u1" {
+			t.Fatalf("unexpected result %v, %v", attrs, err)
+		}
+	}
+	if got := inner.calls.Load(); got != 1 {
+		t.Fatalf("expected 1 fetch, got %d", got)
+	}
+	if s := f.Stats(); s.Hits != 2 || s.Misses != 1 || s.Entries != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	clock = clock.Add(2 * time.Minute)
+	_, _ = f.GetSubjectAttributes(&ctx, "u1")
+	if got := inner.calls.Load(); got != 2 {
+		t.Fatalf("expected refetch after TTL, got %d fetches", got)
+	}
+
+	f.Invalidate("u1")
+	_, _ = f.GetSubjectAttributes(&ctx, "u1")
+	if got := inner.calls.Load(); got != 3 {
+		t.Fatalf("expected refetch after Invalidate, got %d fetches", got)
+	}
+}
+
+func TestCachingSubjectFetcher_NegativeCaching(t *testing.T) {
+	inner := &slowSubjectFetcher{}
+	f := NewCachingSubjectFetcher(inner, WithNegativeCacheTTL(time.Second))
+	clock := time.Now()
+	f.cache.now = func() time.Time { return clock }
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.GetSubjectAttributes(&ctx, "missing"); !errors.Is(err, ErrSubjectNotFound) {
+			t.Fatalf("expected ErrSubjectNotFound, got %v", err)
+		}
+	}
+	if got := inner.calls.Load(); got != 1 {
+		t.Fatalf("expected not-found to be cached, got %d fetches", got)
+	}
+	clock = clock.Add(2 * time.Second)
+	_, _ = f.GetSubjectAttributes(&ctx, "missing")
+	if got := inner.calls.Load(); got != 2 {
+		t.Fatalf("expected negative entry to expire, got %d fetches", got)
+	}
+
+	// Lỗi khác không được cache.
+	_, _ = f.GetSubjectAttributes(&ctx, "broken")
+	_, _ = f.GetSubjectAttributes(&ctx, "broken")
+	if got := inner.calls.Load(); got != 4 {
+		t.Fatalf("expected other errors not to be cached, got %d fetches", got)
+	}
+
+	noNegative := NewCachingSubjectFetcher(&slowSubjectFetcher{}, WithNegativeCacheTTL(0))
+	_, _ = noNegative.GetSubjectAttributes(&ctx, "missing")
+	if s := noNegative.Stats(); s.Entries != 0 {
+		t.Fatalf("expected negative caching disabled, got %+v", s)
+	}
+}
+
+func TestCachingSubjectFetcher_LRUEviction(t *testing.T) {
+	inner := &slowSubjectFetcher{}
+	f := NewCachingSubjectFetcher(inner, WithCacheMaxEntries(2))
+	ctx := context.Background()
+
+	_, _ = f.GetSubjectAttributes(&ctx, "a")
+	_, _ = f.GetSubjectAttributes(&ctx, "b")
+	_, _ = f.GetSubjectAttributes(&ctx, "a") // a được dùng gần đây hơn b
+	_, _ = f.GetSubjectAttributes(&ctx, "c") // loại b
+	if s := f.Stats(); s.Entries != 2 {
+		t.Fatalf("expected 2 entries, got %+v", s)
+	}
+	before := inner.calls.Load()
+	_, _ = f.GetSubjectAttributes(&ctx, "a")
+	if inner.calls.Load() != before {
+		t.Fatalf("expected a to stay cached")
+	}
+	_, _ = f.GetSubjectAttributes(&ctx, "b")
+	if inner.calls.Load() != before+1 {
+		t.Fatalf("expected b to be evicted")
+	}
+}
+
+func TestCachingSubjectFetcher_Singleflight(t *testing.T) {
+	inner := &slowSubjectFetcher{release: make(chan struct{})}
+	f := NewCachingSubjectFetcher(inner)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.GetSubjectAttributes(&ctx, "u1"); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	// Đợi các goroutine cùng chờ lần lấy đầu tiên rồi mới cho nó chạy tiếp.
+	for inner.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(inner.release)
+	wg.Wait()
+	if got := inner.calls.Load(); got != 1 {
+		t.Fatalf("expected concurrent fetches to be merged, got %d", got)
+	}
+}
+
+func TestCachingSubjectFetcher_SingleflightIgnoresCallerCancellation(t *testing.T) {
+	inner := &slowSubjectFetcher{release: make(chan struct{})}
+	f := NewCachingSubjectFetcher(inner)
+	first, cancel := context.WithCancel(context.Background())
+	second := context.Background()
+
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := f.GetSubjectAttributes(&first, "u1")
+		firstErr <- err
+	}()
+	for inner.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	secondDone := make(chan struct{})
+	var attrs Attributes
+	var err error
+	go func() {
+		attrs, err = f.GetSubjectAttributes(&second, "u1")
+		close(secondDone)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// Caller đầu tiên bị hủy: chỉ nó nhận lỗi, lần lấy dùng chung vẫn chạy tiếp.
+	cancel()
+	if got := <-firstErr; !errors.Is(got, context.Canceled) {
+		t.Fatalf("expected the cancelled caller to get context.Canceled, got %v", got)
+	}
+	close(inner.release)
+	<-secondDone
+	if err != nil || attrs["id"] != "u1" {
+		t.Fatalf("expected the live caller to get the attributes, got %v, %v", attrs, err)
+	}
+	if got := inner.calls.Load(); got != 1 {
+		t.Fatalf("expected a single shared fetch, got %d", got)
+	}
+	if s := f.Stats(); s.Entries != 1 {
+		t.Fatalf("expected the shared result to be cached, got %+v", s)
+	}
+}
+
+func TestCachingSubjectFetcher_InvalidateDuringFetch(t *testing.T) {
+	inner := &slowSubjectFetcher{release: make(chan struct{})}
+	f := NewCachingSubjectFetcher(inner)
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		_, _ = f.GetSubjectAttributes(&ctx, "u1")
+		close(done)
+	}()
+	for inner.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	f.Invalidate("u1")
+	close(inner.release)
+	<-done
+	if s := f.Stats(); s.Entries != 0 {
+		t.Fatalf("stale in-flight result must not be cached, got %+v", s)
+	}
+}
+
+func TestWithAttributeCaches_FactoryOption(t *testing.T) {
+	subjects := &slowSubjectFetcher{}
+	resources := &staticFetcher{resource: Attributes{"department": "hr"}}
+	authorizer, _, err := NewABACSystemFromStrings(
+		`[request_definition]
+r = tenant, req
+
+[policy_definition]
+p = tenant, rule, eft, id
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)`,
+		`p, *, "Resource.department == 'hr'", allow, hr`,
+		subjects, resources, nil,
+		WithSubjectCache(), WithResourceCache(WithCacheTTL(time.Hour)),
+	)
+	if err != nil {
+		t.Fatalf("factory failed: %v", err)
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if ok, err := authorizer.Check(&ctx, "t1", "u1", "r1", "read", nil); !ok || err != nil {
+			t.Fatalf("expected allow, got %v, %v", ok, err)
+		}
+	}
+	if got := subjects.calls.Load(); got != 1 {
+		t.Fatalf("expected subject fetched once, got %d", got)
+	}
+	subjectStats, resourceStats := authorizer.AttributeCacheStats()
+	if subjectStats.Hits != 2 || resourceStats.Hits != 2 {
+		t.Fatalf("unexpected stats %+v %+v", subjectStats, resourceStats)
+	}
+	authorizer.InvalidateSubjectAttributes("u1")
+	authorizer.InvalidateResourceAttributes("r1")
+	_, _ = authorizer.Check(&ctx, "t1", "u1", "r1", "read", nil)
+	if got := subjects.calls.Load(); got != 2 {
+		t.Fatalf("expected refetch after invalidation, got %d", got)
+	}
+}
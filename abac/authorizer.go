@@ -4,6 +4,7 @@ package abac
 import (
 	"bufio"
 	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"github.com/casbin/casbin/v2"
@@ -12,21 +13,34 @@ import (
 	"github.com/casbin/govaluate"
 	"gorm.io/gorm"
 	"strings"
-	"time"
 )
 
 // Authorizer là PDP, chứa logic phân quyền.
 type Authorizer struct {
 	enforcer        *casbin.Enforcer
+	evaluator       *expressionEvaluator
+	engine          *policyEngine
 	subjectFetcher  SubjectFetcher
 	resourceFetcher ResourceFetcher
 }
 
 type CustomFunctionMap map[string]govaluate.ExpressionFunction
 
-// expressionEvaluator là một struct giữ trạng thái các hàm tùy chỉnh của người dùng.
+// expressionEvaluator là một struct giữ trạng thái các hàm (có sẵn + tùy chỉnh của người dùng)
+// và cache các rule đã biên dịch.
 type expressionEvaluator struct {
-	userFunctions CustomFunctionMap
+	functions     CustomFunctionMap
+	functionInfos map[string]FunctionInfo
+	rules         *ruleCache
+}
+
+// syncRules biên dịch trước các rule hiện có trong enforcer (cùng các biểu thức khác cần
+// giữ lại, ví dụ target của policy set) và loại bỏ khỏi cache các rule đã bị xóa/cập nhật.
+func (ev *expressionEvaluator) syncRules(e *casbin.Enforcer, extra ...string) {
+	if ev == nil || ev.rules == nil {
+		return
+	}
+	ev.rules.sync(append(policyRules(e), extra...))
 }
 
 // ===== Trace types (optional reasoning) =====
@@ -49,13 +63,49 @@ type AttributeAccess struct {
 	ValuePreview string `json:"value_preview"`
 }
 
+// PolicyEvaluation ghi nhận kết quả đánh giá một policy ứng viên.
+type PolicyEvaluation struct {
+	PolicyID      string `json:"policy_id"`
+	RuleID        string `json:"rule_id"`
+	Tenant        string `json:"tenant"`
+	Effect        string `json:"effect"`
+	Priority      int    `json:"priority"`
+	ResourceIndex int    `json:"resource_index"`
+	Matched       bool   `json:"matched"`
+	Skipped       bool   `json:"skipped,omitempty"`
+	SkipReason    string `json:"skip_reason,omitempty"`
+	SetID         string `json:"set_id,omitempty"` // policy set chứa policy, rỗng ở cấp cao nhất
+	Rule          string `json:"rule,omitempty"`   // rule của policy tại snapshot đã đánh giá
+	Error         string `json:"error,omitempty"`
+	DurationUs    int64  `json:"duration_us"`
+}
+
 type DecisionTrace struct {
 	MatchedPolicies     []RuleMatch           `json:"matched_policies"`
+	Policies            []PolicyEvaluation    `json:"policies"`
 	Predicates          []PredicateEvaluation `json:"predicates"`
 	AttributesEvaluated []AttributeAccess     `json:"attributes_evaluated"`
+	Decision            string                `json:"decision,omitempty"` // allow | deny
+	Effect              DecisionEffect        `json:"effect,omitempty"`
+	DecisionReason      string                `json:"decision_reason,omitempty"`
+	Algorithm           CombiningAlgorithm    `json:"algorithm,omitempty"`
+	DecidingPolicyID    string                `json:"deciding_policy_id,omitempty"`
 	EvaluationMs        int64                 `json:"evaluation_ms"`
 	EngineVersion       string                `json:"engine_version"`
 	Error               string                `json:"error,omitempty"`
+
+	// requests là các request đã được đánh giá (theo ResourceIndex), dùng cho Explain.
+	requests []*AuthorizationRequest
+}
+
+// request trả về request đã đánh giá ứng với vị trí resource, nil nếu không còn.
+func (t *DecisionTrace) request(resourceIndex int) *AuthorizationRequest {
+	for _, req := range t.requests {
+		if req.resourceIndex == resourceIndex {
+			return req
+		}
+	}
+	return nil
 }
 
 type TraceObserver interface {
@@ -64,6 +114,14 @@ type TraceObserver interface {
 	OnAttributeRead(scope, path string, value interface{})
 }
 
+// PolicyTraceObserver là phần mở rộng tùy chọn của TraceObserver để nhận kết quả
+// của từng policy ứng viên (kể cả policy bị bỏ qua do khác tenant) và quyết định cuối cùng.
+type PolicyTraceObserver interface {
+	TraceObserver
+	OnPolicyEvaluated(evaluation PolicyEvaluation)
+	OnDecision(result CombiningResult)
+}
+
 type redactorFunc func(scope, path string, raw interface{}) string
 
 type traceConfig struct {
@@ -114,11 +172,12 @@ const defaultEngineVersion = "go-abac-library/1.0.0"
 
 // traceCollector cài đặt TraceObserver, tuân theo maxItems và redactor
 type traceCollector struct {
-	cfg       *traceConfig
-	trace     *DecisionTrace
-	predCount int
-	attrCount int
-	ruleCount int
+	cfg         *traceConfig
+	trace       *DecisionTrace
+	predCount   int
+	attrCount   int
+	ruleCount   int
+	policyCount int
 }
 
 func newTraceCollector(opts ...TraceOption) (*traceCollector, *DecisionTrace, *traceConfig) {
@@ -134,6 +193,7 @@ func newTraceCollector(opts ...TraceOption) (*traceCollector, *DecisionTrace, *t
 	}
 	t := &DecisionTrace{
 		MatchedPolicies:     make([]RuleMatch, 0, 8),
+		Policies:            make([]PolicyEvaluation, 0, 8),
 		Predicates:          make([]PredicateEvaluation, 0, 32),
 		AttributesEvaluated: make([]AttributeAccess, 0, 32),
 		EngineVersion:       cfg.engineVersion,
@@ -176,6 +236,28 @@ func (c *traceCollector) OnRuleEvaluated(policyID, ruleID string, matched bool)
 	c.ruleCount++
 }
 
+func (c *traceCollector) OnPolicyEvaluated(evaluation PolicyEvaluation) {
+	if c == nil || c.trace == nil {
+		return
+	}
+	if c.cfg.maxItems > 0 && c.policyCount >= c.cfg.maxItems {
+		return
+	}
+	c.trace.Policies = append(c.trace.Policies, evaluation)
+	c.policyCount++
+}
+
+func (c *traceCollector) OnDecision(result CombiningResult) {
+	if c == nil || c.trace == nil {
+		return
+	}
+	c.trace.Decision = result.Decision
+	c.trace.Effect = result.Effect
+	c.trace.DecisionReason = result.Reason
+	c.trace.Algorithm = result.Algorithm
+	c.trace.DecidingPolicyID = result.PolicyID
+}
+
 func (c *traceCollector) OnAttributeRead(scope, path string, value interface{}) {
 	if c == nil || c.trace == nil || !c.cfg.enableAttributeTracing {
 		return
@@ -196,29 +278,49 @@ func (c *traceCollector) OnAttributeRead(scope, path string, value interface{})
 // =========================================================================
 
 // NewABACSystemFromFile khởi tạo hệ thống từ file model và file policy.
-func NewABACSystemFromFile(modelPath, policyPath string, sf SubjectFetcher, rf ResourceFetcher, customFunc CustomFunctionMap) (*Authorizer, *PolicyManager, error) {
-	e, err := casbin.NewEnforcer(modelPath, policyPath)
+func NewABACSystemFromFile(modelPath, policyPath string, sf SubjectFetcher, rf ResourceFetcher, customFunc CustomFunctionMap, opts ...SystemOption) (*Authorizer, *PolicyManager, error) {
+	e, err := casbin.NewEnforcer(modelPath, newFilePolicyAdapter(policyPath))
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create enforcer from file: %w", err)
 	}
-	return newSystemWithEnforcer(e, sf, rf, customFunc)
+	cfg := newSystemConfig(opts)
+	cfg.modelPath, cfg.policyPath = modelPath, policyPath
+	return newSystemWithEnforcer(e, sf, rf, customFunc, cfg)
 }
 
 // NewABACSystemFromDB khởi tạo hệ thống với policy được nạp từ database.
-func NewABACSystemFromDB(modelPath string, db *gorm.DB, sf SubjectFetcher, rf ResourceFetcher, customFunc CustomFunctionMap) (*Authorizer, *PolicyManager, error) {
+func NewABACSystemFromDB(modelPath string, db *gorm.DB, sf SubjectFetcher, rf ResourceFetcher, customFunc CustomFunctionMap, opts ...SystemOption) (*Authorizer, *PolicyManager, error) {
 	gormadapter.TurnOffAutoMigrate(db)
 	adapter, err := gormadapter.NewAdapterByDB(db)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create gorm adapter: %w", err)
 	}
-	e, err := casbin.NewEnforcer(modelPath, adapter)
+	e, err := casbin.NewEnforcer(modelPath, gormPolicyAdapter{adapter})
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create enforcer from adapter: %w", err)
 	}
 	if err := e.LoadPolicy(); err != nil {
 		return nil, nil, fmt.Errorf("failed to load policy from database: %w", err)
 	}
-	return newSystemWithEnforcer(e, sf, rf, customFunc)
+	cfg, err := newDBSystemConfig(db, casbinTableName("", ""), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newSystemWithEnforcer(e, sf, rf, customFunc, cfg)
+}
+
+// casbinTableName trả về tên bảng policy đầy đủ theo cách gorm-adapter đặt tên.
+func casbinTableName(prefix, tableName string) string {
+	if tableName == "" {
+		tableName = "casbin_rule"
+	}
+	if prefix == "" {
+		return tableName
+	}
+	if strings.HasSuffix(prefix, "_") {
+		return prefix + tableName
+	}
+	return prefix + "_" + tableName
 }
 
 // NewABACSystemFromDBUseTableName khởi tạo hệ thống từ DB với một tên bảng tùy chỉnh.
@@ -230,6 +332,7 @@ func NewABACSystemFromDBUseTableName(
 	sf SubjectFetcher,
 	rf ResourceFetcher,
 	customFunc map[string]govaluate.ExpressionFunction,
+	opts ...SystemOption,
 ) (*Authorizer, *PolicyManager, error) {
 	gormadapter.TurnOffAutoMigrate(db)
 	adapter, err := gormadapter.NewAdapterByDBUseTableName(db, preFix, tableName)
@@ -237,18 +340,22 @@ func NewABACSystemFromDBUseTableName(
 		return nil, nil, fmt.Errorf("failed to create gorm adapter with table name %s: %w", tableName, err)
 	}
 
-	e, err := casbin.NewEnforcer(modelPath, adapter)
+	e, err := casbin.NewEnforcer(modelPath, gormPolicyAdapter{adapter})
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create enforcer: %w", err)
 	}
 	if err := e.LoadPolicy(); err != nil {
 		return nil, nil, fmt.Errorf("failed to load policy from database: %w", err)
 	}
-	return newSystemWithEnforcer(e, sf, rf, customFunc)
+	cfg, err := newDBSystemConfig(db, casbinTableName(preFix, tableName), opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newSystemWithEnforcer(e, sf, rf, customFunc, cfg)
 }
 
 // NewABACSystemFromStrings khởi tạo hệ thống từ các chuỗi model và policy trong bộ nhớ.
-func NewABACSystemFromStrings(modelStr, policyStr string, sf SubjectFetcher, rf ResourceFetcher, customFunc CustomFunctionMap) (*Authorizer, *PolicyManager, error) {
+func NewABACSystemFromStrings(modelStr, policyStr string, sf SubjectFetcher, rf ResourceFetcher, customFunc CustomFunctionMap, opts ...SystemOption) (*Authorizer, *PolicyManager, error) {
 	m, err := model.NewModelFromString(modelStr)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create model from string: %w", err)
@@ -258,47 +365,103 @@ func NewABACSystemFromStrings(modelStr, policyStr string, sf SubjectFetcher, rf
 		return nil, nil, fmt.Errorf("failed to create enforcer from model object: %w", err)
 	}
 
-	// Tự parse chuỗi policy và thêm vào enforcer
+	// Tự parse chuỗi policy và thêm vào enforcer.
+	// Mỗi dòng được đọc như một dòng CSV (giống file adapter của Casbin) để giữ nguyên
+	// các rule có dấu phẩy hoặc được bọc trong dấu nháy kép.
 	scanner := bufio.NewScanner(strings.NewReader(policyStr))
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue // Bỏ qua dòng trống và comment
 		}
-		parts := strings.Split(line, ",")
+		reader := csv.NewReader(strings.NewReader(line))
+		reader.TrimLeadingSpace = true
+		parts, err := reader.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse policy line %q: %w", line, err)
+		}
 		if len(parts) > 1 && strings.TrimSpace(parts[0]) == "p" {
 			policy := make([]string, 0, len(parts)-1)
 			for i := 1; i < len(parts); i++ {
 				policy = append(policy, strings.TrimSpace(parts[i]))
 			}
-			if _, err := e.AddPolicy(policy); err != nil {
+			if _, err := e.AddPolicy(padPolicyRow(e.GetModel(), "p", policy)); err != nil {
 				return nil, nil, fmt.Errorf("failed to add policy from string: %w", err)
 			}
 		}
 	}
 
-	return newSystemWithEnforcer(e, sf, rf, customFunc)
+	return newSystemWithEnforcer(e, sf, rf, customFunc, newSystemConfig(opts))
 }
 
 // CustomFunctionMap định nghĩa một map chứa các hàm tùy chỉnh mà người dùng muốn thêm.
 // Key là tên hàm sẽ dùng trong policy, Value là hàm Go tương ứng.
+// Các hàm có sẵn (xem BuiltinFunctions) luôn được đăng ký; key trùng tên sẽ ghi đè
+// hàm có sẵn, còn Value nil sẽ tắt hàm có sẵn đó.
 
 // newSystemWithEnforcer là hàm private để hoàn tất việc khởi tạo, tránh lặp code.
-func newSystemWithEnforcer(e *casbin.Enforcer, sf SubjectFetcher, rf ResourceFetcher, customFunction CustomFunctionMap) (*Authorizer, *PolicyManager, error) {
-	// Tạo một instance của evaluator, truyền map custom function vào.
+func newSystemWithEnforcer(e *casbin.Enforcer, sf SubjectFetcher, rf ResourceFetcher, customFunction CustomFunctionMap, cfg *systemConfig) (*Authorizer, *PolicyManager, error) {
+	if err := checkModel(e); err != nil {
+		return nil, nil, err
+	}
+	// Tạo một instance của evaluator với bộ hàm có sẵn + hàm tùy chỉnh của người dùng.
+	functions, infos := mergeFunctions(customFunction)
 	evaluator := &expressionEvaluator{
-		userFunctions: customFunction,
+		functions:     functions,
+		functionInfos: infos,
+		rules:         newRuleCache(functions),
+	}
+	combining, err := newCombiningSettings(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Biên dịch trước toàn bộ rule đã nạp từ file/DB.
+	engine := newPolicyEngine(evaluator)
+	engine.obligations = newObligationRegistry(cfg.obligationHandlers)
+	engine.targetIndex = !cfg.disableTargetIndex
+	engine.indexCrossCheck = cfg.indexCrossCheck
+	engine.setCombining(combining)
+	if cfg.decisionCache != nil {
+		engine.decisions = newDecisionCache(cfg.decisionCache)
+	}
+	engine.reload(e)
+
+	if cfg.metadataStore == nil {
+		cfg.metadataStore = NewMemoryPolicyMetadataStore()
+	}
+	if cfg.policySetStore == nil {
+		cfg.policySetStore = NewMemoryPolicySetStore()
+	}
+	sets, err := cfg.policySetStore.ListPolicySets()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load policy sets: %w", err)
+	}
+	engine.setPolicySets(sets)
+	if cfg.subjectCache != nil {
+		sf = NewCachingSubjectFetcher(sf, cfg.subjectCache...)
+	}
+	if cfg.resourceCache != nil {
+		rf = NewCachingResourceFetcher(rf, cfg.resourceCache...)
 	}
 
 	// Đăng ký phương thức Evaluate của INSTANCE evaluator đó.
 	e.AddFunction("evaluate", evaluator.Evaluate)
 	authorizer := &Authorizer{
 		enforcer:        e,
+		evaluator:       evaluator,
+		engine:          engine,
 		subjectFetcher:  sf,
 		resourceFetcher: rf,
 	}
 	policyManager := &PolicyManager{
-		enforcer: e,
+		enforcer:    e,
+		engine:      engine,
+		metadata:    cfg.metadataStore,
+		sets:        cfg.policySetStore,
+		db:          cfg.policyDB,
+		policyTable: cfg.policyTable,
+		modelPath:   cfg.modelPath,
+		policyPath:  cfg.policyPath,
 	}
 	return authorizer, policyManager, nil
 }
@@ -307,136 +470,19 @@ func newSystemWithEnforcer(e *casbin.Enforcer, sf SubjectFetcher, rf ResourceFet
 // == Các thành phần cốt lõi
 // =========================================================================
 
-// Check là hàm chính để kiểm tra quyền truy cập.
+// Check là hàm chính để kiểm tra quyền truy cập. Chỉ trả về true khi quyết định là Permit không
+// kèm obligation bắt buộc (Check không thực hiện được obligation, dùng Decide + Fulfill cho các
+// policy đó); lỗi được trả về khi quyết định là Indeterminate (xem Decide để phân biệt các trường hợp).
 func (a *Authorizer) Check(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrsInput *Attributes) (bool, error) {
-	subAttrs, err := a.subjectFetcher.GetSubjectAttributes(ctx, subject)
-	if err != nil {
-		return false, fmt.Errorf("subject attributes error: %w", err)
-	}
-
-	// Nếu envAttrs từ bên ngoài là nil, khởi tạo một map rỗng.
-	var envAttrs Attributes
-	if envAttrsInput != nil {
-		envAttrs = *envAttrsInput
-	} else {
-		envAttrs = make(Attributes)
-	}
-
-	listResAttrs, err := a.resourceFetcher.GetResourceAttributes(ctx, resource)
-	if err != nil {
-		return false, fmt.Errorf("resource attributes error: %w", err)
-	}
-	if listResAttrs == nil || len(listResAttrs) == 0 {
-		request := &AuthorizationRequest{
-			Subject:  subAttrs,
-			Resource: Attributes{},
-			Action:   action,
-			Env:      envAttrs,
-		}
-		allowed, err := a.enforcer.Enforce(tenantID, request)
-		if err != nil || !allowed {
-			return false, err
-		}
-		return allowed, nil
-
-	}
-	for _, resAttribute := range listResAttrs {
-		request := &AuthorizationRequest{
-			Subject:  subAttrs,
-			Resource: resAttribute,
-			Action:   action,
-			Env:      envAttrs,
-		}
-		allowed, err := a.enforcer.Enforce(tenantID, request)
-		if err != nil || !allowed {
-			return false, err
-		}
-	}
-	return true, nil
+	d := a.Decide(ctx, tenantID, subject, resource, action, envAttrsInput)
+	return d.permitsWithoutObligations(), d.Err()
 }
 
-// CheckWithTrace: kiểm tra quyền + trả về DecisionTrace (reasoning)
+// CheckWithTrace: kiểm tra quyền + trả về DecisionTrace (reasoning). Kết quả như Check, trên
+// cùng một lần đánh giá với DecideWithTrace.
 func (a *Authorizer) CheckWithTrace(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrsInput *Attributes, opts ...TraceOption) (bool, *DecisionTrace, error) {
-	start := time.Now()
-	collector, trace, cfg := newTraceCollector(opts...)
-
-	subAttrs, err := a.subjectFetcher.GetSubjectAttributes(ctx, subject)
-	if err != nil {
-		trace.Error = fmt.Sprintf("subject attributes error: %v", err)
-		trace.EvaluationMs = time.Since(start).Milliseconds()
-		return false, trace, fmt.Errorf("subject attributes error: %w", err)
-	}
-
-	var envAttrs Attributes
-	if envAttrsInput != nil {
-		envAttrs = *envAttrsInput
-	} else {
-		envAttrs = make(Attributes)
-	}
-
-	listResAttrs, err := a.resourceFetcher.GetResourceAttributes(ctx, resource)
-	if err != nil {
-		trace.Error = fmt.Sprintf("resource attributes error: %v", err)
-		trace.EvaluationMs = time.Since(start).Milliseconds()
-		return false, trace, fmt.Errorf("resource attributes error: %w", err)
-	}
-
-	// Ghi nhận attributes cấp 1 nếu bật attribute tracing
-	if cfg.enableAttributeTracing {
-		for k, v := range subAttrs {
-			collector.OnAttributeRead("subject", k, v)
-		}
-		for k, v := range envAttrs {
-			collector.OnAttributeRead("env", k, v)
-		}
-	}
-
-	if listResAttrs == nil || len(listResAttrs) == 0 {
-		req := &AuthorizationRequest{
-			Subject:  subAttrs,
-			Resource: Attributes{},
-			Action:   action,
-			Env:      envAttrs,
-			Trace:    collector,
-			TraceCfg: cfg,
-		}
-		allowed, err := a.enforcer.Enforce(tenantID, req)
-		trace.EvaluationMs = time.Since(start).Milliseconds()
-		if err != nil {
-			trace.Error = err.Error()
-			return false, trace, err
-		}
-		return allowed, trace, nil
-	}
-
-	for _, resAttribute := range listResAttrs {
-		if cfg.enableAttributeTracing {
-			for k, v := range resAttribute {
-				collector.OnAttributeRead("resource", k, v)
-			}
-		}
-		req := &AuthorizationRequest{
-			Subject:  subAttrs,
-			Resource: resAttribute,
-			Action:   action,
-			Env:      envAttrs,
-			Trace:    collector,
-			TraceCfg: cfg,
-		}
-		allowed, err := a.enforcer.Enforce(tenantID, req)
-		if err != nil {
-			trace.Error = err.Error()
-			trace.EvaluationMs = time.Since(start).Milliseconds()
-			return false, trace, err
-		}
-		if !allowed {
-			trace.EvaluationMs = time.Since(start).Milliseconds()
-			return false, trace, nil
-		}
-	}
-
-	trace.EvaluationMs = time.Since(start).Milliseconds()
-	return true, trace, nil
+	d, trace := a.DecideWithTrace(ctx, tenantID, subject, resource, action, envAttrsInput, opts...)
+	return d.permitsWithoutObligations(), trace, d.Err()
 }
 
 // AuthorizationRequest chứa tất cả thông tin cho một yêu cầu phân quyền.
@@ -449,6 +495,19 @@ type AuthorizationRequest struct {
 	// Optional tracing
 	Trace    TraceObserver
 	TraceCfg *traceConfig
+
+	// resourceIndex là vị trí của Resource trong danh sách trả về bởi ResourceFetcher.
+	resourceIndex int
+}
+
+// requestParameters trả về bộ tham số top-level mà rule có thể tham chiếu.
+func requestParameters(req *AuthorizationRequest) map[string]interface{} {
+	return map[string]interface{}{
+		"Subject":  req.Subject,
+		"Resource": req.Resource,
+		"Action":   req.Action,
+		"Env":      req.Env,
+	}
 }
 
 // evaluateFunc là hàm tùy chỉnh của Casbin để đánh giá các biểu thức.
@@ -479,47 +538,17 @@ func (ev *expressionEvaluator) Evaluate(args ...interface{}) (interface{}, error
 		}
 	}
 
-	// Kết hợp các hàm, có thể wrap để trace predicate
-	allFunctions := make(CustomFunctionMap)
-	if ev.userFunctions != nil {
-		for name, function := range ev.userFunctions {
-			allFunctions[name] = function
-		}
-	}
-
-	if req != nil && req.Trace != nil && req.TraceCfg != nil && req.TraceCfg.enablePredicateTracing {
-		wrapped := make(CustomFunctionMap, len(allFunctions))
-		for name, fn := range allFunctions {
-			n := name
-			orig := fn
-			wrapped[n] = func(fnArgs ...interface{}) (interface{}, error) {
-				res, err := orig(fnArgs...)
-				// best effort cast
-				boolRes := false
-				if b, ok := res.(bool); ok {
-					boolRes = b
-				}
-				req.Trace.OnPredicate(n, fnArgs, boolRes)
-				return res, err
-			}
-		}
-		allFunctions = wrapped
-	}
-
-	// Khởi tạo bộ đánh giá biểu thức với BỘ HÀM ĐÃ KẾT HỢP
-	expr, err := govaluate.NewEvaluableExpressionWithFunctions(ruleStr, allFunctions)
+	// Lấy bản biên dịch từ cache; predicate chỉ được wrap khi bật tracing.
+	compiled, err := ev.rules.get(ruleStr)
 	if err != nil {
-		return false, fmt.Errorf("invalid rule syntax '%s': %w", ruleStr, err)
+		return false, err
 	}
-
-	parameters := map[string]interface{}{
-		"Subject":  req.Subject,
-		"Resource": req.Resource,
-		"Action":   req.Action,
-		"Env":      req.Env,
+	var observer TraceObserver
+	if req != nil && req.Trace != nil && req.TraceCfg != nil && req.TraceCfg.enablePredicateTracing {
+		observer = req.Trace
 	}
 
-	result, err := expr.Evaluate(parameters)
+	result, err := compiled.evaluate(requestParameters(req), observer)
 	if err != nil {
 		return false, fmt.Errorf("evaluate: lỗi khi đánh giá rule '%s': %w", ruleStr, err)
 	}
@@ -3,6 +3,7 @@ package abac_test
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/duclek15/go-abac-library/abac"
@@ -191,3 +192,115 @@ func TestAuthorizer_CheckWithTrace_SubjectNotFound(t *testing.T) {
 	assert.NotNil(t, trace)
 	assert.NotEmpty(t, trace.Error)
 }
+
+func TestAuthorizer_CheckWithTrace_PolicyIDs(t *testing.T) {
+	authorizer := setupAuthorizer(t)
+	ctx := context.Background()
+
+	allowed, trace, err := authorizer.CheckWithTrace(
+		&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil,
+	)
+
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+	matched := map[string]bool{}
+	for _, m := range trace.MatchedPolicies {
+		assert.NotEmpty(t, m.RuleID)
+		matched[m.PolicyID] = m.Matched
+	}
+	assert.Equal(t, map[string]bool{
+		"root_approve_level_2":          false,
+		"t1_hr_manager_approve_level_2": true,
+	}, matched, "only policies of tenant1 and '*' should be evaluated")
+}
+
+const traceTestModel = `
+[request_definition]
+r = tenant, req
+
+[policy_definition]
+p = tenant, rule, eft, id
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)`
+
+func TestAuthorizer_CheckWithTrace_PerPolicyEvaluations(t *testing.T) {
+	policies := `
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, tenant1, "Resource.department == 'engineering'", deny, deny_engineering
+p, tenant2, "Action == 'approve_level_2'", allow, other_tenant
+p, tenant1, "Action == 'read'", allow, not_matching`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	allowed, trace, err := authorizer.CheckWithTrace(
+		&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil,
+	)
+
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, "deny", trace.Decision)
+	assert.Equal(t, "deny rule deny_engineering overrode allow rule allow_approve", trace.DecisionReason)
+
+	byID := map[string]abac.PolicyEvaluation{}
+	for _, p := range trace.Policies {
+		byID[p.PolicyID] = p
+	}
+	assert.Len(t, byID, 4)
+	assert.True(t, byID["allow_approve"].Matched)
+	assert.Equal(t, "*", byID["allow_approve"].Tenant)
+	assert.True(t, byID["deny_engineering"].Matched)
+	assert.Equal(t, "deny", byID["deny_engineering"].Effect)
+	assert.True(t, byID["other_tenant"].Skipped)
+	assert.Equal(t, "tenant mismatch", byID["other_tenant"].SkipReason)
+	assert.False(t, byID["not_matching"].Matched)
+	assert.False(t, byID["not_matching"].Skipped)
+}
+
+func TestAuthorizer_CheckWithTrace_RecordsRuleErrors(t *testing.T) {
+	policies := `
+p, *, "Resource.department > 5", allow, broken_rule
+p, *, "Action == 'approve_level_2'", allow, allow_approve`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	allowed, trace, err := authorizer.CheckWithTrace(
+		&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil,
+	)
+
+	assert.Error(t, err)
+	assert.False(t, allowed)
+	assert.Len(t, trace.Policies, 2, "policies after the failing one are still traced")
+	assert.NotEmpty(t, trace.Policies[0].Error)
+	assert.True(t, trace.Policies[1].Matched)
+	assert.Contains(t, trace.DecisionReason, "broken_rule")
+}
+
+func TestNewABACSystem_RejectsUnsupportedModel(t *testing.T) {
+	mockFetcher := &mocks.MockFetcher{}
+	policies := `p, *, "Action == 'read'", allow, read`
+
+	// Biến thể matcher được hỗ trợ: khoảng trắng khác, không có p.id.
+	_, _, err := abac.NewABACSystemFromStrings(strings.Replace(traceTestModel,
+		"evaluate(p.rule, r.req, p.id)", "evaluate( p.rule,r.req )", 1), policies, mockFetcher, mockFetcher, nil)
+	assert.NoError(t, err)
+
+	customMatcher := strings.Replace(traceTestModel,
+		"(r.tenant == p.tenant || p.tenant == '*') &&", "r.tenant == p.tenant &&", 1)
+	_, _, err = abac.NewABACSystemFromStrings(customMatcher, policies, mockFetcher, mockFetcher, nil)
+	assert.ErrorIs(t, err, abac.ErrUnsupportedModel)
+	assert.ErrorContains(t, err, "matcher")
+
+	customEffect := strings.Replace(traceTestModel,
+		"e = some(where (p.eft == allow)) && !some(where (p.eft == deny))", "e = some(where (p.eft == allow))", 1)
+	_, _, err = abac.NewABACSystemFromStrings(customEffect, policies, mockFetcher, mockFetcher, nil)
+	assert.ErrorIs(t, err, abac.ErrUnsupportedModel)
+	assert.ErrorContains(t, err, "policy_effect")
+}
@@ -0,0 +1,325 @@
+package authzen
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/duclek15/go-abac-library/abac"
+)
+
+// Decider là phần của abac.Authorizer mà adapter cần.
+type Decider interface {
+	Decide(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrs *abac.Attributes) abac.Decision
+}
+
+// ErrInvalidRequest được trả về khi request AuthZEN thiếu trường bắt buộc hoặc có giá trị
+// không hợp lệ; handler trả về 400.
+var ErrInvalidRequest = errors.New("invalid AuthZEN request")
+
+// EnvActionProperties là khóa Env chứa properties của action (nếu có). Các trường của context
+// AuthZEN được đưa thẳng vào Env.
+const EnvActionProperties = "action_properties"
+
+// Các đường dẫn được Handler phục vụ.
+const (
+	EvaluationPath    = "/access/v1/evaluation"
+	EvaluationsPath   = "/access/v1/evaluations"
+	WellKnownPath     = "/.well-known/authzen-configuration"
+	maxRequestBodyLen = 1 << 20
+)
+
+// TenantResolver chọn tenant cho một evaluation nhận qua HTTP (AuthZEN không có khái niệm
+// tenant). req là evaluation sau khi đã áp dụng giá trị mặc định của request evaluations.
+type TenantResolver func(r *http.Request, req *EvaluationRequest) (string, error)
+
+// StaticTenant dùng một tenant cố định.
+func StaticTenant(tenantID string) TenantResolver {
+	return func(*http.Request, *EvaluationRequest) (string, error) { return tenantID, nil }
+}
+
+// TenantFromHeader đọc tenant từ một header HTTP.
+func TenantFromHeader(name string) TenantResolver {
+	return func(r *http.Request, _ *EvaluationRequest) (string, error) {
+		if v := r.Header.Get(name); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%w: missing tenant header %s", ErrInvalidRequest, name)
+	}
+}
+
+// TenantFromContext đọc tenant (chuỗi) từ một trường của context AuthZEN.
+func TenantFromContext(key string) TenantResolver {
+	return func(_ *http.Request, req *EvaluationRequest) (string, error) {
+		if v, ok := req.Context[key].(string); ok && v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%w: missing tenant in context.%s", ErrInvalidRequest, key)
+	}
+}
+
+// Option là tùy chọn của adapter.
+type Option interface{ apply(*config) }
+
+type optFunc func(*config)
+
+func (f optFunc) apply(c *config) { f(c) }
+
+type config struct {
+	tenant          TenantResolver
+	decisionContext bool
+	baseURL         string
+}
+
+// WithTenant chọn cách lấy tenant cho request HTTP (mặc định: TenantFromContext("tenant_id")).
+func WithTenant(t TenantResolver) Option {
+	return optFunc(func(c *config) {
+		if t != nil {
+			c.tenant = t
+		}
+	})
+}
+
+// WithDecisionContext thêm effect, policy_ids và reason_admin của quyết định vào context của
+// response. Mặc định chỉ obligation và advice được trả về.
+func WithDecisionContext() Option {
+	return optFunc(func(c *config) { c.decisionContext = true })
+}
+
+// WithBaseURL đặt URL gốc công bố tại /.well-known/authzen-configuration (mặc định: suy ra từ
+// request), cần khi handler được mount sau một prefix hoặc reverse proxy.
+func WithBaseURL(url string) Option {
+	return optFunc(func(c *config) { c.baseURL = strings.TrimRight(url, "/") })
+}
+
+// Adapter chuyển request AuthZEN thành lời gọi Decider.
+type Adapter struct {
+	decider Decider
+	cfg     config
+}
+
+// New tạo adapter cho decider (thường là *abac.Authorizer).
+func New(decider Decider, opts ...Option) *Adapter {
+	a := &Adapter{decider: decider, cfg: config{tenant: TenantFromContext("tenant_id")}}
+	for _, o := range opts {
+		if o != nil {
+			o.apply(&a.cfg)
+		}
+	}
+	return a
+}
+
+// Evaluate đánh giá một request AuthZEN trong tenant cho trước. Lỗi (bọc ErrInvalidRequest) chỉ
+// được trả về khi request không hợp lệ; lỗi khi đánh giá cho kết quả decision false.
+func (a *Adapter) Evaluate(ctx context.Context, tenantID string, req EvaluationRequest) (EvaluationResponse, error) {
+	if err := req.validate(); err != nil {
+		return EvaluationResponse{}, err
+	}
+	return a.evaluate(ctx, tenantID, &req), nil
+}
+
+// Evaluations đánh giá một request evaluations trong tenant cho trước, theo
+// EvaluationsOptions.Semantic. Request không có evaluation nào được đánh giá như một evaluation.
+func (a *Adapter) Evaluations(ctx context.Context, tenantID string, req EvaluationsRequest) (EvaluationsResponse, error) {
+	return a.evaluations(ctx, &req, func(*EvaluationRequest) (string, error) { return tenantID, nil })
+}
+
+func (a *Adapter) evaluations(ctx context.Context, req *EvaluationsRequest, tenantOf func(*EvaluationRequest) (string, error)) (EvaluationsResponse, error) {
+	semantic := ExecuteAll
+	if req.Options != nil && req.Options.Semantic != "" {
+		semantic = req.Options.Semantic
+	}
+	switch semantic {
+	case ExecuteAll, DenyOnFirstDeny, PermitOnFirstPermit:
+	default:
+		return EvaluationsResponse{}, fmt.Errorf("%w: unknown evaluations_semantic %q", ErrInvalidRequest, semantic)
+	}
+
+	evals := req.resolved()
+	tenants := make([]string, len(evals))
+	for i := range evals {
+		if err := evals[i].validate(); err != nil {
+			return EvaluationsResponse{}, fmt.Errorf("evaluations[%d]: %w", i, err)
+		}
+		tenantID, err := tenantOf(&evals[i])
+		if err != nil {
+			return EvaluationsResponse{}, fmt.Errorf("evaluations[%d]: %w", i, err)
+		}
+		tenants[i] = tenantID
+	}
+
+	resp := EvaluationsResponse{Evaluations: make([]EvaluationResponse, 0, len(evals))}
+	for i := range evals {
+		result := a.evaluate(ctx, tenants[i], &evals[i])
+		resp.Evaluations = append(resp.Evaluations, result)
+		if (semantic == DenyOnFirstDeny && !result.Decision) || (semantic == PermitOnFirstPermit && result.Decision) {
+			break
+		}
+	}
+	return resp, nil
+}
+
+func (a *Adapter) evaluate(ctx context.Context, tenantID string, req *EvaluationRequest) EvaluationResponse {
+	env := make(abac.Attributes, len(req.Context)+1)
+	for k, v := range req.Context {
+		env[k] = v
+	}
+	if len(req.Action.Properties) > 0 {
+		env[EnvActionProperties] = req.Action.Properties
+	}
+	d := a.decider.Decide(&ctx, tenantID, *req.Subject, *req.Resource, req.Action.Name, &env)
+	return a.response(d)
+}
+
+func (a *Adapter) response(d abac.Decision) EvaluationResponse {
+	resp := EvaluationResponse{Decision: d.Allowed()}
+	ctx := make(map[string]interface{})
+	if len(d.Obligations) > 0 {
+		ctx["obligations"] = d.Obligations
+	}
+	if len(d.Advice) > 0 {
+		ctx["advice"] = d.Advice
+	}
+	if a.cfg.decisionContext {
+		ctx["effect"] = d.Effect
+		if len(d.PolicyIDs) > 0 {
+			ctx["policy_ids"] = d.PolicyIDs
+		}
+		if d.Reason != "" {
+			ctx["reason_admin"] = map[string]string{"en": d.Reason}
+		}
+	}
+	if len(ctx) > 0 {
+		resp.Context = ctx
+	}
+	return resp
+}
+
+func (req *EvaluationRequest) validate() error {
+	switch {
+	case req.Subject == nil || req.Subject.Type == "" || req.Subject.ID == "":
+		return fmt.Errorf("%w: subject.type and subject.id are required", ErrInvalidRequest)
+	case req.Resource == nil || req.Resource.Type == "":
+		return fmt.Errorf("%w: resource.type is required", ErrInvalidRequest)
+	case req.Action == nil || req.Action.Name == "":
+		return fmt.Errorf("%w: action.name is required", ErrInvalidRequest)
+	}
+	return nil
+}
+
+// resolved trả về các evaluation sau khi áp dụng giá trị mặc định ở cấp cao nhất; giá trị của
+// evaluation thay thế toàn bộ giá trị mặc định tương ứng.
+func (req *EvaluationsRequest) resolved() []EvaluationRequest {
+	if len(req.Evaluations) == 0 {
+		return []EvaluationRequest{{Subject: req.Subject, Resource: req.Resource, Action: req.Action, Context: req.Context}}
+	}
+	evals := make([]EvaluationRequest, len(req.Evaluations))
+	for i, e := range req.Evaluations {
+		if e.Subject == nil {
+			e.Subject = req.Subject
+		}
+		if e.Resource == nil {
+			e.Resource = req.Resource
+		}
+		if e.Action == nil {
+			e.Action = req.Action
+		}
+		if e.Context == nil {
+			e.Context = req.Context
+		}
+		evals[i] = e
+	}
+	return evals
+}
+
+// Handler trả về http.Handler phục vụ EvaluationPath, EvaluationsPath và WellKnownPath.
+// Header X-Request-ID của request được gửi lại trong response.
+func (a *Adapter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+EvaluationPath, a.handleEvaluation)
+	mux.HandleFunc("POST "+EvaluationsPath, a.handleEvaluations)
+	mux.HandleFunc("GET "+WellKnownPath, a.handleConfiguration)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := r.Header.Get("X-Request-ID"); id != "" {
+			w.Header().Set("X-Request-ID", id)
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (a *Adapter) handleEvaluation(w http.ResponseWriter, r *http.Request) {
+	var req EvaluationRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, err)
+		return
+	}
+	tenantID, err := a.cfg.tenant(r, &req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.evaluate(r.Context(), tenantID, &req))
+}
+
+func (a *Adapter) handleEvaluations(w http.ResponseWriter, r *http.Request) {
+	var req EvaluationsRequest
+	if err := decode(w, r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	resp, err := a.evaluations(r.Context(), &req, func(e *EvaluationRequest) (string, error) { return a.cfg.tenant(r, e) })
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if len(req.Evaluations) == 0 {
+		// Không có evaluation nào: trả về như endpoint evaluation.
+		writeJSON(w, http.StatusOK, resp.Evaluations[0])
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (a *Adapter) handleConfiguration(w http.ResponseWriter, r *http.Request) {
+	base := a.cfg.baseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	writeJSON(w, http.StatusOK, Configuration{
+		PolicyDecisionPoint:       base,
+		AccessEvaluationEndpoint:  base + EvaluationPath,
+		AccessEvaluationsEndpoint: base + EvaluationsPath,
+	})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodyLen)).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, ErrInvalidRequest) {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,326 @@
+package authzen_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/abac/authzen"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testModel = `
+[request_definition]
+r = tenant, req
+
+[policy_definition]
+p = tenant, rule, eft, id, obligations
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)`
+
+const testPolicies = `
+p, tenant1, "Action == 'can_read' && Resource.type == 'request' && Resource.department == 'engineering'", allow, read_eng, audit
+p, tenant1, "Action == 'can_approve' && Subject.type == 'user' && Subject.role == 'manager' && Env.channel == 'web'", allow, approve_web,
+p, tenant1, "Action == 'can_list' && Resource.type == 'collection' && Env.action_properties.scope == 'own'", allow, list_own,
+p, tenant2, "Action == 'can_read'", allow, read_all,`
+
+func newAdapter(t *testing.T, fetcherOpts []authzen.FetcherOption, opts ...authzen.Option) *authzen.Adapter {
+	t.Helper()
+	mockFetcher := &mocks.MockFetcher{}
+	sf := authzen.NewSubjectFetcher(mockFetcher, fetcherOpts...)
+	rf := authzen.NewResourceFetcher(mockFetcher, fetcherOpts...)
+	audit := abac.WithObligationHandler("audit", func(context.Context, abac.Obligation, interface{}) error { return nil })
+	authorizer, _, err := abac.NewABACSystemFromStrings(testModel, testPolicies, sf, rf, nil, audit)
+	require.NoError(t, err)
+	return authzen.New(authorizer, opts...)
+}
+
+func TestAdapter_Evaluate(t *testing.T) {
+	merge := []authzen.FetcherOption{authzen.WithAttributeSource(authzen.PropertiesOrFetch)}
+	a := newAdapter(t, merge, authzen.WithDecisionContext())
+	ctx := context.Background()
+	manager := &authzen.Subject{Type: "user", ID: "alice", Properties: map[string]interface{}{"role": "manager"}}
+
+	tests := []struct {
+		name     string
+		req      authzen.EvaluationRequest
+		decision bool
+		effect   abac.DecisionEffect
+	}{
+		{
+			name: "subject and resource fetched by id",
+			req: authzen.EvaluationRequest{
+				Subject:  &authzen.Subject{Type: "user", ID: "t1_hr_manager"},
+				Resource: &authzen.Resource{Type: "request", ID: "t1_eng_request"},
+				Action:   &authzen.Action{Name: "can_read"},
+			},
+			decision: true, effect: abac.Permit,
+		},
+		{
+			name: "resource type is part of the attributes",
+			req: authzen.EvaluationRequest{
+				Subject:  &authzen.Subject{Type: "user", ID: "t1_hr_manager"},
+				Resource: &authzen.Resource{Type: "document", ID: "t1_eng_request"},
+				Action:   &authzen.Action{Name: "can_read"},
+			},
+			decision: false, effect: abac.NotApplicable,
+		},
+		{
+			name: "properties used as attributes and context as env",
+			req: authzen.EvaluationRequest{
+				Subject:  manager,
+				Resource: &authzen.Resource{Type: "request", ID: "r1", Properties: map[string]interface{}{"department": "hr"}},
+				Action:   &authzen.Action{Name: "can_approve"},
+				Context:  map[string]interface{}{"channel": "web"},
+			},
+			decision: true, effect: abac.Permit,
+		},
+		{
+			name: "action properties and collection resource",
+			req: authzen.EvaluationRequest{
+				Subject:  manager,
+				Resource: &authzen.Resource{Type: "collection"},
+				Action:   &authzen.Action{Name: "can_list", Properties: map[string]interface{}{"scope": "own"}},
+			},
+			decision: true, effect: abac.Permit,
+		},
+		{
+			name: "unknown subject is indeterminate",
+			req: authzen.EvaluationRequest{
+				Subject:  &authzen.Subject{Type: "user", ID: "nobody"},
+				Resource: &authzen.Resource{Type: "request", ID: "t1_eng_request"},
+				Action:   &authzen.Action{Name: "can_read"},
+			},
+			decision: false, effect: abac.Indeterminate,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := a.Evaluate(ctx, "tenant1", tc.req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.decision, resp.Decision)
+			assert.Equal(t, tc.effect, resp.Context["effect"])
+		})
+	}
+
+	resp, err := a.Evaluate(ctx, "tenant1", tests[0].req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read_eng"}, resp.Context["policy_ids"])
+	assert.Equal(t, []abac.Obligation{{Name: "audit", PolicyID: "read_eng"}}, resp.Context["obligations"])
+
+	_, err = a.Evaluate(ctx, "tenant1", authzen.EvaluationRequest{Subject: manager, Resource: &authzen.Resource{Type: "request"}})
+	assert.ErrorIs(t, err, authzen.ErrInvalidRequest)
+}
+
+func TestAdapter_EvaluateWithoutDecisionContext(t *testing.T) {
+	a := newAdapter(t, nil)
+	resp, err := a.Evaluate(context.Background(), "tenant1", authzen.EvaluationRequest{
+		Subject:  &authzen.Subject{Type: "user", ID: "t1_hr_manager"},
+		Resource: &authzen.Resource{Type: "request", ID: "t2_hr_request"},
+		Action:   &authzen.Action{Name: "can_read"},
+	})
+	require.NoError(t, err)
+	assert.False(t, resp.Decision)
+	assert.Nil(t, resp.Context)
+}
+
+func TestAttributeSource(t *testing.T) {
+	// Subject có properties nhưng id không tồn tại trong fetcher gốc.
+	req := authzen.EvaluationRequest{
+		Subject:  &authzen.Subject{Type: "user", ID: "alice", Properties: map[string]interface{}{"role": "manager"}},
+		Resource: &authzen.Resource{Type: "request", ID: "t1_eng_request", Properties: map[string]interface{}{"department": "hr"}},
+		Action:   &authzen.Action{Name: "can_read"},
+	}
+	ctx := context.Background()
+
+	resp, err := newAdapter(t, nil, authzen.WithDecisionContext()).Evaluate(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.Equal(t, abac.Indeterminate, resp.Context["effect"], "mặc định bỏ qua properties, alice không tồn tại")
+
+	merge := []authzen.FetcherOption{authzen.WithAttributeSource(authzen.PropertiesOrFetch)}
+	resp, err = newAdapter(t, merge, authzen.WithDecisionContext()).Evaluate(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.Equal(t, abac.NotApplicable, resp.Context["effect"], "properties được dùng thay cho fetcher")
+
+	fetchOnly := []authzen.FetcherOption{authzen.WithAttributeSource(authzen.FetchOnly)}
+	resp, err = newAdapter(t, fetchOnly, authzen.WithDecisionContext()).Evaluate(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.Equal(t, abac.Indeterminate, resp.Context["effect"], "properties bị bỏ qua, alice không tồn tại")
+
+	var keys []interface{}
+	key := authzen.WithFetchKey(func(entityType, id string) interface{} {
+		keys = append(keys, entityType+":"+id)
+		return id
+	})
+	req.Subject = &authzen.Subject{Type: "user", ID: "t1_hr_manager"}
+	resp, err = newAdapter(t, append(fetchOnly, key)).Evaluate(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.True(t, resp.Decision)
+	assert.ElementsMatch(t, []interface{}{"user:t1_hr_manager", "request:t1_eng_request"}, keys)
+
+	// Giá trị không phải thực thể AuthZEN được chuyển nguyên cho fetcher gốc.
+	sf := authzen.NewSubjectFetcher(&mocks.MockFetcher{})
+	attrs, err := sf.GetSubjectAttributes(&ctx, "t1_hr_manager")
+	require.NoError(t, err)
+	assert.Equal(t, "t1_hr_manager", attrs["id"])
+	assert.NotContains(t, attrs, "type")
+
+	_, err = authzen.NewResourceFetcher(nil).GetResourceAttributes(&ctx, authzen.Resource{Type: "request", ID: "x"})
+	require.NoError(t, err, "không có fetcher gốc: properties (rỗng) được dùng")
+}
+
+func TestAttributeSource_PropertiesCannotRaisePrivileges(t *testing.T) {
+	// t1_hr_manager không có role "manager" trong fetcher gốc; client tự gửi role trong properties.
+	req := authzen.EvaluationRequest{
+		Subject:  &authzen.Subject{Type: "user", ID: "t1_hr_manager", Properties: map[string]interface{}{"role": "manager"}},
+		Resource: &authzen.Resource{Type: "request", ID: "t1_eng_request"},
+		Action:   &authzen.Action{Name: "can_approve"},
+		Context:  map[string]interface{}{"channel": "web"},
+	}
+	ctx := context.Background()
+
+	resp, err := newAdapter(t, nil, authzen.WithDecisionContext()).Evaluate(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.False(t, resp.Decision)
+	assert.NotEqual(t, abac.Permit, resp.Context["effect"])
+
+	// Chế độ kết hợp phải được bật tường minh, và khi đó properties của client được tin.
+	merge := []authzen.FetcherOption{authzen.WithAttributeSource(authzen.PropertiesOrFetch)}
+	resp, err = newAdapter(t, merge).Evaluate(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.True(t, resp.Decision)
+}
+
+func TestAdapter_Evaluations(t *testing.T) {
+	a := newAdapter(t, nil)
+	ctx := context.Background()
+	req := authzen.EvaluationsRequest{
+		Subject: &authzen.Subject{Type: "user", ID: "t1_hr_manager"},
+		Action:  &authzen.Action{Name: "can_read"},
+		Evaluations: []authzen.EvaluationRequest{
+			{Resource: &authzen.Resource{Type: "request", ID: "t1_eng_request"}},
+			{Resource: &authzen.Resource{Type: "request", ID: "t2_hr_request"}},
+			{Resource: &authzen.Resource{Type: "request", ID: "t1_eng_request"}, Action: &authzen.Action{Name: "can_delete"}},
+		},
+	}
+	decisions := func(resp authzen.EvaluationsResponse) []bool {
+		var out []bool
+		for _, e := range resp.Evaluations {
+			out = append(out, e.Decision)
+		}
+		return out
+	}
+
+	resp, err := a.Evaluations(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false, false}, decisions(resp))
+
+	req.Options = &authzen.EvaluationsOptions{Semantic: authzen.DenyOnFirstDeny}
+	resp, err = a.Evaluations(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true, false}, decisions(resp))
+
+	req.Options.Semantic = authzen.PermitOnFirstPermit
+	resp, err = a.Evaluations(ctx, "tenant1", req)
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true}, decisions(resp))
+
+	req.Options.Semantic = "first_match"
+	_, err = a.Evaluations(ctx, "tenant1", req)
+	assert.ErrorIs(t, err, authzen.ErrInvalidRequest)
+
+	req.Options = nil
+	req.Evaluations = append(req.Evaluations, authzen.EvaluationRequest{})
+	_, err = a.Evaluations(ctx, "tenant1", req)
+	assert.ErrorIs(t, err, authzen.ErrInvalidRequest, "evaluation không có resource")
+}
+
+func post(t *testing.T, h http.Handler, path string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	r := httptest.NewRequest("POST", path, &buf)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandler(t *testing.T) {
+	h := newAdapter(t, nil).Handler()
+	evaluation := map[string]interface{}{
+		"subject":  map[string]interface{}{"type": "user", "id": "t1_hr_manager"},
+		"resource": map[string]interface{}{"type": "request", "id": "t2_hr_request"},
+		"action":   map[string]interface{}{"name": "can_read"},
+		"context":  map[string]interface{}{"tenant_id": "tenant2"},
+	}
+
+	w := post(t, h, authzen.EvaluationPath, evaluation, http.Header{"X-Request-Id": {"req-1"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "req-1", w.Header().Get("X-Request-ID"))
+	assert.JSONEq(t, `{"decision": true}`, w.Body.String())
+
+	// Tenant khác theo từng evaluation (context của evaluation thay thế context mặc định).
+	w = post(t, h, authzen.EvaluationsPath, map[string]interface{}{
+		"subject":  evaluation["subject"],
+		"action":   evaluation["action"],
+		"resource": evaluation["resource"],
+		"context":  map[string]interface{}{"tenant_id": "tenant2"},
+		"evaluations": []interface{}{
+			map[string]interface{}{},
+			map[string]interface{}{"context": map[string]interface{}{"tenant_id": "tenant1"}},
+		},
+	}, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"evaluations": [{"decision": true}, {"decision": false}]}`, w.Body.String())
+
+	// Không có evaluations: response có dạng của endpoint evaluation.
+	w = post(t, h, authzen.EvaluationsPath, evaluation, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"decision": true}`, w.Body.String())
+
+	delete(evaluation, "context")
+	w = post(t, h, authzen.EvaluationPath, evaluation, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "tenant")
+
+	w = post(t, h, authzen.EvaluationPath, "not an object", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	r := httptest.NewRequest("GET", "http://pdp.example.com"+authzen.WellKnownPath, nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"policy_decision_point": "http://pdp.example.com",
+		"access_evaluation_endpoint": "http://pdp.example.com/access/v1/evaluation",
+		"access_evaluations_endpoint": "http://pdp.example.com/access/v1/evaluations"
+	}`, w.Body.String())
+}
+
+func TestHandler_TenantFromHeader(t *testing.T) {
+	h := newAdapter(t, nil, authzen.WithTenant(authzen.TenantFromHeader("X-Tenant-ID")), authzen.WithBaseURL("https://authz.example.com/pdp/")).Handler()
+	w := post(t, h, authzen.EvaluationPath, map[string]interface{}{
+		"subject":  map[string]interface{}{"type": "user", "id": "t1_hr_manager"},
+		"resource": map[string]interface{}{"type": "request", "id": "t1_eng_request"},
+		"action":   map[string]interface{}{"name": "can_read"},
+	}, http.Header{"X-Tenant-Id": {"tenant1"}})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"decision": true, "context": {"obligations": [{"name": "audit", "policy_id": "read_eng"}]}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", authzen.WellKnownPath, nil))
+	assert.Contains(t, w.Body.String(), `"access_evaluation_endpoint":"https://authz.example.com/pdp/access/v1/evaluation"`)
+}
@@ -0,0 +1,181 @@
+package authzen
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/duclek15/go-abac-library/abac"
+)
+
+// AttributeSource chọn nguồn thuộc tính cho subject/resource AuthZEN. Giá trị 0 (mặc định) là
+// FetchOnly khi có fetcher gốc và PropertiesOnly khi inner nil.
+type AttributeSource int
+
+const (
+	// FetchOnly luôn lấy qua fetcher gốc theo id, bỏ qua properties do client gửi.
+	FetchOnly AttributeSource = iota + 1
+	// PropertiesOnly chỉ dùng properties, không gọi fetcher gốc.
+	PropertiesOnly
+	// PropertiesOrFetch dùng properties nếu request có gửi, ngược lại lấy qua fetcher gốc theo id.
+	// Cảnh báo: properties do client đặt thay hoàn toàn thuộc tính của fetcher gốc, nên client có
+	// thể tự gửi {"role": "admin"} để leo thang quyền. Chỉ bật khi mọi client gọi API là dịch vụ
+	// tin cậy (ví dụ PEP nội bộ đã tự lấy thuộc tính).
+	PropertiesOrFetch
+)
+
+// FetcherOption là tùy chọn của NewSubjectFetcher và NewResourceFetcher.
+type FetcherOption interface{ apply(*fetcherConfig) }
+
+type fetcherOptFunc func(*fetcherConfig)
+
+func (f fetcherOptFunc) apply(c *fetcherConfig) { f(c) }
+
+type fetcherConfig struct {
+	source AttributeSource
+	key    func(entityType, id string) interface{}
+}
+
+// WithAttributeSource chọn nguồn thuộc tính (mặc định: FetchOnly, hoặc PropertiesOnly khi inner nil).
+func WithAttributeSource(s AttributeSource) FetcherOption {
+	return fetcherOptFunc(func(c *fetcherConfig) { c.source = s })
+}
+
+// WithFetchKey chọn giá trị truyền cho fetcher gốc (mặc định: id), ví dụ để ghép type vào khóa
+// khi một fetcher phục vụ nhiều loại resource.
+func WithFetchKey(fn func(entityType, id string) interface{}) FetcherOption {
+	return fetcherOptFunc(func(c *fetcherConfig) {
+		if fn != nil {
+			c.key = fn
+		}
+	})
+}
+
+func newFetcherConfig(opts []FetcherOption) fetcherConfig {
+	cfg := fetcherConfig{key: func(_, id string) interface{} { return id }}
+	for _, o := range opts {
+		if o != nil {
+			o.apply(&cfg)
+		}
+	}
+	return cfg
+}
+
+// useProperties cho biết có dùng properties thay vì gọi fetcher gốc hay không.
+func (c *fetcherConfig) useProperties(properties map[string]interface{}, hasInner bool) bool {
+	switch c.source {
+	case FetchOnly:
+		return false
+	case PropertiesOnly:
+		return true
+	case PropertiesOrFetch:
+		return len(properties) > 0 || !hasInner
+	}
+	return !hasInner
+}
+
+// entityAttributes trả về bản sao của attrs kèm id và type của thực thể (nếu attrs chưa có),
+// để rule có thể dùng Subject.type, Resource.type (và target index theo Resource.type).
+func entityAttributes(attrs map[string]interface{}, entityType, id string) abac.Attributes {
+	out := make(abac.Attributes, len(attrs)+2)
+	for k, v := range attrs {
+		out[k] = v
+	}
+	if _, ok := out["id"]; !ok && id != "" {
+		out["id"] = id
+	}
+	if _, ok := out["type"]; !ok && entityType != "" {
+		out["type"] = entityType
+	}
+	return out
+}
+
+type subjectFetcher struct {
+	inner abac.SubjectFetcher
+	cfg   fetcherConfig
+}
+
+// NewSubjectFetcher bọc một SubjectFetcher để nhận Subject AuthZEN: thuộc tính lấy từ inner theo
+// id, hoặc từ properties khi inner nil (xem AttributeSource), kèm id và type. Giá trị khác Subject được chuyển
+// nguyên cho inner, nên hệ thống vẫn dùng được với Check/Decide thông thường. inner có thể nil
+// nếu chỉ dùng properties.
+func NewSubjectFetcher(inner abac.SubjectFetcher, opts ...FetcherOption) abac.SubjectFetcher {
+	return &subjectFetcher{inner: inner, cfg: newFetcherConfig(opts)}
+}
+
+func (f *subjectFetcher) GetSubjectAttributes(ctx *context.Context, subject interface{}) (abac.Attributes, error) {
+	var s Subject
+	switch v := subject.(type) {
+	case Subject:
+		s = v
+	case *Subject:
+		if v == nil {
+			return nil, abac.ErrSubjectNotFound
+		}
+		s = *v
+	default:
+		if f.inner == nil {
+			return nil, abac.ErrSubjectNotFound
+		}
+		return f.inner.GetSubjectAttributes(ctx, subject)
+	}
+
+	if f.cfg.useProperties(s.Properties, f.inner != nil) {
+		return entityAttributes(s.Properties, s.Type, s.ID), nil
+	}
+	if f.inner == nil || s.ID == "" {
+		return nil, fmt.Errorf("%w: %s/%s", abac.ErrSubjectNotFound, s.Type, s.ID)
+	}
+	attrs, err := f.inner.GetSubjectAttributes(ctx, f.cfg.key(s.Type, s.ID))
+	if err != nil {
+		return nil, err
+	}
+	return entityAttributes(attrs, s.Type, s.ID), nil
+}
+
+type resourceFetcher struct {
+	inner abac.ResourceFetcher
+	cfg   fetcherConfig
+}
+
+// NewResourceFetcher bọc một ResourceFetcher để nhận Resource AuthZEN, tương tự NewSubjectFetcher.
+// Resource không có id và properties (ví dụ một collection) có thuộc tính chỉ gồm type.
+func NewResourceFetcher(inner abac.ResourceFetcher, opts ...FetcherOption) abac.ResourceFetcher {
+	return &resourceFetcher{inner: inner, cfg: newFetcherConfig(opts)}
+}
+
+func (f *resourceFetcher) GetResourceAttributes(ctx *context.Context, resource interface{}) ([]abac.Attributes, error) {
+	var r Resource
+	switch v := resource.(type) {
+	case Resource:
+		r = v
+	case *Resource:
+		if v == nil {
+			return nil, abac.ErrResourceNotFound
+		}
+		r = *v
+	default:
+		if f.inner == nil {
+			return nil, abac.ErrResourceNotFound
+		}
+		return f.inner.GetResourceAttributes(ctx, resource)
+	}
+
+	if f.cfg.useProperties(r.Properties, f.inner != nil) {
+		return []abac.Attributes{entityAttributes(r.Properties, r.Type, r.ID)}, nil
+	}
+	if r.ID == "" {
+		return []abac.Attributes{entityAttributes(nil, r.Type, "")}, nil
+	}
+	if f.inner == nil {
+		return nil, fmt.Errorf("%w: %s/%s", abac.ErrResourceNotFound, r.Type, r.ID)
+	}
+	list, err := f.inner.GetResourceAttributes(ctx, f.cfg.key(r.Type, r.ID))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]abac.Attributes, len(list))
+	for i, attrs := range list {
+		out[i] = entityAttributes(attrs, r.Type, r.ID)
+	}
+	return out, nil
+}
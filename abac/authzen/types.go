@@ -0,0 +1,87 @@
+// Package authzen cung cấp adapter theo OpenID AuthZEN Authorization API: chuyển request
+// evaluation/evaluations (subject, resource, action, context) thành lời gọi abac.Authorizer và
+// chuyển quyết định về response AuthZEN.
+//
+// Subject và resource AuthZEN (type, id, properties) được truyền vào Authorizer nguyên dạng;
+// hệ thống phải được tạo với các fetcher bọc bởi NewSubjectFetcher/NewResourceFetcher để
+// properties được dùng trực tiếp làm thuộc tính hoặc id được chuyển cho fetcher gốc:
+//
+//	sf := authzen.NewSubjectFetcher(userRepo)
+//	rf := authzen.NewResourceFetcher(docRepo)
+//	authorizer, _, err := abac.NewABACSystemFromDB(modelPath, db, sf, rf, nil)
+//	mux.Handle("/", authzen.New(authorizer).Handler())
+package authzen
+
+// Subject là chủ thể của request AuthZEN.
+type Subject struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Resource là tài nguyên của request AuthZEN.
+type Resource struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Action là hành động của request AuthZEN; Name được dùng làm Action của rule.
+type Action struct {
+	Name       string                 `json:"name"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// EvaluationRequest là body của endpoint access evaluation.
+type EvaluationRequest struct {
+	Subject  *Subject               `json:"subject,omitempty"`
+	Resource *Resource              `json:"resource,omitempty"`
+	Action   *Action                `json:"action,omitempty"`
+	Context  map[string]interface{} `json:"context,omitempty"`
+}
+
+// EvaluationResponse là kết quả của một evaluation. Context chứa obligation/advice của quyết
+// định và, với WithDecisionContext, effect, policy quyết định và lý do (reason_admin).
+type EvaluationResponse struct {
+	Decision bool                   `json:"decision"`
+	Context  map[string]interface{} `json:"context,omitempty"`
+}
+
+// Các giá trị của EvaluationsOptions.Semantic.
+const (
+	// ExecuteAll đánh giá mọi evaluation (mặc định).
+	ExecuteAll = "execute_all"
+	// DenyOnFirstDeny dừng ở evaluation đầu tiên bị từ chối.
+	DenyOnFirstDeny = "deny_on_first_deny"
+	// PermitOnFirstPermit dừng ở evaluation đầu tiên được phép.
+	PermitOnFirstPermit = "permit_on_first_permit"
+)
+
+// EvaluationsOptions là tùy chọn của request evaluations.
+type EvaluationsOptions struct {
+	Semantic string `json:"evaluations_semantic,omitempty"`
+}
+
+// EvaluationsRequest là body của endpoint access evaluations. Subject, Resource, Action và
+// Context ở cấp cao nhất là giá trị mặc định cho các evaluation không khai báo chúng.
+type EvaluationsRequest struct {
+	Subject     *Subject               `json:"subject,omitempty"`
+	Resource    *Resource              `json:"resource,omitempty"`
+	Action      *Action                `json:"action,omitempty"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+	Evaluations []EvaluationRequest    `json:"evaluations,omitempty"`
+	Options     *EvaluationsOptions    `json:"options,omitempty"`
+}
+
+// EvaluationsResponse là kết quả của request evaluations, theo thứ tự các evaluation. Với
+// DenyOnFirstDeny/PermitOnFirstPermit, danh sách dừng ở evaluation làm dừng việc đánh giá.
+type EvaluationsResponse struct {
+	Evaluations []EvaluationResponse `json:"evaluations"`
+}
+
+// Configuration là metadata của PDP tại /.well-known/authzen-configuration.
+type Configuration struct {
+	PolicyDecisionPoint       string `json:"policy_decision_point"`
+	AccessEvaluationEndpoint  string `json:"access_evaluation_endpoint"`
+	AccessEvaluationsEndpoint string `json:"access_evaluations_endpoint"`
+}
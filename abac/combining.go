@@ -0,0 +1,297 @@
+package abac
+
+import (
+	"fmt"
+)
+
+// CombiningAlgorithm là thuật toán kết hợp kết quả của các policy áp dụng cho một request.
+type CombiningAlgorithm string
+
+const (
+	// DenyOverrides: có deny khớp thì deny (kể cả khi có allow hoặc rule lỗi), ngược lại rule
+	// lỗi làm request lỗi, còn lại có allow khớp thì allow (mặc định, tương đương
+	// policy_effect: some(allow) && !some(deny)).
+	DenyOverrides CombiningAlgorithm = "deny-overrides"
+	// PermitOverrides: có allow khớp thì allow (kể cả khi có deny hoặc rule lỗi),
+	// ngược lại rule lỗi làm request lỗi, còn lại deny.
+	PermitOverrides CombiningAlgorithm = "permit-overrides"
+	// FirstApplicable: policy khớp đầu tiên theo thứ tự quyết định; rule lỗi trước đó làm request lỗi.
+	FirstApplicable CombiningAlgorithm = "first-applicable"
+	// DenyUnlessPermit: có allow khớp thì allow, mọi trường hợp còn lại (kể cả rule lỗi) là deny.
+	DenyUnlessPermit CombiningAlgorithm = "deny-unless-permit"
+	// PermitUnlessDeny: có deny khớp thì deny, mọi trường hợp còn lại (kể cả không có policy
+	// nào khớp hoặc rule lỗi) là allow. Chỉ dùng khi mặc định là cho phép.
+	PermitUnlessDeny CombiningAlgorithm = "permit-unless-deny"
+)
+
+func (alg CombiningAlgorithm) valid() bool {
+	switch alg {
+	case DenyOverrides, PermitOverrides, FirstApplicable, DenyUnlessPermit, PermitUnlessDeny:
+		return true
+	}
+	return false
+}
+
+func checkCombiningAlgorithm(alg CombiningAlgorithm) error {
+	if !alg.valid() {
+		return fmt.Errorf("%w: %q", ErrUnknownCombiningAlgorithm, alg)
+	}
+	return nil
+}
+
+// CombiningResult là kết quả bước kết hợp các policy, được báo cho PolicyTraceObserver.
+type CombiningResult struct {
+	Algorithm CombiningAlgorithm `json:"algorithm"`
+	Decision  string             `json:"decision"` // allow | deny
+	Effect    DecisionEffect     `json:"effect"`
+	Reason    string             `json:"reason"`
+	// PolicyID là policy quyết định kết quả, rỗng nếu kết quả là mặc định của thuật toán.
+	PolicyID string `json:"policy_id,omitempty"`
+}
+
+// combiningSettings là thuật toán mặc định và thuật toán riêng của từng tenant. Bất biến,
+// mỗi lần thay đổi một bản mới được gắn vào snapshot policy mới.
+type combiningSettings struct {
+	defaultAlgorithm CombiningAlgorithm
+	tenants          map[string]CombiningAlgorithm
+}
+
+func (s *combiningSettings) forTenant(tenantID string) CombiningAlgorithm {
+	if s == nil {
+		return DenyOverrides
+	}
+	if alg, ok := s.tenants[tenantID]; ok {
+		return alg
+	}
+	return s.defaultAlgorithm
+}
+
+// withTenant trả về bản sao có thuật toán của tenant được đặt lại (alg rỗng: dùng mặc định).
+func (s *combiningSettings) withTenant(tenantID string, alg CombiningAlgorithm) *combiningSettings {
+	next := &combiningSettings{defaultAlgorithm: DenyOverrides, tenants: make(map[string]CombiningAlgorithm)}
+	if s != nil {
+		next.defaultAlgorithm = s.defaultAlgorithm
+		for t, a := range s.tenants {
+			next.tenants[t] = a
+		}
+	}
+	if alg == "" {
+		delete(next.tenants, tenantID)
+	} else {
+		next.tenants[tenantID] = alg
+	}
+	return next
+}
+
+// newCombiningSettings kiểm tra và dựng cấu hình thuật toán từ các SystemOption.
+func newCombiningSettings(cfg *systemConfig) (*combiningSettings, error) {
+	s := &combiningSettings{defaultAlgorithm: DenyOverrides, tenants: make(map[string]CombiningAlgorithm)}
+	if cfg.combiningAlgorithm != "" {
+		if err := checkCombiningAlgorithm(cfg.combiningAlgorithm); err != nil {
+			return nil, err
+		}
+		s.defaultAlgorithm = cfg.combiningAlgorithm
+	}
+	for tenantID, alg := range cfg.tenantAlgorithms {
+		if err := checkCombiningAlgorithm(alg); err != nil {
+			return nil, err
+		}
+		s.tenants[tenantID] = alg
+	}
+	return s, nil
+}
+
+// WithCombiningAlgorithm đặt thuật toán kết hợp mặc định cho mọi tenant (mặc định: DenyOverrides).
+func WithCombiningAlgorithm(alg CombiningAlgorithm) SystemOption {
+	return systemOptFunc(func(c *systemConfig) { c.combiningAlgorithm = alg })
+}
+
+// WithTenantCombiningAlgorithm đặt thuật toán kết hợp riêng cho một tenant.
+// Thuật toán được chọn theo tenant của request, áp dụng cho cả policy của tenant '*'.
+func WithTenantCombiningAlgorithm(tenantID string, alg CombiningAlgorithm) SystemOption {
+	return systemOptFunc(func(c *systemConfig) {
+		if c.tenantAlgorithms == nil {
+			c.tenantAlgorithms = make(map[string]CombiningAlgorithm)
+		}
+		c.tenantAlgorithms[tenantID] = alg
+	})
+}
+
+// SetTenantCombiningAlgorithm đổi thuật toán kết hợp của một tenant lúc đang chạy;
+// alg rỗng sẽ xóa cấu hình riêng để tenant dùng thuật toán mặc định.
+// Cấu hình chỉ nằm trong bộ nhớ của instance: không được lưu xuống storage, không được phát
+// qua notifier và mất khi khởi động lại. Với nhiều instance, cấu hình mọi instance bằng
+// WithTenantCombiningAlgorithm; PolicyManager đã gắn notifier (UseChangeNotifier) trả về
+// ErrProcessLocalSetting thay vì để các instance quyết định khác nhau.
+func (pm *PolicyManager) SetTenantCombiningAlgorithm(tenantID string, alg CombiningAlgorithm) error {
+	if alg != "" {
+		if err := checkCombiningAlgorithm(alg); err != nil {
+			return err
+		}
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.changes != nil {
+		return fmt.Errorf("%w: configure tenant %s with WithTenantCombiningAlgorithm on every instance", ErrProcessLocalSetting, tenantID)
+	}
+	pm.engine.setCombining(pm.engine.current().combining.withTenant(tenantID, alg))
+	return nil
+}
+
+// TenantCombiningAlgorithm trả về thuật toán kết hợp đang áp dụng cho tenant.
+func (pm *PolicyManager) TenantCombiningAlgorithm(tenantID string) CombiningAlgorithm {
+	return pm.engine.current().combining.forTenant(tenantID)
+}
+
+// =========================================================================
+// == Kết hợp kết quả
+// =========================================================================
+
+// combineState gom kết quả đánh giá các policy áp dụng cho một request.
+type combineState struct {
+	tenantID   string
+	applicable int
+	allowIDs   []string // các allow khớp, theo thứ tự đánh giá
+	denyIDs    []string // các deny khớp, theo thứ tự đánh giá
+	errIDs     []string
+	errs       []error
+	reported   []error // mọi lỗi gặp phải, kể cả lỗi bên trong policy set con
+}
+
+func (s *combineState) addError(id string, err error) {
+	s.errIDs = append(s.errIDs, id)
+	s.errs = append(s.errs, err)
+	s.reported = append(s.reported, err)
+}
+
+// addSet gộp quyết định của một policy set con như kết quả của một policy. Quyết định mặc định
+// của thuật toán (không có policy quyết định) được ghi nhận bằng ID của policy set.
+func (s *combineState) addSet(setID string, sub combineOutcome, errs []error) {
+	ids := sub.policyIDs
+	if len(ids) == 0 {
+		ids = []string{setID}
+	}
+	switch sub.effect {
+	case Permit:
+		s.allowIDs = append(s.allowIDs, ids...)
+	case Deny:
+		s.denyIDs = append(s.denyIDs, ids...)
+	case Indeterminate:
+		s.errIDs = append(s.errIDs, ids[0])
+		s.errs = append(s.errs, sub.err)
+	}
+	s.reported = append(s.reported, errs...)
+}
+
+// combineOutcome là quyết định cuối cùng; err khác nil nghĩa là request lỗi (Indeterminate).
+type combineOutcome struct {
+	effect    DecisionEffect
+	policyIDs []string
+	reason    string
+	err       error
+}
+
+// settled cho biết các policy đã đánh giá đủ để quyết định, khi đó các tầng priority
+// thấp hơn không cần đánh giá: có policy khớp, hoặc có lỗi mà thuật toán không bỏ qua lỗi.
+func (s *combineState) settled(alg CombiningAlgorithm) bool {
+	if len(s.allowIDs) > 0 || len(s.denyIDs) > 0 {
+		return true
+	}
+	return len(s.errs) > 0 && alg != DenyUnlessPermit && alg != PermitUnlessDeny
+}
+
+// decide áp dụng thuật toán lên kết quả đã gom.
+func (s *combineState) decide(alg CombiningAlgorithm) combineOutcome {
+	var allowID, denyID, errID string
+	if len(s.allowIDs) > 0 {
+		allowID = s.allowIDs[0]
+	}
+	if len(s.denyIDs) > 0 {
+		denyID = s.denyIDs[0]
+	}
+	if len(s.errs) > 0 {
+		errID = s.errIDs[0]
+	}
+	permit := func(reason string) combineOutcome {
+		return combineOutcome{effect: Permit, policyIDs: s.allowIDs, reason: reason}
+	}
+	deny := func(reason string) combineOutcome {
+		return combineOutcome{effect: Deny, policyIDs: s.denyIDs, reason: reason}
+	}
+	failed := func() combineOutcome {
+		return combineOutcome{
+			effect:    Indeterminate,
+			policyIDs: s.errIDs,
+			reason:    fmt.Sprintf("rule %s returned an error: %v", errID, s.errs[0]),
+			err:       s.errs[0],
+		}
+	}
+	// byDefault là kết quả mặc định của thuật toán, không có policy quyết định.
+	byDefault := func(effect DecisionEffect, reason string) combineOutcome {
+		return combineOutcome{effect: effect, reason: reason}
+	}
+	noMatch := func() string {
+		if s.applicable == 0 {
+			return fmt.Sprintf("no policy applies to tenant %s (default deny)", s.tenantID)
+		}
+		return "no allow rule matched (default deny)"
+	}
+
+	switch alg {
+	case PermitOverrides:
+		switch {
+		case allowID != "" && denyID != "":
+			return permit(fmt.Sprintf("allow rule %s overrode deny rule %s", allowID, denyID))
+		case allowID != "":
+			return permit(fmt.Sprintf("allow rule %s matched", allowID))
+		case errID != "":
+			return failed()
+		case denyID != "":
+			return deny(fmt.Sprintf("deny rule %s matched", denyID))
+		}
+	case FirstApplicable:
+		// Vòng đánh giá dừng ở policy khớp hoặc lỗi đầu tiên nên chỉ một trong ba được đặt.
+		switch {
+		case errID != "":
+			return failed()
+		case allowID != "":
+			return permit(fmt.Sprintf("first applicable rule %s allowed", allowID))
+		case denyID != "":
+			return deny(fmt.Sprintf("first applicable rule %s denied", denyID))
+		}
+	case DenyUnlessPermit:
+		switch {
+		case allowID != "":
+			return permit(fmt.Sprintf("allow rule %s matched", allowID))
+		case denyID != "":
+			return deny(fmt.Sprintf("deny rule %s matched", denyID))
+		case errID != "":
+			return byDefault(Deny, fmt.Sprintf("rule %s returned an error (ignored), no allow rule matched (default deny)", errID))
+		default:
+			return byDefault(Deny, noMatch())
+		}
+	case PermitUnlessDeny:
+		switch {
+		case denyID != "":
+			return deny(fmt.Sprintf("deny rule %s matched", denyID))
+		case allowID != "":
+			return permit(fmt.Sprintf("allow rule %s matched", allowID))
+		case errID != "":
+			return byDefault(Permit, fmt.Sprintf("rule %s returned an error (ignored), no deny rule matched (default permit)", errID))
+		default:
+			return byDefault(Permit, "no deny rule matched (default permit)")
+		}
+	default: // DenyOverrides
+		switch {
+		case denyID != "" && allowID != "":
+			return deny(fmt.Sprintf("deny rule %s overrode allow rule %s", denyID, allowID))
+		case denyID != "":
+			return deny(fmt.Sprintf("deny rule %s matched", denyID))
+		case errID != "":
+			return failed()
+		case allowID != "":
+			return permit(fmt.Sprintf("allow rule %s matched", allowID))
+		}
+	}
+	return byDefault(NotApplicable, noMatch())
+}
@@ -0,0 +1,221 @@
+package abac_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCombiningAlgorithms(t *testing.T) {
+	conflicting := `
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, tenant1, "Resource.department == 'engineering'", deny, deny_engineering`
+	noMatch := `
+p, *, "Action == 'read'", allow, allow_read`
+	failing := `
+p, *, "Resource.department > 5", allow, broken_rule
+p, *, "Action == 'read'", deny, deny_read`
+
+	cases := []struct {
+		name     string
+		alg      abac.CombiningAlgorithm
+		policies string
+		allowed  bool
+		wantErr  bool
+		deciding string
+	}{
+		{"deny-overrides conflict", abac.DenyOverrides, conflicting, false, false, "deny_engineering"},
+		{"permit-overrides conflict", abac.PermitOverrides, conflicting, true, false, "allow_approve"},
+		{"first-applicable conflict", abac.FirstApplicable, conflicting, true, false, "allow_approve"},
+		{"deny-unless-permit conflict", abac.DenyUnlessPermit, conflicting, true, false, "allow_approve"},
+		{"permit-unless-deny conflict", abac.PermitUnlessDeny, conflicting, false, false, "deny_engineering"},
+
+		{"deny-overrides no match", abac.DenyOverrides, noMatch, false, false, ""},
+		{"permit-unless-deny no match", abac.PermitUnlessDeny, noMatch, true, false, ""},
+		{"deny-unless-permit no match", abac.DenyUnlessPermit, noMatch, false, false, ""},
+
+		{"deny-overrides error", abac.DenyOverrides, failing, false, true, "broken_rule"},
+		{"permit-overrides error", abac.PermitOverrides, failing, false, true, "broken_rule"},
+		{"first-applicable error", abac.FirstApplicable, failing, false, true, "broken_rule"},
+		{"deny-unless-permit error", abac.DenyUnlessPermit, failing, false, false, ""},
+		{"permit-unless-deny error", abac.PermitUnlessDeny, failing, true, false, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockFetcher := &mocks.MockFetcher{}
+			authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, tc.policies, mockFetcher, mockFetcher, nil,
+				abac.WithCombiningAlgorithm(tc.alg))
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			allowed, trace, err := authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+			assert.Equal(t, tc.wantErr, err != nil, "error: %v", err)
+			assert.Equal(t, tc.allowed, allowed)
+			assert.Equal(t, tc.alg, trace.Algorithm)
+			assert.Equal(t, tc.deciding, trace.DecidingPolicyID)
+
+			// Check (không trace) cho cùng kết quả.
+			allowed, err = authorizer.Check(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+			assert.Equal(t, tc.wantErr, err != nil)
+			assert.Equal(t, tc.allowed, allowed)
+		})
+	}
+}
+
+func TestCombiningAlgorithms_FirstApplicableStopsAtFirstMatch(t *testing.T) {
+	policies := `
+p, tenant1, "Resource.department == 'engineering'", deny, deny_engineering
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, *, "Resource.department > 5", allow, broken_rule`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil,
+		abac.WithCombiningAlgorithm(abac.FirstApplicable))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	allowed, trace, err := authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	require.NoError(t, err, "the failing rule after the first match is never evaluated")
+	assert.False(t, allowed)
+	assert.Equal(t, "deny_engineering", trace.DecidingPolicyID)
+	assert.Len(t, trace.Policies, 1)
+}
+
+func TestCombiningAlgorithms_PerTenant(t *testing.T) {
+	policies := `
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, *, "Resource.department == 'engineering'", deny, deny_engineering`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, pm, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil,
+		abac.WithTenantCombiningAlgorithm("tenant2", abac.PermitOverrides),
+		abac.WithDecisionCache())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	check := func(tenantID string) bool {
+		allowed, err := authorizer.Check(&ctx, tenantID, "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+		require.NoError(t, err)
+		return allowed
+	}
+	assert.False(t, check("tenant1"))
+	assert.True(t, check("tenant2"))
+	assert.Equal(t, abac.DenyOverrides, pm.TenantCombiningAlgorithm("tenant1"))
+	assert.Equal(t, abac.PermitOverrides, pm.TenantCombiningAlgorithm("tenant2"))
+
+	// Đổi thuật toán lúc chạy không trả về quyết định cũ từ decision cache.
+	require.NoError(t, pm.SetTenantCombiningAlgorithm("tenant1", abac.PermitOverrides))
+	assert.True(t, check("tenant1"))
+	require.NoError(t, pm.SetTenantCombiningAlgorithm("tenant2", ""))
+	assert.False(t, check("tenant2"))
+
+	assert.ErrorIs(t, pm.SetTenantCombiningAlgorithm("tenant1", "most-specific"), abac.ErrUnknownCombiningAlgorithm)
+
+	// Cấu hình không được đồng bộ nên bị từ chối khi các instance dùng chung notifier.
+	sub, err := pm.UseChangeNotifier(abac.NewMemoryPolicyChangeNotifier())
+	require.NoError(t, err)
+	assert.ErrorIs(t, pm.SetTenantCombiningAlgorithm("tenant1", abac.DenyOverrides), abac.ErrProcessLocalSetting)
+	assert.Equal(t, abac.PermitOverrides, pm.TenantCombiningAlgorithm("tenant1"))
+	sub.Stop()
+	assert.NoError(t, pm.SetTenantCombiningAlgorithm("tenant1", abac.DenyOverrides))
+	_, _, err = abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil,
+		abac.WithCombiningAlgorithm("most-specific"))
+	assert.ErrorIs(t, err, abac.ErrUnknownCombiningAlgorithm)
+}
+
+func TestCombiningAlgorithms_PartialEvaluate(t *testing.T) {
+	policies := `
+p, *, "Resource.department == 'sales'", allow, allow_sales
+p, *, "Action == 'approve_level_2'", deny, deny_all`
+	salesOnly := &abac.Condition{Op: abac.CondEq, Field: "department", Value: "sales"}
+
+	cases := []struct {
+		alg  abac.CombiningAlgorithm
+		want *abac.Condition
+	}{
+		{abac.DenyOverrides, &abac.Condition{Op: abac.CondFalse}},
+		{abac.PermitOverrides, salesOnly},
+		{abac.FirstApplicable, salesOnly},
+		{abac.DenyUnlessPermit, salesOnly},
+		{abac.PermitUnlessDeny, &abac.Condition{Op: abac.CondFalse}},
+	}
+	for _, tc := range cases {
+		t.Run(string(tc.alg), func(t *testing.T) {
+			mockFetcher := &mocks.MockFetcher{}
+			authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil,
+				abac.WithCombiningAlgorithm(tc.alg))
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			cond, err := authorizer.PartialEvaluate(&ctx, "tenant1", "t1_hr_manager", "approve_level_2", nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want.String(), cond.String())
+		})
+	}
+}
+
+var priorityTestModel = strings.Replace(traceTestModel, "p = tenant, rule, eft, id", "p = tenant, rule, eft, id, priority", 1)
+
+func TestCombiningAlgorithms_Priorities(t *testing.T) {
+	// Deny chung được thêm trước, allow của tenant có priority cao hơn.
+	policies := `
+p, *, "Action == 'approve_level_2'", deny, generic_deny, 0
+p, *, "Resource.department > 5", allow, broken_rule, -1
+p, tenant1, "Resource.department == 'engineering'", allow, tenant_allow, 10`
+
+	for _, alg := range []abac.CombiningAlgorithm{abac.DenyOverrides, abac.FirstApplicable, abac.PermitUnlessDeny} {
+		t.Run(string(alg), func(t *testing.T) {
+			mockFetcher := &mocks.MockFetcher{}
+			authorizer, _, err := abac.NewABACSystemFromStrings(priorityTestModel, policies, mockFetcher, mockFetcher, nil,
+				abac.WithCombiningAlgorithm(alg))
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			allowed, trace, err := authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+			require.NoError(t, err, "lower-priority rules are not evaluated once a higher tier decided")
+			assert.True(t, allowed)
+			assert.Equal(t, "tenant_allow", trace.DecidingPolicyID)
+			require.NotEmpty(t, trace.Policies)
+			assert.Equal(t, "tenant_allow", trace.Policies[0].PolicyID)
+			assert.Equal(t, 10, trace.Policies[0].Priority)
+
+			// Tenant khác không có policy priority 10: tầng 0 quyết định.
+			allowed, err = authorizer.Check(&ctx, "tenant2", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+			require.NoError(t, err)
+			assert.False(t, allowed)
+		})
+	}
+
+	t.Run("skipped tiers are traced", func(t *testing.T) {
+		mockFetcher := &mocks.MockFetcher{}
+		authorizer, _, err := abac.NewABACSystemFromStrings(priorityTestModel, policies, mockFetcher, mockFetcher, nil)
+		require.NoError(t, err)
+		ctx := context.Background()
+
+		_, trace, err := authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+		require.NoError(t, err)
+		require.Len(t, trace.Policies, 3)
+		for _, pe := range trace.Policies[1:] {
+			assert.True(t, pe.Skipped)
+			assert.Equal(t, "lower priority", pe.SkipReason)
+		}
+	})
+}
+
+func TestCombiningAlgorithms_PartialEvaluateWithPriorities(t *testing.T) {
+	policies := `
+p, *, "Action == 'approve_level_2'", deny, deny_all, 0
+p, *, "Resource.department == 'sales'", allow, allow_sales, 5`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(priorityTestModel, policies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	cond, err := authorizer.PartialEvaluate(&ctx, "tenant1", "t1_hr_manager", "approve_level_2", nil)
+	require.NoError(t, err)
+	want := &abac.Condition{Op: abac.CondEq, Field: "department", Value: "sales"}
+	assert.Equal(t, want.String(), cond.String())
+}
@@ -0,0 +1,187 @@
+package abac
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// DecisionEffect là kết quả bốn giá trị của Decide.
+type DecisionEffect string
+
+const (
+	// Permit: request được phép.
+	Permit DecisionEffect = "permit"
+	// Deny: request bị từ chối bởi một policy deny, hoặc bởi mặc định của thuật toán
+	// DenyUnlessPermit.
+	Deny DecisionEffect = "deny"
+	// NotApplicable: không policy nào khớp với request (Check coi là từ chối).
+	NotApplicable DecisionEffect = "not_applicable"
+	// Indeterminate: không thể quyết định do lỗi khi lấy thuộc tính hoặc đánh giá rule.
+	Indeterminate DecisionEffect = "indeterminate"
+)
+
+// Decision là quyết định đầy đủ trả về bởi Authorizer.Decide.
+type Decision struct {
+	Effect    DecisionEffect     `json:"effect"`
+	Algorithm CombiningAlgorithm `json:"algorithm,omitempty"`
+	// PolicyIDs là các policy quyết định kết quả: các allow khớp với Permit, các deny khớp
+	// với Deny, các rule lỗi với Indeterminate. Rỗng khi kết quả là mặc định của thuật toán.
+	PolicyIDs []string `json:"policy_ids,omitempty"`
+	Reason    string   `json:"reason,omitempty"`
+	// Obligations là các obligation bắt buộc của policy quyết định (chỉ với Permit/Deny), PEP
+	// phải thực hiện (xem Authorizer.Fulfill); Advice là các advice, có thể bỏ qua.
+	Obligations []Obligation `json:"obligations,omitempty"`
+	Advice      []Obligation `json:"advice,omitempty"`
+	// Errors là mọi lỗi gặp phải, kể cả lỗi bị thuật toán bỏ qua (DenyUnlessPermit, PermitUnlessDeny).
+	Errors []error `json:"-"`
+
+	err error // lỗi khiến quyết định là Indeterminate
+}
+
+// Allowed trả về true nếu quyết định là Permit.
+func (d Decision) Allowed() bool {
+	return d.Effect == Permit
+}
+
+// permitsWithoutObligations trả về true nếu quyết định là Permit không kèm obligation bắt buộc.
+// Các API dạng bool (Check, AllowedActions, SubjectsAllowed) dùng hàm này vì người gọi không thực
+// hiện được obligation; policy có obligation phải dùng Decide + Fulfill.
+func (d Decision) permitsWithoutObligations() bool {
+	return d.Effect == Permit && len(d.Obligations) == 0
+}
+
+// Err trả về lỗi khiến quyết định là Indeterminate (nil với các quyết định khác),
+// chính là lỗi mà Check trả về.
+func (d Decision) Err() error {
+	return d.err
+}
+
+// clone trả về bản sao có các slice riêng, để người gọi sửa quyết định mà không làm hỏng
+// bản nằm trong decision cache.
+func (d Decision) clone() Decision {
+	d.PolicyIDs = slices.Clone(d.PolicyIDs)
+	d.Obligations = slices.Clone(d.Obligations)
+	d.Advice = slices.Clone(d.Advice)
+	d.Errors = slices.Clone(d.Errors)
+	return d
+}
+
+func indeterminate(err error) Decision {
+	return Decision{Effect: Indeterminate, Reason: err.Error(), Errors: []error{err}, err: err}
+}
+
+// Decide giống Check nhưng trả về quyết định bốn giá trị (Permit, Deny, NotApplicable,
+// Indeterminate) kèm policy quyết định và các lỗi, để phân biệt "bị từ chối" (403) với
+// "không quyết định được" (500) và "không có policy nào áp dụng".
+// Với nhiều resource, mọi resource phải Permit; quyết định của resource đầu tiên không Permit
+// được trả về.
+func (a *Authorizer) Decide(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrsInput *Attributes) Decision {
+	subAttrs, err := a.subjectFetcher.GetSubjectAttributes(ctx, subject)
+	if err != nil {
+		return indeterminate(fmt.Errorf("subject attributes error: %w", err))
+	}
+
+	envAttrs := make(Attributes)
+	if envAttrsInput != nil {
+		envAttrs = *envAttrsInput
+	}
+
+	listResAttrs, err := a.resourceFetcher.GetResourceAttributes(ctx, resource)
+	if err != nil {
+		return indeterminate(fmt.Errorf("resource attributes error: %w", err))
+	}
+	return a.decideResources(tenantID, subAttrs, listResAttrs, action, envAttrs, nil)
+}
+
+// DecideWithTrace giống Decide nhưng trả về thêm DecisionTrace của chính lần đánh giá đó (không
+// đánh giá lại như khi gọi Decide rồi CheckWithTrace). Request có trace không dùng decision cache.
+func (a *Authorizer) DecideWithTrace(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrsInput *Attributes, opts ...TraceOption) (Decision, *DecisionTrace) {
+	start := time.Now()
+	collector, trace, cfg := newTraceCollector(opts...)
+	finish := func(d Decision) (Decision, *DecisionTrace) {
+		if err := d.Err(); err != nil {
+			trace.Error = err.Error()
+		}
+		trace.EvaluationMs = time.Since(start).Milliseconds()
+		return d, trace
+	}
+
+	subAttrs, err := a.subjectFetcher.GetSubjectAttributes(ctx, subject)
+	if err != nil {
+		return finish(indeterminate(fmt.Errorf("subject attributes error: %w", err)))
+	}
+	envAttrs := make(Attributes)
+	if envAttrsInput != nil {
+		envAttrs = *envAttrsInput
+	}
+	listResAttrs, err := a.resourceFetcher.GetResourceAttributes(ctx, resource)
+	if err != nil {
+		return finish(indeterminate(fmt.Errorf("resource attributes error: %w", err)))
+	}
+	if cfg.enableAttributeTracing {
+		for k, v := range subAttrs {
+			collector.OnAttributeRead("subject", k, v)
+		}
+		for k, v := range envAttrs {
+			collector.OnAttributeRead("env", k, v)
+		}
+	}
+	return finish(a.decideResources(tenantID, subAttrs, listResAttrs, action, envAttrs, collector))
+}
+
+// decideResources quyết định cho từng resource trong danh sách (rỗng nghĩa là một resource
+// không có thuộc tính) và gộp kết quả như mô tả ở Decide. collector khác nil thì mỗi request
+// được ghi vào trace của nó.
+func (a *Authorizer) decideResources(tenantID string, subAttrs Attributes, listResAttrs []Attributes, action string, envAttrs Attributes, collector *traceCollector) Decision {
+	if len(listResAttrs) == 0 {
+		listResAttrs = []Attributes{{}}
+	}
+
+	var result Decision
+	for i, resAttrs := range listResAttrs {
+		req := &AuthorizationRequest{
+			Subject:  subAttrs,
+			Resource: resAttrs,
+			Action:   action,
+			Env:      envAttrs,
+		}
+		if collector != nil {
+			if collector.cfg.enableAttributeTracing {
+				for k, v := range resAttrs {
+					collector.OnAttributeRead("resource", k, v)
+				}
+			}
+			req.Trace, req.TraceCfg, req.resourceIndex = collector, collector.cfg, i
+			collector.trace.requests = append(collector.trace.requests, req)
+		}
+		d := a.engine.decide(tenantID, req)
+		if d.Effect != Permit {
+			return d
+		}
+		if i == 0 {
+			result = d
+			continue
+		}
+		for _, id := range d.PolicyIDs {
+			if !slices.Contains(result.PolicyIDs, id) {
+				result.PolicyIDs = append(result.PolicyIDs, id)
+			}
+		}
+		result.Errors = append(result.Errors, d.Errors...)
+		result.Obligations = appendObligations(result.Obligations, d.Obligations)
+		result.Advice = appendObligations(result.Advice, d.Advice)
+	}
+	return result
+}
+
+// appendObligations gộp obligation của nhiều resource, bỏ các mục trùng.
+func appendObligations(list, more []Obligation) []Obligation {
+	for _, ob := range more {
+		if !slices.Contains(list, ob) {
+			list = append(list, ob)
+		}
+	}
+	return list
+}
@@ -0,0 +1,98 @@
+package abac
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+)
+
+// WithCacheEnvKeys chỉ đưa các khóa Env này vào khóa của decision cache
+// (mặc định: mọi khóa Env). Không có tác dụng với cache thuộc tính.
+func WithCacheEnvKeys(keys ...string) CacheOption {
+	return cacheOptFunc(func(c *cacheConfig) {
+		c.envInclude = toSet(keys)
+	})
+}
+
+// WithCacheExcludedEnvKeys bỏ các khóa Env này khỏi khóa của decision cache, ví dụ
+// các giá trị thay đổi theo từng request nhưng không được rule nào dùng tới (request_id...).
+// Không có tác dụng với cache thuộc tính.
+func WithCacheExcludedEnvKeys(keys ...string) CacheOption {
+	return cacheOptFunc(func(c *cacheConfig) {
+		c.envExclude = toSet(keys)
+	})
+}
+
+func toSet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+// decisionCache lưu quyết định cuối cùng theo (phiên bản policy, tenant, subject, resource, action, env).
+type decisionCache struct {
+	cache   *ttlCache[Decision]
+	version atomic.Uint64
+}
+
+func newDecisionCache(opts []CacheOption) *decisionCache {
+	return &decisionCache{cache: newTTLCache[Decision](newCacheConfig(opts), nil)}
+}
+
+// key tạo khóa cache từ request; ok = false nếu thuộc tính không thể mã hóa (khi đó không dùng cache).
+// Phiên bản policy nằm trong khóa nên kết quả đánh giá trên snapshot cũ không bao giờ được dùng lại.
+func (d *decisionCache) key(version uint64, tenantID string, req *AuthorizationRequest) (string, bool) {
+	env := req.Env
+	if d.cache.cfg.envInclude != nil || d.cache.cfg.envExclude != nil {
+		env = make(Attributes, len(req.Env))
+		for k, v := range req.Env {
+			if d.cache.cfg.envInclude != nil && !d.cache.cfg.envInclude[k] {
+				continue
+			}
+			if d.cache.cfg.envExclude[k] {
+				continue
+			}
+			env[k] = v
+		}
+	}
+	// encoding/json sắp xếp khóa của map nên kết quả mã hóa ổn định.
+	payload, err := json.Marshal([]interface{}{tenantID, req.Action, req.Subject, req.Resource, env})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(payload)
+	return strconv.FormatUint(version, 10) + ":" + hex.EncodeToString(sum[:]), true
+}
+
+func (d *decisionCache) get(key string, evaluate func() (Decision, error)) (Decision, error) {
+	return d.cache.get(context.Background(), key, func(context.Context) (Decision, error) {
+		return evaluate()
+	})
+}
+
+// flush xóa toàn bộ quyết định khi policy chuyển sang phiên bản mới.
+func (d *decisionCache) flush(version uint64) {
+	if d == nil {
+		return
+	}
+	if d.version.Swap(version) != version {
+		d.cache.invalidateAll()
+	}
+}
+
+func (d *decisionCache) stats() CacheStats {
+	if d == nil {
+		return CacheStats{}
+	}
+	return d.cache.stats()
+}
+
+// DecisionCacheStats trả về số liệu hit/miss của decision cache (rỗng nếu không bật WithDecisionCache).
+func (a *Authorizer) DecisionCacheStats() CacheStats {
+	return a.engine.decisions.stats()
+}
@@ -0,0 +1,95 @@
+package abac_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDecisionCacheSystem(t *testing.T, policies string, opts ...abac.CacheOption) (*abac.Authorizer, *abac.PolicyManager, *atomic.Int32) {
+	t.Helper()
+	var evaluations atomic.Int32
+	functions := abac.CustomFunctionMap{
+		"counted": func(args ...interface{}) (interface{}, error) {
+			evaluations.Add(1)
+			return true, nil
+		},
+	}
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, pm, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, functions,
+		abac.WithDecisionCache(opts...))
+	require.NoError(t, err)
+	return authorizer, pm, &evaluations
+}
+
+func TestDecisionCache_HitsAndPolicyFlush(t *testing.T) {
+	authorizer, pm, evaluations := newDecisionCacheSystem(t,
+		`p, *, "counted() && Resource.department == 'hr'", allow, hr_only`)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		allowed, err := authorizer.Check(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", "read", nil)
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	assert.Equal(t, int32(1), evaluations.Load())
+	stats := authorizer.DecisionCacheStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+
+	// Thuộc tính khác => khóa khác.
+	allowed, err := authorizer.Check(&ctx, "tenant2", "t2_hr_manager", "t2_sales_request", "read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, int32(2), evaluations.Load())
+
+	// Thay đổi policy => cache bị xóa và quyết định mới được áp dụng ngay.
+	_, err = pm.AddPolicy([]string{"*", "Resource.department == 'hr'", "deny", "deny_hr"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, authorizer.DecisionCacheStats().Entries)
+	allowed, err = authorizer.Check(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", "read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, int32(3), evaluations.Load())
+
+	// CheckWithTrace không dùng cache.
+	_, trace, err := authorizer.CheckWithTrace(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", "read", nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, trace.Policies)
+	assert.Equal(t, int32(4), evaluations.Load())
+}
+
+func TestDecisionCache_EnvKeys(t *testing.T) {
+	policy := `p, *, "counted() && Env.hour >= 8", allow, office_hours`
+	ctx := context.Background()
+	check := func(authorizer *abac.Authorizer, env abac.Attributes) bool {
+		allowed, err := authorizer.Check(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "read", &env)
+		require.NoError(t, err)
+		return allowed
+	}
+
+	// Mặc định: mọi khóa Env nằm trong khóa cache.
+	authorizer, _, evaluations := newDecisionCacheSystem(t, policy)
+	assert.True(t, check(authorizer, abac.Attributes{"hour": 9, "request_id": "a"}))
+	assert.True(t, check(authorizer, abac.Attributes{"hour": 9, "request_id": "b"}))
+	assert.False(t, check(authorizer, abac.Attributes{"hour": 7, "request_id": "c"}))
+	assert.Equal(t, int32(3), evaluations.Load())
+
+	// Bỏ request_id khỏi khóa: hai request đầu dùng chung kết quả, hour vẫn được tính.
+	authorizer, _, evaluations = newDecisionCacheSystem(t, policy, abac.WithCacheExcludedEnvKeys("request_id"))
+	assert.True(t, check(authorizer, abac.Attributes{"hour": 9, "request_id": "a"}))
+	assert.True(t, check(authorizer, abac.Attributes{"hour": 9, "request_id": "b"}))
+	assert.False(t, check(authorizer, abac.Attributes{"hour": 7, "request_id": "c"}))
+	assert.Equal(t, int32(2), evaluations.Load())
+
+	// Chỉ đưa hour vào khóa.
+	authorizer, _, evaluations = newDecisionCacheSystem(t, policy, abac.WithCacheEnvKeys("hour"))
+	assert.True(t, check(authorizer, abac.Attributes{"hour": 9, "ip_address": "10.0.0.1"}))
+	assert.True(t, check(authorizer, abac.Attributes{"hour": 9, "ip_address": "10.0.0.2"}))
+	assert.Equal(t, int32(1), evaluations.Load())
+}
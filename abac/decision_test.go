@@ -0,0 +1,192 @@
+package abac_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizer_Decide(t *testing.T) {
+	cases := []struct {
+		name      string
+		alg       abac.CombiningAlgorithm
+		policies  string
+		effect    abac.DecisionEffect
+		policyIDs []string
+		errors    int
+		wantErr   bool
+	}{
+		{
+			name: "permit",
+			policies: `
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, tenant1, "Resource.department == 'engineering'", allow, allow_engineering`,
+			effect:    abac.Permit,
+			policyIDs: []string{"allow_approve", "allow_engineering"},
+		},
+		{
+			name: "explicit deny",
+			policies: `
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, tenant1, "Resource.department == 'engineering'", deny, deny_engineering`,
+			effect:    abac.Deny,
+			policyIDs: []string{"deny_engineering"},
+		},
+		{
+			name:     "not applicable",
+			policies: `p, *, "Action == 'read'", allow, allow_read`,
+			effect:   abac.NotApplicable,
+		},
+		{
+			name: "indeterminate",
+			policies: `
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, *, "Resource.department > 5", deny, broken_rule`,
+			effect:    abac.Indeterminate,
+			policyIDs: []string{"broken_rule"},
+			errors:    1,
+			wantErr:   true,
+		},
+		{
+			name: "deny overrides rule errors",
+			policies: `
+p, *, "Resource.department > 5", allow, broken_rule
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, tenant1, "Resource.department == 'engineering'", deny, deny_engineering`,
+			effect:    abac.Deny,
+			policyIDs: []string{"deny_engineering"},
+			errors:    1,
+		},
+		{
+			name:     "deny-unless-permit has no not applicable",
+			alg:      abac.DenyUnlessPermit,
+			policies: `p, *, "Action == 'read'", allow, allow_read`,
+			effect:   abac.Deny,
+		},
+		{
+			name: "ignored errors are still reported",
+			alg:  abac.PermitUnlessDeny,
+			policies: `
+p, *, "Resource.department > 5", deny, broken_rule`,
+			effect: abac.Permit,
+			errors: 1,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts []abac.SystemOption
+			if tc.alg != "" {
+				opts = append(opts, abac.WithCombiningAlgorithm(tc.alg))
+			}
+			mockFetcher := &mocks.MockFetcher{}
+			authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, tc.policies, mockFetcher, mockFetcher, nil, opts...)
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			d := authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+			assert.Equal(t, tc.effect, d.Effect)
+			assert.Equal(t, tc.policyIDs, d.PolicyIDs)
+			assert.Len(t, d.Errors, tc.errors)
+			assert.Equal(t, tc.wantErr, d.Err() != nil)
+			assert.NotEmpty(t, d.Reason)
+
+			// Check là lớp bọc của Decide.
+			allowed, err := authorizer.Check(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+			assert.Equal(t, d.Allowed(), allowed)
+			assert.Equal(t, d.Err(), err)
+
+			_, trace, _ := authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+			assert.Equal(t, tc.effect, trace.Effect)
+
+			// DecideWithTrace trả về cùng quyết định và trace của chính lần đánh giá đó.
+			traced, trace := authorizer.DecideWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+			assert.Equal(t, d.Effect, traced.Effect)
+			assert.Equal(t, d.PolicyIDs, traced.PolicyIDs)
+			require.NotNil(t, trace)
+			assert.Equal(t, tc.effect, trace.Effect)
+			assert.NotEmpty(t, trace.Policies)
+		})
+	}
+}
+
+func TestAuthorizer_DecideWithTrace(t *testing.T) {
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, `p, *, "Action == 'read' && Resource.department == 'hr'", allow, allow_hr_read`,
+		mockFetcher, mockFetcher, nil, abac.WithDecisionCache())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	d, trace := authorizer.DecideWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "read", nil, abac.WithAttributeTracing(true))
+	assert.Equal(t, abac.NotApplicable, d.Effect)
+	assert.NotEmpty(t, trace.AttributesEvaluated)
+	explanation, err := authorizer.Explain(trace)
+	require.NoError(t, err)
+	assert.Contains(t, explanation.String(), "allow_hr_read")
+	// Request có trace không đi qua decision cache.
+	assert.Zero(t, authorizer.DecisionCacheStats().Misses)
+
+	d, trace = authorizer.DecideWithTrace(&ctx, "tenant1", "unknown_user", "t1_eng_request", "read", nil)
+	assert.Equal(t, abac.Indeterminate, d.Effect)
+	assert.ErrorIs(t, d.Err(), abac.ErrSubjectNotFound)
+	assert.Contains(t, trace.Error, "subject attributes error")
+}
+
+func TestAuthorizer_Decide_AttributeErrors(t *testing.T) {
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, `p, *, "Action == 'read'", allow, allow_read`, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	d := authorizer.Decide(&ctx, "tenant1", "unknown_user", "t1_eng_request", "read", nil)
+	assert.Equal(t, abac.Indeterminate, d.Effect)
+	assert.ErrorIs(t, d.Err(), abac.ErrSubjectNotFound)
+
+	d = authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "missing_request", "read", nil)
+	assert.Equal(t, abac.Indeterminate, d.Effect)
+	assert.ErrorIs(t, d.Err(), abac.ErrResourceNotFound)
+}
+
+func TestAuthorizer_Decide_UsesDecisionCache(t *testing.T) {
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, `p, *, "Action == 'read'", allow, allow_read`, mockFetcher, mockFetcher, nil,
+		abac.WithDecisionCache())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	first := authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "read", nil)
+	second := authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "read", nil)
+	assert.Equal(t, abac.Permit, first.Effect)
+	assert.Equal(t, first.PolicyIDs, second.PolicyIDs)
+	assert.Equal(t, uint64(1), authorizer.DecisionCacheStats().Hits)
+}
+
+func TestAuthorizer_Decide_CachedDecisionsAreCopied(t *testing.T) {
+	policies := `
+p, *, "Action == 'approve_level_2'", allow, allow_approve
+p, tenant1, "Resource.department == 'engineering'", deny, deny_engineering`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil,
+		abac.WithDecisionCache())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for _, tenantID := range []string{"tenant1", "tenant2"} { // Deny, Permit
+		first := authorizer.Decide(&ctx, tenantID, "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+		require.NotEmpty(t, first.PolicyIDs)
+		want := slices.Clone(first.PolicyIDs)
+		first.PolicyIDs[0] = "mutated"
+
+		second := authorizer.Decide(&ctx, tenantID, "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+		assert.Equal(t, want, second.PolicyIDs, tenantID)
+		second.PolicyIDs[0] = "mutated"
+
+		third := authorizer.Decide(&ctx, tenantID, "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+		assert.Equal(t, want, third.PolicyIDs, tenantID)
+	}
+	assert.Equal(t, uint64(4), authorizer.DecisionCacheStats().Hits)
+}
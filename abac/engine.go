@@ -0,0 +1,435 @@
+package abac
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// policyEntry là một policy đã được biên dịch sẵn trong snapshot.
+type policyEntry struct {
+	Policy
+	ruleID     string
+	compiled   *compiledRule
+	compileErr error
+
+	obligations []Obligation
+	advice      []Obligation
+
+	// Cây biểu thức của rule, chỉ được dựng khi cần (Explain, PartialEvaluate...).
+	astOnce sync.Once
+	ast     *ruleAST
+	astErr  error
+}
+
+// policySnapshot là tập policy bất biến tại một thời điểm. Mỗi lần policy thay đổi
+// một snapshot mới được dựng và hoán đổi nguyên tử, các request đang chạy vẫn dùng snapshot cũ.
+type policySnapshot struct {
+	version   uint64 // tăng sau mỗi lần reload
+	layout    policyLayout
+	policies  []*policyEntry // theo priority giảm dần, cùng priority giữ thứ tự của enforcer
+	byID      map[string]*policyEntry
+	combining *combiningSettings
+
+	sets      []PolicySet  // định nghĩa policy set, theo thứ tự tạo
+	root      []policyNode // policy và policy set cấp cao nhất, theo priority giảm dần
+	rootIndex *targetIndex // nil nếu không policy nào ở cấp cao nhất có ràng buộc
+}
+
+// policyEngine đánh giá các policy của enforcer bằng các rule đã biên dịch,
+// thay cho việc gọi enforcer.Enforce trên từng request.
+type policyEngine struct {
+	evaluator *expressionEvaluator
+	snapshot  atomic.Pointer[policySnapshot]
+	versions  atomic.Uint64
+	decisions *decisionCache // nil nếu không bật WithDecisionCache
+
+	obligations *obligationRegistry
+
+	targetIndex     bool                      // dùng target index với request không trace
+	indexCrossCheck func(TargetIndexMismatch) // nil nếu không bật WithTargetIndexCrossCheck
+}
+
+// supportedMatchers là các matcher mà engine cài đặt lại: bộ lọc tenant (appliesTo, có thể
+// bỏ nếu model không có trường tenant) và evaluate trên rule. supportedEffect là policy_effect
+// tương ứng với thuật toán mặc định DenyOverrides.
+var supportedMatchers = []string{
+	"(r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)",
+	"(r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req)",
+	"evaluate(p.rule, r.req, p.id)",
+	"evaluate(p.rule, r.req)",
+}
+
+const supportedEffect = "some(where (p.eft == allow)) && !some(where (p.eft == deny))"
+
+// checkModel trả về ErrUnsupportedModel nếu matcher hoặc policy_effect của model khác với
+// cách engine đánh giá policy, thay vì âm thầm bỏ qua chúng.
+func checkModel(e *casbin.Enforcer) error {
+	m := e.GetModel()
+	matcher, effect := "", ""
+	if a, ok := m["m"]["m"]; ok {
+		matcher = a.Value
+	}
+	if a, ok := m["e"]["e"]; ok {
+		effect = a.Value
+	}
+	supported := false
+	for _, s := range supportedMatchers {
+		if normalizeModelExpr(s) == normalizeModelExpr(matcher) {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("%w: matcher %q is not supported, use %q", ErrUnsupportedModel, matcher, supportedMatchers[0])
+	}
+	if normalizeModelExpr(effect) != normalizeModelExpr(supportedEffect) {
+		return fmt.Errorf("%w: policy_effect %q is not supported, use %q and select other algorithms with WithCombiningAlgorithm",
+			ErrUnsupportedModel, effect, supportedEffect)
+	}
+	return nil
+}
+
+// normalizeModelExpr bỏ khoảng trắng và đưa "r."/"p." về dạng "r_"/"p_" mà casbin lưu trong model.
+func normalizeModelExpr(s string) string {
+	s = strings.Join(strings.Fields(s), "")
+	return strings.NewReplacer("r.", "r_", "p.", "p_").Replace(s)
+}
+
+func newPolicyEngine(evaluator *expressionEvaluator) *policyEngine {
+	en := &policyEngine{evaluator: evaluator, obligations: newObligationRegistry(nil), targetIndex: true}
+	en.snapshot.Store(&policySnapshot{byID: map[string]*policyEntry{}})
+	return en
+}
+
+// reload đồng bộ cache rule và dựng lại snapshot từ policy hiện có trong enforcer.
+func (en *policyEngine) reload(e *casbin.Enforcer) {
+	if en == nil {
+		return
+	}
+	prev := en.current()
+	en.evaluator.syncRules(e, prev.targets()...)
+
+	layout := layoutOf(e)
+	snap := &policySnapshot{
+		version:   en.versions.Add(1),
+		layout:    layout,
+		byID:      make(map[string]*policyEntry),
+		combining: prev.combining,
+		sets:      prev.sets,
+	}
+	if assertion, ok := e.GetModel()["p"]["p"]; ok && layout.rule >= 0 {
+		snap.policies = make([]*policyEntry, 0, len(assertion.Policy))
+		for _, row := range assertion.Policy {
+			entry := &policyEntry{Policy: layout.toPolicy(row)}
+			entry.ruleID = ruleIDOf(entry.Rule)
+			entry.compiled, entry.compileErr = en.evaluator.rules.get(entry.Rule)
+			if obligations, advice, err := parseObligations(entry.Obligations); err != nil && entry.compileErr == nil {
+				entry.compileErr = fmt.Errorf("evaluate: policy %s: %w", entry.ID, err)
+			} else {
+				entry.obligations, entry.advice = withPolicyID(obligations, entry.ID), withPolicyID(advice, entry.ID)
+			}
+			snap.policies = append(snap.policies, entry)
+			if _, exists := snap.byID[entry.ID]; !exists {
+				snap.byID[entry.ID] = entry
+			}
+		}
+		sort.SliceStable(snap.policies, func(i, j int) bool {
+			return snap.policies[i].Priority > snap.policies[j].Priority
+		})
+	}
+	snap.root, snap.rootIndex = en.buildPolicyTree(snap.policies, snap.sets)
+	en.snapshot.Store(snap)
+	en.decisions.flush(snap.version)
+}
+
+// setCombining đổi thuật toán kết hợp bằng một snapshot mới (cùng tập policy, version mới)
+// để decision cache không trả về quyết định theo thuật toán cũ.
+func (en *policyEngine) setCombining(settings *combiningSettings) {
+	next := *en.current()
+	next.version = en.versions.Add(1)
+	next.combining = settings
+	en.snapshot.Store(&next)
+	en.decisions.flush(next.version)
+}
+
+func (en *policyEngine) current() *policySnapshot {
+	return en.snapshot.Load()
+}
+
+// syntax trả về cây biểu thức của rule, dựng một lần cho mỗi policy trong snapshot.
+func (p *policyEntry) syntax(functions CustomFunctionMap) (*ruleAST, error) {
+	p.astOnce.Do(func() {
+		if p.compileErr != nil {
+			p.astErr = p.compileErr
+			return
+		}
+		p.ast, p.astErr = parseRuleAST(p.Rule, functions)
+	})
+	return p.ast, p.astErr
+}
+
+// appliesTo áp dụng bộ lọc tenant của matcher: (r.tenant == p.tenant || p.tenant == '*').
+func (p *policyEntry) appliesTo(tenantID string) bool {
+	return p.TenantID == tenantID || p.TenantID == "*"
+}
+
+// evaluate đánh giá rule của policy với request, báo kết quả về TraceObserver nếu có.
+func (p *policyEntry) evaluate(req *AuthorizationRequest) (bool, error) {
+	if p.compileErr != nil {
+		return false, p.compileErr
+	}
+	var observer TraceObserver
+	if req.Trace != nil && req.TraceCfg != nil && req.TraceCfg.enablePredicateTracing {
+		observer = req.Trace
+	}
+	result, err := p.compiled.evaluate(requestParameters(req), observer)
+	if err != nil {
+		return false, fmt.Errorf("evaluate: lỗi khi đánh giá rule '%s': %w", p.Rule, err)
+	}
+	matched, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("evaluate: rule '%s' phải trả về bool, nhận được %T", p.Rule, result)
+	}
+	if req.Trace != nil {
+		req.Trace.OnRuleEvaluated(p.ID, p.ruleID, matched)
+	}
+	return matched, nil
+}
+
+// decide trả về quyết định cho request trên snapshot hiện tại, dùng decision cache nếu được bật.
+// Quyết định Indeterminate không được cache; quyết định lấy từ cache được sao chép (mọi effect)
+// để người gọi không sửa được bản trong cache.
+func (en *policyEngine) decide(tenantID string, req *AuthorizationRequest) Decision {
+	snap := en.current()
+	// Request có trace luôn được đánh giá đầy đủ để trace không bị thiếu.
+	if en.decisions != nil && req.Trace == nil {
+		if key, ok := en.decisions.key(snap.version, tenantID, req); ok {
+			d, _ := en.decisions.get(key, func() (Decision, error) {
+				d := en.combine(snap, tenantID, req)
+				return d, d.err
+			})
+			return en.checkObligations(d.clone(), req)
+		}
+	}
+	return en.checkObligations(en.combine(snap, tenantID, req), req)
+}
+
+// checkObligations chuyển Permit thành Deny nếu có obligation bắt buộc chưa đăng ký handler.
+// Bước này nằm sau decision cache vì handler có thể được đăng ký lúc đang chạy.
+func (en *policyEngine) checkObligations(d Decision, req *AuthorizationRequest) Decision {
+	if d.Effect != Permit {
+		return d
+	}
+	ob, missing := en.obligations.unhandled(d.Obligations)
+	if !missing {
+		return d
+	}
+	denied := Decision{
+		Effect:    Deny,
+		Algorithm: d.Algorithm,
+		PolicyIDs: d.PolicyIDs,
+		Reason:    fmt.Sprintf("obligation %s of policy %s has no registered handler", ob, ob.PolicyID),
+		Errors:    d.Errors,
+	}
+	if tracer, ok := req.Trace.(PolicyTraceObserver); ok {
+		tracer.OnDecision(CombiningResult{
+			Algorithm: d.Algorithm,
+			Decision:  decisionString(false),
+			Effect:    Deny,
+			Reason:    denied.Reason,
+			PolicyID:  ob.PolicyID,
+		})
+	}
+	return denied
+}
+
+// enforce trả về quyết định dạng (allowed, lỗi) như Check: Permit kèm obligation bắt buộc là từ chối.
+func (en *policyEngine) enforce(tenantID string, req *AuthorizationRequest) (bool, error) {
+	d := en.decide(tenantID, req)
+	return d.permitsWithoutObligations(), d.err
+}
+
+// combine đánh giá các policy áp dụng cho tenant và kết hợp kết quả theo thuật toán của tenant
+// (mặc định deny-overrides, tương đương policy_effect: some(allow) && !some(deny)).
+// Request không trace dùng target index để bỏ qua các rule chắc chắn không khớp.
+func (en *policyEngine) combine(snap *policySnapshot, tenantID string, req *AuthorizationRequest) Decision {
+	indexed := en.targetIndex && req.Trace == nil
+	d := combineSnapshot(snap, tenantID, req, indexed)
+	if indexed && en.indexCrossCheck != nil {
+		if full := combineSnapshot(snap, tenantID, req, false); !sameDecision(d, full) {
+			en.indexCrossCheck(TargetIndexMismatch{TenantID: tenantID, Request: req, Indexed: d, Full: full})
+			return full
+		}
+	}
+	return d
+}
+
+func combineSnapshot(snap *policySnapshot, tenantID string, req *AuthorizationRequest, indexed bool) Decision {
+	tracer, _ := req.Trace.(PolicyTraceObserver)
+	alg := snap.combining.forTenant(tenantID)
+
+	run := &combineRun{tenantID: tenantID, req: req, tracer: tracer, indexed: indexed}
+	outcome, errs := combineNodes(snap.root, snap.rootIndex, alg, run)
+	if tracer != nil {
+		result := CombiningResult{
+			Algorithm: alg,
+			Decision:  decisionString(outcome.effect == Permit),
+			Effect:    outcome.effect,
+			Reason:    outcome.reason,
+		}
+		if len(outcome.policyIDs) > 0 {
+			result.PolicyID = outcome.policyIDs[0]
+		}
+		tracer.OnDecision(result)
+	}
+	d := Decision{
+		Effect:    outcome.effect,
+		Algorithm: alg,
+		PolicyIDs: outcome.policyIDs,
+		Reason:    outcome.reason,
+		Errors:    errs,
+		err:       outcome.err,
+	}
+	if d.Effect == Permit || d.Effect == Deny {
+		for _, id := range d.PolicyIDs {
+			if p, ok := snap.byID[id]; ok {
+				d.Obligations = append(d.Obligations, p.obligations...)
+				d.Advice = append(d.Advice, p.advice...)
+			}
+		}
+	}
+	return d
+}
+
+// combineRun là request đang được kết hợp, dùng chung cho mọi cấp của cây policy.
+type combineRun struct {
+	tenantID string
+	req      *AuthorizationRequest
+	tracer   PolicyTraceObserver
+	indexed  bool // dùng target index (chỉ khi không trace)
+}
+
+// combineNodes kết hợp các policy và policy set cùng cấp (theo priority giảm dần) bằng thuật
+// toán alg; policy set có target khớp được kết hợp đệ quy bằng thuật toán của nó và kết quả
+// được tính như một policy khớp. Trả về quyết định và mọi lỗi gặp phải, kể cả lỗi bên trong
+// policy set con mà thuật toán của policy set đó bỏ qua.
+// Policy được đánh giá theo từng tầng priority, từ cao xuống thấp: khi một tầng đã quyết định
+// (có policy khớp, hoặc lỗi với thuật toán không bỏ qua lỗi) các tầng thấp hơn bị bỏ qua.
+// Trong một tầng, khi có lỗi các policy còn lại vẫn được đánh giá để trace đầy đủ; lỗi đầu tiên
+// được trả về nếu thuật toán coi lỗi là lỗi của request. Với first-applicable, vòng đánh giá
+// dừng ở policy khớp hoặc lỗi đầu tiên.
+// Node không nằm trong tập ứng viên của index được tính như đã đánh giá và không khớp.
+func combineNodes(nodes []policyNode, index *targetIndex, alg CombiningAlgorithm, run *combineRun) (combineOutcome, []error) {
+	tenantID, req, tracer := run.tenantID, run.req, run.tracer
+	var candidates bitset
+	if run.indexed && index != nil {
+		candidates = index.candidates(req)
+	}
+	state := combineState{tenantID: tenantID}
+	tier := 0
+	for i, n := range nodes {
+		if !n.appliesTo(tenantID) {
+			n.skip(tracer, req, "tenant mismatch")
+			continue
+		}
+		if state.applicable > 0 && n.priority() != tier && state.settled(alg) {
+			// Tầng priority cao hơn đã quyết định, các policy còn lại chỉ được ghi vào trace.
+			if tracer == nil {
+				break
+			}
+			n.skip(tracer, req, "lower priority")
+			continue
+		}
+		excluded := candidates != nil && !candidates.has(i)
+
+		if n.set != nil {
+			var matched bool
+			var err error
+			if !excluded {
+				matched, err = n.set.matches(req)
+			}
+			if err == nil && !matched {
+				n.skip(tracer, req, fmt.Sprintf("policy set %s target not matched", n.set.ID))
+				continue
+			}
+			tier = n.set.Priority
+			state.applicable++
+			if err != nil {
+				n.skip(tracer, req, fmt.Sprintf("policy set %s target error", n.set.ID))
+				state.addError(n.set.ID, err)
+			} else {
+				sub, errs := combineNodes(n.set.members, n.set.index, n.set.algorithm(alg), run)
+				state.addSet(n.set.ID, sub, errs)
+			}
+		} else {
+			tier = n.policy.Priority
+			state.applicable++
+			if !excluded {
+				state.addPolicy(n, req, tracer)
+			}
+		}
+		if alg == FirstApplicable && state.settled(alg) {
+			break
+		}
+	}
+	return state.decide(alg), state.reported
+}
+
+// addPolicy đánh giá một policy và ghi kết quả vào state (và trace nếu có).
+func (s *combineState) addPolicy(n policyNode, req *AuthorizationRequest, tracer PolicyTraceObserver) {
+	p := n.policy
+	start := time.Now()
+	matched, err := p.evaluate(req)
+	if tracer != nil {
+		record := n.record(req, "")
+		record.Matched = matched
+		record.DurationUs = time.Since(start).Microseconds()
+		if err != nil {
+			record.Error = err.Error()
+		}
+		tracer.OnPolicyEvaluated(record)
+	}
+	switch {
+	case err != nil:
+		s.addError(p.ID, err)
+	case !matched:
+	case p.Effect == "allow":
+		s.allowIDs = append(s.allowIDs, p.ID)
+	case p.Effect == "deny":
+		s.denyIDs = append(s.denyIDs, p.ID)
+	}
+}
+
+func withPolicyID(obligations []Obligation, policyID string) []Obligation {
+	for i := range obligations {
+		obligations[i].PolicyID = policyID
+	}
+	return obligations
+}
+
+func (p *policyEntry) traceRecord(req *AuthorizationRequest, skipReason string) PolicyEvaluation {
+	return PolicyEvaluation{
+		PolicyID:      p.ID,
+		RuleID:        p.ruleID,
+		Tenant:        p.TenantID,
+		Effect:        p.Effect,
+		Priority:      p.Priority,
+		Rule:          p.Rule,
+		ResourceIndex: req.resourceIndex,
+		Skipped:       skipReason != "",
+		SkipReason:    skipReason,
+	}
+}
+
+func decisionString(allowed bool) string {
+	if allowed {
+		return "allow"
+	}
+	return "deny"
+}
@@ -9,4 +9,49 @@ var (
 
 	// ErrResourceNotFound được trả về khi không tìm thấy tài nguyên.
 	ErrResourceNotFound = errors.New("resource not found")
+
+	// ErrPolicyNotFound được trả về khi không tìm thấy policy theo ID.
+	ErrPolicyNotFound = errors.New("policy not found")
+
+	// ErrPolicyExists được trả về khi thêm một policy đã tồn tại (trùng ID hoặc trùng nội dung).
+	ErrPolicyExists = errors.New("policy already exists")
+
+	// ErrInvalidPolicy được trả về khi nội dung policy không hợp lệ.
+	ErrInvalidPolicy = errors.New("invalid policy")
+
+	// ErrPolicySetNotFound được trả về khi không tìm thấy policy set theo ID.
+	ErrPolicySetNotFound = errors.New("policy set not found")
+
+	// ErrPolicySetExists được trả về khi tạo policy set trùng ID.
+	ErrPolicySetExists = errors.New("policy set already exists")
+
+	// ErrPolicyIDNotSupported được trả về khi model không khai báo trường id trong [policy_definition].
+	ErrPolicyIDNotSupported = errors.New("policy model has no id field")
+
+	// ErrPriorityNotSupported được trả về khi đặt priority khác 0 mà model không khai báo
+	// trường priority trong [policy_definition].
+	ErrPriorityNotSupported = errors.New("policy model has no priority field")
+
+	// ErrObligationsNotSupported được trả về khi đặt obligation mà model không khai báo
+	// trường obligations trong [policy_definition].
+	ErrObligationsNotSupported = errors.New("policy model has no obligations field")
+
+	// ErrUnsupportedModel được trả về khi [matchers] hoặc [policy_effect] của model khác với
+	// matcher/effect mà engine cài đặt (policy được đánh giá bởi engine, không qua enforcer).
+	ErrUnsupportedModel = errors.New("unsupported policy model")
+
+	// ErrWatchNotSupported được trả về khi storage của hệ thống không hỗ trợ watcher
+	// (ví dụ: gọi WatchDB trên hệ thống không tạo từ database).
+	ErrWatchNotSupported = errors.New("policy storage does not support watching")
+
+	// ErrProcessLocalSetting được trả về khi đổi lúc đang chạy một cấu hình chỉ nằm trong bộ
+	// nhớ của instance (không được lưu hay đồng bộ) trên PolicyManager đã gắn notifier.
+	ErrProcessLocalSetting = errors.New("setting is process-local and is not replicated")
+
+	// ErrUnknownCombiningAlgorithm được trả về khi cấu hình một thuật toán kết hợp không hỗ trợ.
+	ErrUnknownCombiningAlgorithm = errors.New("unknown combining algorithm")
+
+	// ErrUnsupportedCondition được trả về khi PartialEvaluate gặp điều kiện trên Resource
+	// không thể chuyển thành bộ lọc.
+	ErrUnsupportedCondition = errors.New("condition cannot be translated to a filter")
 )
@@ -0,0 +1,98 @@
+package abac
+
+import (
+	"context"
+	"fmt"
+)
+
+// EvaluateOption là tùy chọn của Authorizer.Evaluate.
+type EvaluateOption interface{ apply(*evaluateConfig) }
+
+type evaluateOptFunc func(*evaluateConfig)
+
+func (f evaluateOptFunc) apply(c *evaluateConfig) { f(c) }
+
+type evaluateConfig struct {
+	subject, resource           interface{}
+	fetchSubject, fetchResource bool
+}
+
+// WithFetchedSubject bật chế độ kết hợp cho subject: thuộc tính được lấy qua SubjectFetcher,
+// sau đó các khóa của req.Subject được ghi đè lên (thuộc tính truyền vào thắng).
+func WithFetchedSubject(subject interface{}) EvaluateOption {
+	return evaluateOptFunc(func(c *evaluateConfig) { c.subject, c.fetchSubject = subject, true })
+}
+
+// WithFetchedResource bật chế độ kết hợp cho resource, tương tự WithFetchedSubject. Khi
+// ResourceFetcher trả về nhiều resource, req.Resource được ghi đè lên từng resource.
+func WithFetchedResource(resource interface{}) EvaluateOption {
+	return evaluateOptFunc(func(c *evaluateConfig) { c.resource, c.fetchResource = resource, true })
+}
+
+// Evaluate giống Decide nhưng nhận thuộc tính đã có sẵn (ví dụ resource handler vừa nạp, subject
+// lấy từ claim của JWT) nên không gọi SubjectFetcher/ResourceFetcher, tránh truy vấn lặp.
+// req.Subject, req.Resource, req.Env nil được coi là rỗng; req.Trace bị bỏ qua (dùng
+// CheckWithTrace để lấy trace). Với WithFetchedSubject/WithFetchedResource, thuộc tính được lấy
+// qua fetcher rồi thuộc tính truyền vào được ghi đè lên ở cấp cao nhất (không gộp sâu).
+func (a *Authorizer) Evaluate(ctx *context.Context, tenantID string, req AuthorizationRequest, opts ...EvaluateOption) Decision {
+	var cfg evaluateConfig
+	for _, o := range opts {
+		if o != nil {
+			o.apply(&cfg)
+		}
+	}
+
+	subAttrs := req.Subject
+	if cfg.fetchSubject {
+		fetched, err := a.subjectFetcher.GetSubjectAttributes(ctx, cfg.subject)
+		if err != nil {
+			return indeterminate(fmt.Errorf("subject attributes error: %w", err))
+		}
+		subAttrs = mergeAttributes(fetched, req.Subject)
+	}
+	if subAttrs == nil {
+		subAttrs = Attributes{}
+	}
+
+	listResAttrs := []Attributes{req.Resource}
+	if cfg.fetchResource {
+		fetched, err := a.resourceFetcher.GetResourceAttributes(ctx, cfg.resource)
+		if err != nil {
+			return indeterminate(fmt.Errorf("resource attributes error: %w", err))
+		}
+		if len(fetched) == 0 {
+			fetched = []Attributes{{}}
+		}
+		listResAttrs = make([]Attributes, len(fetched))
+		for i, resAttrs := range fetched {
+			listResAttrs[i] = mergeAttributes(resAttrs, req.Resource)
+		}
+	}
+	for i := range listResAttrs {
+		if listResAttrs[i] == nil {
+			listResAttrs[i] = Attributes{}
+		}
+	}
+
+	envAttrs := req.Env
+	if envAttrs == nil {
+		envAttrs = make(Attributes)
+	}
+	return a.decideResources(tenantID, subAttrs, listResAttrs, req.Action, envAttrs, nil)
+}
+
+// mergeAttributes trả về base với các khóa của override ghi đè lên. base không bị sửa
+// (có thể là dữ liệu trong cache thuộc tính).
+func mergeAttributes(base, override Attributes) Attributes {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(Attributes, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,157 @@
+package abac_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sharedFetcher trả về cùng một map cho mọi lần gọi (như fetcher có cache) và đếm số lần gọi.
+type sharedFetcher struct {
+	mocks.MockFetcher
+	subject       abac.Attributes
+	resources     []abac.Attributes
+	subjectCalls  atomic.Int32
+	resourceCalls atomic.Int32
+}
+
+func (f *sharedFetcher) GetSubjectAttributes(ctx *context.Context, subject interface{}) (abac.Attributes, error) {
+	f.subjectCalls.Add(1)
+	if f.subject == nil {
+		return f.MockFetcher.GetSubjectAttributes(ctx, subject)
+	}
+	return f.subject, nil
+}
+
+func (f *sharedFetcher) GetResourceAttributes(ctx *context.Context, resource interface{}) ([]abac.Attributes, error) {
+	f.resourceCalls.Add(1)
+	if f.resources == nil {
+		return f.MockFetcher.GetResourceAttributes(ctx, resource)
+	}
+	return f.resources, nil
+}
+
+const evaluateTestPolicies = `
+p, *, "Action == 'read' && Resource.owner == Subject.id", allow, owner_read
+p, *, "Action == 'read' && Resource.department == 'engineering'", deny, no_engineering`
+
+func TestAuthorizer_Evaluate_InlineAttributes(t *testing.T) {
+	fetcher := &sharedFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, evaluateTestPolicies, fetcher, fetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	d := authorizer.Evaluate(&ctx, "tenant1", abac.AuthorizationRequest{
+		Subject:  abac.Attributes{"id": "alice"},
+		Resource: abac.Attributes{"owner": "alice", "department": "hr"},
+		Action:   "read",
+	})
+	require.NoError(t, d.Err())
+	assert.Equal(t, abac.Permit, d.Effect)
+	assert.Equal(t, []string{"owner_read"}, d.PolicyIDs)
+
+	d = authorizer.Evaluate(&ctx, "tenant1", abac.AuthorizationRequest{
+		Subject:  abac.Attributes{"id": "alice"},
+		Resource: abac.Attributes{"owner": "alice", "department": "engineering"},
+		Action:   "read",
+	})
+	assert.Equal(t, abac.Deny, d.Effect)
+
+	// Subject/Resource/Env nil được coi là rỗng.
+	d = authorizer.Evaluate(&ctx, "tenant1", abac.AuthorizationRequest{Action: "read"})
+	assert.False(t, d.Allowed())
+
+	assert.Zero(t, fetcher.subjectCalls.Load(), "Evaluate must not call the subject fetcher")
+	assert.Zero(t, fetcher.resourceCalls.Load(), "Evaluate must not call the resource fetcher")
+}
+
+func TestAuthorizer_Evaluate_MatchesDecide(t *testing.T) {
+	authorizer := setupAuthorizer(t)
+	mockFetcher := &mocks.MockFetcher{}
+	ctx := context.Background()
+
+	cases := []struct{ subject, resource, action string }{
+		{"t1_hr_manager", "t1_eng_request", "approve_level_2"},
+		{"t2_hr_manager", "t2_hr_request", "approve_level_2"},
+		{"t2_hr_manager", "t2_sales_request", "approve_level_2"},
+		{"root_user", "t2_sales_request", "approve_level_2"},
+	}
+	for _, c := range cases {
+		tenantID := "tenant2"
+		subAttrs, err := mockFetcher.GetSubjectAttributes(&ctx, c.subject)
+		require.NoError(t, err)
+		resAttrs, err := mockFetcher.GetResourceAttributes(&ctx, c.resource)
+		require.NoError(t, err)
+
+		want := authorizer.Decide(&ctx, tenantID, c.subject, c.resource, c.action, nil)
+		got := authorizer.Evaluate(&ctx, tenantID, abac.AuthorizationRequest{
+			Subject: subAttrs, Resource: resAttrs[0], Action: c.action,
+		})
+		assert.Equal(t, want.Effect, got.Effect, "%s/%s", c.subject, c.resource)
+		assert.Equal(t, want.PolicyIDs, got.PolicyIDs, "%s/%s", c.subject, c.resource)
+	}
+}
+
+func TestAuthorizer_Evaluate_Hybrid(t *testing.T) {
+	fetcher := &sharedFetcher{
+		subject: abac.Attributes{"id": "alice", "department": "hr"},
+		resources: []abac.Attributes{
+			{"id": "doc1", "owner": "bob", "department": "hr"},
+			{"id": "doc2", "owner": "bob", "department": "sales"},
+		},
+	}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, evaluateTestPolicies, fetcher, fetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Chỉ fetch subject; resource truyền vào được dùng nguyên.
+	d := authorizer.Evaluate(&ctx, "tenant1", abac.AuthorizationRequest{
+		Resource: abac.Attributes{"owner": "alice", "department": "hr"},
+		Action:   "read",
+	}, abac.WithFetchedSubject("alice"))
+	assert.Equal(t, abac.Permit, d.Effect)
+	assert.EqualValues(t, 1, fetcher.subjectCalls.Load())
+	assert.Zero(t, fetcher.resourceCalls.Load())
+
+	// Thuộc tính truyền vào ghi đè thuộc tính được fetch, cho mọi resource.
+	d = authorizer.Evaluate(&ctx, "tenant1", abac.AuthorizationRequest{
+		Subject:  abac.Attributes{"id": "carol"},
+		Resource: abac.Attributes{"owner": "carol"},
+		Action:   "read",
+	}, abac.WithFetchedSubject("alice"), abac.WithFetchedResource("docs"))
+	assert.Equal(t, abac.Permit, d.Effect)
+	assert.EqualValues(t, 1, fetcher.resourceCalls.Load())
+
+	d = authorizer.Evaluate(&ctx, "tenant1", abac.AuthorizationRequest{
+		Subject: abac.Attributes{"id": "carol"},
+		Action:  "read",
+	}, abac.WithFetchedSubject("alice"), abac.WithFetchedResource("docs"))
+	assert.False(t, d.Allowed(), "fetched owner bob must not match carol")
+
+	// Dữ liệu của fetcher (có thể là cache) không bị sửa.
+	assert.Equal(t, abac.Attributes{"id": "alice", "department": "hr"}, fetcher.subject)
+	assert.Equal(t, "bob", fetcher.resources[0]["owner"])
+	assert.Equal(t, "bob", fetcher.resources[1]["owner"])
+}
+
+func TestAuthorizer_Evaluate_FetchErrors(t *testing.T) {
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, evaluateTestPolicies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	d := authorizer.Evaluate(&ctx, "tenant1", abac.AuthorizationRequest{Action: "read"},
+		abac.WithFetchedSubject("unknown_user"))
+	assert.Equal(t, abac.Indeterminate, d.Effect)
+	assert.ErrorIs(t, d.Err(), abac.ErrSubjectNotFound)
+
+	d = authorizer.Evaluate(&ctx, "tenant1", abac.AuthorizationRequest{Action: "read"},
+		abac.WithFetchedResource("unknown_request"))
+	assert.Equal(t, abac.Indeterminate, d.Effect)
+	assert.ErrorIs(t, d.Err(), abac.ErrResourceNotFound)
+}
@@ -0,0 +1,195 @@
+package abac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Explanation là lời giải thích có cấu trúc cho một DecisionTrace:
+// rule deny nào đã chặn, rule allow nào gần khớp nhất và vì sao chúng không khớp.
+type Explanation struct {
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+	// DenyRules là các rule deny đã khớp (nguyên nhân trực tiếp của deny).
+	DenyRules []RuleExplanation `json:"deny_rules,omitempty"`
+	// AllowRules là các rule allow đã khớp.
+	AllowRules []RuleExplanation `json:"allow_rules,omitempty"`
+	// ClosestAllowRules là các rule allow không khớp, xếp theo mức độ gần khớp giảm dần.
+	ClosestAllowRules []RuleExplanation `json:"closest_allow_rules,omitempty"`
+	// ErrorRules là các rule bị lỗi khi đánh giá.
+	ErrorRules []RuleExplanation `json:"error_rules,omitempty"`
+}
+
+// RuleExplanation giải thích kết quả của một policy.
+type RuleExplanation struct {
+	PolicyID      string `json:"policy_id"`
+	Effect        string `json:"effect"`
+	Rule          string `json:"rule"`
+	ResourceIndex int    `json:"resource_index"`
+	Matched       bool   `json:"matched"`
+	// Score là tỉ lệ các điều kiện && cấp cao nhất của rule được thỏa (0..1).
+	Score            float64                `json:"score"`
+	FailedConditions []ConditionExplanation `json:"failed_conditions,omitempty"`
+	Error            string                 `json:"error,omitempty"`
+}
+
+// ConditionExplanation mô tả một biểu thức con bị false, kèm giá trị thực tế
+// của các thuộc tính mà nó tham chiếu.
+type ConditionExplanation struct {
+	Expression string            `json:"expression"`
+	Values     map[string]string `json:"values,omitempty"`
+	Text       string            `json:"text"`
+}
+
+// Explain dựng lời giải thích từ trace trả về bởi CheckWithTrace.
+// Rule được lấy từ trace (PolicyEvaluation.Rule) nên không phụ thuộc policy đã đổi sau đó.
+// Các biểu thức con được đánh giá lại trên đúng bộ thuộc tính của request đã tạo ra trace;
+// trace được đọc lại từ JSON không còn thuộc tính nên chỉ có thông tin ở mức policy.
+func (a *Authorizer) Explain(trace *DecisionTrace) (*Explanation, error) {
+	if trace == nil {
+		return nil, errors.New("explain: trace không được nil")
+	}
+	ex := &Explanation{Decision: trace.Decision, Reason: trace.DecisionReason}
+	if ex.Decision == "" {
+		ex.Decision = "deny"
+	}
+
+	for _, ev := range trace.Policies {
+		if ev.Skipped {
+			continue
+		}
+		re := RuleExplanation{
+			PolicyID:      ev.PolicyID,
+			Effect:        ev.Effect,
+			ResourceIndex: ev.ResourceIndex,
+			Rule:          ev.Rule,
+			Matched:       ev.Matched,
+			Error:         ev.Error,
+		}
+		if ev.Matched {
+			re.Score = 1
+		}
+		if req := trace.request(ev.ResourceIndex); req != nil && ev.Rule != "" && ev.Error == "" {
+			if ast, err := parseRuleAST(ev.Rule, a.engine.evaluator.functions); err == nil {
+				a.explainRule(&re, ast, requestParameters(req))
+			}
+		}
+
+		switch {
+		case re.Error != "":
+			ex.ErrorRules = append(ex.ErrorRules, re)
+		case re.Matched && re.Effect == "deny":
+			ex.DenyRules = append(ex.DenyRules, re)
+		case re.Matched:
+			ex.AllowRules = append(ex.AllowRules, re)
+		case re.Effect == "allow":
+			ex.ClosestAllowRules = append(ex.ClosestAllowRules, re)
+		}
+	}
+	sort.SliceStable(ex.ClosestAllowRules, func(i, j int) bool {
+		return ex.ClosestAllowRules[i].Score > ex.ClosestAllowRules[j].Score
+	})
+	return ex, nil
+}
+
+// explainRule tính Score và các điều kiện bị false của một rule không khớp.
+func (a *Authorizer) explainRule(re *RuleExplanation, ast *ruleAST, params map[string]interface{}) {
+	if re.Matched {
+		return
+	}
+	conjuncts := ast.root.conjuncts()
+	satisfied := 0
+	for _, c := range conjuncts {
+		if v, err := ast.evaluate(c, params); err == nil && v == true {
+			satisfied++
+		}
+	}
+	re.Score = float64(satisfied) / float64(len(conjuncts))
+	for _, n := range ast.failedConditions(ast.root, params) {
+		re.FailedConditions = append(re.FailedConditions, ast.explainCondition(n, params))
+	}
+}
+
+// failedConditions trả về các biểu thức con nhỏ nhất giải thích vì sao node là false:
+// với && là các vế false, với các loại node khác là chính node đó.
+func (a *ruleAST) failedConditions(n *exprNode, params map[string]interface{}) []*exprNode {
+	if n.kind == exprLogical && n.op == "&&" {
+		var out []*exprNode
+		for _, c := range n.children {
+			if v, err := a.evaluate(c, params); err != nil || v != true {
+				out = append(out, a.failedConditions(c, params)...)
+			}
+		}
+		return out
+	}
+	return []*exprNode{n}
+}
+
+func (a *ruleAST) explainCondition(n *exprNode, params map[string]interface{}) ConditionExplanation {
+	ce := ConditionExplanation{Expression: a.text(n)}
+	var parts []string
+	for _, path := range n.variables() {
+		name := strings.Join(path, ".")
+		value, ok := lookupPath(params, path)
+		if ce.Values == nil {
+			ce.Values = make(map[string]string)
+		}
+		ce.Values[name] = formatExplainValue(value, ok)
+		parts = append(parts, fmt.Sprintf("%s was %s", name, ce.Values[name]))
+	}
+
+	if _, err := a.evaluate(n, params); err != nil {
+		ce.Text = fmt.Sprintf("%s could not be evaluated: %v", ce.Expression, err)
+	} else {
+		ce.Text = ce.Expression + " was false"
+	}
+	if len(parts) > 0 {
+		ce.Text += " because " + strings.Join(parts, ", ")
+	}
+	return ce
+}
+
+func formatExplainValue(value interface{}, present bool) string {
+	if !present {
+		return "missing"
+	}
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return "'" + v + "'"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// String trả về lời giải thích dạng văn bản, phù hợp để gửi cho bộ phận hỗ trợ.
+func (e *Explanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Decision: %s", e.Decision)
+	if e.Reason != "" {
+		fmt.Fprintf(&b, " (%s)", e.Reason)
+	}
+	b.WriteString("\n")
+	for _, r := range e.DenyRules {
+		fmt.Fprintf(&b, "Deny rule %s fired: %s\n", r.PolicyID, r.Rule)
+	}
+	for _, r := range e.AllowRules {
+		fmt.Fprintf(&b, "Allow rule %s matched: %s\n", r.PolicyID, r.Rule)
+	}
+	if len(e.ClosestAllowRules) > 0 {
+		b.WriteString("Closest allow rules:\n")
+		for _, r := range e.ClosestAllowRules {
+			fmt.Fprintf(&b, "- %s (%.0f%% of conditions met): %s\n", r.PolicyID, r.Score*100, r.Rule)
+			for _, c := range r.FailedConditions {
+				fmt.Fprintf(&b, "    * %s\n", c.Text)
+			}
+		}
+	}
+	for _, r := range e.ErrorRules {
+		fmt.Fprintf(&b, "Rule %s returned an error: %s\n", r.PolicyID, r.Error)
+	}
+	return b.String()
+}
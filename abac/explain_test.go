@@ -0,0 +1,119 @@
+package abac_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizer_Explain_ClosestAllowRule(t *testing.T) {
+	authorizer := setupAuthorizer(t)
+	ctx := context.Background()
+
+	allowed, trace, err := authorizer.CheckWithTrace(
+		&ctx, "tenant2", "t2_hr_manager", "t2_sales_request", "approve_level_2", nil,
+	)
+	require.NoError(t, err)
+	require.False(t, allowed)
+
+	ex, err := authorizer.Explain(trace)
+	require.NoError(t, err)
+	assert.Equal(t, "deny", ex.Decision)
+	assert.Empty(t, ex.DenyRules)
+	require.Len(t, ex.ClosestAllowRules, 2)
+
+	closest := ex.ClosestAllowRules[0]
+	assert.Equal(t, "t2_hr_manager_approve_hr_level_2", closest.PolicyID)
+	assert.InDelta(t, 2.0/3.0, closest.Score, 0.001)
+	require.Len(t, closest.FailedConditions, 1)
+	cond := closest.FailedConditions[0]
+	assert.Equal(t, "Resource.department == 'hr'", cond.Expression)
+	assert.Equal(t, map[string]string{"Resource.department": "'sales'"}, cond.Values)
+	assert.Equal(t, "Resource.department == 'hr' was false because Resource.department was 'sales'", cond.Text)
+
+	root := ex.ClosestAllowRules[1]
+	assert.Equal(t, "root_approve_level_2", root.PolicyID)
+	require.Len(t, root.FailedConditions, 1)
+	assert.Equal(t, "hasGlobalRole(Subject, 'root')", root.FailedConditions[0].Expression)
+
+	assert.Contains(t, ex.String(), "Resource.department == 'hr' was false because Resource.department was 'sales'")
+}
+
+func TestAuthorizer_Explain_DenyRuleAndNestedConditions(t *testing.T) {
+	policies := `
+p, *, "Action == 'approve_level_2' && (Resource.department == 'hr' || Resource.department == 'finance') && !(Env.ip == '')", allow, allow_hr_finance
+p, tenant1, "Resource.department == 'engineering'", deny, deny_engineering`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	env := abac.Attributes{"ip": ""}
+
+	_, trace, err := authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", &env)
+	require.NoError(t, err)
+
+	ex, err := authorizer.Explain(trace)
+	require.NoError(t, err)
+	require.Len(t, ex.DenyRules, 1)
+	assert.Equal(t, "deny_engineering", ex.DenyRules[0].PolicyID)
+
+	require.Len(t, ex.ClosestAllowRules, 1)
+	rule := ex.ClosestAllowRules[0]
+	assert.InDelta(t, 1.0/3.0, rule.Score, 0.001)
+	require.Len(t, rule.FailedConditions, 2)
+	assert.Equal(t, "(Resource.department == 'hr' || Resource.department == 'finance')", rule.FailedConditions[0].Expression)
+	assert.Equal(t, "'engineering'", rule.FailedConditions[0].Values["Resource.department"])
+	assert.Equal(t, "!(Env.ip == '')", rule.FailedConditions[1].Expression)
+	assert.Contains(t, ex.String(), "Deny rule deny_engineering fired")
+}
+
+func TestAuthorizer_Explain_TraceFromJSON(t *testing.T) {
+	authorizer := setupAuthorizer(t)
+	ctx := context.Background()
+
+	_, trace, err := authorizer.CheckWithTrace(
+		&ctx, "tenant2", "t2_hr_manager", "t2_sales_request", "approve_level_2", nil,
+	)
+	require.NoError(t, err)
+	raw, err := json.Marshal(trace)
+	require.NoError(t, err)
+	var decoded abac.DecisionTrace
+	require.NoError(t, json.Unmarshal(raw, &decoded))
+
+	ex, err := authorizer.Explain(&decoded)
+	require.NoError(t, err)
+	require.Len(t, ex.ClosestAllowRules, 2)
+	assert.NotEmpty(t, ex.ClosestAllowRules[0].Rule)
+	assert.Empty(t, ex.ClosestAllowRules[0].FailedConditions, "attributes are not serialized")
+
+	_, err = authorizer.Explain(nil)
+	assert.Error(t, err)
+}
+
+func TestAuthorizer_Explain_UsesTracedRule(t *testing.T) {
+	authorizer, pm := newPolicySetTestSystem(t, `
+p, tenant1, "Action == 'read' && Resource.department == 'hr'", allow, hr_read`)
+	ctx := context.Background()
+
+	allowed, trace, err := authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "read", nil)
+	require.NoError(t, err)
+	require.False(t, allowed)
+
+	// Policy đổi sau khi trace được tạo: Explain vẫn giải thích rule đã được đánh giá.
+	_, err = pm.UpdatePolicyByID("hr_read", abac.Policy{TenantID: "tenant1", Rule: "Action == 'write'", Effect: "allow"})
+	require.NoError(t, err)
+
+	ex, err := authorizer.Explain(trace)
+	require.NoError(t, err)
+	require.Len(t, ex.ClosestAllowRules, 1)
+	rule := ex.ClosestAllowRules[0]
+	assert.Equal(t, "Action == 'read' && Resource.department == 'hr'", rule.Rule)
+	assert.InDelta(t, 0.5, rule.Score, 0.001)
+	require.Len(t, rule.FailedConditions, 1)
+	assert.Equal(t, "Resource.department == 'hr'", rule.FailedConditions[0].Expression)
+}
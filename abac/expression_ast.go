@@ -0,0 +1,489 @@
+package abac
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/casbin/govaluate"
+)
+
+// exprKind phân loại các node trong cây biểu thức của một rule.
+type exprKind int
+
+const (
+	exprLiteral    exprKind = iota // 'hr', 10, true
+	exprVariable                   // Action, Subject.id, Resource.department
+	exprLogical                    // &&, ||
+	exprNot                        // !x
+	exprComparison                 // ==, !=, >, <, >=, <=, =~, !~, in
+	exprFunction                   // has(Subject.roles, 'admin')
+	exprList                       // ('a', 'b') ở vế phải của in
+	exprOther                      // toán tử số học, bitwise, ternary, dấu âm...
+)
+
+// exprNode là một node trong cây biểu thức, dựng từ token của govaluate.
+// start/end là khoảng token [start, end) của node, dùng để đánh giá lại
+// hoặc in ra đúng biểu thức con đó.
+type exprNode struct {
+	kind     exprKind
+	op       string
+	name     string      // tên hàm với exprFunction
+	path     []string    // với exprVariable: ["Resource", "department"]
+	value    interface{} // với exprLiteral
+	children []*exprNode
+	start    int
+	end      int
+}
+
+// ruleAST là cây biểu thức của một rule cùng chuỗi token gốc.
+type ruleAST struct {
+	source string
+	root   *exprNode
+	tokens []govaluate.ExpressionToken
+	names  map[int]string // tên hàm theo vị trí token FUNCTION
+	calls  map[int]int    // vị trí byte của lời gọi hàm trong rule theo vị trí token FUNCTION
+}
+
+// parseRuleAST phân tích rule thành cây biểu thức, dùng bộ hàm đã đăng ký.
+func parseRuleAST(rule string, functions CustomFunctionMap) (*ruleAST, error) {
+	expr, err := govaluate.NewEvaluableExpressionWithFunctions(rule, functions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule syntax '%s': %w", rule, err)
+	}
+	// Token FUNCTION của govaluate chỉ giữ con trỏ hàm, nên tên hàm được lấy
+	// từ các lời gọi hàm trong chuỗi rule theo đúng thứ tự xuất hiện.
+	tokens := expr.Tokens()
+	calls := ruleFunctionCalls(rule)
+	names := make(map[int]string)
+	positions := make(map[int]int)
+	for i, t := range tokens {
+		if t.Kind == govaluate.FUNCTION && len(calls) > 0 {
+			names[i] = calls[0].name
+			positions[i] = calls[0].pos
+			calls = calls[1:]
+		}
+	}
+	p := &exprParser{tokens: tokens, names: names}
+	root, err := p.parseExpression()
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule syntax '%s': %w", rule, err)
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("invalid rule syntax '%s': unexpected token at %d", rule, p.pos)
+	}
+	return &ruleAST{source: rule, root: root, tokens: p.tokens, names: names, calls: positions}, nil
+}
+
+// position trả về vị trí byte của node hàm trong rule, -1 nếu không xác định được.
+func (a *ruleAST) position(n *exprNode) int {
+	if pos, ok := a.calls[n.start]; ok {
+		return pos
+	}
+	return -1
+}
+
+// ruleIdent là một định danh xuất hiện trong chuỗi rule (ngoài chuỗi ký tự).
+type ruleIdent struct {
+	name string
+	pos  int  // vị trí byte trong rule
+	call bool // định danh được theo sau bởi '(' (lời gọi hàm)
+}
+
+// scanRuleIdents quét các định danh (kể cả dạng Subject.id) trong rule,
+// bỏ qua nội dung trong dấu nháy và trong [..] (biến escape của govaluate).
+func scanRuleIdents(rule string) []ruleIdent {
+	var idents []ruleIdent
+	for i := 0; i < len(rule); {
+		c := rule[i]
+		switch {
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < len(rule) && rule[j] != c {
+				if rule[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			i = j + 1
+		case c == '[':
+			for i < len(rule) && rule[i] != ']' {
+				i++
+			}
+			i++
+		case isIdentStart(c):
+			j := i
+			for j < len(rule) && (isIdentPart(rule[j]) || rule[j] == '.') {
+				j++
+			}
+			k := j
+			for k < len(rule) && (rule[k] == ' ' || rule[k] == '\t') {
+				k++
+			}
+			name := rule[i:j]
+			idents = append(idents, ruleIdent{
+				name: name,
+				pos:  i,
+				call: k < len(rule) && rule[k] == '(' && !isRuleKeyword(name),
+			})
+			i = j
+		case c >= '0' && c <= '9':
+			for i < len(rule) && (isIdentPart(rule[i]) || rule[i] == '.') {
+				i++
+			}
+		default:
+			i++
+		}
+	}
+	return idents
+}
+
+// ruleFunctionCalls trả về các lời gọi hàm trong rule theo thứ tự xuất hiện.
+func ruleFunctionCalls(rule string) []ruleIdent {
+	var calls []ruleIdent
+	for _, ident := range scanRuleIdents(rule) {
+		if ident.call {
+			calls = append(calls, ident)
+		}
+	}
+	return calls
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func isRuleKeyword(name string) bool {
+	switch name {
+	case "in", "true", "false", "nil":
+		return true
+	}
+	return false
+}
+
+// evaluate đánh giá lại biểu thức con của node bằng chính govaluate,
+// đảm bảo ngữ nghĩa giống hệt khi đánh giá cả rule.
+func (a *ruleAST) evaluate(n *exprNode, parameters map[string]interface{}) (interface{}, error) {
+	expr, err := govaluate.NewEvaluableExpressionFromTokens(a.tokens[n.start:n.end])
+	if err != nil {
+		return nil, err
+	}
+	return expr.Evaluate(parameters)
+}
+
+// text in biểu thức con của node dưới dạng chuỗi đọc được.
+func (a *ruleAST) text(n *exprNode) string {
+	var b strings.Builder
+	for i := n.start; i < n.end; i++ {
+		t := a.tokens[i]
+		switch t.Kind {
+		case govaluate.STRING:
+			fmt.Fprintf(&b, "'%v'", t.Value)
+		case govaluate.ACCESSOR:
+			if path, ok := t.Value.([]string); ok {
+				b.WriteString(strings.Join(path, "."))
+			}
+		case govaluate.FUNCTION:
+			b.WriteString(a.names[i])
+		case govaluate.CLAUSE:
+			b.WriteString("(")
+		case govaluate.CLAUSE_CLOSE:
+			b.WriteString(")")
+		case govaluate.SEPARATOR:
+			b.WriteString(", ")
+		case govaluate.PREFIX:
+			fmt.Fprintf(&b, "%v", t.Value)
+		case govaluate.COMPARATOR, govaluate.LOGICALOP, govaluate.MODIFIER, govaluate.TERNARY:
+			fmt.Fprintf(&b, " %v ", t.Value)
+		default:
+			fmt.Fprintf(&b, "%v", t.Value)
+		}
+	}
+	return b.String()
+}
+
+// walk duyệt cây theo thứ tự trước (pre-order).
+func (n *exprNode) walk(fn func(*exprNode)) {
+	if n == nil {
+		return
+	}
+	fn(n)
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+// conjuncts tách các vế của chuỗi && ở cấp cao nhất.
+func (n *exprNode) conjuncts() []*exprNode {
+	if n.kind == exprLogical && n.op == "&&" {
+		var out []*exprNode
+		for _, c := range n.children {
+			out = append(out, c.conjuncts()...)
+		}
+		return out
+	}
+	return []*exprNode{n}
+}
+
+// variables trả về các đường dẫn thuộc tính được tham chiếu trong node (không trùng lặp).
+func (n *exprNode) variables() [][]string {
+	seen := make(map[string]bool)
+	var out [][]string
+	n.walk(func(c *exprNode) {
+		if c.kind != exprVariable {
+			return
+		}
+		key := strings.Join(c.path, ".")
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, c.path)
+		}
+	})
+	return out
+}
+
+// lookupPath đọc giá trị của một đường dẫn thuộc tính trong bộ tham số.
+func lookupPath(parameters map[string]interface{}, path []string) (interface{}, bool) {
+	if len(path) == 0 {
+		return nil, false
+	}
+	current, ok := parameters[path[0]]
+	if !ok {
+		return nil, false
+	}
+	for _, key := range path[1:] {
+		switch m := current.(type) {
+		case Attributes:
+			current, ok = m[key]
+		case map[string]interface{}:
+			current, ok = m[key]
+		default:
+			return nil, false
+		}
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// =========================================================================
+// == Parser (đệ quy theo độ ưu tiên toán tử của govaluate)
+// =========================================================================
+
+type exprParser struct {
+	tokens []govaluate.ExpressionToken
+	pos    int
+	names  map[int]string
+}
+
+// Các mức ưu tiên của MODIFIER, từ thấp đến cao.
+var modifierLevels = [][]string{
+	{"|", "^", "&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+	{"**"},
+}
+
+func (p *exprParser) peek() (govaluate.ExpressionToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return govaluate.ExpressionToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *exprParser) peekOp(kind govaluate.TokenKind, ops ...string) (string, bool) {
+	t, ok := p.peek()
+	if !ok || t.Kind != kind {
+		return "", false
+	}
+	op := fmt.Sprint(t.Value)
+	if len(ops) == 0 {
+		return op, true
+	}
+	for _, candidate := range ops {
+		if op == candidate {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseExpression() (*exprNode, error) {
+	left, err := p.parseLogical("||")
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOp(govaluate.TERNARY)
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseLogical("||")
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{kind: exprOther, op: op, children: []*exprNode{left, right}, start: left.start, end: right.end}
+	}
+}
+
+func (p *exprParser) parseLogical(op string) (*exprNode, error) {
+	next := func() (*exprNode, error) {
+		if op == "||" {
+			return p.parseLogical("&&")
+		}
+		return p.parseComparison()
+	}
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.peekOp(govaluate.LOGICALOP, op); !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{kind: exprLogical, op: op, children: []*exprNode{left, right}, start: left.start, end: right.end}
+	}
+}
+
+func (p *exprParser) parseComparison() (*exprNode, error) {
+	left, err := p.parseModifier(0)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOp(govaluate.COMPARATOR)
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseModifier(0)
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{kind: exprComparison, op: op, children: []*exprNode{left, right}, start: left.start, end: right.end}
+	}
+}
+
+func (p *exprParser) parseModifier(level int) (*exprNode, error) {
+	if level >= len(modifierLevels) {
+		return p.parsePrefix()
+	}
+	left, err := p.parseModifier(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOp(govaluate.MODIFIER, modifierLevels[level]...)
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseModifier(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &exprNode{kind: exprOther, op: op, children: []*exprNode{left, right}, start: left.start, end: right.end}
+	}
+}
+
+func (p *exprParser) parsePrefix() (*exprNode, error) {
+	if op, ok := p.peekOp(govaluate.PREFIX); ok {
+		start := p.pos
+		p.pos++
+		operand, err := p.parsePrefix()
+		if err != nil {
+			return nil, err
+		}
+		kind := exprOther
+		if op == "!" {
+			kind = exprNot
+		}
+		return &exprNode{kind: kind, op: op, children: []*exprNode{operand}, start: start, end: operand.end}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (*exprNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	start := p.pos
+	switch t.Kind {
+	case govaluate.CLAUSE:
+		p.pos++
+		items, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 1 {
+			inner := *items[0]
+			inner.start, inner.end = start, p.pos
+			return &inner, nil
+		}
+		return &exprNode{kind: exprList, children: items, start: start, end: p.pos}, nil
+	case govaluate.FUNCTION:
+		p.pos++
+		if next, ok := p.peek(); !ok || next.Kind != govaluate.CLAUSE {
+			return nil, fmt.Errorf("expected '(' after function")
+		}
+		p.pos++
+		args, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		name := p.names[start]
+		return &exprNode{kind: exprFunction, name: name, children: args, start: start, end: p.pos}, nil
+	case govaluate.VARIABLE:
+		p.pos++
+		return &exprNode{kind: exprVariable, path: []string{fmt.Sprint(t.Value)}, start: start, end: p.pos}, nil
+	case govaluate.ACCESSOR:
+		p.pos++
+		path, _ := t.Value.([]string)
+		return &exprNode{kind: exprVariable, path: append([]string(nil), path...), start: start, end: p.pos}, nil
+	case govaluate.NUMERIC, govaluate.BOOLEAN, govaluate.STRING, govaluate.PATTERN, govaluate.TIME:
+		p.pos++
+		return &exprNode{kind: exprLiteral, value: t.Value, start: start, end: p.pos}, nil
+	}
+	return nil, fmt.Errorf("unexpected token %v", t.Kind)
+}
+
+// parseList đọc các biểu thức phân tách bằng dấu phẩy cho đến dấu ')' (đã tiêu thụ '(').
+func (p *exprParser) parseList() ([]*exprNode, error) {
+	var items []*exprNode
+	if t, ok := p.peek(); ok && t.Kind == govaluate.CLAUSE_CLOSE {
+		p.pos++
+		return items, nil
+	}
+	for {
+		item, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		t, ok := p.peek()
+		if !ok {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.pos++
+		switch t.Kind {
+		case govaluate.SEPARATOR:
+			continue
+		case govaluate.CLAUSE_CLOSE:
+			return items, nil
+		default:
+			return nil, fmt.Errorf("unexpected token %v in list", t.Kind)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package abac
+
+import (
+	"math"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseRuleAST_StructureAndText(t *testing.T) {
+	rule := "Action in ('read', 'write') && (hasTenantRole(Subject, 'tenant1', 'hr') || Subject.level >= 3) && !isBusinessHours(Env)"
+	ast, err := parseRuleAST(rule, BuiltinFunctions())
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	conjuncts := ast.root.conjuncts()
+	if len(conjuncts) != 3 {
+		t.Fatalf("expected 3 conjuncts, got %d", len(conjuncts))
+	}
+	want := []string{
+		"Action in ('read', 'write')",
+		"(hasTenantRole(Subject, 'tenant1', 'hr') || Subject.level >= 3)",
+		"!isBusinessHours(Env)",
+	}
+	for i, c := range conjuncts {
+		if got := ast.text(c); got != want[i] {
+			t.Errorf("conjunct %d: got %q, want %q", i, got, want[i])
+		}
+	}
+	if conjuncts[0].kind != exprComparison || conjuncts[1].kind != exprLogical || conjuncts[2].kind != exprNot {
+		t.Errorf("unexpected node kinds: %v %v %v", conjuncts[0].kind, conjuncts[1].kind, conjuncts[2].kind)
+	}
+	if fn := conjuncts[2].children[0]; fn.kind != exprFunction || fn.name != "isBusinessHours" {
+		t.Errorf("expected isBusinessHours call, got %+v", fn)
+	}
+
+	params := map[string]interface{}{
+		"Action":   "read",
+		"Subject":  Attributes{"level": 5.0},
+		"Resource": Attributes{},
+		"Env":      Attributes{},
+	}
+	if v, err := ast.evaluate(conjuncts[1], params); err != nil || v != true {
+		t.Errorf("expected second conjunct to be true, got %v (%v)", v, err)
+	}
+}
+
+func TestScanRuleIdents_SkipsStringsAndKeywords(t *testing.T) {
+	idents := scanRuleIdents(`Action in ('has(x)') && has(Subject.roles, "a") && Env.n > 1.5`)
+	var names []string
+	var calls []string
+	for _, id := range idents {
+		names = append(names, id.name)
+		if id.call {
+			calls = append(calls, id.name)
+		}
+	}
+	wantNames := []string{"Action", "in", "has", "Subject.roles", "Env.n"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("got idents %v, want %v", names, wantNames)
+	}
+	for i := range wantNames {
+		if names[i] != wantNames[i] {
+			t.Fatalf("got idents %v, want %v", names, wantNames)
+		}
+	}
+	if len(calls) != 1 || calls[0] != "has" {
+		t.Errorf("expected only has() as call, got %v", calls)
+	}
+}
+
+// TestParseRuleAST_MatchesGovaluate so sánh cây do parseRuleAST dựng với chính govaluate:
+// cây được tính lại theo từng node (toán tử của node áp lên giá trị các node con) và kết quả
+// của mọi node phải bằng kết quả govaluate trên đúng khoảng token của node đó.
+func TestParseRuleAST_MatchesGovaluate(t *testing.T) {
+	params := map[string]interface{}{
+		"Action":   "read",
+		"Subject":  Attributes{"level": 5.0, "name": "alice", "roles": []string{"admin"}},
+		"Resource": Attributes{"department": "hr", "level": 2.0},
+		"Env":      Attributes{},
+	}
+	rules := []string{
+		"1 + 2 * 3 == 7",
+		"(1 + 2) * 3 == 9",
+		"10 - 4 - 3 == 3",
+		"2 ** 3 * 2 == 16",
+		"7 % 4 + 1 == 4",
+		"1 << 2 + 1 == 8",
+		"1 | 2 & 0",
+		"6 ^ 3 | 8",
+		"true || false && false",
+		"false && true || true",
+		"Subject.level > 3 ? 'senior' : 'junior'",
+		"Resource.level > 3 ? 'senior' : 'junior'",
+		"Resource.level > 3 ? 'a' : Resource.level > 1 ? 'b' : 'c'",
+		"Action in ('read', 'write') && !(Subject.level < 3)",
+		"Resource.department in ('finance', 'sales') || Action == 'read'",
+		"-Subject.level + 10 == 5",
+		"-2 ** 2",
+		"!true == false",
+		"!(Subject.level >= 3 && Resource.level >= 3)",
+		"~1 == -2",
+		"Subject.name =~ '^a' && Subject.name !~ 'z$'",
+		"has(Subject.roles, 'admin') && Subject.level >= 3",
+		"!has(Subject.roles, 'guest') && Resource.level * 2 > Subject.level - 2",
+	}
+	for _, rule := range rules {
+		t.Run(rule, func(t *testing.T) {
+			ast, err := parseRuleAST(rule, BuiltinFunctions())
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			want, err := ast.evaluate(ast.root, params)
+			if err != nil {
+				t.Fatalf("govaluate: %v", err)
+			}
+			if got := interpretNode(t, ast, ast.root, params); !reflect.DeepEqual(got, want) {
+				t.Fatalf("tree evaluates to %v, govaluate to %v", got, want)
+			}
+		})
+	}
+}
+
+// interpretNode tính giá trị của node từ các node con và kiểm tra từng node với govaluate.
+func interpretNode(t *testing.T, ast *ruleAST, n *exprNode, params map[string]interface{}) interface{} {
+	t.Helper()
+	var got interface{}
+	child := func(i int) interface{} { return interpretNode(t, ast, n.children[i], params) }
+	switch n.kind {
+	case exprLiteral:
+		got = n.value
+	case exprVariable:
+		got, _ = lookupPath(params, n.path)
+	case exprFunction:
+		// Hàm được govaluate gọi trực tiếp; chỉ các đối số được kiểm tra.
+		for i := range n.children {
+			child(i)
+		}
+		v, err := ast.evaluate(n, params)
+		if err != nil {
+			t.Fatalf("%s: %v", ast.text(n), err)
+		}
+		return v
+	case exprList:
+		var items []interface{}
+		for i := range n.children {
+			items = append(items, child(i))
+		}
+		return items
+	case exprNot:
+		got = !child(0).(bool)
+	case exprLogical:
+		l, r := child(0).(bool), child(1).(bool)
+		if n.op == "&&" {
+			got = l && r
+		} else {
+			got = l || r
+		}
+	case exprComparison:
+		got = compareValues(t, n.op, child(0), child(1))
+	case exprOther:
+		if len(n.children) == 1 {
+			v := child(0).(float64)
+			switch n.op {
+			case "-":
+				got = -v
+			case "~":
+				got = float64(^int64(v))
+			default:
+				t.Fatalf("unexpected prefix %q", n.op)
+			}
+			break
+		}
+		l, r := child(0), child(1)
+		switch n.op {
+		case "?":
+			if l == true {
+				got = r
+			}
+		case ":":
+			got = l
+			if l == nil {
+				got = r
+			}
+		default:
+			got = arithmetic(t, n.op, l.(float64), r.(float64))
+		}
+	}
+	want, err := ast.evaluate(n, params)
+	if err != nil {
+		t.Fatalf("%s: %v", ast.text(n), err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("node %q: tree gives %v, govaluate gives %v", ast.text(n), got, want)
+	}
+	return got
+}
+
+func compareValues(t *testing.T, op string, l, r interface{}) bool {
+	t.Helper()
+	switch op {
+	case "==":
+		return reflect.DeepEqual(l, r)
+	case "!=":
+		return !reflect.DeepEqual(l, r)
+	case "=~", "!~":
+		// Pattern hằng được govaluate biên dịch sẵn thành *regexp.Regexp.
+		re, ok := r.(*regexp.Regexp)
+		if !ok {
+			re = regexp.MustCompile(r.(string))
+		}
+		matched := re.MatchString(l.(string))
+		return matched == (op == "=~")
+	case "in":
+		for _, item := range r.([]interface{}) {
+			if reflect.DeepEqual(l, item) {
+				return true
+			}
+		}
+		return false
+	}
+	a, b := l.(float64), r.(float64)
+	switch op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	}
+	t.Fatalf("unexpected comparator %q", op)
+	return false
+}
+
+func arithmetic(t *testing.T, op string, a, b float64) float64 {
+	t.Helper()
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	case "%":
+		return math.Mod(a, b)
+	case "**":
+		return math.Pow(a, b)
+	case "<<":
+		return float64(int64(a) << uint64(b))
+	case ">>":
+		return float64(int64(a) >> uint64(b))
+	case "&":
+		return float64(int64(a) & int64(b))
+	case "|":
+		return float64(int64(a) | int64(b))
+	case "^":
+		return float64(int64(a) ^ int64(b))
+	}
+	t.Fatalf("unexpected operator %q", op)
+	return 0
+}
@@ -0,0 +1,94 @@
+package abac
+
+import (
+	"sort"
+
+	"github.com/casbin/govaluate"
+)
+
+// FunctionInfo mô tả một hàm có thể gọi trong policy, dùng cho tooling
+// (editor, validator, tài liệu tự sinh...).
+type FunctionInfo struct {
+	Name string `json:"name"`
+	// Arity là số tham số bắt buộc, -1 nếu không xác định (hàm do người dùng đăng ký).
+	Arity    int      `json:"arity"`
+	ArgTypes []string `json:"arg_types,omitempty"`
+	// Builtin cho biết hàm thuộc thư viện có sẵn và không bị người dùng ghi đè.
+	Builtin bool `json:"builtin"`
+}
+
+type builtinFunction struct {
+	info FunctionInfo
+	fn   govaluate.ExpressionFunction
+}
+
+// builtinFunctions là danh sách các hàm có sẵn, được tự động đăng ký
+// cho mọi hệ thống tạo bởi các factory function.
+var builtinFunctions = []builtinFunction{
+	{FunctionInfo{Name: "has", Arity: 2, ArgTypes: []string{"list", "any"}, Builtin: true}, HasFunc},
+	{FunctionInfo{Name: "intersects", Arity: 2, ArgTypes: []string{"list", "list"}, Builtin: true}, IntersectsFunc},
+	{FunctionInfo{Name: "isIpInCidr", Arity: 2, ArgTypes: []string{"string", "string"}, Builtin: true}, IsIpInCidrFunc},
+	{FunctionInfo{Name: "matches", Arity: 2, ArgTypes: []string{"string", "string"}, Builtin: true}, MatchesFunc},
+	{FunctionInfo{Name: "isBusinessHours", Arity: 3, ArgTypes: []string{"number", "number", "number"}, Builtin: true}, IsBusinessHoursFunc},
+	{FunctionInfo{Name: "hasGlobalRole", Arity: 2, ArgTypes: []string{"Attributes", "string"}, Builtin: true}, HasGlobalRoleFunc},
+	{FunctionInfo{Name: "hasTenantRole", Arity: 3, ArgTypes: []string{"Attributes", "string", "string"}, Builtin: true}, HasTenantRoleFunc},
+	{FunctionInfo{Name: "hasOrgRole", Arity: 3, ArgTypes: []string{"Attributes", "string", "string"}, Builtin: true}, HasOrgRoleFunc},
+}
+
+// BuiltinFunctions trả về bản sao của bộ hàm có sẵn.
+func BuiltinFunctions() CustomFunctionMap {
+	functions := make(CustomFunctionMap, len(builtinFunctions))
+	for _, b := range builtinFunctions {
+		functions[b.info.Name] = b.fn
+	}
+	return functions
+}
+
+// BuiltinFunctionInfos trả về thông tin (arity, kiểu tham số) của các hàm có sẵn.
+func BuiltinFunctionInfos() []FunctionInfo {
+	infos := make([]FunctionInfo, 0, len(builtinFunctions))
+	for _, b := range builtinFunctions {
+		infos = append(infos, cloneFunctionInfo(b.info))
+	}
+	return infos
+}
+
+// mergeFunctions gộp bộ hàm có sẵn với CustomFunctionMap của người dùng.
+// Hàm cùng tên của người dùng sẽ ghi đè hàm có sẵn; giá trị nil sẽ tắt hàm đó.
+func mergeFunctions(user CustomFunctionMap) (CustomFunctionMap, map[string]FunctionInfo) {
+	functions := make(CustomFunctionMap, len(builtinFunctions)+len(user))
+	infos := make(map[string]FunctionInfo, len(builtinFunctions)+len(user))
+	for _, b := range builtinFunctions {
+		functions[b.info.Name] = b.fn
+		infos[b.info.Name] = cloneFunctionInfo(b.info)
+	}
+	for name, fn := range user {
+		if fn == nil {
+			delete(functions, name)
+			delete(infos, name)
+			continue
+		}
+		functions[name] = fn
+		infos[name] = FunctionInfo{Name: name, Arity: -1}
+	}
+	return functions, infos
+}
+
+func cloneFunctionInfo(info FunctionInfo) FunctionInfo {
+	info.ArgTypes = append([]string(nil), info.ArgTypes...)
+	return info
+}
+
+// Functions liệt kê toàn bộ các hàm đang được đăng ký cho Authorizer,
+// sắp xếp theo tên.
+func (a *Authorizer) Functions() []FunctionInfo {
+	if a.evaluator == nil {
+		return nil
+	}
+	infos := make([]FunctionInfo, 0, len(a.evaluator.functionInfos))
+	for _, info := range a.evaluator.functionInfos {
+		infos = append(infos, cloneFunctionInfo(info))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
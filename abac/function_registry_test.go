@@ -0,0 +1,81 @@
+package abac_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func newAuthorizerWithFunctions(t *testing.T, functions abac.CustomFunctionMap) *abac.Authorizer {
+	t.Helper()
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromFile(
+		"../casbin_config/abac_model.conf",
+		"../casbin_config/abac_policy.csv",
+		mockFetcher,
+		mockFetcher,
+		functions,
+	)
+	assert.NoError(t, err, "Failed to create authorizer")
+	return authorizer
+}
+
+func TestFunctionRegistry_BuiltinsRegisteredAutomatically(t *testing.T) {
+	authorizer := newAuthorizerWithFunctions(t, nil)
+	ctx := context.Background()
+
+	allowed, err := authorizer.Check(&ctx, "tenant2", "root_user", "t2_sales_request", "approve_level_2", nil)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	names := make([]string, 0)
+	for _, info := range authorizer.Functions() {
+		assert.True(t, info.Builtin)
+		names = append(names, info.Name)
+	}
+	assert.Equal(t, []string{
+		"has", "hasGlobalRole", "hasOrgRole", "hasTenantRole",
+		"intersects", "isBusinessHours", "isIpInCidr", "matches",
+	}, names)
+}
+
+func TestFunctionRegistry_UserOverridesBuiltin(t *testing.T) {
+	denyAll := func(args ...interface{}) (interface{}, error) { return false, nil }
+	authorizer := newAuthorizerWithFunctions(t, abac.CustomFunctionMap{"hasGlobalRole": denyAll})
+	ctx := context.Background()
+
+	allowed, err := authorizer.Check(&ctx, "tenant2", "root_user", "t2_sales_request", "approve_level_2", nil)
+	assert.NoError(t, err)
+	assert.False(t, allowed, "overridden hasGlobalRole should be used instead of the built-in")
+
+	for _, info := range authorizer.Functions() {
+		if info.Name == "hasGlobalRole" {
+			assert.False(t, info.Builtin)
+			assert.Equal(t, -1, info.Arity)
+		}
+	}
+}
+
+func TestFunctionRegistry_UserDisablesBuiltin(t *testing.T) {
+	authorizer := newAuthorizerWithFunctions(t, abac.CustomFunctionMap{"matches": nil, "isIpInCidr": nil})
+
+	for _, info := range authorizer.Functions() {
+		assert.NotEqual(t, "matches", info.Name)
+		assert.NotEqual(t, "isIpInCidr", info.Name)
+	}
+	assert.Len(t, authorizer.Functions(), 6)
+}
+
+func TestBuiltinFunctionInfos(t *testing.T) {
+	infos := abac.BuiltinFunctionInfos()
+	assert.Len(t, infos, len(abac.BuiltinFunctions()))
+	for _, info := range infos {
+		if info.Name == "hasTenantRole" {
+			assert.Equal(t, 3, info.Arity)
+			assert.Equal(t, []string{"Attributes", "string", "string"}, info.ArgTypes)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package grpcmw
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"google.golang.org/grpc/metadata"
+)
+
+// TenantExtractor lấy tenant của lời gọi từ context (metadata, giá trị do interceptor khác đặt...).
+type TenantExtractor func(ctx context.Context) (string, error)
+
+// SubjectExtractor lấy subject truyền vào SubjectFetcher.GetSubjectAttributes. Lỗi nên bọc
+// ErrUnauthenticated để interceptor trả về codes.Unauthenticated.
+type SubjectExtractor func(ctx context.Context) (interface{}, error)
+
+// TokenVerifier xác thực bearer token (ví dụ kiểm tra chữ ký JWT) và trả về các claim.
+type TokenVerifier func(ctx context.Context, token string) (map[string]interface{}, error)
+
+type claimsKey struct{}
+
+// ContextWithClaims gắn claims vào context, dùng khi token đã được xác thực bởi interceptor khác.
+func ContextWithClaims(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext trả về claims đã được xác thực của lời gọi.
+func ClaimsFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(map[string]interface{})
+	return claims, ok
+}
+
+// ResourceExtractor lấy resource (thường là ID) từ message request của một method.
+type ResourceExtractor func(ctx context.Context, req interface{}) (interface{}, error)
+
+// ActionMapper ánh xạ tên method đầy đủ ("/pkg.Service/Method") sang action.
+type ActionMapper func(fullMethod string) (string, error)
+
+// EnvExtractor bổ sung thuộc tính môi trường cho lời gọi.
+type EnvExtractor func(ctx context.Context, fullMethod string, env abac.Attributes)
+
+// metadataValue trả về giá trị đầu tiên khác rỗng của khóa trong incoming metadata.
+func metadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get(key) {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// StaticTenant dùng một tenant cố định cho mọi lời gọi.
+func StaticTenant(tenantID string) TenantExtractor {
+	return func(ctx context.Context) (string, error) { return tenantID, nil }
+}
+
+// TenantFromMetadata đọc tenant từ incoming metadata.
+func TenantFromMetadata(key string) TenantExtractor {
+	return func(ctx context.Context) (string, error) {
+		if v := metadataValue(ctx, key); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%w: tenant not found in metadata %s", errInvalidArgument, key)
+	}
+}
+
+// TenantFromClaim đọc tenant từ claim dạng chuỗi của token (xem WithTokenVerifier).
+func TenantFromClaim(claim string) TenantExtractor {
+	return func(ctx context.Context) (string, error) {
+		claims, _ := ClaimsFromContext(ctx)
+		if v, ok := claims[claim].(string); ok && v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("%w: tenant not found in claim %s", ErrUnauthenticated, claim)
+	}
+}
+
+// SubjectFromClaim đọc subject từ claim của token (xem WithTokenVerifier); claim rỗng trả về
+// toàn bộ claims.
+func SubjectFromClaim(claim string) SubjectExtractor {
+	return func(ctx context.Context) (interface{}, error) {
+		claims, ok := ClaimsFromContext(ctx)
+		if ok && claim == "" {
+			return claims, nil
+		}
+		if v, found := claims[claim]; found && v != nil && v != "" {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%w: subject not found in claim %s", ErrUnauthenticated, claim)
+	}
+}
+
+// SubjectFromMetadata đọc subject (chuỗi) từ incoming metadata. Client tự đặt metadata nên chỉ
+// an toàn khi server nằm sau proxy tin cậy đã xác thực lời gọi và ghi đè khóa này; nếu không,
+// bất kỳ ai cũng có thể mạo danh subject khác.
+func SubjectFromMetadata(key string) SubjectExtractor {
+	return func(ctx context.Context) (interface{}, error) {
+		if v := metadataValue(ctx, key); v != "" {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%w: subject not found in metadata %s", ErrUnauthenticated, key)
+	}
+}
+
+// SubjectFromContext đọc subject từ context, ví dụ được đặt bởi interceptor xác thực chạy trước.
+func SubjectFromContext(key interface{}) SubjectExtractor {
+	return func(ctx context.Context) (interface{}, error) {
+		if v := ctx.Value(key); v != nil {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%w: subject not found in context", ErrUnauthenticated)
+	}
+}
+
+// MethodName dùng tên method (phần sau dấu '/' cuối cùng, ví dụ "GetDocument") làm action.
+func MethodName() ActionMapper {
+	return func(fullMethod string) (string, error) {
+		name := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+		if name == "" {
+			return "", fmt.Errorf("%w: %s", ErrNoAction, fullMethod)
+		}
+		return name, nil
+	}
+}
+
+// ActionMap ánh xạ tên method đầy đủ sang action theo map; method không có trong map bị từ chối.
+func ActionMap(actions map[string]string) ActionMapper {
+	copied := make(map[string]string, len(actions))
+	for k, v := range actions {
+		copied[k] = v
+	}
+	return func(fullMethod string) (string, error) {
+		if action, ok := copied[fullMethod]; ok {
+			return action, nil
+		}
+		return "", fmt.Errorf("%w: %s", ErrNoAction, fullMethod)
+	}
+}
+
+// ResourceIDGetter trả về ResourceExtractor đọc ID từ message có getter sinh bởi protoc, ví dụ
+// ResourceIDGetter(func(r *pb.GetDocumentRequest) string { return r.GetId() }).
+func ResourceIDGetter[T any](get func(T) string) ResourceExtractor {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		msg, ok := req.(T)
+		if !ok {
+			return nil, fmt.Errorf("unexpected request message %T", req)
+		}
+		id := get(msg)
+		if id == "" {
+			return nil, fmt.Errorf("request message %T has no resource id", req)
+		}
+		return id, nil
+	}
+}
@@ -0,0 +1,418 @@
+// Package grpcmw cung cấp interceptor gRPC phía server (unary và stream) kiểm tra quyền bằng
+// abac.Authorizer: action lấy từ tên method đầy đủ, tenant từ incoming metadata, subject từ
+// claims của bearer token đã xác thực (WithTokenVerifier) hoặc từ extractor khai báo bằng
+// WithSubject, resource từ message request qua extractor đăng ký cho từng method. Request bị từ chối nhận
+// codes.PermissionDenied với lý do của quyết định trong status details (errdetails.ErrorInfo).
+//
+//	opts := []grpcmw.Option{grpcmw.WithTokenVerifier(verifyJWT)}
+//	srv := grpc.NewServer(
+//	    grpc.UnaryInterceptor(grpcmw.UnaryServerInterceptor(authorizer, opts...)),
+//	    grpc.StreamInterceptor(grpcmw.StreamServerInterceptor(authorizer, opts...)),
+//	)
+package grpcmw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// Decider là phần của abac.Authorizer mà interceptor cần.
+type Decider interface {
+	Decide(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrs *abac.Attributes) abac.Decision
+}
+
+// Explainer là phần của abac.Authorizer dùng để giải thích quyết định (xem WithExplanation).
+type Explainer interface {
+	CheckWithTrace(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrs *abac.Attributes, opts ...abac.TraceOption) (bool, *abac.DecisionTrace, error)
+	Explain(trace *abac.DecisionTrace) (*abac.Explanation, error)
+}
+
+var (
+	// ErrUnauthenticated được trả về khi lời gọi không có (hoặc có sai) thông tin xác thực;
+	// interceptor trả về codes.Unauthenticated.
+	ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+	// ErrNoAction được trả về khi method không được ánh xạ sang action; interceptor trả về
+	// codes.PermissionDenied.
+	ErrNoAction = errors.New("no action mapped for method")
+)
+
+// ErrorDomain là Domain của errdetails.ErrorInfo trong status khi từ chối.
+const ErrorDomain = "abac"
+
+// Các khóa Env được interceptor tự điền.
+const (
+	EnvIPAddress  = "ip_address" // IP của peer
+	EnvTime       = "time"       // RFC 3339
+	EnvTimeOfDay  = "timeOfDay"  // 9.5 = 9:30, dùng với isBusinessHours
+	EnvGRPCMethod = "grpc_method"
+)
+
+// config chứa các tùy chọn của interceptor.
+type config struct {
+	tenant    TenantExtractor
+	subject   SubjectExtractor
+	verifier  TokenVerifier
+	action    ActionMapper
+	resources map[string]ResourceExtractor
+	env       []EnvExtractor
+	skip      map[string]bool
+	now       func() time.Time
+	explain   bool
+}
+
+// Option là tùy chọn của UnaryServerInterceptor và StreamServerInterceptor.
+type Option interface{ apply(*config) }
+
+type optFunc func(*config)
+
+func (f optFunc) apply(c *config) { f(c) }
+
+// WithTenant chọn cách lấy tenant (mặc định: metadata x-tenant-id).
+func WithTenant(e TenantExtractor) Option {
+	return optFunc(func(c *config) { c.tenant = e })
+}
+
+// WithSubject chọn cách lấy subject truyền vào SubjectFetcher (mặc định: claim "sub" của token
+// đã xác thực, xem WithTokenVerifier). Không có verifier và không có WithSubject thì mọi lời
+// gọi bị từ chối với codes.Unauthenticated.
+func WithSubject(e SubjectExtractor) Option {
+	return optFunc(func(c *config) { c.subject = e })
+}
+
+// WithTokenVerifier xác thực bearer token ở metadata "authorization" trước mọi extractor;
+// claims được lưu vào context của handler (xem ClaimsFromContext, SubjectFromClaim,
+// TenantFromClaim). Lời gọi không có token hoặc token không hợp lệ nhận codes.Unauthenticated.
+// Với stream, token được xác thực một lần khi stream bắt đầu.
+func WithTokenVerifier(v TokenVerifier) Option {
+	return optFunc(func(c *config) { c.verifier = v })
+}
+
+// WithActionMapper chọn cách ánh xạ tên method đầy đủ sang action (mặc định: MethodName()).
+func WithActionMapper(m ActionMapper) Option {
+	return optFunc(func(c *config) { c.action = m })
+}
+
+// WithActions ánh xạ tên method đầy đủ ("/pkg.Service/Method") sang action; method không có
+// trong map bị từ chối.
+func WithActions(actions map[string]string) Option {
+	return WithActionMapper(ActionMap(actions))
+}
+
+// WithResourceExtractor đăng ký cách lấy resource từ message request của một method (tên đầy
+// đủ). Method không có extractor được kiểm tra với resource nil.
+func WithResourceExtractor(fullMethod string, e ResourceExtractor) Option {
+	return optFunc(func(c *config) {
+		if c.resources == nil {
+			c.resources = make(map[string]ResourceExtractor)
+		}
+		c.resources[fullMethod] = e
+	})
+}
+
+// WithEnv thêm các EnvExtractor, chạy sau các thuộc tính Env mặc định.
+func WithEnv(extractors ...EnvExtractor) Option {
+	return optFunc(func(c *config) { c.env = append(c.env, extractors...) })
+}
+
+// WithSkipMethods bỏ qua kiểm tra quyền cho các method (tên đầy đủ), ví dụ health check.
+func WithSkipMethods(fullMethods ...string) Option {
+	return optFunc(func(c *config) {
+		if c.skip == nil {
+			c.skip = make(map[string]bool)
+		}
+		for _, m := range fullMethods {
+			c.skip[m] = true
+		}
+	})
+}
+
+// WithClock thay nguồn thời gian của EnvTime và EnvTimeOfDay (mặc định: time.Now).
+func WithClock(now func() time.Time) Option {
+	return optFunc(func(c *config) {
+		if now != nil {
+			c.now = now
+		}
+	})
+}
+
+// WithExplanation thêm giải thích đầy đủ (abac.Explanation) vào status details dưới dạng
+// errdetails.DebugInfo khi từ chối. Decider phải cài đặt Explainer; request bị từ chối được
+// đánh giá lại với trace, chỉ nên bật cho dịch vụ nội bộ.
+func WithExplanation() Option {
+	return optFunc(func(c *config) { c.explain = true })
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		tenant:  TenantFromMetadata("x-tenant-id"),
+		subject: SubjectFromClaim("sub"),
+		action:  MethodName(),
+		now:     time.Now,
+	}
+	for _, o := range opts {
+		if o != nil {
+			o.apply(c)
+		}
+	}
+	return c
+}
+
+// UnaryServerInterceptor kiểm tra quyền trước khi gọi handler unary.
+func UnaryServerInterceptor(decider Decider, opts ...Option) grpc.UnaryServerInterceptor {
+	cfg := newConfig(opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if cfg.skip[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		holder := &decisionHolder{}
+		ctx = context.WithValue(ctx, decisionKey{}, holder)
+		ctx, err := cfg.authenticate(ctx, holder)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.authorize(ctx, decider, info.FullMethod, req, true, holder); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor kiểm tra quyền cho stream. Method có ResourceExtractor được kiểm tra
+// với từng message nhận được (RecvMsg trả về lỗi nếu bị từ chối); method còn lại được kiểm tra
+// một lần khi stream bắt đầu, với resource nil.
+func StreamServerInterceptor(decider Decider, opts ...Option) grpc.StreamServerInterceptor {
+	cfg := newConfig(opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if cfg.skip[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		holder := &decisionHolder{}
+		ctx, err := cfg.authenticate(context.WithValue(ss.Context(), decisionKey{}, holder), holder)
+		if err != nil {
+			return err
+		}
+		if _, perMessage := cfg.resources[info.FullMethod]; !perMessage {
+			if err := cfg.authorize(ctx, decider, info.FullMethod, nil, false, holder); err != nil {
+				return err
+			}
+			return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+		}
+		return handler(srv, &authorizedStream{
+			ServerStream: ss,
+			ctx:          ctx,
+			authorize: func(msg interface{}) error {
+				return cfg.authorize(ctx, decider, info.FullMethod, msg, true, holder)
+			},
+		})
+	}
+}
+
+// authorizedStream gắn context có quyết định và kiểm tra quyền với từng message nhận được.
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	authorize func(msg interface{}) error // nil: đã kiểm tra khi stream bắt đầu
+}
+
+func (s *authorizedStream) Context() context.Context { return s.ctx }
+
+func (s *authorizedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.authorize == nil {
+		return nil
+	}
+	return s.authorize(m)
+}
+
+// authenticate xác thực bearer token bằng verifier (nếu có) và gắn claims vào context.
+func (c *config) authenticate(ctx context.Context, holder *decisionHolder) (context.Context, error) {
+	if c.verifier == nil {
+		return ctx, nil
+	}
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return ctx, deny(holder, ErrUnauthenticated)
+	}
+	claims, err := c.verifier(ctx, token)
+	if err != nil {
+		return ctx, deny(holder, errors.Join(ErrUnauthenticated, err))
+	}
+	return ContextWithClaims(ctx, claims), nil
+}
+
+// bearerToken đọc token từ metadata "authorization: Bearer <token>".
+func bearerToken(ctx context.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(metadataValue(ctx, "authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// deny ghi quyết định Indeterminate cho lỗi trước khi Decide và trả về status tương ứng.
+func deny(holder *decisionHolder, err error) error {
+	d := abac.Decision{Effect: abac.Indeterminate, Reason: err.Error(), Errors: []error{err}}
+	holder.set(d)
+	return denyStatus(d, nil)
+}
+
+// authorize chạy các extractor, gọi Decide và chuyển quyết định không Permit thành status lỗi.
+func (c *config) authorize(ctx context.Context, decider Decider, fullMethod string, req interface{}, hasMessage bool, holder *decisionHolder) error {
+	in, err := c.input(ctx, fullMethod, req, hasMessage)
+	if err != nil {
+		return deny(holder, err)
+	}
+	d := decider.Decide(&ctx, in.tenantID, in.subject, in.resource, in.action, &in.env)
+	holder.set(d)
+	if d.Allowed() {
+		return nil
+	}
+	var explanation *abac.Explanation
+	if explainer, ok := decider.(Explainer); ok && c.explain {
+		if _, trace, _ := explainer.CheckWithTrace(&ctx, in.tenantID, in.subject, in.resource, in.action, &in.env); trace != nil {
+			explanation, _ = explainer.Explain(trace)
+		}
+	}
+	return denyStatus(d, explanation)
+}
+
+// request là đầu vào của Decide lấy được từ một lời gọi gRPC.
+type request struct {
+	tenantID string
+	subject  interface{}
+	resource interface{}
+	action   string
+	env      abac.Attributes
+}
+
+func (c *config) input(ctx context.Context, fullMethod string, req interface{}, hasMessage bool) (*request, error) {
+	var in request
+	var err error
+	if in.action, err = c.action(fullMethod); err != nil {
+		return nil, err
+	}
+	if in.tenantID, err = c.tenant(ctx); err != nil {
+		return nil, err
+	}
+	if in.subject, err = c.subject(ctx); err != nil {
+		return nil, err
+	}
+	if extract, ok := c.resources[fullMethod]; ok && hasMessage {
+		if in.resource, err = extract(ctx, req); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidArgument, err)
+		}
+	}
+
+	now := c.now()
+	in.env = abac.Attributes{
+		EnvTime:       now.Format(time.RFC3339),
+		EnvTimeOfDay:  float64(now.Hour()) + float64(now.Minute())/60,
+		EnvGRPCMethod: fullMethod,
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr := p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+		in.env[EnvIPAddress] = addr
+	}
+	for _, e := range c.env {
+		e(ctx, fullMethod, in.env)
+	}
+	return &in, nil
+}
+
+// denyStatus chuyển quyết định không Permit thành status gRPC kèm errdetails.ErrorInfo
+// (và errdetails.DebugInfo nếu có explanation).
+func denyStatus(d abac.Decision, explanation *abac.Explanation) error {
+	code := codes.PermissionDenied
+	if d.Effect == abac.Indeterminate {
+		code = codeOf(d.Err(), d.Errors)
+	}
+	st := status.New(code, fmt.Sprintf("abac: %s", strings.ReplaceAll(string(d.Effect), "_", " ")))
+	info := &errdetails.ErrorInfo{
+		Reason: strings.ToUpper(string(d.Effect)),
+		Domain: ErrorDomain,
+		Metadata: map[string]string{
+			"reason": d.Reason,
+		},
+	}
+	if len(d.PolicyIDs) > 0 {
+		info.Metadata["policy_ids"] = strings.Join(d.PolicyIDs, ",")
+	}
+	if d.Algorithm != "" {
+		info.Metadata["algorithm"] = string(d.Algorithm)
+	}
+	details := []protoadapt.MessageV1{info}
+	if explanation != nil {
+		details = append(details, &errdetails.DebugInfo{Detail: explanation.String()})
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// errInvalidArgument đánh dấu lỗi thiếu tenant hoặc lỗi của ResourceExtractor; interceptor trả về codes.InvalidArgument.
+var errInvalidArgument = errors.New("invalid request")
+
+func codeOf(err error, errs []error) codes.Code {
+	if err == nil && len(errs) > 0 {
+		err = errs[0]
+	}
+	switch {
+	case errors.Is(err, ErrUnauthenticated), errors.Is(err, abac.ErrSubjectNotFound):
+		return codes.Unauthenticated
+	case errors.Is(err, ErrNoAction):
+		return codes.PermissionDenied
+	case errors.Is(err, abac.ErrResourceNotFound):
+		return codes.NotFound
+	case errors.Is(err, errInvalidArgument):
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
+
+// decisionHolder giữ quyết định gần nhất của lời gọi (với stream: của message gần nhất).
+type decisionHolder struct {
+	mu sync.Mutex
+	d  abac.Decision
+	ok bool
+}
+
+func (h *decisionHolder) set(d abac.Decision) {
+	h.mu.Lock()
+	h.d, h.ok = d, true
+	h.mu.Unlock()
+}
+
+type decisionKey struct{}
+
+// DecisionFromContext trả về quyết định của interceptor cho lời gọi; với stream kiểm tra theo
+// message, đó là quyết định của message gần nhất.
+func DecisionFromContext(ctx context.Context) (abac.Decision, bool) {
+	h, ok := ctx.Value(decisionKey{}).(*decisionHolder)
+	if !ok {
+		return abac.Decision{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.d, h.ok
+}
@@ -0,0 +1,293 @@
+package grpcmw_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/abac/grpcmw"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testModel = `
+[request_definition]
+r = tenant, req
+
+[policy_definition]
+p = tenant, rule, eft, id
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)`
+
+const testPolicies = `
+p, tenant1, "Action == 'approve_level_2' && Resource.department == 'engineering'", allow, approve_eng
+p, *, "Action == 'list' && Subject.id == 't1_hr_manager' && Env.grpc_method == '/test.Requests/List'", allow, list_own`
+
+// Dịch vụ test được khai báo thủ công (không cần protoc): request và response là StringValue.
+func unaryHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		d, _ := grpcmw.DecisionFromContext(ctx)
+		return wrapperspb.String(string(d.Effect)), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{FullMethod: "/test.Requests/" + methodOf(ctx)}, handler)
+}
+
+func methodOf(ctx context.Context) string {
+	method, _ := grpc.Method(ctx)
+	return method[len("/test.Requests/"):]
+}
+
+// watchHandler trả lời từng message nhận được cho đến khi client đóng stream.
+func watchHandler(srv interface{}, stream grpc.ServerStream) error {
+	for {
+		in := new(wrapperspb.StringValue)
+		if err := stream.RecvMsg(in); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := stream.SendMsg(wrapperspb.String("ok:" + in.GetValue())); err != nil {
+			return err
+		}
+	}
+}
+
+func listHandler(srv interface{}, stream grpc.ServerStream) error {
+	d, _ := grpcmw.DecisionFromContext(stream.Context())
+	return stream.SendMsg(wrapperspb.String(string(d.Effect)))
+}
+
+var testServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Requests",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Approve", Handler: unaryHandler},
+		{MethodName: "Delete", Handler: unaryHandler},
+		{MethodName: "Health", Handler: unaryHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Watch", Handler: watchHandler, ServerStreams: true, ClientStreams: true},
+		{StreamName: "List", Handler: listHandler, ServerStreams: true},
+	},
+}
+
+// resourceFetcher trả về resource rỗng cho method không có ResourceExtractor (resource nil).
+type resourceFetcher struct{ mocks.MockFetcher }
+
+func (f *resourceFetcher) GetResourceAttributes(ctx *context.Context, resource interface{}) ([]abac.Attributes, error) {
+	if resource == nil {
+		return []abac.Attributes{{}}, nil
+	}
+	return f.MockFetcher.GetResourceAttributes(ctx, resource)
+}
+
+// verifyTestToken chấp nhận token dạng "valid:<subject>".
+func verifyTestToken(ctx context.Context, token string) (map[string]interface{}, error) {
+	subject, ok := strings.CutPrefix(token, "valid:")
+	if !ok {
+		return nil, errors.New("bad signature")
+	}
+	return map[string]interface{}{"sub": subject}, nil
+}
+
+func newTestClient(t *testing.T, opts ...grpcmw.Option) *grpc.ClientConn {
+	t.Helper()
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(testModel, testPolicies, mockFetcher, &resourceFetcher{}, nil)
+	require.NoError(t, err)
+
+	resourceID := grpcmw.ResourceIDGetter(func(r *wrapperspb.StringValue) string { return r.GetValue() })
+	opts = append([]grpcmw.Option{
+		grpcmw.WithTokenVerifier(verifyTestToken),
+		grpcmw.WithActions(map[string]string{
+			"/test.Requests/Approve": "approve_level_2",
+			"/test.Requests/Watch":   "approve_level_2",
+			"/test.Requests/List":    "list",
+		}),
+		grpcmw.WithResourceExtractor("/test.Requests/Approve", resourceID),
+		grpcmw.WithResourceExtractor("/test.Requests/Watch", resourceID),
+		grpcmw.WithSkipMethods("/test.Requests/Health"),
+	}, opts...)
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcmw.UnaryServerInterceptor(authorizer, opts...)),
+		grpc.StreamInterceptor(grpcmw.StreamServerInterceptor(authorizer, opts...)),
+	)
+	srv.RegisterService(&testServiceDesc, nil)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func callContext(tenantID, subject string) context.Context {
+	md := metadata.Pairs("x-tenant-id", tenantID)
+	if subject != "" {
+		md.Append("authorization", "Bearer valid:"+subject)
+	}
+	return metadata.NewOutgoingContext(context.Background(), md)
+}
+
+func invoke(conn *grpc.ClientConn, ctx context.Context, method, resource string) (string, error) {
+	out := new(wrapperspb.StringValue)
+	err := conn.Invoke(ctx, "/test.Requests/"+method, wrapperspb.String(resource), out)
+	return out.GetValue(), err
+}
+
+func errorInfo(t *testing.T, err error) *errdetails.ErrorInfo {
+	t.Helper()
+	st, ok := status.FromError(err)
+	require.True(t, ok)
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+	t.Fatalf("status %v has no ErrorInfo", st)
+	return nil
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	conn := newTestClient(t)
+
+	effect, err := invoke(conn, callContext("tenant1", "t1_hr_manager"), "Approve", "t1_eng_request")
+	require.NoError(t, err)
+	assert.Equal(t, string(abac.Permit), effect)
+
+	_, err = invoke(conn, callContext("tenant2", "t2_hr_manager"), "Approve", "t1_eng_request")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	info := errorInfo(t, err)
+	assert.Equal(t, grpcmw.ErrorDomain, info.Domain)
+	assert.Equal(t, "NOT_APPLICABLE", info.Reason)
+	assert.Equal(t, "no allow rule matched (default deny)", info.Metadata["reason"])
+	assert.Equal(t, string(abac.DenyOverrides), info.Metadata["algorithm"])
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		res    string
+		code   codes.Code
+	}{
+		{"missing tenant", metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer valid:t1_hr_manager")), "Approve", "t1_eng_request", codes.InvalidArgument},
+		{"missing token", callContext("tenant1", ""), "Approve", "t1_eng_request", codes.Unauthenticated},
+		{"invalid token", metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-tenant-id", "tenant1", "authorization", "Bearer forged:t1_hr_manager")), "Approve", "t1_eng_request", codes.Unauthenticated},
+		{"unknown subject", callContext("tenant1", "nobody"), "Approve", "t1_eng_request", codes.Unauthenticated},
+		{"unknown resource", callContext("tenant1", "t1_hr_manager"), "Approve", "missing", codes.NotFound},
+		{"empty resource id", callContext("tenant1", "t1_hr_manager"), "Approve", "", codes.InvalidArgument},
+		{"unmapped method", callContext("tenant1", "t1_hr_manager"), "Delete", "t1_eng_request", codes.PermissionDenied},
+		{"skipped method", context.Background(), "Health", "", codes.OK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := invoke(conn, tc.ctx, tc.method, tc.res)
+			assert.Equal(t, tc.code, status.Code(err), err)
+		})
+	}
+}
+
+func TestUnaryServerInterceptor_SubjectRequiresAuthentication(t *testing.T) {
+	// Mặc định subject chỉ lấy từ token đã xác thực: metadata x-subject-id do client tự đặt bị bỏ qua.
+	spoofed := metadata.NewOutgoingContext(context.Background(),
+		metadata.Pairs("x-tenant-id", "tenant1", "x-subject-id", "t1_hr_manager"))
+
+	conn := newTestClient(t)
+	_, err := invoke(conn, spoofed, "Approve", "t1_eng_request")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Không có verifier: claim "sub" không bao giờ có nên mọi lời gọi bị từ chối.
+	conn = newTestClient(t, grpcmw.WithTokenVerifier(nil))
+	_, err = invoke(conn, spoofed, "Approve", "t1_eng_request")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// SubjectFromMetadata phải được chọn tường minh (sau proxy tin cậy).
+	conn = newTestClient(t, grpcmw.WithTokenVerifier(nil), grpcmw.WithSubject(grpcmw.SubjectFromMetadata("x-subject-id")))
+	effect, err := invoke(conn, spoofed, "Approve", "t1_eng_request")
+	require.NoError(t, err)
+	assert.Equal(t, string(abac.Permit), effect)
+}
+
+func TestUnaryServerInterceptor_Explanation(t *testing.T) {
+	conn := newTestClient(t, grpcmw.WithExplanation())
+
+	_, err := invoke(conn, callContext("tenant1", "t1_hr_manager"), "Approve", "t2_sales_request")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	st, _ := status.FromError(err)
+	var debug *errdetails.DebugInfo
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.DebugInfo); ok {
+			debug = info
+		}
+	}
+	require.NotNil(t, debug)
+	assert.Contains(t, debug.Detail, "approve_eng")
+	assert.Contains(t, debug.Detail, "Resource.department")
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	conn := newTestClient(t)
+	watch := &testServiceDesc.Streams[0]
+	list := &testServiceDesc.Streams[1]
+
+	// Bidi stream: mỗi message được kiểm tra với resource của nó.
+	stream, err := conn.NewStream(callContext("tenant1", "t1_hr_manager"), watch, "/test.Requests/Watch")
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg(wrapperspb.String("t1_eng_request")))
+	out := new(wrapperspb.StringValue)
+	require.NoError(t, stream.RecvMsg(out))
+	assert.Equal(t, "ok:t1_eng_request", out.GetValue())
+	require.NoError(t, stream.SendMsg(wrapperspb.String("t2_hr_request")))
+	err = stream.RecvMsg(out)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "NOT_APPLICABLE", errorInfo(t, err).Reason)
+
+	// Server stream không có ResourceExtractor: kiểm tra một lần khi bắt đầu.
+	stream, err = conn.NewStream(callContext("tenant1", "t1_hr_manager"), list, "/test.Requests/List")
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+	require.NoError(t, stream.RecvMsg(out))
+	assert.Equal(t, string(abac.Permit), out.GetValue())
+
+	stream, err = conn.NewStream(callContext("tenant2", "t2_hr_manager"), list, "/test.Requests/List")
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+	err = stream.RecvMsg(out)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Token được xác thực khi stream bắt đầu.
+	stream, err = conn.NewStream(callContext("tenant1", ""), watch, "/test.Requests/Watch")
+	require.NoError(t, err)
+	require.NoError(t, stream.SendMsg(wrapperspb.String("t1_eng_request")))
+	err = stream.RecvMsg(out)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
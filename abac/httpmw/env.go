@@ -0,0 +1,107 @@
+package httpmw
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/duclek15/go-abac-library/abac"
+)
+
+// Các khóa Env được middleware tự điền.
+const (
+	// EnvIPAddress là IP của client (xem ClientIP), dùng với isIpInCidr(Env.ip_address, ...).
+	EnvIPAddress = "ip_address"
+	// EnvTime là thời điểm request theo RFC 3339.
+	EnvTime = "time"
+	// EnvTimeOfDay là giờ trong ngày dạng số thập phân (9.5 = 9:30), dùng với
+	// isBusinessHours(Env.timeOfDay, 9, 17).
+	EnvTimeOfDay = "timeOfDay"
+	// EnvUserAgent là header User-Agent của request.
+	EnvUserAgent = "user_agent"
+)
+
+// EnvExtractor bổ sung thuộc tính môi trường từ request, chạy sau các thuộc tính mặc định.
+type EnvExtractor func(r *http.Request, env abac.Attributes)
+
+// WithEnv thêm các EnvExtractor.
+func WithEnv(extractors ...EnvExtractor) Option {
+	return optFunc(func(c *config) { c.env = append(c.env, extractors...) })
+}
+
+// WithoutDefaultEnv tắt việc tự điền EnvIPAddress, EnvTime, EnvTimeOfDay, EnvUserAgent.
+func WithoutDefaultEnv() Option {
+	return optFunc(func(c *config) { c.defaultEnv = false })
+}
+
+// WithTrustedProxies khai báo các proxy tin cậy: khi request đến từ các dải này, IP client
+// được lấy từ X-Forwarded-For / X-Real-IP (xem ClientIP).
+func WithTrustedProxies(prefixes ...netip.Prefix) Option {
+	return optFunc(func(c *config) { c.trusted = append(c.trusted, prefixes...) })
+}
+
+// WithClock thay nguồn thời gian của EnvTime và EnvTimeOfDay (mặc định: time.Now).
+func WithClock(now func() time.Time) Option {
+	return optFunc(func(c *config) {
+		if now != nil {
+			c.now = now
+		}
+	})
+}
+
+func (c *config) populateEnv(r *http.Request, env abac.Attributes) {
+	now := c.now()
+	env[EnvIPAddress] = ClientIP(r, c.trusted...)
+	env[EnvTime] = now.Format(time.RFC3339)
+	env[EnvTimeOfDay] = float64(now.Hour()) + float64(now.Minute())/60
+	env[EnvUserAgent] = r.UserAgent()
+}
+
+// ClientIP trả về IP của client. Mặc định là địa chỉ của kết nối (RemoteAddr); nếu kết nối đến
+// từ một proxy tin cậy, X-Forwarded-For được duyệt từ phải sang trái và IP đầu tiên không thuộc
+// proxy tin cậy được trả về (hoặc X-Real-IP nếu không có X-Forwarded-For).
+func ClientIP(r *http.Request, trusted ...netip.Prefix) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	isTrusted := func(s string) bool {
+		addr, err := netip.ParseAddr(strings.TrimSpace(s))
+		if err != nil {
+			return false
+		}
+		addr = addr.Unmap()
+		for _, p := range trusted {
+			if p.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(trusted) == 0 || !isTrusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if !isTrusted(hop) {
+			if _, err := netip.ParseAddr(hop); err != nil {
+				// Giá trị không phải IP (giả mạo hoặc sai định dạng), giữ IP của proxy.
+				return remote
+			}
+			return hop
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); len(hops) == 0 && realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return remote
+}
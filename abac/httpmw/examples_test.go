@@ -0,0 +1,37 @@
+package httpmw_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestExamplesBuild biên dịch các ví dụ trong _examples: "go build ./..." bỏ qua thư mục bắt
+// đầu bằng "_" nên ví dụ dùng API cũ sẽ không bị phát hiện nếu thiếu bước này.
+func TestExamplesBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping example build in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+	root, err := filepath.Abs("../..")
+	require.NoError(t, err)
+	mains, err := filepath.Glob(filepath.Join(root, "_examples", "*", "main.go"))
+	require.NoError(t, err)
+	require.NotEmpty(t, mains)
+
+	for _, main := range mains {
+		pkg := "./_examples/" + filepath.Base(filepath.Dir(main))
+		t.Run(pkg, func(t *testing.T) {
+			cmd := exec.Command(goTool, "build", "-o", os.DevNull, pkg)
+			cmd.Dir = root
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, "%s", out)
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package httpmw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// errBadRequest đánh dấu lỗi do request thiếu hoặc sai thông tin (tenant, resource); middleware trả về 400.
+var errBadRequest = errors.New("bad request")
+
+// TenantExtractor lấy tenant của request.
+type TenantExtractor func(r *http.Request) (string, error)
+
+// SubjectExtractor lấy subject truyền vào SubjectFetcher.GetSubjectAttributes. Lỗi nên bọc
+// ErrUnauthenticated để middleware trả về 401.
+type SubjectExtractor func(r *http.Request) (interface{}, error)
+
+// ResourceExtractor lấy resource truyền vào ResourceFetcher.GetResourceAttributes.
+type ResourceExtractor func(r *http.Request) (interface{}, error)
+
+// ActionExtractor lấy action của request.
+type ActionExtractor func(r *http.Request) (string, error)
+
+// TokenVerifier xác thực bearer token (ví dụ kiểm tra chữ ký JWT) và trả về các claim.
+type TokenVerifier func(ctx context.Context, token string) (map[string]interface{}, error)
+
+// ContextWithClaims gắn claims vào context, dùng khi token đã được xác thực bởi middleware khác.
+func ContextWithClaims(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext trả về claims đã được xác thực của request.
+func ClaimsFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(map[string]interface{})
+	return claims, ok
+}
+
+func missing(kind, source string, cause error) error {
+	return fmt.Errorf("%w: %s not found in %s", cause, kind, source)
+}
+
+// =========================================================================
+// == Tenant
+// =========================================================================
+
+// StaticTenant dùng một tenant cố định cho mọi request.
+func StaticTenant(tenantID string) TenantExtractor {
+	return func(r *http.Request) (string, error) { return tenantID, nil }
+}
+
+// TenantFromHeader đọc tenant từ header.
+func TenantFromHeader(name string) TenantExtractor {
+	return func(r *http.Request) (string, error) {
+		if v := strings.TrimSpace(r.Header.Get(name)); v != "" {
+			return v, nil
+		}
+		return "", missing("tenant", "header "+name, errBadRequest)
+	}
+}
+
+// TenantFromPathValue đọc tenant từ wildcard của pattern http.ServeMux (r.PathValue).
+func TenantFromPathValue(name string) TenantExtractor {
+	return func(r *http.Request) (string, error) {
+		if v := r.PathValue(name); v != "" {
+			return v, nil
+		}
+		return "", missing("tenant", "path value "+name, errBadRequest)
+	}
+}
+
+// TenantFromClaim đọc tenant từ claim dạng chuỗi của token (xem WithTokenVerifier).
+func TenantFromClaim(claim string) TenantExtractor {
+	return func(r *http.Request) (string, error) {
+		claims, _ := ClaimsFromContext(r.Context())
+		if v, ok := claims[claim].(string); ok && v != "" {
+			return v, nil
+		}
+		return "", missing("tenant", "claim "+claim, ErrUnauthenticated)
+	}
+}
+
+// TenantFromContext đọc tenant dạng chuỗi từ context của request.
+func TenantFromContext(key interface{}) TenantExtractor {
+	return func(r *http.Request) (string, error) {
+		if v, ok := r.Context().Value(key).(string); ok && v != "" {
+			return v, nil
+		}
+		return "", missing("tenant", "request context", errBadRequest)
+	}
+}
+
+// =========================================================================
+// == Subject
+// =========================================================================
+
+// SubjectFromHeader đọc subject (chuỗi) từ header.
+func SubjectFromHeader(name string) SubjectExtractor {
+	return func(r *http.Request) (interface{}, error) {
+		if v := strings.TrimSpace(r.Header.Get(name)); v != "" {
+			return v, nil
+		}
+		return nil, missing("subject", "header "+name, ErrUnauthenticated)
+	}
+}
+
+// SubjectFromClaim đọc subject từ claim của token (xem WithTokenVerifier); claim rỗng trả về
+// toàn bộ claims.
+func SubjectFromClaim(claim string) SubjectExtractor {
+	return func(r *http.Request) (interface{}, error) {
+		claims, ok := ClaimsFromContext(r.Context())
+		if ok && claim == "" {
+			return claims, nil
+		}
+		if v, found := claims[claim]; found && v != nil && v != "" {
+			return v, nil
+		}
+		return nil, missing("subject", "claim "+claim, ErrUnauthenticated)
+	}
+}
+
+// SubjectFromContext đọc subject từ context của request (ví dụ được đặt bởi middleware xác thực).
+func SubjectFromContext(key interface{}) SubjectExtractor {
+	return func(r *http.Request) (interface{}, error) {
+		if v := r.Context().Value(key); v != nil {
+			return v, nil
+		}
+		return nil, missing("subject", "request context", ErrUnauthenticated)
+	}
+}
+
+// =========================================================================
+// == Resource
+// =========================================================================
+
+// ResourceFromURLPath dùng đường dẫn URL của request làm resource.
+func ResourceFromURLPath() ResourceExtractor {
+	return func(r *http.Request) (interface{}, error) { return r.URL.Path, nil }
+}
+
+// ResourceFromPathValue đọc resource từ wildcard của pattern http.ServeMux (r.PathValue).
+func ResourceFromPathValue(name string) ResourceExtractor {
+	return func(r *http.Request) (interface{}, error) {
+		if v := r.PathValue(name); v != "" {
+			return v, nil
+		}
+		return nil, missing("resource", "path value "+name, errBadRequest)
+	}
+}
+
+// ResourceFromPath khớp đường dẫn request với template (ví dụ "/requests/{id}/approve", cú pháp
+// wildcard như http.ServeMux, {name...} khớp phần còn lại) và trả về giá trị của wildcard name.
+// Dùng khi router không phải http.ServeMux.
+func ResourceFromPath(template, name string) ResourceExtractor {
+	return func(r *http.Request) (interface{}, error) {
+		values, ok := matchPath(template, r.URL.Path)
+		if v := values[name]; ok && v != "" {
+			return v, nil
+		}
+		return nil, missing("resource", "path "+template, errBadRequest)
+	}
+}
+
+// matchPath khớp path với template theo từng đoạn; trả về giá trị các wildcard.
+func matchPath(template, path string) (map[string]string, bool) {
+	tmpl := strings.Split(strings.Trim(template, "/"), "/")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	values := make(map[string]string)
+	for i, seg := range tmpl {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "...}") {
+			if i > len(parts) {
+				return nil, false
+			}
+			values[strings.TrimSuffix(seg[1:], "...}")] = strings.Join(parts[i:], "/")
+			return values, true
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if parts[i] == "" {
+				return nil, false
+			}
+			values[seg[1:len(seg)-1]] = parts[i]
+			continue
+		}
+		if seg != parts[i] {
+			return nil, false
+		}
+	}
+	return values, len(tmpl) == len(parts)
+}
+
+// =========================================================================
+// == Action
+// =========================================================================
+
+// StaticAction dùng một action cố định, ví dụ cho middleware gắn vào một route.
+func StaticAction(action string) ActionExtractor {
+	return func(r *http.Request) (string, error) { return action, nil }
+}
+
+// DefaultMethodActions là ánh xạ method → action mặc định của ActionFromMethod.
+var DefaultMethodActions = map[string]string{
+	http.MethodGet:    "read",
+	http.MethodHead:   "read",
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// ActionFromMethod ánh xạ HTTP method sang action (nil: DefaultMethodActions).
+func ActionFromMethod(actions map[string]string) ActionExtractor {
+	if actions == nil {
+		actions = DefaultMethodActions
+	}
+	return func(r *http.Request) (string, error) {
+		if action, ok := actions[r.Method]; ok {
+			return action, nil
+		}
+		return "", fmt.Errorf("%w: method %s", ErrNoAction, r.Method)
+	}
+}
+
+// Route ánh xạ method + template đường dẫn sang action. Method rỗng khớp mọi method.
+type Route struct {
+	Method  string
+	Pattern string // cú pháp như ResourceFromPath: "/requests/{id}/approve"
+	Action  string
+}
+
+// ActionFromRoutes trả về action của route đầu tiên khớp với request; không route nào khớp
+// thì request bị từ chối (403).
+func ActionFromRoutes(routes ...Route) ActionExtractor {
+	routes = append([]Route(nil), routes...)
+	return func(r *http.Request) (string, error) {
+		for _, route := range routes {
+			if route.Method != "" && !strings.EqualFold(route.Method, r.Method) {
+				continue
+			}
+			if _, ok := matchPath(route.Pattern, r.URL.Path); ok {
+				return route.Action, nil
+			}
+		}
+		return "", fmt.Errorf("%w: %s %s", ErrNoAction, r.Method, r.URL.Path)
+	}
+}
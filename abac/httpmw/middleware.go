@@ -0,0 +1,230 @@
+// Package httpmw cung cấp middleware net/http (PEP) kiểm tra quyền bằng abac.Authorizer
+// trước khi gọi handler: lấy tenant, subject, resource, action từ request qua các extractor,
+// tự điền thuộc tính môi trường (IP, thời gian, user agent), từ chối bằng 401/403/404/500 và
+// lưu quyết định vào context của request.
+//
+//	authz := httpmw.Middleware(authorizer,
+//	    httpmw.WithTokenVerifier(verify),
+//	    httpmw.WithTenant(httpmw.TenantFromClaim("tenant")),
+//	    httpmw.WithResource(httpmw.ResourceFromPathValue("id")),
+//	    httpmw.WithAction(httpmw.ActionFromRoutes(
+//	        httpmw.Route{Method: "POST", Pattern: "/requests/{id}/approve", Action: "approve_level_2"},
+//	    )),
+//	)
+//	mux.Handle("POST /requests/{id}/approve", authz(approveHandler))
+package httpmw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/duclek15/go-abac-library/abac"
+)
+
+// Decider là phần của abac.Authorizer mà middleware cần.
+type Decider interface {
+	Decide(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrs *abac.Attributes) abac.Decision
+}
+
+var (
+	// ErrUnauthenticated được trả về khi request không có (hoặc có sai) thông tin xác thực;
+	// middleware trả về 401.
+	ErrUnauthenticated = errors.New("missing or invalid credentials")
+
+	// ErrNoAction được trả về khi không ánh xạ được request sang action nào; middleware trả về 403.
+	ErrNoAction = errors.New("no action mapped for request")
+)
+
+// config chứa các tùy chọn của middleware.
+type config struct {
+	tenant   TenantExtractor
+	subject  SubjectExtractor
+	resource ResourceExtractor
+	action   ActionExtractor
+
+	verifier     TokenVerifier
+	defaultEnv   bool
+	env          []EnvExtractor
+	trusted      []netip.Prefix
+	now          func() time.Time
+	deny         DenyHandler
+	format       DenyFormat
+	exposeReason bool
+}
+
+// Option là tùy chọn của Middleware.
+type Option interface{ apply(*config) }
+
+type optFunc func(*config)
+
+func (f optFunc) apply(c *config) { f(c) }
+
+// WithTenant chọn cách lấy tenant (mặc định: header X-Tenant-ID).
+func WithTenant(e TenantExtractor) Option {
+	return optFunc(func(c *config) { c.tenant = e })
+}
+
+// WithSubject chọn cách lấy subject truyền vào SubjectFetcher (mặc định: claim "sub").
+func WithSubject(e SubjectExtractor) Option {
+	return optFunc(func(c *config) { c.subject = e })
+}
+
+// WithResource chọn cách lấy resource truyền vào ResourceFetcher (mặc định: đường dẫn URL).
+func WithResource(e ResourceExtractor) Option {
+	return optFunc(func(c *config) { c.resource = e })
+}
+
+// WithAction chọn cách lấy action (mặc định: ActionFromMethod(nil)).
+func WithAction(e ActionExtractor) Option {
+	return optFunc(func(c *config) { c.action = e })
+}
+
+// WithTokenVerifier xác thực bearer token ở header Authorization trước mọi extractor; claims
+// được lưu vào context (xem ClaimsFromContext, SubjectFromClaim, TenantFromClaim). Request
+// không có token hoặc token không hợp lệ bị từ chối với 401.
+func WithTokenVerifier(v TokenVerifier) Option {
+	return optFunc(func(c *config) { c.verifier = v })
+}
+
+// WithDenyHandler thay response mặc định khi request bị từ chối.
+func WithDenyHandler(h DenyHandler) Option {
+	return optFunc(func(c *config) { c.deny = h })
+}
+
+// WithDenyFormat chọn định dạng response mặc định khi từ chối (mặc định: DenyJSON).
+func WithDenyFormat(f DenyFormat) Option {
+	return optFunc(func(c *config) { c.format = f })
+}
+
+// WithDecisionReason đưa Decision.Reason vào response khi từ chối. Reason có thể lộ ID và nội
+// dung policy, chỉ nên bật khi debug.
+func WithDecisionReason() Option {
+	return optFunc(func(c *config) { c.exposeReason = true })
+}
+
+// Middleware trả về middleware kiểm tra quyền bằng decider.Decide trước khi gọi handler.
+// Quyết định (kể cả khi bị từ chối) được lưu vào context, lấy ra bằng DecisionFromContext;
+// obligation của quyết định Permit do handler thực hiện (abac.Authorizer.Fulfill).
+func Middleware(decider Decider, opts ...Option) func(http.Handler) http.Handler {
+	cfg := &config{
+		tenant:     TenantFromHeader("X-Tenant-ID"),
+		subject:    SubjectFromClaim("sub"),
+		resource:   ResourceFromURLPath(),
+		action:     ActionFromMethod(nil),
+		defaultEnv: true,
+		now:        time.Now,
+	}
+	for _, o := range opts {
+		if o != nil {
+			o.apply(cfg)
+		}
+	}
+	if cfg.deny == nil {
+		cfg.deny = defaultDenyHandler(cfg.format, cfg.exposeReason)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r, d := cfg.decide(decider, r)
+			r = r.WithContext(context.WithValue(r.Context(), decisionKey{}, d))
+			if !d.Allowed() {
+				cfg.deny(w, r, statusOf(d), d)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// decide chạy các extractor và gọi Decide; lỗi của extractor trở thành quyết định Indeterminate.
+func (c *config) decide(decider Decider, r *http.Request) (*http.Request, abac.Decision) {
+	if c.verifier != nil {
+		token, ok := bearerToken(r)
+		if !ok {
+			return r, failed(ErrUnauthenticated)
+		}
+		claims, err := c.verifier(r.Context(), token)
+		if err != nil {
+			return r, failed(errors.Join(ErrUnauthenticated, err))
+		}
+		r = r.WithContext(ContextWithClaims(r.Context(), claims))
+	}
+
+	tenantID, err := c.tenant(r)
+	if err != nil {
+		return r, failed(err)
+	}
+	subject, err := c.subject(r)
+	if err != nil {
+		return r, failed(err)
+	}
+	resource, err := c.resource(r)
+	if err != nil {
+		return r, failed(err)
+	}
+	action, err := c.action(r)
+	if err != nil {
+		return r, failed(err)
+	}
+
+	env := make(abac.Attributes)
+	if c.defaultEnv {
+		c.populateEnv(r, env)
+	}
+	for _, e := range c.env {
+		e(r, env)
+	}
+	ctx := r.Context()
+	return r, decider.Decide(&ctx, tenantID, subject, resource, action, &env)
+}
+
+func failed(err error) abac.Decision {
+	return abac.Decision{Effect: abac.Indeterminate, Reason: err.Error(), Errors: []error{err}}
+}
+
+// bearerToken đọc token từ header "Authorization: Bearer <token>".
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+// statusOf chọn mã HTTP cho quyết định không Permit.
+func statusOf(d abac.Decision) int {
+	if d.Effect != abac.Indeterminate {
+		return http.StatusForbidden
+	}
+	var err error
+	if len(d.Errors) > 0 {
+		err = d.Errors[0]
+	}
+	switch {
+	case errors.Is(err, ErrUnauthenticated), errors.Is(err, abac.ErrSubjectNotFound):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrNoAction):
+		return http.StatusForbidden
+	case errors.Is(err, abac.ErrResourceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errBadRequest):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+type (
+	decisionKey struct{}
+	claimsKey   struct{}
+)
+
+// DecisionFromContext trả về quyết định của middleware cho request.
+func DecisionFromContext(ctx context.Context) (abac.Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(abac.Decision)
+	return d, ok
+}
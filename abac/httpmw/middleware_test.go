@@ -0,0 +1,268 @@
+package httpmw_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/abac/httpmw"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testModel = `
+[request_definition]
+r = tenant, req
+
+[policy_definition]
+p = tenant, rule, eft, id
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)`
+
+const testPolicies = `
+p, tenant1, "Action == 'approve_level_2' && Resource.department == 'engineering'", allow, approve_eng
+p, *, "Action == 'read' && isIpInCidr(Env.ip_address, '10.0.0.0/8')", allow, read_internal`
+
+var testTokens = map[string]map[string]interface{}{
+	"t1-token":      {"sub": "t1_hr_manager", "tenant": "tenant1"},
+	"t2-token":      {"sub": "t2_hr_manager", "tenant": "tenant2"},
+	"unknown-token": {"sub": "nobody", "tenant": "tenant1"},
+}
+
+func verifyTestToken(ctx context.Context, token string) (map[string]interface{}, error) {
+	if claims, ok := testTokens[token]; ok {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func newTestServer(t *testing.T, opts ...httpmw.Option) http.Handler {
+	t.Helper()
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(testModel, testPolicies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+
+	authz := httpmw.Middleware(authorizer, append([]httpmw.Option{
+		httpmw.WithTokenVerifier(verifyTestToken),
+		httpmw.WithTenant(httpmw.TenantFromClaim("tenant")),
+		httpmw.WithResource(httpmw.ResourceFromPathValue("id")),
+		httpmw.WithAction(httpmw.ActionFromRoutes(
+			httpmw.Route{Method: http.MethodPost, Pattern: "/requests/{id}/approve", Action: "approve_level_2"},
+			httpmw.Route{Method: http.MethodGet, Pattern: "/requests/{id}", Action: "read"},
+		)),
+	}, opts...)...)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, ok := httpmw.DecisionFromContext(r.Context())
+		require.True(t, ok)
+		_ = json.NewEncoder(w).Encode(d)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("POST /requests/{id}/approve", authz(handler))
+	mux.Handle("GET /requests/{id}", authz(handler))
+	mux.Handle("DELETE /requests/{id}", authz(handler))
+	return mux
+}
+
+func serve(h http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_Decisions(t *testing.T) {
+	h := newTestServer(t)
+
+	rec := serve(h, http.MethodPost, "/requests/t1_eng_request/approve", "t1-token")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var d abac.Decision
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &d))
+	assert.Equal(t, abac.Permit, d.Effect)
+	assert.Equal(t, []string{"approve_eng"}, d.PolicyIDs)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		status int
+		effect abac.DecisionEffect
+	}{
+		{"other tenant", http.MethodPost, "/requests/t1_eng_request/approve", "t2-token", http.StatusForbidden, abac.NotApplicable},
+		{"no token", http.MethodPost, "/requests/t1_eng_request/approve", "", http.StatusUnauthorized, abac.Indeterminate},
+		{"invalid token", http.MethodPost, "/requests/t1_eng_request/approve", "forged", http.StatusUnauthorized, abac.Indeterminate},
+		{"unknown subject", http.MethodPost, "/requests/t1_eng_request/approve", "unknown-token", http.StatusUnauthorized, abac.Indeterminate},
+		{"unknown resource", http.MethodPost, "/requests/missing/approve", "t1-token", http.StatusNotFound, abac.Indeterminate},
+		{"no action mapped", http.MethodDelete, "/requests/t1_eng_request", "t1-token", http.StatusForbidden, abac.Indeterminate},
+		// RemoteAddr của httptest là 192.0.2.1, không thuộc 10.0.0.0/8.
+		{"env ip", http.MethodGet, "/requests/t1_eng_request", "t1-token", http.StatusForbidden, abac.NotApplicable},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := serve(h, tc.method, tc.path, tc.token)
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, string(tc.effect), body["effect"])
+			assert.Equal(t, float64(tc.status), body["status"])
+			assert.NotContains(t, body, "reason")
+		})
+	}
+}
+
+func TestMiddleware_ProblemJSONAndTrustedProxy(t *testing.T) {
+	h := newTestServer(t,
+		httpmw.WithDenyFormat(httpmw.DenyProblemJSON),
+		httpmw.WithDecisionReason(),
+		httpmw.WithTrustedProxies(netip.MustParsePrefix("192.0.2.0/24")))
+
+	rec := serve(h, http.MethodPost, "/requests/t1_eng_request/approve", "t2-token")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+	var problem map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, "about:blank", problem["type"])
+	assert.Equal(t, "Forbidden", problem["title"])
+	assert.Equal(t, "no allow rule matched (default deny)", problem["detail"])
+
+	// Request qua proxy tin cậy: IP client lấy từ X-Forwarded-For.
+	req := httptest.NewRequest(http.MethodGet, "/requests/t1_eng_request", nil)
+	req.Header.Set("Authorization", "Bearer t1-token")
+	req.Header.Set("X-Forwarded-For", "10.1.2.3, 192.0.2.7")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+type recordingDecider struct {
+	tenantID string
+	subject  interface{}
+	resource interface{}
+	action   string
+	env      abac.Attributes
+}
+
+func (d *recordingDecider) Decide(ctx *context.Context, tenantID string, subject interface{}, resource interface{}, action string, envAttrs *abac.Attributes) abac.Decision {
+	d.tenantID, d.subject, d.resource, d.action, d.env = tenantID, subject, resource, action, *envAttrs
+	return abac.Decision{Effect: abac.Deny, Reason: "deny rule secret matched"}
+}
+
+func TestMiddleware_ExtractorsAndEnv(t *testing.T) {
+	decider := &recordingDecider{}
+	now := time.Date(2026, 3, 16, 9, 30, 0, 0, time.UTC)
+	var denied int
+	authz := httpmw.Middleware(decider,
+		httpmw.WithSubject(httpmw.SubjectFromHeader("X-User")),
+		httpmw.WithResource(httpmw.ResourceFromPath("/docs/{path...}", "path")),
+		httpmw.WithClock(func() time.Time { return now }),
+		httpmw.WithEnv(func(r *http.Request, env abac.Attributes) { env["method"] = r.Method }),
+		httpmw.WithDenyHandler(func(w http.ResponseWriter, r *http.Request, status int, d abac.Decision) {
+			denied = status
+			stored, ok := httpmw.DecisionFromContext(r.Context())
+			assert.True(t, ok)
+			assert.Equal(t, d, stored)
+			w.WriteHeader(status)
+		}))
+
+	req := httptest.NewRequest(http.MethodPatch, "/docs/a/b.txt", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	req.Header.Set("X-User", "alice")
+	req.Header.Set("User-Agent", "test-agent")
+	rec := httptest.NewRecorder()
+	authz(http.NotFoundHandler()).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, http.StatusForbidden, denied)
+	assert.Equal(t, "tenant1", decider.tenantID)
+	assert.Equal(t, "alice", decider.subject)
+	assert.Equal(t, "a/b.txt", decider.resource)
+	assert.Equal(t, "update", decider.action)
+	assert.Equal(t, abac.Attributes{
+		httpmw.EnvIPAddress: "192.0.2.1",
+		httpmw.EnvTime:      "2026-03-16T09:30:00Z",
+		httpmw.EnvTimeOfDay: 9.5,
+		httpmw.EnvUserAgent: "test-agent",
+		"method":            http.MethodPatch,
+	}, decider.env)
+
+	// Thiếu tenant: 400, decider không được gọi.
+	decider.tenantID = ""
+	req = httptest.NewRequest(http.MethodGet, "/docs/a", nil)
+	req.Header.Set("X-User", "alice")
+	rec = httptest.NewRecorder()
+	authz(http.NotFoundHandler()).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, decider.tenantID)
+
+	// Resource không khớp template.
+	req = httptest.NewRequest(http.MethodGet, "/files/a", nil)
+	req.Header.Set("X-Tenant-ID", "tenant1")
+	req.Header.Set("X-User", "alice")
+	rec = httptest.NewRecorder()
+	authz(http.NotFoundHandler()).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestActionFromRoutes(t *testing.T) {
+	action := httpmw.ActionFromRoutes(
+		httpmw.Route{Method: http.MethodPost, Pattern: "/requests/{id}/approve", Action: "approve"},
+		httpmw.Route{Pattern: "/requests/{id}", Action: "manage"},
+		httpmw.Route{Method: http.MethodGet, Pattern: "/files/{rest...}", Action: "download"},
+	)
+	tests := []struct {
+		method, path, want string
+	}{
+		{http.MethodPost, "/requests/42/approve", "approve"},
+		{http.MethodDelete, "/requests/42/", "manage"},
+		{http.MethodGet, "/files/a/b/c", "download"},
+		{http.MethodGet, "/files", "download"},
+	}
+	for _, tc := range tests {
+		got, err := action(httptest.NewRequest(tc.method, tc.path, nil))
+		require.NoError(t, err, tc.path)
+		assert.Equal(t, tc.want, got, tc.path)
+	}
+	for _, path := range []string{"/requests/42/reject", "/requests", "/other"} {
+		_, err := action(httptest.NewRequest(http.MethodPost, path, nil))
+		assert.ErrorIs(t, err, httpmw.ErrNoAction, path)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{"direct", "203.0.113.5:4000", map[string]string{"X-Forwarded-For": "1.1.1.1"}, "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.9, 10.0.0.2"}, "198.51.100.9"},
+		{"ipv6 proxy", "[::1]:4000", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+		{"spoofed value", "10.0.0.1:4000", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.0.0.1"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tc.remote
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		assert.Equal(t, tc.want, httpmw.ClientIP(req, trusted...), tc.name)
+	}
+}
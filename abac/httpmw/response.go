@@ -0,0 +1,55 @@
+package httpmw
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/duclek15/go-abac-library/abac"
+)
+
+// DenyHandler viết response khi request không được phép. status là mã HTTP middleware chọn:
+// 401 (thiếu/sai xác thực, subject không tồn tại), 403 (Deny, NotApplicable, không có action),
+// 404 (resource không tồn tại), 400 (thiếu tenant/resource), 500 (lỗi khi đánh giá).
+type DenyHandler func(w http.ResponseWriter, r *http.Request, status int, d abac.Decision)
+
+// DenyFormat là định dạng response mặc định khi từ chối.
+type DenyFormat int
+
+const (
+	// DenyJSON: {"error": "Forbidden", "status": 403, "effect": "deny"} với Content-Type application/json.
+	DenyJSON DenyFormat = iota
+	// DenyProblemJSON: problem details theo RFC 9457 với Content-Type application/problem+json.
+	DenyProblemJSON
+)
+
+func defaultDenyHandler(format DenyFormat, exposeReason bool) DenyHandler {
+	return func(w http.ResponseWriter, r *http.Request, status int, d abac.Decision) {
+		var reason string
+		if exposeReason {
+			reason = d.Reason
+		}
+		var body interface{}
+		contentType := "application/json"
+		switch format {
+		case DenyProblemJSON:
+			contentType = "application/problem+json"
+			body = struct {
+				Type   string              `json:"type"`
+				Title  string              `json:"title"`
+				Status int                 `json:"status"`
+				Detail string              `json:"detail,omitempty"`
+				Effect abac.DecisionEffect `json:"effect"`
+			}{"about:blank", http.StatusText(status), status, reason, d.Effect}
+		default:
+			body = struct {
+				Error  string              `json:"error"`
+				Status int                 `json:"status"`
+				Effect abac.DecisionEffect `json:"effect"`
+				Reason string              `json:"reason,omitempty"`
+			}{http.StatusText(status), status, d.Effect, reason}
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
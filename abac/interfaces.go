@@ -15,3 +15,10 @@ type SubjectFetcher interface {
 type ResourceFetcher interface {
 	GetResourceAttributes(ctx *context.Context, resource interface{}) ([]Attributes, error)
 }
+
+// SubjectEnumerator liệt kê các subject ứng viên (thường từ kho người dùng) cho truy vấn ngược
+// "ai được phép làm X trên Y". EnumerateSubjects gọi yield cho từng subject theo thứ tự
+// và phải dừng sớm khi yield trả về false.
+type SubjectEnumerator interface {
+	EnumerateSubjects(ctx *context.Context, tenantID string, yield func(subject interface{}) bool) error
+}
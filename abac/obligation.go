@@ -0,0 +1,175 @@
+package abac
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Obligation là một yêu cầu đi kèm quyết định mà PEP phải (obligation) hoặc nên (advice)
+// thực hiện, ví dụ "mask:Resource.salary" hay "notify:compliance".
+type Obligation struct {
+	Name string `json:"name"`
+	// Argument là phần sau dấu ':' đầu tiên, giữ nguyên dạng chuỗi (rỗng nếu không có).
+	Argument string `json:"argument,omitempty"`
+	PolicyID string `json:"policy_id"`
+}
+
+func (o Obligation) String() string {
+	if o.Argument == "" {
+		return o.Name
+	}
+	return o.Name + ":" + o.Argument
+}
+
+// adviceMarker là tiền tố đánh dấu một advice trong biểu thức obligation của policy.
+const adviceMarker = "advice:"
+
+// ParseObligations tách biểu thức obligation của policy thành obligation bắt buộc và advice.
+// Các mục cách nhau bởi ';', mỗi mục có dạng name hoặc name:argument; mục có tiền tố
+// "advice:" là advice. Ví dụ: "mask:Resource.salary; advice:notify:compliance".
+func ParseObligations(expr string) (obligations, advice []Obligation, err error) {
+	obligations, advice, err = parseObligations(expr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+	return obligations, advice, nil
+}
+
+func parseObligations(expr string) (obligations, advice []Obligation, err error) {
+	for _, item := range strings.Split(expr, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		isAdvice := strings.HasPrefix(item, adviceMarker)
+		if isAdvice {
+			item = strings.TrimSpace(strings.TrimPrefix(item, adviceMarker))
+		}
+		name, arg, _ := strings.Cut(item, ":")
+		name, arg = strings.TrimSpace(name), strings.TrimSpace(arg)
+		if !isObligationName(name) {
+			return nil, nil, fmt.Errorf("obligation '%s' không hợp lệ, tên phải là định danh", item)
+		}
+		ob := Obligation{Name: name, Argument: arg}
+		if isAdvice {
+			advice = append(advice, ob)
+		} else {
+			obligations = append(obligations, ob)
+		}
+	}
+	return obligations, advice, nil
+}
+
+func isObligationName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+		case i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ObligationHandler thực thi một obligation hoặc advice tại PEP. target là đối tượng PEP
+// truyền vào Fulfill (ví dụ: dữ liệu trả về cần che bớt trường).
+type ObligationHandler func(ctx context.Context, ob Obligation, target interface{}) error
+
+// obligationRegistry là bộ handler theo tên obligation, dùng chung giữa Authorizer và engine.
+type obligationRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]ObligationHandler
+}
+
+func newObligationRegistry(handlers map[string]ObligationHandler) *obligationRegistry {
+	r := &obligationRegistry{handlers: make(map[string]ObligationHandler, len(handlers))}
+	for name, h := range handlers {
+		if h != nil {
+			r.handlers[name] = h
+		}
+	}
+	return r
+}
+
+func (r *obligationRegistry) handler(name string) (ObligationHandler, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h, ok := r.handlers[name]
+	return h, ok
+}
+
+// unhandled trả về obligation bắt buộc đầu tiên chưa có handler.
+func (r *obligationRegistry) unhandled(obligations []Obligation) (Obligation, bool) {
+	for _, ob := range obligations {
+		if _, ok := r.handler(ob.Name); !ok {
+			return ob, true
+		}
+	}
+	return Obligation{}, false
+}
+
+// WithObligationHandler đăng ký handler cho obligation/advice có tên name.
+func WithObligationHandler(name string, h ObligationHandler) SystemOption {
+	return systemOptFunc(func(c *systemConfig) {
+		if c.obligationHandlers == nil {
+			c.obligationHandlers = make(map[string]ObligationHandler)
+		}
+		c.obligationHandlers[name] = h
+	})
+}
+
+// RegisterObligationHandler đăng ký (h nil: gỡ) handler cho obligation/advice lúc đang chạy.
+func (a *Authorizer) RegisterObligationHandler(name string, h ObligationHandler) {
+	r := a.engine.obligations
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h == nil {
+		delete(r.handlers, name)
+		return
+	}
+	r.handlers[name] = h
+}
+
+// ObligationHandlers trả về tên các obligation đã có handler, theo thứ tự chữ cái.
+func (a *Authorizer) ObligationHandlers() []string {
+	r := a.engine.obligations
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fulfill gọi handler cho các obligation và advice của quyết định. Lỗi của một obligation
+// bắt buộc (hoặc obligation không có handler) được trả về ngay và PEP phải từ chối request;
+// advice không có handler hoặc handler lỗi được bỏ qua.
+func (a *Authorizer) Fulfill(ctx context.Context, d Decision, target interface{}) error {
+	for _, ob := range d.Obligations {
+		h, ok := a.engine.obligations.handler(ob.Name)
+		if !ok {
+			return fmt.Errorf("obligation %s of policy %s has no registered handler", ob, ob.PolicyID)
+		}
+		if err := h(ctx, ob, target); err != nil {
+			return fmt.Errorf("obligation %s of policy %s failed: %w", ob, ob.PolicyID, err)
+		}
+	}
+	for _, ob := range d.Advice {
+		if h, ok := a.engine.obligations.handler(ob.Name); ok {
+			_ = h(ctx, ob, target)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package abac_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var obligationTestModel = strings.Replace(traceTestModel, "p = tenant, rule, eft, id", "p = tenant, rule, eft, id, obligations", 1)
+
+func TestParseObligations(t *testing.T) {
+	obligations, advice, err := abac.ParseObligations(" mask:Resource.salary ; advice:notify:compliance;audit ")
+	require.NoError(t, err)
+	assert.Equal(t, []abac.Obligation{{Name: "mask", Argument: "Resource.salary"}, {Name: "audit"}}, obligations)
+	assert.Equal(t, []abac.Obligation{{Name: "notify", Argument: "compliance"}}, advice)
+
+	obligations, advice, err = abac.ParseObligations("")
+	require.NoError(t, err)
+	assert.Empty(t, obligations)
+	assert.Empty(t, advice)
+
+	for _, expr := range []string{":salary", "advice:", "mask salary:x", "1mask"} {
+		_, _, err := abac.ParseObligations(expr)
+		assert.ErrorIs(t, err, abac.ErrInvalidPolicy, expr)
+	}
+}
+
+func TestAuthorizer_Decide_Obligations(t *testing.T) {
+	policies := `
+p, *, "Action == 'approve_level_2'", allow, allow_approve, "mask:Resource.salary; advice:notify:compliance"
+p, *, "Action == 'approve_level_2' && Resource.department == 'engineering'", allow, allow_engineering, audit
+p, *, "Action == 'delete'", deny, deny_delete, "advice:request_approval:manager"`
+	mockFetcher := &mocks.MockFetcher{}
+	var masked []string
+	mask := func(ctx context.Context, ob abac.Obligation, target interface{}) error {
+		masked = append(masked, ob.Argument)
+		return nil
+	}
+	authorizer, _, err := abac.NewABACSystemFromStrings(obligationTestModel, policies, mockFetcher, mockFetcher, nil,
+		abac.WithObligationHandler("mask", mask))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// "audit" chưa có handler nên allow bị chuyển thành deny.
+	d := authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	assert.Equal(t, abac.Deny, d.Effect)
+	assert.Contains(t, d.Reason, "audit")
+	assert.Empty(t, d.Obligations)
+	allowed, err := authorizer.Check(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	var audited bool
+	authorizer.RegisterObligationHandler("audit", func(ctx context.Context, ob abac.Obligation, target interface{}) error {
+		audited = true
+		return nil
+	})
+	assert.Equal(t, []string{"audit", "mask"}, authorizer.ObligationHandlers())
+
+	d = authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	require.Equal(t, abac.Permit, d.Effect)
+	assert.Equal(t, []abac.Obligation{
+		{Name: "mask", Argument: "Resource.salary", PolicyID: "allow_approve"},
+		{Name: "audit", PolicyID: "allow_engineering"},
+	}, d.Obligations)
+	assert.Equal(t, []abac.Obligation{{Name: "notify", Argument: "compliance", PolicyID: "allow_approve"}}, d.Advice)
+
+	// Advice "notify" không có handler nên được bỏ qua.
+	require.NoError(t, authorizer.Fulfill(ctx, d, nil))
+	assert.Equal(t, []string{"Resource.salary"}, masked)
+	assert.True(t, audited)
+
+	// Obligation của deny vẫn được trả về, kể cả khi không có handler.
+	d = authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "delete", nil)
+	assert.Equal(t, abac.Deny, d.Effect)
+	assert.Equal(t, []abac.Obligation{{Name: "request_approval", Argument: "manager", PolicyID: "deny_delete"}}, d.Advice)
+
+	authorizer.RegisterObligationHandler("audit", nil)
+	d = authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	assert.Equal(t, abac.Deny, d.Effect)
+}
+
+func TestAuthorizer_BooleanAPIsDenyPermitWithObligations(t *testing.T) {
+	policies := `
+p, *, "Action == 'read'", allow, allow_read, "mask:Resource.salary"
+p, *, "Action == 'list'", allow, allow_list, "advice:notify:compliance"`
+	mockFetcher := &mocks.MockFetcher{}
+	noop := func(ctx context.Context, ob abac.Obligation, target interface{}) error { return nil }
+	authorizer, _, err := abac.NewABACSystemFromStrings(obligationTestModel, policies, mockFetcher, mockFetcher, nil,
+		abac.WithObligationHandler("mask", noop))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Decide trả về Permit kèm obligation để PEP gọi Fulfill.
+	d := authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "read", nil)
+	require.Equal(t, abac.Permit, d.Effect)
+	require.Len(t, d.Obligations, 1)
+
+	// Các API dạng bool không thực hiện được obligation nên từ chối; advice không ảnh hưởng.
+	allowed, err := authorizer.Check(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	allowed, _, err = authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "read", nil)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	allowed, err = authorizer.Check(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "list", nil)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	actions, err := authorizer.AllowedActions(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"list"}, actions)
+
+	subjects, err := authorizer.SubjectsAllowed(&ctx, "tenant1", sliceEnumerator{"t1_hr_manager"}, "t1_eng_request", "read", nil)
+	require.NoError(t, err)
+	assert.Empty(t, subjects)
+}
+
+func TestAuthorizer_Fulfill_Errors(t *testing.T) {
+	mockFetcher := &mocks.MockFetcher{}
+	failure := errors.New("mask failed")
+	authorizer, _, err := abac.NewABACSystemFromStrings(obligationTestModel, "", mockFetcher, mockFetcher, nil,
+		abac.WithObligationHandler("mask", func(ctx context.Context, ob abac.Obligation, target interface{}) error {
+			return failure
+		}),
+		abac.WithObligationHandler("notify", func(ctx context.Context, ob abac.Obligation, target interface{}) error {
+			return failure
+		}))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	advice := abac.Decision{Effect: abac.Permit, Advice: []abac.Obligation{{Name: "notify"}, {Name: "unknown"}}}
+	assert.NoError(t, authorizer.Fulfill(ctx, advice, nil))
+
+	failing := abac.Decision{Effect: abac.Permit, Obligations: []abac.Obligation{{Name: "mask", PolicyID: "p1"}}}
+	assert.ErrorIs(t, authorizer.Fulfill(ctx, failing, nil), failure)
+
+	missing := abac.Decision{Effect: abac.Permit, Obligations: []abac.Obligation{{Name: "audit", PolicyID: "p1"}}}
+	assert.Error(t, authorizer.Fulfill(ctx, missing, nil))
+}
+
+func TestPolicyManager_Obligations(t *testing.T) {
+	mockFetcher := &mocks.MockFetcher{}
+	_, pm, err := abac.NewABACSystemFromStrings(obligationTestModel, "", mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+
+	p, err := pm.CreatePolicy(abac.Policy{TenantID: "*", Rule: "Action == 'read'", Effect: "allow", Obligations: "mask:Resource.salary"})
+	require.NoError(t, err)
+	stored, err := pm.GetPolicyByID(p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "mask:Resource.salary", stored.Obligations)
+
+	_, err = pm.CreatePolicy(abac.Policy{TenantID: "*", Rule: "Action == 'write'", Effect: "allow", Obligations: "mask salary"})
+	var verr *abac.PolicyValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, abac.ValidationObligation, verr.Issues[0].Code)
+
+	_, pm, err = abac.NewABACSystemFromStrings(traceTestModel, "", mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	_, err = pm.CreatePolicy(abac.Policy{TenantID: "*", Rule: "Action == 'read'", Effect: "allow", Obligations: "audit"})
+	assert.ErrorIs(t, err, abac.ErrObligationsNotSupported)
+}
@@ -0,0 +1,116 @@
+package abac
+
+import "gorm.io/gorm"
+
+// systemConfig chứa các tùy chọn khi khởi tạo hệ thống qua factory function.
+type systemConfig struct {
+	metadataStore  PolicyMetadataStore
+	policySetStore PolicySetStore
+	subjectCache   []CacheOption // nil: không cache thuộc tính subject
+	resourceCache  []CacheOption // nil: không cache thuộc tính resource
+	decisionCache  []CacheOption // nil: không cache quyết định
+
+	combiningAlgorithm CombiningAlgorithm
+	tenantAlgorithms   map[string]CombiningAlgorithm
+
+	obligationHandlers map[string]ObligationHandler
+
+	disableTargetIndex bool
+	indexCrossCheck    func(TargetIndexMismatch)
+
+	// autoMigrate cho phép factory DB tạo bảng metadata và bảng policy set (WithAutoMigrate).
+	autoMigrate bool
+
+	// policyDB và policyTable được đặt bởi các factory tạo hệ thống từ DB.
+	policyDB    *gorm.DB
+	policyTable string
+
+	// modelPath và policyPath được đặt bởi NewABACSystemFromFile.
+	modelPath  string
+	policyPath string
+}
+
+// SystemOption là tùy chọn truyền vào các factory function (NewABACSystemFrom...).
+type SystemOption interface{ apply(*systemConfig) }
+
+type systemOptFunc func(*systemConfig)
+
+func (f systemOptFunc) apply(c *systemConfig) { f(c) }
+
+// WithPolicyMetadataStore chỉ định nơi lưu metadata của policy.
+// Mặc định: bảng DefaultPolicyMetadataTable với hệ thống tạo từ DB nếu bảng đã có (hoặc với
+// WithAutoMigrate), bộ nhớ với các trường hợp còn lại.
+func WithPolicyMetadataStore(store PolicyMetadataStore) SystemOption {
+	return systemOptFunc(func(c *systemConfig) {
+		if store != nil {
+			c.metadataStore = store
+		}
+	})
+}
+
+// WithSubjectCache bọc SubjectFetcher bằng cache thuộc tính (xem NewCachingSubjectFetcher).
+// Dùng Authorizer.InvalidateSubjectAttributes để xóa cache khi thuộc tính của subject thay đổi.
+func WithSubjectCache(opts ...CacheOption) SystemOption {
+	return systemOptFunc(func(c *systemConfig) {
+		c.subjectCache = append([]CacheOption{}, opts...)
+	})
+}
+
+// WithResourceCache bọc ResourceFetcher bằng cache thuộc tính (xem NewCachingResourceFetcher).
+// Dùng Authorizer.InvalidateResourceAttributes để xóa cache khi thuộc tính của resource thay đổi.
+func WithResourceCache(opts ...CacheOption) SystemOption {
+	return systemOptFunc(func(c *systemConfig) {
+		c.resourceCache = append([]CacheOption{}, opts...)
+	})
+}
+
+// WithDecisionCache bật cache quyết định cuối cùng của Check (và các API không trace như
+// AllowedActions, SubjectsAllowed). Khóa gồm tenant, action và hash của thuộc tính subject,
+// resource, env; cache tự xóa mỗi khi PolicyManager thay đổi hoặc nạp lại policy.
+// CheckWithTrace luôn đánh giá đầy đủ. Dùng WithCacheEnvKeys/WithCacheExcludedEnvKeys để chọn
+// các khóa Env được đưa vào khóa cache.
+func WithDecisionCache(opts ...CacheOption) SystemOption {
+	return systemOptFunc(func(c *systemConfig) {
+		c.decisionCache = append([]CacheOption{}, opts...)
+	})
+}
+
+// WithAutoMigrate cho phép NewABACSystemFromDB* tạo bảng DefaultPolicyMetadataTable và
+// DefaultPolicySetTable trong database của policy nếu chưa có. Mặc định factory không chạy DDL:
+// bảng đã có thì được dùng, chưa có thì metadata và policy set chỉ nằm trong bộ nhớ.
+func WithAutoMigrate() SystemOption {
+	return systemOptFunc(func(c *systemConfig) { c.autoMigrate = true })
+}
+
+func newSystemConfig(opts []SystemOption) *systemConfig {
+	cfg := &systemConfig{}
+	for _, o := range opts {
+		if o != nil {
+			o.apply(cfg)
+		}
+	}
+	return cfg
+}
+
+// newDBSystemConfig dùng bảng metadata và bảng policy set trong cùng database nếu người dùng
+// không chỉ định PolicyMetadataStore/PolicySetStore khác và bảng đã có (hoặc WithAutoMigrate);
+// nếu không, store trong bộ nhớ được dùng (xem newSystem).
+func newDBSystemConfig(db *gorm.DB, policyTable string, opts []SystemOption) (*systemConfig, error) {
+	cfg := newSystemConfig(opts)
+	cfg.policyDB, cfg.policyTable = db, policyTable
+	if cfg.metadataStore == nil && (cfg.autoMigrate || db.Migrator().HasTable(DefaultPolicyMetadataTable)) {
+		store, err := newGormPolicyMetadataStore(db, DefaultPolicyMetadataTable, cfg.autoMigrate)
+		if err != nil {
+			return nil, err
+		}
+		cfg.metadataStore = store
+	}
+	if cfg.policySetStore == nil && (cfg.autoMigrate || db.Migrator().HasTable(DefaultPolicySetTable)) {
+		store, err := newGormPolicySetStore(db, DefaultPolicySetTable, cfg.autoMigrate)
+		if err != nil {
+			return nil, err
+		}
+		cfg.policySetStore = store
+	}
+	return cfg, nil
+}
@@ -0,0 +1,522 @@
+package abac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Các toán tử của Condition.
+const (
+	CondTrue  = "true"
+	CondFalse = "false"
+	CondAnd   = "and"
+	CondOr    = "or"
+	CondNot   = "not"
+	CondEq    = "eq"
+	CondNe    = "ne"
+	CondGt    = "gt"
+	CondGte   = "gte"
+	CondLt    = "lt"
+	CondLte   = "lte"
+	CondIn    = "in"
+)
+
+// Condition là cây điều kiện còn lại (residual) trên các thuộc tính Resource.*
+// sau khi mọi tham chiếu tới Subject, Env và Action đã được đánh giá.
+// Field là đường dẫn thuộc tính bỏ tiền tố "Resource." (ví dụ: "department", "owner.id").
+type Condition struct {
+	Op       string       `json:"op"`
+	Field    string       `json:"field,omitempty"`
+	Value    interface{}  `json:"value,omitempty"`
+	Children []*Condition `json:"children,omitempty"`
+}
+
+var (
+	condTrue  = &Condition{Op: CondTrue}
+	condFalse = &Condition{Op: CondFalse}
+)
+
+// Always cho biết điều kiện luôn đúng (mọi resource đều được phép).
+func (c *Condition) Always() bool { return c != nil && c.Op == CondTrue }
+
+// Never cho biết điều kiện luôn sai (không resource nào được phép).
+func (c *Condition) Never() bool { return c == nil || c.Op == CondFalse }
+
+// String in điều kiện dưới dạng biểu thức đọc được.
+func (c *Condition) String() string {
+	if c == nil {
+		return CondFalse
+	}
+	switch c.Op {
+	case CondTrue, CondFalse:
+		return c.Op
+	case CondAnd, CondOr:
+		parts := make([]string, len(c.Children))
+		for i, child := range c.Children {
+			parts[i] = child.String()
+		}
+		sep := " && "
+		if c.Op == CondOr {
+			sep = " || "
+		}
+		return "(" + strings.Join(parts, sep) + ")"
+	case CondNot:
+		inner := c.Children[0].String()
+		if !strings.HasPrefix(inner, "(") {
+			inner = "(" + inner + ")"
+		}
+		return "!" + inner
+	}
+	return fmt.Sprintf("Resource.%s %s %s", c.Field, condSymbols[c.Op], formatConditionValue(c.Value))
+}
+
+var condSymbols = map[string]string{
+	CondEq: "==", CondNe: "!=", CondGt: ">", CondGte: ">=", CondLt: "<", CondLte: "<=", CondIn: "in",
+}
+
+func formatConditionValue(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return "'" + x + "'"
+	case []interface{}:
+		parts := make([]string, len(x))
+		for i, item := range x {
+			parts[i] = formatConditionValue(item)
+		}
+		return "(" + strings.Join(parts, ", ") + ")"
+	}
+	return fmt.Sprint(v)
+}
+
+// GormScope chuyển điều kiện thành scope của GORM để đưa việc phân quyền vào mệnh đề WHERE.
+// columns ánh xạ Field sang tên cột; Field không có trong columns được dùng trực tiếp làm tên cột
+// (dấu "." được thay bằng "_").
+func (c *Condition) GormScope(columns map[string]string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if c.Always() {
+			return db
+		}
+		return db.Clauses(clause.Where{Exprs: []clause.Expression{c.gormExpr(columns)}})
+	}
+}
+
+func (c *Condition) gormExpr(columns map[string]string) clause.Expression {
+	if c == nil {
+		return clause.Expr{SQL: "1 = 0"}
+	}
+	column := func() clause.Column {
+		if name, ok := columns[c.Field]; ok {
+			return clause.Column{Name: name}
+		}
+		return clause.Column{Name: strings.ReplaceAll(c.Field, ".", "_")}
+	}
+	children := func() []clause.Expression {
+		out := make([]clause.Expression, len(c.Children))
+		for i, child := range c.Children {
+			out[i] = child.gormExpr(columns)
+		}
+		return out
+	}
+	switch c.Op {
+	case CondTrue:
+		return clause.Expr{SQL: "1 = 1"}
+	case CondAnd:
+		return clause.And(children()...)
+	case CondOr:
+		return clause.Or(children()...)
+	case CondNot:
+		return clause.Not(children()...)
+	case CondEq:
+		return clause.Eq{Column: column(), Value: c.Value}
+	case CondNe:
+		return clause.Neq{Column: column(), Value: c.Value}
+	case CondGt:
+		return clause.Gt{Column: column(), Value: c.Value}
+	case CondGte:
+		return clause.Gte{Column: column(), Value: c.Value}
+	case CondLt:
+		return clause.Lt{Column: column(), Value: c.Value}
+	case CondLte:
+		return clause.Lte{Column: column(), Value: c.Value}
+	case CondIn:
+		values, _ := c.Value.([]interface{})
+		return clause.IN{Column: column(), Values: values}
+	}
+	return clause.Expr{SQL: "1 = 0"}
+}
+
+// =========================================================================
+// == Partial evaluation
+// =========================================================================
+
+// PartialEvaluate đánh giá trước mọi tham chiếu tới Subject, Env và Action trong các policy
+// của tenant và trả về điều kiện còn lại trên Resource.*: một resource được phép khi và chỉ khi
+// nó thỏa điều kiện này (theo thuật toán kết hợp của tenant, giống Check).
+// Trả về ErrUnsupportedCondition nếu một điều kiện trên Resource không thể chuyển thành bộ lọc
+// (ví dụ: gọi hàm với tham số Resource, so sánh hai thuộc tính Resource, =~).
+func (a *Authorizer) PartialEvaluate(ctx *context.Context, tenantID string, subject interface{}, action string, envAttrsInput *Attributes) (*Condition, error) {
+	subAttrs, err := a.subjectFetcher.GetSubjectAttributes(ctx, subject)
+	if err != nil {
+		return nil, fmt.Errorf("subject attributes error: %w", err)
+	}
+	envAttrs := make(Attributes)
+	if envAttrsInput != nil {
+		envAttrs = *envAttrsInput
+	}
+	params := requestParameters(&AuthorizationRequest{
+		Subject:  subAttrs,
+		Resource: Attributes{},
+		Action:   action,
+		Env:      envAttrs,
+	})
+
+	snap := a.engine.current()
+	alg := snap.combining.forTenant(tenantID)
+	rules, err := a.partialRules(snap.root, alg, tenantID, params)
+	if err != nil {
+		return nil, err
+	}
+	return combineConditions(alg, rules), nil
+}
+
+// partialRules tính điều kiện của các policy và policy set cùng cấp. Một policy set trở thành
+// hai partialRule cùng priority: allow khi target khớp và các policy bên trong cho phép, deny
+// khi target khớp, policy set áp dụng nhưng không cho phép.
+func (a *Authorizer) partialRules(nodes []policyNode, alg CombiningAlgorithm, tenantID string, params map[string]interface{}) ([]partialRule, error) {
+	functions := a.engine.evaluator.functions
+	var rules []partialRule
+	for _, n := range nodes {
+		if !n.appliesTo(tenantID) {
+			continue
+		}
+		if p := n.policy; p != nil {
+			ast, err := p.syntax(functions)
+			if err != nil {
+				return nil, err
+			}
+			cond, err := (&partialEvaluator{ast: ast, params: params}).condition(ast.root)
+			if err != nil {
+				return nil, fmt.Errorf("partial: policy %s: %w", p.ID, err)
+			}
+			if p.Effect == "allow" || p.Effect == "deny" {
+				rules = append(rules, partialRule{allow: p.Effect == "allow", priority: p.Priority, cond: cond})
+			}
+			continue
+		}
+
+		set := n.set
+		target := condTrue
+		if strings.TrimSpace(set.Target) != "" {
+			ast, err := set.syntax(functions)
+			if err != nil {
+				return nil, err
+			}
+			if target, err = (&partialEvaluator{ast: ast, params: params}).condition(ast.root); err != nil {
+				return nil, fmt.Errorf("partial: policy set %s: %w", set.ID, err)
+			}
+			if target.Never() {
+				continue
+			}
+		}
+		setAlg := set.algorithm(alg)
+		members, err := a.partialRules(set.members, setAlg, tenantID, params)
+		if err != nil {
+			return nil, err
+		}
+		allowed := combineConditions(setAlg, members)
+		// Với DenyUnlessPermit/PermitUnlessDeny policy set luôn quyết định (permit hoặc deny).
+		applies := condTrue
+		if setAlg != DenyUnlessPermit && setAlg != PermitUnlessDeny {
+			conds := make([]*Condition, 0, len(members))
+			for _, r := range members {
+				conds = append(conds, r.cond)
+			}
+			applies = condOr(conds...)
+		}
+		rules = append(rules,
+			partialRule{allow: true, priority: set.Priority, cond: condAnd(target, allowed)},
+			partialRule{allow: false, priority: set.Priority, cond: condAnd(target, applies, condNot(allowed))},
+		)
+	}
+	return rules, nil
+}
+
+// partialRule là điều kiện còn lại của một policy cùng effect và priority của nó.
+type partialRule struct {
+	allow    bool
+	priority int
+	cond     *Condition
+}
+
+// combineConditions kết hợp điều kiện của các policy (theo priority giảm dần) giống Check:
+// tầng priority cao nhất có policy khớp quyết định, ngược lại xét tầng thấp hơn.
+func combineConditions(alg CombiningAlgorithm, rules []partialRule) *Condition {
+	if alg == FirstApplicable || len(rules) == 0 {
+		return combineTier(alg, rules)
+	}
+	// Dựng từ tầng thấp nhất lên: (allow của tầng) || (!tầng khớp && phần còn lại).
+	end := len(rules)
+	var result *Condition
+	for start := len(rules) - 1; start >= 0; start-- {
+		if start > 0 && rules[start-1].priority == rules[start].priority {
+			continue
+		}
+		tier := rules[start:end]
+		if result == nil {
+			result = combineTier(alg, tier)
+		} else {
+			conds := make([]*Condition, 0, len(tier))
+			for _, r := range tier {
+				conds = append(conds, r.cond)
+			}
+			applies := condOr(conds...)
+			allowed := combineTier(alg, tier)
+			if alg == PermitUnlessDeny {
+				// !deny còn đúng cả khi tầng không có policy nào khớp.
+				allowed = condAnd(applies, allowed)
+			}
+			result = condOr(allowed, condAnd(condNot(applies), result))
+		}
+		end = start
+	}
+	return result
+}
+
+// combineTier kết hợp điều kiện của các policy cùng một tầng priority theo thuật toán.
+func combineTier(alg CombiningAlgorithm, rules []partialRule) *Condition {
+	var allows, denies []*Condition
+	for _, r := range rules {
+		if r.allow {
+			allows = append(allows, r.cond)
+		} else {
+			denies = append(denies, r.cond)
+		}
+	}
+	switch alg {
+	case PermitOverrides, DenyUnlessPermit:
+		return condOr(allows...)
+	case PermitUnlessDeny:
+		return condNot(condOr(denies...))
+	case FirstApplicable:
+		// Policy khớp đầu tiên quyết định: dựng từ cuối danh sách về đầu.
+		result := condFalse
+		for i := len(rules) - 1; i >= 0; i-- {
+			if rules[i].allow {
+				result = condOr(rules[i].cond, result)
+			} else {
+				result = condAnd(condNot(rules[i].cond), result)
+			}
+		}
+		return result
+	}
+	return condAnd(condOr(allows...), condNot(condOr(denies...)))
+}
+
+// partialEvaluator tính phần còn lại của một rule khi chưa biết Resource.
+type partialEvaluator struct {
+	ast    *ruleAST
+	params map[string]interface{}
+}
+
+// partialValue là kết quả của một node: hoặc giá trị đã biết, hoặc một trường Resource chưa biết.
+type partialValue struct {
+	known bool
+	value interface{}
+	field string
+}
+
+func (pe *partialEvaluator) unsupported(n *exprNode) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedCondition, pe.ast.text(n))
+}
+
+// condition chuyển một node có giá trị bool thành Condition.
+func (pe *partialEvaluator) condition(n *exprNode) (*Condition, error) {
+	if !dependsOnResource(n) {
+		v, err := pe.ast.evaluate(n, pe.params)
+		if err != nil {
+			return nil, fmt.Errorf("evaluate: lỗi khi đánh giá '%s': %w", pe.ast.text(n), err)
+		}
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("evaluate: '%s' phải trả về bool, nhận được %T", pe.ast.text(n), v)
+		}
+		if b {
+			return condTrue, nil
+		}
+		return condFalse, nil
+	}
+
+	switch n.kind {
+	case exprLogical:
+		left, err := pe.condition(n.children[0])
+		if err != nil {
+			return nil, err
+		}
+		// Giữ ngữ nghĩa short-circuit của govaluate: vế phải không được đánh giá nếu đã đủ kết luận.
+		if (n.op == "&&" && left.Never()) || (n.op == "||" && left.Always()) {
+			return left, nil
+		}
+		right, err := pe.condition(n.children[1])
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "&&" {
+			return condAnd(left, right), nil
+		}
+		return condOr(left, right), nil
+	case exprNot:
+		inner, err := pe.condition(n.children[0])
+		if err != nil {
+			return nil, err
+		}
+		return condNot(inner), nil
+	case exprVariable:
+		// Thuộc tính Resource dùng trực tiếp như giá trị bool.
+		return &Condition{Op: CondEq, Field: strings.Join(n.path[1:], "."), Value: true}, nil
+	case exprComparison:
+		return pe.comparison(n)
+	}
+	return nil, pe.unsupported(n)
+}
+
+func (pe *partialEvaluator) comparison(n *exprNode) (*Condition, error) {
+	left, err := pe.operand(n.children[0])
+	if err != nil {
+		return nil, err
+	}
+	right, err := pe.operand(n.children[1])
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "in" {
+		values, ok := right.value.([]interface{})
+		if left.known || !right.known || !ok {
+			return nil, pe.unsupported(n)
+		}
+		return &Condition{Op: CondIn, Field: left.field, Value: values}, nil
+	}
+
+	op, ok := comparisonOps[n.op]
+	if !ok || left.known == right.known {
+		return nil, pe.unsupported(n)
+	}
+	if left.known {
+		// 'hr' == Resource.department  =>  Resource.department == 'hr'
+		left, right = right, left
+		op = flippedOps[op]
+	}
+	return &Condition{Op: op, Field: left.field, Value: right.value}, nil
+}
+
+var comparisonOps = map[string]string{
+	"==": CondEq, "!=": CondNe, ">": CondGt, ">=": CondGte, "<": CondLt, "<=": CondLte,
+}
+
+var flippedOps = map[string]string{
+	CondEq: CondEq, CondNe: CondNe, CondGt: CondLt, CondGte: CondLte, CondLt: CondGt, CondLte: CondGte,
+}
+
+// operand tính giá trị một vế của phép so sánh.
+func (pe *partialEvaluator) operand(n *exprNode) (partialValue, error) {
+	if n.kind == exprVariable && isResourcePath(n.path) {
+		if len(n.path) < 2 {
+			return partialValue{}, pe.unsupported(n)
+		}
+		return partialValue{field: strings.Join(n.path[1:], ".")}, nil
+	}
+	if dependsOnResource(n) {
+		return partialValue{}, pe.unsupported(n)
+	}
+	if n.kind == exprList {
+		values := make([]interface{}, 0, len(n.children))
+		for _, child := range n.children {
+			v, err := pe.ast.evaluate(child, pe.params)
+			if err != nil {
+				return partialValue{}, err
+			}
+			values = append(values, v)
+		}
+		return partialValue{known: true, value: values}, nil
+	}
+	v, err := pe.ast.evaluate(n, pe.params)
+	if err != nil {
+		return partialValue{}, fmt.Errorf("evaluate: lỗi khi đánh giá '%s': %w", pe.ast.text(n), err)
+	}
+	return partialValue{known: true, value: v}, nil
+}
+
+func isResourcePath(path []string) bool {
+	return len(path) > 0 && path[0] == "Resource"
+}
+
+func dependsOnResource(n *exprNode) bool {
+	for _, path := range n.variables() {
+		if isResourcePath(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// condAnd/condOr/condNot dựng Condition và rút gọn các hằng true/false.
+func condAnd(items ...*Condition) *Condition {
+	var children []*Condition
+	for _, c := range items {
+		switch {
+		case c.Never():
+			return condFalse
+		case c.Always():
+			continue
+		case c.Op == CondAnd:
+			children = append(children, c.Children...)
+		default:
+			children = append(children, c)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return condTrue
+	case 1:
+		return children[0]
+	}
+	return &Condition{Op: CondAnd, Children: children}
+}
+
+func condOr(items ...*Condition) *Condition {
+	var children []*Condition
+	for _, c := range items {
+		switch {
+		case c.Always():
+			return condTrue
+		case c.Never():
+			continue
+		case c.Op == CondOr:
+			children = append(children, c.Children...)
+		default:
+			children = append(children, c)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return condFalse
+	case 1:
+		return children[0]
+	}
+	return &Condition{Op: CondOr, Children: children}
+}
+
+func condNot(c *Condition) *Condition {
+	switch {
+	case c.Always():
+		return condFalse
+	case c.Never():
+		return condTrue
+	case c.Op == CondNot:
+		return c.Children[0]
+	}
+	return &Condition{Op: CondNot, Children: []*Condition{c}}
+}
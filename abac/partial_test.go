@@ -0,0 +1,108 @@
+package abac_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+type leaveRequest struct {
+	ID         string `gorm:"primaryKey"`
+	Department string
+	Amount     float64
+}
+
+func newLeaveRequestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&leaveRequest{}))
+	require.NoError(t, db.Create([]leaveRequest{
+		{ID: "hr_small", Department: "hr", Amount: 100},
+		{ID: "hr_big", Department: "hr", Amount: 5000},
+		{ID: "sales", Department: "sales", Amount: 100},
+		{ID: "finance", Department: "finance", Amount: 100},
+	}).Error)
+	return db
+}
+
+func allowedIDs(t *testing.T, db *gorm.DB, cond *abac.Condition) []string {
+	t.Helper()
+	var rows []leaveRequest
+	require.NoError(t, db.Scopes(cond.GormScope(map[string]string{"cost": "amount"})).Order("id").Find(&rows).Error)
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestAuthorizer_PartialEvaluate_ResidualFromFilePolicies(t *testing.T) {
+	authorizer := setupAuthorizer(t)
+	ctx := context.Background()
+
+	cond, err := authorizer.PartialEvaluate(&ctx, "tenant2", "t2_hr_manager", "approve_level_2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, &abac.Condition{Op: abac.CondEq, Field: "department", Value: "hr"}, cond)
+
+	cond, err = authorizer.PartialEvaluate(&ctx, "tenant1", "t1_hr_manager", "approve_level_2", nil)
+	require.NoError(t, err)
+	assert.True(t, cond.Always())
+
+	cond, err = authorizer.PartialEvaluate(&ctx, "tenant2", "t2_hr_manager", "read", nil)
+	require.NoError(t, err)
+	assert.True(t, cond.Never())
+}
+
+func TestAuthorizer_PartialEvaluate_GormScope(t *testing.T) {
+	policies := `
+p, *, "Action == 'approve' && (Resource.department in ('hr', 'finance') || Subject.id == 'root_user')", allow, allow_hr_finance
+p, *, "Action == 'approve' && Resource.cost > 1000 && !hasTenantRole(Subject, 'tenant2', 'cfo')", deny, deny_big
+p, *, "Action == 'approve' && 'sales' == Resource.department", allow, allow_sales_for_none`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+	db := newLeaveRequestDB(t)
+
+	cond, err := authorizer.PartialEvaluate(&ctx, "tenant2", "t2_hr_manager", "approve", nil)
+	require.NoError(t, err)
+	assert.Equal(t,
+		"((Resource.department in ('hr', 'finance') || Resource.department == 'sales') && !(Resource.cost > 1000))",
+		cond.String())
+	assert.Equal(t, []string{"finance", "hr_small", "sales"}, allowedIDs(t, db, cond))
+
+	cond, err = authorizer.PartialEvaluate(&ctx, "tenant2", "root_user", "approve", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"finance", "hr_small", "sales"}, allowedIDs(t, db, cond))
+
+	cond, err = authorizer.PartialEvaluate(&ctx, "tenant2", "root_user", "delete", nil)
+	require.NoError(t, err)
+	assert.Empty(t, allowedIDs(t, db, cond))
+}
+
+func TestAuthorizer_PartialEvaluate_Unsupported(t *testing.T) {
+	policies := `p, *, "Action == 'read' && matches(Resource.name, '^a')", allow, regex_on_resource`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = authorizer.PartialEvaluate(&ctx, "tenant1", "t1_hr_manager", "read", nil)
+	assert.True(t, errors.Is(err, abac.ErrUnsupportedCondition))
+
+	// Action khác: vế trái false nên phần không hỗ trợ không cần đánh giá.
+	cond, err := authorizer.PartialEvaluate(&ctx, "tenant1", "t1_hr_manager", "write", nil)
+	require.NoError(t, err)
+	assert.True(t, cond.Never())
+}
@@ -0,0 +1,205 @@
+package abac
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// Policy là dạng có cấu trúc của một dòng policy, kèm metadata mô tả.
+// TenantID, Rule, Effect, ID, Obligations và Priority được lưu trong dòng policy của adapter;
+// các trường còn lại được lưu trong PolicyMetadataStore.
+type Policy struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	Rule     string `json:"rule"`
+	Effect   string `json:"effect"`
+	// Obligations là biểu thức obligation/advice của policy (xem ParseObligations),
+	// ví dụ "mask:Resource.salary; advice:notify:compliance".
+	Obligations string `json:"obligations,omitempty"`
+	// Priority: số lớn hơn được ưu tiên hơn (mặc định 0). Policy có priority cao nhất
+	// khớp với request quyết định kết quả, các policy priority thấp hơn bị bỏ qua.
+	Priority    int       `json:"priority"`
+	Description string    `json:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// PolicyMetadata là phần metadata của Policy, được lưu tách khỏi dòng policy.
+type PolicyMetadata struct {
+	PolicyID    string    `json:"policy_id"`
+	Description string    `json:"description,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (p Policy) metadata() PolicyMetadata {
+	return PolicyMetadata{
+		PolicyID:    p.ID,
+		Description: p.Description,
+		Owner:       p.Owner,
+		Tags:        append([]string(nil), p.Tags...),
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+func (p *Policy) applyMetadata(meta *PolicyMetadata) {
+	if meta == nil {
+		return
+	}
+	p.Description = meta.Description
+	p.Owner = meta.Owner
+	p.Tags = append([]string(nil), meta.Tags...)
+	p.CreatedAt = meta.CreatedAt
+	p.UpdatedAt = meta.UpdatedAt
+}
+
+// policyLayout lưu vị trí các trường trong một dòng policy theo
+// [policy_definition] của model (ví dụ: p = tenant, rule, eft, id, priority, obligations).
+// Vị trí -1 nghĩa là model không khai báo trường đó.
+type policyLayout struct {
+	tenant      int
+	rule        int
+	effect      int
+	id          int
+	obligations int
+	priority    int
+	size        int
+}
+
+func layoutOf(e *casbin.Enforcer) policyLayout {
+	l := policyLayout{tenant: -1, rule: -1, effect: -1, id: -1, obligations: -1, priority: -1}
+	assertion, ok := e.GetModel()["p"]["p"]
+	if !ok {
+		return l
+	}
+	l.size = len(assertion.Tokens)
+	for i, token := range assertion.Tokens {
+		switch token {
+		case "p_tenant":
+			l.tenant = i
+		case "p_rule":
+			l.rule = i
+		case "p_eft":
+			l.effect = i
+		case "p_id":
+			l.id = i
+		case "p_obligations":
+			l.obligations = i
+		case "p_priority":
+			l.priority = i
+		}
+	}
+	return l
+}
+
+func (l policyLayout) field(row []string, index int) string {
+	if index < 0 || index >= len(row) {
+		return ""
+	}
+	return row[index]
+}
+
+// toPolicy chuyển một dòng policy thành Policy (chưa có metadata).
+// Dòng không có ID (model cũ hoặc dữ liệu cũ) sẽ nhận ID suy ra từ nội dung.
+func (l policyLayout) toPolicy(row []string) Policy {
+	p := Policy{
+		ID:          l.field(row, l.id),
+		TenantID:    l.field(row, l.tenant),
+		Rule:        l.field(row, l.rule),
+		Effect:      l.field(row, l.effect),
+		Obligations: l.field(row, l.obligations),
+	}
+	p.Priority, _ = parsePriority(l.field(row, l.priority))
+	if l.tenant < 0 {
+		p.TenantID = "*"
+	}
+	if l.effect < 0 {
+		p.Effect = "allow"
+	}
+	if p.ID == "" {
+		p.ID = derivedPolicyID(p.TenantID, p.Rule, p.Effect)
+	}
+	return p
+}
+
+// toRow chuyển Policy thành dòng policy theo layout của model.
+func (l policyLayout) toRow(p Policy) []string {
+	row := make([]string, l.size)
+	set := func(index int, value string) {
+		if index >= 0 {
+			row[index] = value
+		}
+	}
+	set(l.tenant, p.TenantID)
+	set(l.rule, p.Rule)
+	set(l.effect, p.Effect)
+	set(l.id, p.ID)
+	set(l.obligations, p.Obligations)
+	set(l.priority, strconv.Itoa(p.Priority))
+	return row
+}
+
+// complete bổ sung các trường id, obligations và priority còn thiếu ở cuối một dòng policy được
+// truyền theo dạng ngắn, ví dụ []string{tenant, rule, eft}. Trả về nguyên dòng nếu thiếu trường khác.
+func (l policyLayout) complete(row []string, id, obligations, priority string) []string {
+	if len(row) >= l.size {
+		return row
+	}
+	if priority == "" {
+		priority = "0"
+	}
+	full := make([]string, l.size)
+	copy(full, row)
+	for i := len(row); i < l.size; i++ {
+		switch i {
+		case l.id:
+			full[i] = id
+		case l.obligations:
+			full[i] = obligations
+		case l.priority:
+			full[i] = priority
+		default:
+			return row
+		}
+	}
+	return full
+}
+
+// parsePriority đọc trường priority của dòng policy; chuỗi rỗng là 0.
+func parsePriority(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// newPolicyID sinh ID ngẫu nhiên cho policy mới.
+func newPolicyID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return derivedPolicyID(time.Now().String(), "", "")
+	}
+	return "pol_" + hex.EncodeToString(b)
+}
+
+// derivedPolicyID sinh ID ổn định từ nội dung cho các dòng policy không lưu ID.
+func derivedPolicyID(tenant, rule, effect string) string {
+	sum := sha1.Sum([]byte(tenant + "\x00" + rule + "\x00" + effect))
+	return "pol_" + hex.EncodeToString(sum[:8])
+}
+
+// ruleIDOf trả về định danh của chuỗi rule, giống nhau cho các policy dùng chung rule.
+func ruleIDOf(rule string) string {
+	sum := sha1.Sum([]byte(rule))
+	return "rule_" + hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,109 @@
+package abac
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+)
+
+// Casbin từ chối dòng policy có số trường khác model, trong khi adapter bỏ các trường rỗng ở cuối
+// dòng (ví dụ obligations rỗng) và dữ liệu cũ có thể thiếu các trường được thêm sau (priority,
+// obligations). Các adapter dưới đây bổ sung trường rỗng cho dòng policy ngắn hơn model khi nạp,
+// các thao tác ghi giữ nguyên của adapter gốc.
+
+// padPolicyRow bổ sung chuỗi rỗng cho dòng policy ptype ngắn hơn [policy_definition] của model.
+func padPolicyRow(m model.Model, ptype string, row []string) []string {
+	if !strings.HasPrefix(ptype, "p") {
+		return row
+	}
+	assertion, ok := m["p"][ptype]
+	if !ok || len(row) >= len(assertion.Tokens) {
+		return row
+	}
+	full := make([]string, len(assertion.Tokens))
+	copy(full, row)
+	return full
+}
+
+// loadPolicyRow nạp một dòng policy (đã bỏ các trường rỗng ở cuối) vào model.
+func loadPolicyRow(m model.Model, ptype string, row []string) error {
+	end := len(row)
+	for end > 0 && row[end-1] == "" {
+		end--
+	}
+	return persist.LoadPolicyArray(append([]string{ptype}, padPolicyRow(m, ptype, row[:end])...), m)
+}
+
+// gormPolicyAdapter là adapter gorm với LoadPolicy bổ sung trường cho dòng policy ngắn.
+type gormPolicyAdapter struct {
+	*gormadapter.Adapter
+}
+
+// LoadPolicy nạp policy từ database.
+func (a gormPolicyAdapter) LoadPolicy(m model.Model) error {
+	return a.LoadPolicyCtx(context.Background(), m)
+}
+
+// LoadPolicyCtx nạp policy từ database.
+func (a gormPolicyAdapter) LoadPolicyCtx(ctx context.Context, m model.Model) error {
+	var lines []gormadapter.CasbinRule
+	if err := a.GetDb().WithContext(ctx).Order("ID").Find(&lines).Error; err != nil {
+		return err
+	}
+	for _, line := range lines {
+		row := []string{line.V0, line.V1, line.V2, line.V3, line.V4, line.V5}
+		if err := loadPolicyRow(m, line.Ptype, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filePolicyAdapter là file adapter của Casbin với LoadPolicy bổ sung trường cho dòng policy ngắn.
+type filePolicyAdapter struct {
+	*fileadapter.Adapter
+	path string
+}
+
+func newFilePolicyAdapter(path string) filePolicyAdapter {
+	return filePolicyAdapter{Adapter: fileadapter.NewAdapter(path), path: path}
+}
+
+// LoadPolicy nạp policy từ file CSV.
+func (a filePolicyAdapter) LoadPolicy(m model.Model) error {
+	if a.path == "" {
+		return errors.New("invalid file path, file path cannot be empty")
+	}
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		reader := csv.NewReader(strings.NewReader(line))
+		reader.Comment = '#'
+		reader.TrimLeadingSpace = true
+		tokens, err := reader.Read()
+		if err != nil {
+			return err
+		}
+		if err := loadPolicyRow(m, tokens[0], tokens[1:]); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
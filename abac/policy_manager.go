@@ -1,11 +1,124 @@
 package abac
 
-import "github.com/casbin/casbin/v2"
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	"gorm.io/gorm"
+)
 
 // PolicyManager đóng vai trò là PAP, cung cấp một giao diện hoàn chỉnh
 // để quản lý các quy tắc policy trong bộ nhớ của Casbin.
 type PolicyManager struct {
 	enforcer *casbin.Enforcer
+	engine   *policyEngine
+	metadata PolicyMetadataStore
+	sets     PolicySetStore
+
+	// mu bảo vệ model của enforcer (Casbin không có khóa bên trong): thao tác ghi/nạp lại
+	// giữ khóa ghi, thao tác đọc policy giữ khóa đọc. Check không cần khóa vì chỉ đọc
+	// snapshot đã biên dịch.
+	mu sync.RWMutex
+
+	// db và policyTable được đặt khi hệ thống tạo từ DB (dùng cho WatchDB).
+	db          *gorm.DB
+	policyTable string
+
+	// modelPath và policyPath được đặt khi hệ thống tạo từ file (dùng cho WatchFiles).
+	modelPath  string
+	policyPath string
+
+	// changes là notifier đang gắn (UseChangeNotifier), nil nếu không có.
+	changes *PolicyChangeSubscription
+}
+
+// afterWrite dựng lại snapshot policy đã biên dịch khi thay đổi policy thành công; enforcer
+// trả về ok=false (không có gì thay đổi) thì snapshot và decision cache được giữ nguyên.
+func (pm *PolicyManager) afterWrite(ok bool, err error) (bool, error) {
+	if ok && err == nil {
+		pm.engine.reload(pm.enforcer)
+	}
+	return ok, err
+}
+
+// completeRule bổ sung các trường còn thiếu (ID, priority, obligations) cho dòng policy được
+// truyền theo dạng cũ, ví dụ []string{tenant, rule, eft} với model có thêm các trường đó.
+// Dòng dạng cũ trùng với một policy đã có (hoặc một dòng trong pending) trả về chính dòng đó,
+// nên thêm trùng vẫn trả về false như trước khi có trường id.
+func (pm *PolicyManager) completeRule(rule []string, pending ...[]string) []string {
+	l := layoutOf(pm.enforcer)
+	if len(rule) >= l.size {
+		return rule
+	}
+	if matches := prefixMatches(pending, rule); len(matches) > 0 {
+		return matches[0]
+	}
+	if matches := pm.resolveRule(rule); len(matches[0]) > len(rule) {
+		return matches[0]
+	}
+	return l.complete(rule, newPolicyID(), "", "")
+}
+
+// resolveRule trả về mọi dòng policy đầy đủ tương ứng với một dòng policy bị thiếu trường
+// (các bản sao cùng tenant/rule/eft có ID khác nhau). Trả về nguyên dòng đầu vào nếu
+// không cần/không tìm thấy.
+func (pm *PolicyManager) resolveRule(rule []string) [][]string {
+	if len(rule) >= layoutOf(pm.enforcer).size {
+		return [][]string{rule}
+	}
+	rows, err := pm.enforcer.GetPolicy()
+	if err != nil {
+		return [][]string{rule}
+	}
+	if matches := prefixMatches(rows, rule); len(matches) > 0 {
+		return matches
+	}
+	return [][]string{rule}
+}
+
+func (pm *PolicyManager) resolveRules(rules [][]string) [][]string {
+	resolved := make([][]string, 0, len(rules))
+	for _, rule := range rules {
+		resolved = append(resolved, pm.resolveRule(rule)...)
+	}
+	return resolved
+}
+
+// prefixMatches trả về các dòng có phần đầu trùng với rule.
+func prefixMatches(rows [][]string, rule []string) [][]string {
+	var matches [][]string
+	for _, row := range rows {
+		if len(row) > len(rule) && equalRows(row[:len(rule)], rule) {
+			matches = append(matches, row)
+		}
+	}
+	return matches
+}
+
+func equalRows(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// forgetMetadata xóa metadata của các dòng policy đã bị xóa.
+func (pm *PolicyManager) forgetMetadata(rows [][]string) {
+	if pm.metadata == nil {
+		return
+	}
+	l := layoutOf(pm.enforcer)
+	for _, row := range rows {
+		_ = pm.metadata.DeletePolicyMetadata(l.toPolicy(row).ID)
+	}
 }
 
 // =========================================================================
@@ -13,14 +126,39 @@ type PolicyManager struct {
 // =========================================================================
 
 // AddPolicy thêm một policy mới vào bộ nhớ. Trả về true nếu thành công.
-// rule: []string{"Subject.role == 'manager'", "allow"}
+// rule: []string{"tenant1", "Subject.role == 'manager'", "allow"}
+// Nếu model có trường id mà rule không truyền, một ID mới sẽ được sinh tự động.
 func (pm *PolicyManager) AddPolicy(rule []string) (bool, error) {
-	return pm.enforcer.AddPolicy(rule)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	rule = pm.completeRule(rule)
+	if err := pm.validateRow(rule); err != nil {
+		return false, err
+	}
+	ok, err := pm.afterWrite(pm.enforcer.AddPolicy(rule))
+	if ok && err == nil {
+		pm.publish(PolicyChangeAdd, [][]string{rule}, nil)
+	}
+	return ok, err
 }
 
 // AddPolicies thêm nhiều policy mới vào bộ nhớ. Giao dịch nguyên tử.
 func (pm *PolicyManager) AddPolicies(rules [][]string) (bool, error) {
-	return pm.enforcer.AddPolicies(rules)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	completed := make([][]string, 0, len(rules))
+	for _, rule := range rules {
+		rule = pm.completeRule(rule, completed...)
+		if err := pm.validateRow(rule); err != nil {
+			return false, err
+		}
+		completed = append(completed, rule)
+	}
+	ok, err := pm.afterWrite(pm.enforcer.AddPolicies(completed))
+	if ok && err == nil {
+		pm.publish(PolicyChangeAdd, completed, nil)
+	}
+	return ok, err
 }
 
 // =========================================================================
@@ -29,18 +167,25 @@ func (pm *PolicyManager) AddPolicies(rules [][]string) (bool, error) {
 
 // GetPolicies trả về tất cả các policy hiện có.
 func (pm *PolicyManager) GetPolicies() ([][]string, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	return pm.enforcer.GetPolicy()
 }
 
 // GetFilteredPolicies trả về các policy được lọc theo điều kiện.
 // Ví dụ: GetFilteredPolicies(1, "allow") sẽ trả về tất cả các rule có effect là "allow".
 func (pm *PolicyManager) GetFilteredPolicies(fieldIndex int, fieldValues ...string) ([][]string, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	return pm.enforcer.GetFilteredPolicy(fieldIndex, fieldValues...)
 }
 
-// HasPolicy kiểm tra policy đã tồn tại chưa.
+// HasPolicy kiểm tra policy đã tồn tại chưa. Dòng thiếu trường (dạng cũ) tồn tại nếu có ít nhất
+// một policy cùng các trường đã truyền.
 func (pm *PolicyManager) HasPolicy(rule []string) (bool, error) {
-	return pm.enforcer.HasPolicy(rule)
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.enforcer.HasPolicy(pm.resolveRule(rule)[0])
 }
 
 // =========================================================================
@@ -49,8 +194,29 @@ func (pm *PolicyManager) HasPolicy(rule []string) (bool, error) {
 
 // UpdatePolicy cập nhật một policy cũ thành policy mới.
 // Trả về true nếu policy cũ tồn tại và được cập nhật thành công.
+// Nếu newRule thiếu trường id/obligations/priority, policy giữ nguyên giá trị của oldRule.
+// oldRule thiếu trường mà khớp nhiều policy thì trả về ErrInvalidPolicy.
 func (pm *PolicyManager) UpdatePolicy(oldRule []string, newRule []string) (bool, error) {
-	return pm.enforcer.UpdatePolicy(oldRule, newRule)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	matches := pm.resolveRule(oldRule)
+	if len(matches) > 1 {
+		return false, fmt.Errorf("%w: dòng policy khớp %d policy, hãy truyền đủ các trường (gồm id)", ErrInvalidPolicy, len(matches))
+	}
+	oldRule = matches[0]
+	l := layoutOf(pm.enforcer)
+	newRule = l.complete(newRule, l.field(oldRule, l.id), l.field(oldRule, l.obligations), l.field(oldRule, l.priority))
+	if err := pm.validateRow(newRule); err != nil {
+		return false, err
+	}
+	ok, err := pm.afterWrite(pm.enforcer.UpdatePolicy(oldRule, newRule))
+	if ok && err == nil {
+		pm.publish(PolicyChangeUpdate, [][]string{newRule}, [][]string{oldRule})
+		if oldID, newID := l.toPolicy(oldRule).ID, l.toPolicy(newRule).ID; oldID != newID {
+			return ok, pm.relinkPolicySets(map[string]string{oldID: newID})
+		}
+	}
+	return ok, err
 }
 
 // =========================================================================
@@ -58,26 +224,68 @@ func (pm *PolicyManager) UpdatePolicy(oldRule []string, newRule []string) (bool,
 // =========================================================================
 
 // RemovePolicy xóa một policy khỏi bộ nhớ.
-// Trả về true nếu quy tắc tồn tại và được xóa thành công.
+// Trả về true nếu quy tắc tồn tại và được xóa thành công. Dòng thiếu trường (dạng cũ) xóa mọi
+// policy cùng các trường đã truyền.
 func (pm *PolicyManager) RemovePolicy(rule []string) (bool, error) {
-	return pm.enforcer.RemovePolicy(rule)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.removePolicy(rule)
+}
+
+func (pm *PolicyManager) removePolicy(rule []string) (bool, error) {
+	rules := pm.resolveRule(rule)
+	var ok bool
+	var err error
+	if len(rules) == 1 {
+		ok, err = pm.afterWrite(pm.enforcer.RemovePolicy(rules[0]))
+	} else {
+		ok, err = pm.afterWrite(pm.enforcer.RemovePolicies(rules))
+	}
+	if ok && err == nil {
+		pm.forgetMetadata(rules)
+		pm.publish(PolicyChangeRemove, rules, nil)
+		return ok, pm.relinkPolicySets(pm.removedIDs(rules))
+	}
+	return ok, err
 }
 
 // RemovePolicies xóa nhiều policy khỏi bộ nhớ.
 // Đây là một giao dịch nguyên tử (atomic).
 func (pm *PolicyManager) RemovePolicies(rules [][]string) (bool, error) {
-	return pm.enforcer.RemovePolicies(rules)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	rules = pm.resolveRules(rules)
+	ok, err := pm.afterWrite(pm.enforcer.RemovePolicies(rules))
+	if ok && err == nil {
+		pm.forgetMetadata(rules)
+		pm.publish(PolicyChangeRemove, rules, nil)
+		return ok, pm.relinkPolicySets(pm.removedIDs(rules))
+	}
+	return ok, err
 }
 
 // RemoveFilteredPolicy xóa các policy được lọc theo điều kiện.
 // Trả về true nếu có quy tắc bị xóa.
 func (pm *PolicyManager) RemoveFilteredPolicy(fieldIndex int, fieldValues ...string) (bool, error) {
-	return pm.enforcer.RemoveFilteredPolicy(fieldIndex, fieldValues...)
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	removed, _ := pm.enforcer.GetFilteredPolicy(fieldIndex, fieldValues...)
+	ok, err := pm.afterWrite(pm.enforcer.RemoveFilteredPolicy(fieldIndex, fieldValues...))
+	if ok && err == nil {
+		pm.forgetMetadata(removed)
+		pm.publish(PolicyChangeRemove, removed, nil)
+		return ok, pm.relinkPolicySets(pm.removedIDs(removed))
+	}
+	return ok, err
 }
 
 // ClearAllPolicies xóa toàn bộ policy khỏi bộ nhớ.
 func (pm *PolicyManager) ClearAllPolicies() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	pm.enforcer.ClearPolicy()
+	pm.engine.reload(pm.enforcer)
+	pm.publish(PolicyChangeClear, nil, nil)
 }
 
 // =========================================================================
@@ -87,11 +295,240 @@ func (pm *PolicyManager) ClearAllPolicies() {
 // SavePoliciesToStorage lưu policy hiện có xuống storage (file/DB).
 // Hữu ích khi bạn muốn thực hiện nhiều thay đổi trong bộ nhớ trước rồi mới "commit".
 func (pm *PolicyManager) SavePoliciesToStorage() error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	return pm.enforcer.SavePolicy()
 }
 
-// LoadPoliciesFromStorage tải lại toàn bộ policy từ storage.
+// LoadPoliciesFromStorage tải lại toàn bộ policy (và policy set) từ storage.
 // Cần thiết để đồng bộ khi policy trong DB bị thay đổi bởi một hệ thống khác.
 func (pm *PolicyManager) LoadPoliciesFromStorage() error {
-	return pm.enforcer.LoadPolicy()
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.enforcer.GetAdapter() == nil {
+		return errors.New("policy storage is not configured")
+	}
+	if err := pm.enforcer.LoadPolicy(); err != nil {
+		return err
+	}
+	pm.engine.reload(pm.enforcer)
+	return pm.reloadPolicySets()
+}
+
+// =========================================================================
+// == POLICY CÓ CẤU TRÚC (Policy + metadata, thao tác theo ID)
+// =========================================================================
+
+// CreatePolicy thêm một policy kèm metadata. ID được sinh tự động nếu để trống.
+// Yêu cầu model có trường id trong [policy_definition] (p = tenant, rule, eft, id).
+func (pm *PolicyManager) CreatePolicy(p Policy) (*Policy, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	l := layoutOf(pm.enforcer)
+	if l.id < 0 {
+		return nil, ErrPolicyIDNotSupported
+	}
+	if p.TenantID == "" || p.Rule == "" || p.Effect == "" {
+		return nil, fmt.Errorf("%w: tenant, rule và effect là bắt buộc", ErrInvalidPolicy)
+	}
+	if l.priority < 0 && p.Priority != 0 {
+		return nil, ErrPriorityNotSupported
+	}
+	if l.obligations < 0 && p.Obligations != "" {
+		return nil, ErrObligationsNotSupported
+	}
+	if p.ID == "" {
+		p.ID = newPolicyID()
+	} else if _, found := pm.findRow(p.ID); found {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyExists, p.ID)
+	}
+
+	now := time.Now().UTC()
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = now
+	}
+	p.UpdatedAt = now
+
+	row := l.toRow(p)
+	if err := pm.validateRow(row); err != nil {
+		return nil, err
+	}
+	ok, err := pm.afterWrite(pm.enforcer.AddPolicy(row))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyExists, p.ID)
+	}
+	pm.publish(PolicyChangeAdd, [][]string{row}, nil)
+	if err := pm.saveMetadata(p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPolicyByID trả về policy kèm metadata theo ID.
+func (pm *PolicyManager) GetPolicyByID(id string) (*Policy, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.getPolicyByID(id)
+}
+
+func (pm *PolicyManager) getPolicyByID(id string) (*Policy, error) {
+	row, found := pm.findRow(id)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, id)
+	}
+	p := layoutOf(pm.enforcer).toPolicy(row)
+	if pm.metadata != nil {
+		meta, err := pm.metadata.GetPolicyMetadata(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		p.applyMetadata(meta)
+	}
+	return &p, nil
+}
+
+// ListPolicies trả về các policy (kèm metadata) của một tenant theo thứ tự lưu trữ.
+// tenantID rỗng sẽ trả về policy của mọi tenant.
+func (pm *PolicyManager) ListPolicies(tenantID string) ([]Policy, error) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	rows, err := pm.enforcer.GetPolicy()
+	if err != nil {
+		return nil, err
+	}
+	var metas map[string]PolicyMetadata
+	if pm.metadata != nil {
+		if metas, err = pm.metadata.ListPolicyMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	l := layoutOf(pm.enforcer)
+	policies := make([]Policy, 0, len(rows))
+	for _, row := range rows {
+		p := l.toPolicy(row)
+		if tenantID != "" && p.TenantID != tenantID {
+			continue
+		}
+		if meta, ok := metas[p.ID]; ok {
+			p.applyMetadata(&meta)
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// UpdatePolicyByID thay thế nội dung và metadata của policy có ID cho trước.
+// ID và thời điểm tạo được giữ nguyên.
+func (pm *PolicyManager) UpdatePolicyByID(id string, p Policy) (*Policy, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	return pm.updatePolicyByID(id, p)
+}
+
+// SetPolicyPriority đổi priority của policy có ID cho trước, giữ nguyên các trường khác.
+func (pm *PolicyManager) SetPolicyPriority(id string, priority int) (*Policy, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	p, err := pm.getPolicyByID(id)
+	if err != nil {
+		return nil, err
+	}
+	p.Priority = priority
+	return pm.updatePolicyByID(id, *p)
+}
+
+func (pm *PolicyManager) updatePolicyByID(id string, p Policy) (*Policy, error) {
+	oldRow, found := pm.findRow(id)
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrPolicyNotFound, id)
+	}
+	if p.TenantID == "" || p.Rule == "" || p.Effect == "" {
+		return nil, fmt.Errorf("%w: tenant, rule và effect là bắt buộc", ErrInvalidPolicy)
+	}
+	l := layoutOf(pm.enforcer)
+	if l.priority < 0 && p.Priority != 0 {
+		return nil, ErrPriorityNotSupported
+	}
+	if l.obligations < 0 && p.Obligations != "" {
+		return nil, ErrObligationsNotSupported
+	}
+	p.ID = id
+	p.CreatedAt = time.Time{}
+	if pm.metadata != nil {
+		if meta, err := pm.metadata.GetPolicyMetadata(id); err == nil && meta != nil {
+			p.CreatedAt = meta.CreatedAt
+		}
+	}
+	p.UpdatedAt = time.Now().UTC()
+	if p.CreatedAt.IsZero() {
+		p.CreatedAt = p.UpdatedAt
+	}
+
+	newRow := l.toRow(p)
+	if err := pm.validateRow(newRow); err != nil {
+		return nil, err
+	}
+	if l.id < 0 {
+		// Model không lưu ID: ID mới được suy ra từ nội dung.
+		p.ID = l.toPolicy(newRow).ID
+	}
+	if !equalRows(oldRow, newRow) {
+		ok, err := pm.afterWrite(pm.enforcer.UpdatePolicy(oldRow, newRow))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			pm.publish(PolicyChangeUpdate, [][]string{newRow}, [][]string{oldRow})
+		}
+	}
+	if p.ID != id {
+		pm.forgetMetadata([][]string{oldRow})
+		if err := pm.relinkPolicySets(map[string]string{id: p.ID}); err != nil {
+			return nil, err
+		}
+	}
+	if err := pm.saveMetadata(p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// DeletePolicyByID xóa policy và metadata của nó. Trả về false nếu không tìm thấy.
+func (pm *PolicyManager) DeletePolicyByID(id string) (bool, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	row, found := pm.findRow(id)
+	if !found {
+		return false, nil
+	}
+	return pm.removePolicy(row)
+}
+
+// findRow tìm dòng policy có ID cho trước (kể cả ID suy ra từ nội dung). Người gọi phải
+// giữ pm.mu.
+func (pm *PolicyManager) findRow(id string) ([]string, bool) {
+	rows, err := pm.enforcer.GetPolicy()
+	if err != nil {
+		return nil, false
+	}
+	l := layoutOf(pm.enforcer)
+	for _, row := range rows {
+		if l.toPolicy(row).ID == id {
+			return row, true
+		}
+	}
+	return nil, false
+}
+
+func (pm *PolicyManager) saveMetadata(p Policy) error {
+	if pm.metadata == nil {
+		return nil
+	}
+	if err := pm.metadata.SavePolicyMetadata(p.metadata()); err != nil {
+		return fmt.Errorf("failed to save policy metadata: %w", err)
+	}
+	return nil
 }
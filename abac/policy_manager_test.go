@@ -1,9 +1,16 @@
 package abac
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
 	"github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
-	"testing"
+	gormadapter "github.com/casbin/gorm-adapter/v3"
 )
 
 func newTestPolicyManager(t *testing.T) *PolicyManager {
@@ -55,3 +62,339 @@ func TestPolicyManager_UpdatePolicy(t *testing.T) {
 		t.Fatalf("HasPolicy after update failed: %v", err)
 	}
 }
+
+const testABACModel = `
+[request_definition]
+r = tenant, req
+
+[policy_definition]
+p = tenant, rule, eft, id
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)`
+
+func TestPolicyManager_PolicyCRUDWithMetadata(t *testing.T) {
+	_, pm, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+
+	created, err := pm.CreatePolicy(Policy{
+		TenantID:    "tenant1",
+		Rule:        "Action == 'read'",
+		Effect:      "allow",
+		Description: "everyone can read",
+		Owner:       "team-a",
+		Tags:        []string{"read", "baseline"},
+	})
+	if err != nil {
+		t.Fatalf("CreatePolicy failed: %v", err)
+	}
+	if created.ID == "" || created.CreatedAt.IsZero() {
+		t.Fatalf("CreatePolicy should assign ID and timestamps: %+v", created)
+	}
+	if _, err := pm.CreatePolicy(Policy{ID: created.ID, TenantID: "tenant1", Rule: "Action == 'x'", Effect: "allow"}); !errors.Is(err, ErrPolicyExists) {
+		t.Fatalf("expected ErrPolicyExists, got %v", err)
+	}
+
+	got, err := pm.GetPolicyByID(created.ID)
+	if err != nil {
+		t.Fatalf("GetPolicyByID failed: %v", err)
+	}
+	if got.Owner != "team-a" || got.Description != "everyone can read" || len(got.Tags) != 2 {
+		t.Fatalf("metadata not returned: %+v", got)
+	}
+
+	updated, err := pm.UpdatePolicyByID(created.ID, Policy{
+		TenantID: "tenant1",
+		Rule:     "Action == 'list'",
+		Effect:   "allow",
+		Owner:    "team-b",
+	})
+	if err != nil {
+		t.Fatalf("UpdatePolicyByID failed: %v", err)
+	}
+	if updated.ID != created.ID || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("ID and CreatedAt must be preserved: %+v", updated)
+	}
+	if ok, _ := pm.HasPolicy([]string{"tenant1", "Action == 'list'", "allow"}); !ok {
+		t.Fatal("updated rule should be stored")
+	}
+
+	policies, err := pm.ListPolicies("tenant1")
+	if err != nil || len(policies) != 1 || policies[0].Owner != "team-b" {
+		t.Fatalf("ListPolicies returned %+v, %v", policies, err)
+	}
+
+	ok, err := pm.DeletePolicyByID(created.ID)
+	if err != nil || !ok {
+		t.Fatalf("DeletePolicyByID failed: %v", err)
+	}
+	if _, err := pm.GetPolicyByID(created.ID); !errors.Is(err, ErrPolicyNotFound) {
+		t.Fatalf("expected ErrPolicyNotFound, got %v", err)
+	}
+	if meta, _ := pm.metadata.GetPolicyMetadata(created.ID); meta != nil {
+		t.Fatal("metadata should be removed with the policy")
+	}
+}
+
+func TestPolicyManager_TupleAPIAssignsStableIDs(t *testing.T) {
+	_, pm, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+	if _, err := pm.AddPolicy([]string{"tenant1", "Action == 'read'", "allow"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	policies, _ := pm.ListPolicies("")
+	if len(policies) != 1 || policies[0].ID == "" {
+		t.Fatalf("tuple policy should receive an ID: %+v", policies)
+	}
+	id := policies[0].ID
+
+	if _, err := pm.UpdatePolicy(
+		[]string{"tenant1", "Action == 'read'", "allow"},
+		[]string{"tenant1", "Action == 'read'", "deny"},
+	); err != nil {
+		t.Fatalf("UpdatePolicy failed: %v", err)
+	}
+	got, err := pm.GetPolicyByID(id)
+	if err != nil || got.Effect != "deny" {
+		t.Fatalf("ID should survive tuple updates: %+v, %v", got, err)
+	}
+}
+
+func TestPolicyManager_TupleAPIDuplicatesAndCopies(t *testing.T) {
+	_, pm, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+	rule := []string{"t1", "Action == 'read'", "allow"}
+	if ok, err := pm.AddPolicy(rule); !ok || err != nil {
+		t.Fatalf("AddPolicy = %v, %v", ok, err)
+	}
+	version := pm.engine.current().version
+	if ok, err := pm.AddPolicy(rule); ok || err != nil {
+		t.Fatalf("duplicate AddPolicy = %v, %v; want false", ok, err)
+	}
+	if ok, err := pm.AddPolicies([][]string{rule}); ok || err != nil {
+		t.Fatalf("duplicate AddPolicies = %v, %v; want false", ok, err)
+	}
+	if rows, _ := pm.GetPolicies(); len(rows) != 1 {
+		t.Fatalf("duplicates must not be stored: %v", rows)
+	}
+	if pm.engine.current().version != version {
+		t.Fatal("a write that changed nothing must not rebuild the snapshot")
+	}
+
+	// Hai bản sao cùng tenant/rule/eft với ID khác nhau.
+	if _, err := pm.CreatePolicy(Policy{ID: "copy", TenantID: "t1", Rule: "Action == 'read'", Effect: "allow"}); err != nil {
+		t.Fatalf("CreatePolicy failed: %v", err)
+	}
+	if ok, _ := pm.HasPolicy(rule); !ok {
+		t.Fatal("HasPolicy should find the short row")
+	}
+	if _, err := pm.UpdatePolicy(rule, []string{"t1", "Action == 'read'", "deny"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("ambiguous UpdatePolicy: expected ErrInvalidPolicy, got %v", err)
+	}
+	if ok, err := pm.RemovePolicy(rule); !ok || err != nil {
+		t.Fatalf("RemovePolicy = %v, %v", ok, err)
+	}
+	if rows, _ := pm.GetPolicies(); len(rows) != 0 {
+		t.Fatalf("RemovePolicy should remove every copy: %v", rows)
+	}
+	if ok, _ := pm.HasPolicy(rule); ok {
+		t.Fatal("HasPolicy after removal")
+	}
+}
+
+func TestPolicyManager_LegacyModelDerivesIDs(t *testing.T) {
+	legacyModel := strings.Replace(testABACModel, "p = tenant, rule, eft, id", "p = tenant, rule, eft", 1)
+	legacyModel = strings.Replace(legacyModel, "evaluate(p.rule, r.req, p.id)", "evaluate(p.rule, r.req)", 1)
+	_, pm, err := NewABACSystemFromStrings(legacyModel, `p, *, "Action == 'read'", allow`, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+	policies, _ := pm.ListPolicies("")
+	if len(policies) != 1 || policies[0].ID != derivedPolicyID("*", "Action == 'read'", "allow") {
+		t.Fatalf("legacy policy should get a derived ID: %+v", policies)
+	}
+	if _, err := pm.CreatePolicy(Policy{TenantID: "*", Rule: "true", Effect: "allow"}); !errors.Is(err, ErrPolicyIDNotSupported) {
+		t.Fatalf("expected ErrPolicyIDNotSupported, got %v", err)
+	}
+}
+
+func TestPolicyManager_PrioritiesStoredAndHonored(t *testing.T) {
+	db := newTestDB(t)
+	fetcher := &staticFetcher{subject: Attributes{"id": "u1"}, resource: Attributes{"department": "hr"}}
+	auth, pm, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, fetcher, fetcher, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	ctx := context.Background()
+	check := func() bool {
+		t.Helper()
+		allowed, err := auth.Check(&ctx, "tenant1", "u1", "r1", "read", nil)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		return allowed
+	}
+
+	// Rule cũ dạng []string không có priority nhận priority 0.
+	if _, err := pm.AddPolicy([]string{"*", "Action == 'read'", "deny", "generic_deny"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	if _, err := pm.CreatePolicy(Policy{ID: "hr_allow", TenantID: "tenant1", Rule: "Resource.department == 'hr'", Effect: "allow"}); err != nil {
+		t.Fatalf("CreatePolicy failed: %v", err)
+	}
+	if check() {
+		t.Fatal("expected deny-overrides within the same priority")
+	}
+
+	// Allow của tenant có priority cao hơn thắng deny chung, bất kể thứ tự thêm.
+	if _, err := pm.SetPolicyPriority("hr_allow", 10); err != nil {
+		t.Fatalf("SetPolicyPriority failed: %v", err)
+	}
+	if !check() {
+		t.Fatal("expected the higher-priority allow to win")
+	}
+	if _, err := pm.AddPolicy([]string{"tenant1", "Subject.id == 'u1'", "deny", "u1_deny", "20"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	if check() {
+		t.Fatal("expected the priority 20 deny to win")
+	}
+
+	// Priority được lưu trong bảng của adapter.
+	if err := pm.LoadPoliciesFromStorage(); err != nil {
+		t.Fatalf("LoadPoliciesFromStorage failed: %v", err)
+	}
+	p, err := pm.GetPolicyByID("hr_allow")
+	if err != nil || p.Priority != 10 {
+		t.Fatalf("expected stored priority 10, got %+v, %v", p, err)
+	}
+	if check() {
+		t.Fatal("expected the same decision after reload")
+	}
+
+	// UpdatePolicy giữ priority cũ khi newRule không truyền priority.
+	if _, err := pm.UpdatePolicy([]string{"tenant1", "Resource.department == 'hr'", "allow", "hr_allow", "10", ""}, []string{"tenant1", "Resource.department != 'it'", "allow"}); err != nil {
+		t.Fatalf("UpdatePolicy failed: %v", err)
+	}
+	if p, _ := pm.GetPolicyByID("hr_allow"); p == nil || p.Priority != 10 {
+		t.Fatalf("expected priority to be kept, got %+v", p)
+	}
+
+	if _, err := pm.AddPolicy([]string{"*", "Action == 'read'", "allow", "bad", "high"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("expected ErrInvalidPolicy for a non-integer priority, got %v", err)
+	}
+}
+
+func TestPolicyManager_LoadsRowsStoredWithoutObligations(t *testing.T) {
+	db := newTestDB(t)
+	// Dòng do model `p = tenant, rule, eft, id, priority` ghi: priority ở v4, không có v5.
+	if err := db.Create(&gormadapter.CasbinRule{Ptype: "p", V0: "tenant1", V1: "Resource.department == 'hr'", V2: "allow", V3: "hr_allow", V4: "10"}).Error; err != nil {
+		t.Fatalf("failed to insert rule: %v", err)
+	}
+	if err := db.Create(&gormadapter.CasbinRule{Ptype: "p", V0: "*", V1: "Action == 'read'", V2: "deny", V3: "generic_deny", V4: "0"}).Error; err != nil {
+		t.Fatalf("failed to insert rule: %v", err)
+	}
+	fetcher := &staticFetcher{subject: Attributes{"id": "u1"}, resource: Attributes{"department": "hr"}}
+	auth, pm, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, fetcher, fetcher, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+
+	p, err := pm.GetPolicyByID("hr_allow")
+	if err != nil || p.Priority != 10 || p.Obligations != "" {
+		t.Fatalf("expected priority 10 without obligations, got %+v, %v", p, err)
+	}
+	ctx := context.Background()
+	if allowed, err := auth.Check(&ctx, "tenant1", "u1", "r1", "read", nil); err != nil || !allowed {
+		t.Fatalf("expected the priority 10 allow to win, got %v, %v", allowed, err)
+	}
+
+	// Dòng nạp lại được bổ sung trường obligations nên khớp với dòng đầy đủ khi ghi.
+	if ok, err := pm.HasPolicy([]string{"*", "Action == 'read'", "deny", "generic_deny", "0", ""}); err != nil || !ok {
+		t.Fatalf("expected the padded row to be found, got %v, %v", ok, err)
+	}
+	if ok, err := pm.DeletePolicyByID("generic_deny"); err != nil || !ok {
+		t.Fatalf("DeletePolicyByID failed: %v, %v", ok, err)
+	}
+	if _, err := pm.SetPolicyPriority("hr_allow", 20); err != nil {
+		t.Fatalf("SetPolicyPriority failed: %v", err)
+	}
+	if err := pm.LoadPoliciesFromStorage(); err != nil {
+		t.Fatalf("LoadPoliciesFromStorage failed: %v", err)
+	}
+	if rules, _ := pm.GetPolicies(); len(rules) != 1 {
+		t.Fatalf("expected one stored rule, got %v", rules)
+	}
+	if p, _ := pm.GetPolicyByID("hr_allow"); p == nil || p.Priority != 20 {
+		t.Fatalf("expected stored priority 20, got %+v", p)
+	}
+}
+
+func TestPolicyManager_PriorityNotSupported(t *testing.T) {
+	_, pm, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+	if _, err := pm.CreatePolicy(Policy{TenantID: "*", Rule: "Action == 'read'", Effect: "allow", Priority: 5}); !errors.Is(err, ErrPriorityNotSupported) {
+		t.Fatalf("expected ErrPriorityNotSupported, got %v", err)
+	}
+	p, err := pm.CreatePolicy(Policy{TenantID: "*", Rule: "Action == 'read'", Effect: "allow"})
+	if err != nil {
+		t.Fatalf("CreatePolicy failed: %v", err)
+	}
+	if _, err := pm.SetPolicyPriority(p.ID, 1); !errors.Is(err, ErrPriorityNotSupported) {
+		t.Fatalf("expected ErrPriorityNotSupported, got %v", err)
+	}
+}
+
+func TestPolicyManager_ConcurrentReadsAndWrites(t *testing.T) {
+	_, pm, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+	created, err := pm.CreatePolicy(Policy{TenantID: "tenant1", Rule: "Action == 'read'", Effect: "allow"})
+	if err != nil {
+		t.Fatalf("CreatePolicy failed: %v", err)
+	}
+
+	// Chạy với -race: thao tác đọc phải giữ khóa như thao tác ghi.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				p, err := pm.CreatePolicy(Policy{TenantID: "tenant1", Rule: fmt.Sprintf("Action == 'w%d_%d'", i, j), Effect: "allow"})
+				if err != nil {
+					t.Errorf("CreatePolicy failed: %v", err)
+					return
+				}
+				if _, err := pm.DeletePolicyByID(p.ID); err != nil {
+					t.Errorf("DeletePolicyByID failed: %v", err)
+					return
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := pm.GetPolicyByID(created.ID); err != nil {
+					t.Errorf("GetPolicyByID failed: %v", err)
+				}
+				_, _ = pm.ListPolicies("tenant1")
+				_, _ = pm.GetPolicies()
+				_, _ = pm.HasPolicy([]string{"tenant1", "Action == 'read'", "allow"})
+			}
+		}()
+	}
+	wg.Wait()
+}
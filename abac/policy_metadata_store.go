@@ -0,0 +1,176 @@
+package abac
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PolicyMetadataStore lưu metadata (mô tả, người sở hữu, tags, thời gian) của policy,
+// khóa theo Policy.ID.
+type PolicyMetadataStore interface {
+	// GetPolicyMetadata trả về nil, nil nếu policy chưa có metadata.
+	GetPolicyMetadata(policyID string) (*PolicyMetadata, error)
+	ListPolicyMetadata() (map[string]PolicyMetadata, error)
+	SavePolicyMetadata(meta PolicyMetadata) error
+	DeletePolicyMetadata(policyID string) error
+}
+
+// =========================================================================
+// == In-memory store (mặc định cho hệ thống tạo từ file/chuỗi)
+// =========================================================================
+
+type memoryPolicyMetadataStore struct {
+	mu    sync.RWMutex
+	items map[string]PolicyMetadata
+}
+
+// NewMemoryPolicyMetadataStore tạo store lưu metadata trong bộ nhớ.
+func NewMemoryPolicyMetadataStore() PolicyMetadataStore {
+	return &memoryPolicyMetadataStore{items: make(map[string]PolicyMetadata)}
+}
+
+func (s *memoryPolicyMetadataStore) GetPolicyMetadata(policyID string) (*PolicyMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	meta, ok := s.items[policyID]
+	if !ok {
+		return nil, nil
+	}
+	meta.Tags = append([]string(nil), meta.Tags...)
+	return &meta, nil
+}
+
+func (s *memoryPolicyMetadataStore) ListPolicyMetadata() (map[string]PolicyMetadata, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]PolicyMetadata, len(s.items))
+	for id, meta := range s.items {
+		meta.Tags = append([]string(nil), meta.Tags...)
+		out[id] = meta
+	}
+	return out, nil
+}
+
+func (s *memoryPolicyMetadataStore) SavePolicyMetadata(meta PolicyMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta.Tags = append([]string(nil), meta.Tags...)
+	s.items[meta.PolicyID] = meta
+	return nil
+}
+
+func (s *memoryPolicyMetadataStore) DeletePolicyMetadata(policyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, policyID)
+	return nil
+}
+
+// =========================================================================
+// == GORM store (mặc định cho hệ thống tạo từ DB)
+// =========================================================================
+
+// DefaultPolicyMetadataTable là tên bảng metadata mặc định.
+const DefaultPolicyMetadataTable = "abac_policy_metadata"
+
+type policyMetadataRecord struct {
+	PolicyID    string `gorm:"primaryKey;size:64"`
+	Description string `gorm:"type:text"`
+	Owner       string `gorm:"size:255"`
+	Tags        string `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type gormPolicyMetadataStore struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewGormPolicyMetadataStore tạo store lưu metadata trong bảng tableName
+// (mặc định DefaultPolicyMetadataTable) và tự tạo bảng nếu chưa có.
+func NewGormPolicyMetadataStore(db *gorm.DB, tableName string) (PolicyMetadataStore, error) {
+	return newGormPolicyMetadataStore(db, tableName, true)
+}
+
+func newGormPolicyMetadataStore(db *gorm.DB, tableName string, migrate bool) (PolicyMetadataStore, error) {
+	if tableName == "" {
+		tableName = DefaultPolicyMetadataTable
+	}
+	s := &gormPolicyMetadataStore{db: db, table: tableName}
+	if !migrate {
+		return s, nil
+	}
+	if err := s.query().AutoMigrate(&policyMetadataRecord{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate policy metadata table %s: %w", tableName, err)
+	}
+	return s, nil
+}
+
+func (s *gormPolicyMetadataStore) query() *gorm.DB {
+	return s.db.Table(s.table)
+}
+
+func (s *gormPolicyMetadataStore) GetPolicyMetadata(policyID string) (*PolicyMetadata, error) {
+	var rec policyMetadataRecord
+	err := s.query().Where("policy_id = ?", policyID).Take(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta := rec.toMetadata()
+	return &meta, nil
+}
+
+func (s *gormPolicyMetadataStore) ListPolicyMetadata() (map[string]PolicyMetadata, error) {
+	var recs []policyMetadataRecord
+	if err := s.query().Find(&recs).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[string]PolicyMetadata, len(recs))
+	for _, rec := range recs {
+		out[rec.PolicyID] = rec.toMetadata()
+	}
+	return out, nil
+}
+
+func (s *gormPolicyMetadataStore) SavePolicyMetadata(meta PolicyMetadata) error {
+	tags, err := json.Marshal(meta.Tags)
+	if err != nil {
+		return err
+	}
+	rec := policyMetadataRecord{
+		PolicyID:    meta.PolicyID,
+		Description: meta.Description,
+		Owner:       meta.Owner,
+		Tags:        string(tags),
+		CreatedAt:   meta.CreatedAt,
+		UpdatedAt:   meta.UpdatedAt,
+	}
+	return s.query().Save(&rec).Error
+}
+
+func (s *gormPolicyMetadataStore) DeletePolicyMetadata(policyID string) error {
+	return s.query().Where("policy_id = ?", policyID).Delete(&policyMetadataRecord{}).Error
+}
+
+func (rec policyMetadataRecord) toMetadata() PolicyMetadata {
+	meta := PolicyMetadata{
+		PolicyID:    rec.PolicyID,
+		Description: rec.Description,
+		Owner:       rec.Owner,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+	if rec.Tags != "" {
+		_ = json.Unmarshal([]byte(rec.Tags), &meta.Tags)
+	}
+	return meta
+}
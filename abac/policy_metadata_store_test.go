@@ -0,0 +1,107 @@
+package abac
+
+import (
+	"testing"
+
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open sqlite: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	// Mỗi connection của sqlite in-memory là một database riêng.
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&gormadapter.CasbinRule{}); err != nil {
+		t.Fatalf("failed to migrate casbin_rule: %v", err)
+	}
+	return db
+}
+
+func TestGormPolicyMetadataStore_RoundTrip(t *testing.T) {
+	store, err := NewGormPolicyMetadataStore(newTestDB(t), "")
+	if err != nil {
+		t.Fatalf("NewGormPolicyMetadataStore failed: %v", err)
+	}
+	meta := PolicyMetadata{PolicyID: "pol_1", Description: "desc", Owner: "owner", Tags: []string{"a", "b"}}
+	if err := store.SavePolicyMetadata(meta); err != nil {
+		t.Fatalf("SavePolicyMetadata failed: %v", err)
+	}
+	got, err := store.GetPolicyMetadata("pol_1")
+	if err != nil || got == nil || got.Owner != "owner" || len(got.Tags) != 2 {
+		t.Fatalf("GetPolicyMetadata returned %+v, %v", got, err)
+	}
+	all, err := store.ListPolicyMetadata()
+	if err != nil || len(all) != 1 {
+		t.Fatalf("ListPolicyMetadata returned %+v, %v", all, err)
+	}
+	if err := store.DeletePolicyMetadata("pol_1"); err != nil {
+		t.Fatalf("DeletePolicyMetadata failed: %v", err)
+	}
+	if got, _ := store.GetPolicyMetadata("pol_1"); got != nil {
+		t.Fatal("metadata should be deleted")
+	}
+}
+
+func TestNewABACSystemFromDB_PersistsPolicyAndMetadata(t *testing.T) {
+	db := newTestDB(t)
+	_, pm, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil, WithAutoMigrate())
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	created, err := pm.CreatePolicy(Policy{TenantID: "tenant1", Rule: "Action == 'read'", Effect: "allow", Owner: "team-a"})
+	if err != nil {
+		t.Fatalf("CreatePolicy failed: %v", err)
+	}
+
+	// Một hệ thống khác trên cùng database phải thấy cả policy lẫn metadata.
+	_, other, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	got, err := other.GetPolicyByID(created.ID)
+	if err != nil {
+		t.Fatalf("GetPolicyByID failed: %v", err)
+	}
+	if got.Rule != "Action == 'read'" || got.Owner != "team-a" {
+		t.Fatalf("unexpected policy: %+v", got)
+	}
+}
+
+func TestNewABACSystemFromDB_CreatesTablesOnlyWithAutoMigrate(t *testing.T) {
+	db := newTestDB(t)
+	_, pm, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	for _, table := range []string{DefaultPolicyMetadataTable, DefaultPolicySetTable} {
+		if db.Migrator().HasTable(table) {
+			t.Fatalf("table %s must not be created without WithAutoMigrate", table)
+		}
+	}
+	// Không có bảng: metadata và policy set nằm trong bộ nhớ.
+	created, err := pm.CreatePolicy(Policy{TenantID: "tenant1", Rule: "Action == 'read'", Effect: "allow", Owner: "team-a"})
+	if err != nil {
+		t.Fatalf("CreatePolicy failed: %v", err)
+	}
+	if got, err := pm.GetPolicyByID(created.ID); err != nil || got.Owner != "team-a" {
+		t.Fatalf("GetPolicyByID returned %+v, %v", got, err)
+	}
+
+	if _, _, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil, WithAutoMigrate()); err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	for _, table := range []string{DefaultPolicyMetadataTable, DefaultPolicySetTable} {
+		if !db.Migrator().HasTable(table) {
+			t.Fatalf("WithAutoMigrate should create table %s", table)
+		}
+	}
+}
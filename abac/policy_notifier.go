@@ -0,0 +1,472 @@
+package abac
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PolicyChangeType là loại thay đổi policy được phát qua PolicyChangeNotifier.
+type PolicyChangeType string
+
+const (
+	PolicyChangeAdd    PolicyChangeType = "add"
+	PolicyChangeRemove PolicyChangeType = "remove"
+	PolicyChangeUpdate PolicyChangeType = "update"
+	PolicyChangeClear  PolicyChangeType = "clear"
+	// PolicyChangePolicySets: policy set đã thay đổi; instance nhận nạp lại policy set từ
+	// PolicySetStore dùng chung (sự kiện không mang dòng policy).
+	PolicyChangePolicySets PolicyChangeType = "policy_sets"
+)
+
+// PolicyChangeEvent mô tả một thay đổi policy đã được ghi thành công trên một instance.
+type PolicyChangeEvent struct {
+	// Version do notifier gán, tăng liên tục từng đơn vị theo thứ tự phát.
+	Version uint64           `json:"version"`
+	Source  string           `json:"source"` // instance đã phát sự kiện
+	Type    PolicyChangeType `json:"type"`
+	Rules   [][]string       `json:"rules,omitempty"`
+	// OldRules chỉ dùng với PolicyChangeUpdate: OldRules[i] được thay bằng Rules[i].
+	OldRules [][]string `json:"old_rules,omitempty"`
+	Time     time.Time  `json:"time"`
+}
+
+// PolicyChangeNotifier là kênh phát/nhận thay đổi policy giữa các instance (xem
+// PolicyManager.UseChangeNotifier). Cài đặt phải gán Version tăng liên tục và gửi sự kiện
+// cho handler theo đúng thứ tự Version; sự kiện bị mất được phát hiện qua khoảng trống version.
+type PolicyChangeNotifier interface {
+	// Publish gán Version cho sự kiện, phát đi và trả về Version đã gán.
+	Publish(ctx context.Context, event PolicyChangeEvent) (uint64, error)
+	// LatestVersion trả về Version của sự kiện mới nhất (0 nếu chưa có).
+	LatestVersion(ctx context.Context) (uint64, error)
+	// Subscribe gọi handler (tuần tự) cho các sự kiện có Version > after.
+	Subscribe(after uint64, handler func(PolicyChangeEvent)) (unsubscribe func(), err error)
+}
+
+// =========================================================================
+// == Đăng ký notifier cho PolicyManager
+// =========================================================================
+
+// PolicyChangeSubscription gắn một PolicyManager với một PolicyChangeNotifier:
+// mọi thay đổi ghi qua PolicyManager được phát đi, thay đổi từ instance khác được áp dụng
+// vào bộ nhớ (không ghi lại xuống storage).
+type PolicyChangeSubscription struct {
+	pm       *PolicyManager
+	notifier PolicyChangeNotifier
+	cfg      watcherConfig
+	source   string
+
+	mu          sync.Mutex // tuần tự hóa việc áp dụng sự kiện
+	last        uint64
+	unsubscribe func()
+	once        sync.Once
+}
+
+// UseChangeNotifier phát các thay đổi policy của PolicyManager qua notifier và áp dụng các
+// thay đổi do instance khác phát. Khi phát hiện thiếu sự kiện (khoảng trống version) hoặc
+// không áp dụng được một sự kiện, toàn bộ policy được nạp lại bằng LoadPoliciesFromStorage.
+// WithOnReload được gọi sau mỗi lần áp dụng thay đổi từ instance khác, WithOnReloadError khi
+// phát, áp dụng hoặc nạp lại thất bại. Metadata của policy không được đồng bộ qua notifier.
+func (pm *PolicyManager) UseChangeNotifier(notifier PolicyChangeNotifier, opts ...WatcherOption) (*PolicyChangeSubscription, error) {
+	version, err := notifier.LatestVersion(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy change version: %w", err)
+	}
+	s := &PolicyChangeSubscription{
+		pm:       pm,
+		notifier: notifier,
+		cfg:      newWatcherConfig(opts),
+		source:   newInstanceID(),
+		last:     version,
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if pm.changes != nil {
+		return nil, errors.New("policy change notifier already attached")
+	}
+	s.unsubscribe, err = notifier.Subscribe(version, s.handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to policy changes: %w", err)
+	}
+	pm.changes = s
+	return s, nil
+}
+
+// Version trả về Version của sự kiện cuối cùng đã được xử lý.
+func (s *PolicyChangeSubscription) Version() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// Stop ngừng phát và nhận thay đổi policy.
+func (s *PolicyChangeSubscription) Stop() {
+	s.once.Do(func() {
+		s.pm.mu.Lock()
+		if s.pm.changes == s {
+			s.pm.changes = nil
+		}
+		s.pm.mu.Unlock()
+		s.unsubscribe()
+	})
+}
+
+func (s *PolicyChangeSubscription) handle(event PolicyChangeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.Version <= s.last {
+		return
+	}
+	if event.Version != s.last+1 {
+		s.resync(event.Version, fmt.Errorf("missed policy changes %d-%d", s.last+1, event.Version-1))
+		return
+	}
+	s.last = event.Version
+	if event.Source == s.source {
+		return // đã áp dụng khi ghi
+	}
+	if err := s.pm.applyChange(event); err != nil {
+		s.resync(event.Version, err)
+		return
+	}
+	if s.cfg.onReload != nil {
+		s.cfg.onReload()
+	}
+}
+
+// resync nạp lại toàn bộ policy; nếu thất bại, version không đổi để sự kiện kế tiếp thử lại.
+func (s *PolicyChangeSubscription) resync(version uint64, cause error) {
+	if err := s.pm.LoadPoliciesFromStorage(); err != nil {
+		s.reportError(fmt.Errorf("failed to reload policy after %v: %w", cause, err))
+		return
+	}
+	s.last = version
+	if s.cfg.onReload != nil {
+		s.cfg.onReload()
+	}
+}
+
+func (s *PolicyChangeSubscription) reportError(err error) {
+	if s.cfg.onError != nil {
+		s.cfg.onError(err)
+	}
+}
+
+// publish phát thay đổi vừa ghi thành công; được gọi khi đang giữ pm.mu.
+// Lỗi phát không làm hỏng thao tác ghi, chỉ được báo qua WithOnReloadError.
+func (pm *PolicyManager) publish(typ PolicyChangeType, rules, oldRules [][]string) {
+	s := pm.changes
+	if s == nil {
+		return
+	}
+	event := PolicyChangeEvent{
+		Source:   s.source,
+		Type:     typ,
+		Rules:    rules,
+		OldRules: oldRules,
+		Time:     time.Now().UTC(),
+	}
+	if _, err := s.notifier.Publish(context.Background(), event); err != nil {
+		s.reportError(fmt.Errorf("failed to publish policy change: %w", err))
+	}
+}
+
+// applyChange áp dụng thay đổi từ instance khác vào model trong bộ nhớ rồi dựng lại snapshot.
+func (pm *PolicyManager) applyChange(event PolicyChangeEvent) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	m := pm.enforcer.GetModel()
+	switch event.Type {
+	case PolicyChangeAdd:
+		for _, rule := range event.Rules {
+			if has, _ := m.HasPolicy("p", "p", rule); has {
+				continue
+			}
+			if err := m.AddPolicy("p", "p", rule); err != nil {
+				return err
+			}
+		}
+	case PolicyChangeRemove:
+		for _, rule := range event.Rules {
+			if _, err := m.RemovePolicy("p", "p", rule); err != nil {
+				return err
+			}
+		}
+		pm.forgetMetadata(event.Rules)
+	case PolicyChangeUpdate:
+		if len(event.OldRules) != len(event.Rules) {
+			return fmt.Errorf("policy change %d: %d old rules for %d new rules", event.Version, len(event.OldRules), len(event.Rules))
+		}
+		for i := range event.Rules {
+			ok, err := m.UpdatePolicy("p", "p", event.OldRules[i], event.Rules[i])
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("policy change %d: rule to update not found", event.Version)
+			}
+		}
+	case PolicyChangeClear:
+		m.ClearPolicy()
+	case PolicyChangePolicySets:
+		return pm.reloadPolicySets()
+	default:
+		return fmt.Errorf("policy change %d: unknown type %q", event.Version, event.Type)
+	}
+	pm.engine.reload(pm.enforcer)
+	return nil
+}
+
+func newInstanceID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// =========================================================================
+// == In-process notifier
+// =========================================================================
+
+// memoryChangeHistory là số sự kiện gần nhất MemoryPolicyChangeNotifier giữ lại cho Subscribe.
+const memoryChangeHistory = 1000
+
+// MemoryPolicyChangeNotifier phát thay đổi giữa các PolicyManager trong cùng tiến trình.
+// Mỗi subscriber nhận sự kiện trên goroutine riêng nên Publish không bao giờ bị chặn.
+type MemoryPolicyChangeNotifier struct {
+	mu      sync.Mutex
+	version uint64
+	history []PolicyChangeEvent // tối đa memoryChangeHistory sự kiện gần nhất
+	nextID  int
+	subs    map[int]*changeQueue
+}
+
+// NewMemoryPolicyChangeNotifier tạo notifier trong bộ nhớ.
+func NewMemoryPolicyChangeNotifier() *MemoryPolicyChangeNotifier {
+	return &MemoryPolicyChangeNotifier{subs: make(map[int]*changeQueue)}
+}
+
+func (n *MemoryPolicyChangeNotifier) Publish(ctx context.Context, event PolicyChangeEvent) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.version++
+	event.Version = n.version
+	if len(n.history) == memoryChangeHistory {
+		n.history = n.history[1:]
+	}
+	n.history = append(n.history, event)
+	for _, q := range n.subs {
+		q.push(event)
+	}
+	return event.Version, nil
+}
+
+func (n *MemoryPolicyChangeNotifier) LatestVersion(ctx context.Context) (uint64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.version, nil
+}
+
+// Subscribe gửi các sự kiện có Version > after: trước hết là các sự kiện còn trong lịch sử
+// (memoryChangeHistory sự kiện gần nhất), sau đó là các sự kiện phát sau thời điểm đăng ký.
+// Sự kiện đã rơi khỏi lịch sử không được gửi lại; subscriber nhận ra qua khoảng trống version.
+func (n *MemoryPolicyChangeNotifier) Subscribe(after uint64, handler func(PolicyChangeEvent)) (func(), error) {
+	q := newChangeQueue(after, handler)
+	n.mu.Lock()
+	for _, event := range n.history {
+		q.push(event)
+	}
+	id := n.nextID
+	n.nextID++
+	n.subs[id] = q
+	n.mu.Unlock()
+	go q.run()
+
+	return func() {
+		n.mu.Lock()
+		delete(n.subs, id)
+		n.mu.Unlock()
+		q.close()
+	}, nil
+}
+
+// changeQueue là hàng đợi không giới hạn, gửi các sự kiện có Version > after cho handler
+// theo thứ tự.
+type changeQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	events  []PolicyChangeEvent
+	after   uint64
+	closed  bool
+	handler func(PolicyChangeEvent)
+	done    chan struct{}
+}
+
+func newChangeQueue(after uint64, handler func(PolicyChangeEvent)) *changeQueue {
+	q := &changeQueue{after: after, handler: handler, done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *changeQueue) push(event PolicyChangeEvent) {
+	q.mu.Lock()
+	if !q.closed && event.Version > q.after {
+		q.events = append(q.events, event)
+		q.cond.Signal()
+	}
+	q.mu.Unlock()
+}
+
+func (q *changeQueue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.events) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		event := q.events[0]
+		q.events = q.events[1:]
+		q.mu.Unlock()
+		q.handler(event)
+	}
+}
+
+// close dừng hàng đợi và đợi handler đang chạy (nếu có) kết thúc.
+func (q *changeQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+}
+
+// =========================================================================
+// == Notifier qua bảng DB (không cần message broker)
+// =========================================================================
+
+// DefaultPolicyChangeTable là tên bảng sự kiện thay đổi policy mặc định.
+const DefaultPolicyChangeTable = "abac_policy_changes"
+
+// changeGapPolls là số chu kỳ GormPolicyChangeNotifier đọc lại các version còn thiếu trước khi
+// bỏ qua chúng. Khóa tự tăng có thể thiếu tạm thời (giao dịch chưa commit, sẽ xuất hiện sau)
+// hoặc vĩnh viễn (giao dịch rollback, sự kiện đã bị Prune).
+const changeGapPolls = 3
+
+type policyChangeRecord struct {
+	Version   uint64 `gorm:"primaryKey;autoIncrement"`
+	Source    string `gorm:"size:64"`
+	Type      string `gorm:"size:16"`
+	Payload   string `gorm:"type:text"`
+	CreatedAt time.Time
+}
+
+type policyChangePayload struct {
+	Rules    [][]string `json:"rules,omitempty"`
+	OldRules [][]string `json:"old_rules,omitempty"`
+}
+
+// GormPolicyChangeNotifier ghi sự kiện vào một bảng (Version là khóa tự tăng) và mỗi
+// subscriber định kỳ đọc các dòng mới. Dùng được với mọi database mà GORM hỗ trợ.
+type GormPolicyChangeNotifier struct {
+	db    *gorm.DB
+	table string
+	cfg   watcherConfig
+}
+
+// NewGormPolicyChangeNotifier tạo notifier dùng bảng tableName (mặc định DefaultPolicyChangeTable)
+// và tự tạo bảng nếu chưa có. WithWatchInterval đặt chu kỳ đọc sự kiện mới,
+// WithOnReloadError nhận lỗi khi đọc.
+func NewGormPolicyChangeNotifier(db *gorm.DB, tableName string, opts ...WatcherOption) (*GormPolicyChangeNotifier, error) {
+	if tableName == "" {
+		tableName = DefaultPolicyChangeTable
+	}
+	n := &GormPolicyChangeNotifier{db: db, table: tableName, cfg: newWatcherConfig(opts)}
+	if err := n.query(context.Background()).AutoMigrate(&policyChangeRecord{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate policy change table %s: %w", tableName, err)
+	}
+	return n, nil
+}
+
+func (n *GormPolicyChangeNotifier) query(ctx context.Context) *gorm.DB {
+	return n.db.WithContext(ctx).Table(n.table)
+}
+
+func (n *GormPolicyChangeNotifier) Publish(ctx context.Context, event PolicyChangeEvent) (uint64, error) {
+	payload, err := json.Marshal(policyChangePayload{Rules: event.Rules, OldRules: event.OldRules})
+	if err != nil {
+		return 0, err
+	}
+	rec := policyChangeRecord{Source: event.Source, Type: string(event.Type), Payload: string(payload), CreatedAt: event.Time}
+	if err := n.query(ctx).Create(&rec).Error; err != nil {
+		return 0, err
+	}
+	return rec.Version, nil
+}
+
+func (n *GormPolicyChangeNotifier) LatestVersion(ctx context.Context) (uint64, error) {
+	var version uint64
+	if err := n.query(ctx).Select("COALESCE(MAX(version), 0)").Row().Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Subscribe bắt đầu một goroutine đọc các sự kiện có Version > after theo chu kỳ.
+// Gặp version còn thiếu, các sự kiện sau đó được giữ lại và version thiếu được đọc lại ở
+// changeGapPolls chu kỳ kế tiếp; quá hạn mới gửi tiếp (subscriber thấy khoảng trống và nạp lại).
+func (n *GormPolicyChangeNotifier) Subscribe(after uint64, handler func(PolicyChangeEvent)) (func(), error) {
+	last := after
+	gapPolls := 0
+	w := startPolicyWatcher(n.cfg, func(ctx context.Context) (bool, error) {
+		var records []policyChangeRecord
+		if err := n.query(ctx).Where("version > ?", last).Order("version").Limit(1000).Find(&records).Error; err != nil {
+			return false, fmt.Errorf("failed to read policy changes: %w", err)
+		}
+		for _, rec := range records {
+			if rec.Version != last+1 && gapPolls < changeGapPolls {
+				gapPolls++
+				return false, nil
+			}
+			gapPolls = 0
+			var payload policyChangePayload
+			if err := json.Unmarshal([]byte(rec.Payload), &payload); err != nil {
+				return false, fmt.Errorf("failed to decode policy change %d: %w", rec.Version, err)
+			}
+			handler(PolicyChangeEvent{
+				Version:  rec.Version,
+				Source:   rec.Source,
+				Type:     PolicyChangeType(rec.Type),
+				Rules:    payload.Rules,
+				OldRules: payload.OldRules,
+				Time:     rec.CreatedAt,
+			})
+			last = rec.Version
+		}
+		return false, nil
+	})
+	return w.Stop, nil
+}
+
+// Prune xóa các sự kiện cũ hơn olderThan, luôn giữ lại sự kiện mới nhất để Version không
+// bị đánh số lại. Subscriber còn chưa đọc tới các sự kiện đã xóa sẽ phát hiện khoảng trống
+// version và nạp lại toàn bộ policy.
+func (n *GormPolicyChangeNotifier) Prune(ctx context.Context, olderThan time.Duration) error {
+	latest, err := n.LatestVersion(ctx)
+	if err != nil {
+		return err
+	}
+	return n.query(ctx).
+		Where("created_at < ? AND version < ?", time.Now().UTC().Add(-olderThan), latest).
+		Delete(&policyChangeRecord{}).Error
+}
@@ -0,0 +1,292 @@
+package abac
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor đợi tới khi cond trả về true hoặc hết thời gian.
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", msg)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMemoryPolicyChangeNotifier_PropagatesWrites(t *testing.T) {
+	notifier := NewMemoryPolicyChangeNotifier()
+	_, writer, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromStrings failed: %v", err)
+	}
+	readerAuth, reader, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromStrings failed: %v", err)
+	}
+	ws, err := writer.UseChangeNotifier(notifier)
+	if err != nil {
+		t.Fatalf("UseChangeNotifier failed: %v", err)
+	}
+	defer ws.Stop()
+	rs, err := reader.UseChangeNotifier(notifier)
+	if err != nil {
+		t.Fatalf("UseChangeNotifier failed: %v", err)
+	}
+	defer rs.Stop()
+	if _, err := reader.UseChangeNotifier(notifier); err == nil {
+		t.Fatalf("expected error when attaching a second notifier")
+	}
+
+	ctx := context.Background()
+	check := func(action string) bool {
+		ok, err := readerAuth.Check(&ctx, "t1", "u1", "r1", action, nil)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		return ok
+	}
+
+	if _, err := writer.AddPolicy([]string{"*", "Action == 'read'", "allow", "allow_read"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	waitFor(t, "add", func() bool { return rs.Version() == 1 })
+	if !check("read") {
+		t.Fatalf("expected the added policy on the reader")
+	}
+
+	if _, err := writer.UpdatePolicy([]string{"*", "Action == 'read'", "allow", "allow_read"}, []string{"*", "Action == 'write'", "allow", "allow_read"}); err != nil {
+		t.Fatalf("UpdatePolicy failed: %v", err)
+	}
+	waitFor(t, "update", func() bool { return rs.Version() == 2 })
+	if check("read") || !check("write") {
+		t.Fatalf("expected the updated policy on the reader")
+	}
+
+	if _, err := writer.RemovePolicy([]string{"*", "Action == 'write'", "allow", "allow_read"}); err != nil {
+		t.Fatalf("RemovePolicy failed: %v", err)
+	}
+	waitFor(t, "remove", func() bool { return rs.Version() == 3 })
+	if check("write") {
+		t.Fatalf("expected the removed policy to be gone on the reader")
+	}
+
+	// Thay đổi của reader cũng đến writer; instance không áp dụng lại sự kiện của chính nó.
+	if _, err := reader.AddPolicy([]string{"*", "Action == 'list'", "allow", "allow_list"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	waitFor(t, "reverse propagation", func() bool { return ws.Version() == 4 && rs.Version() == 4 })
+	if rows, _ := writer.GetPolicies(); len(rows) != 1 {
+		t.Fatalf("expected writer to have 1 policy, got %v", rows)
+	}
+	if rows, _ := reader.GetPolicies(); len(rows) != 1 {
+		t.Fatalf("expected reader to have 1 policy, got %v", rows)
+	}
+}
+
+func TestMemoryPolicyChangeNotifier_SubscribeAfter(t *testing.T) {
+	notifier := NewMemoryPolicyChangeNotifier()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := notifier.Publish(ctx, PolicyChangeEvent{Type: PolicyChangeClear}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	var got []uint64
+	unsubscribe, err := notifier.Subscribe(1, func(event PolicyChangeEvent) {
+		mu.Lock()
+		got = append(got, event.Version)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer unsubscribe()
+	if _, err := notifier.Publish(ctx, PolicyChangeEvent{Type: PolicyChangeClear}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	// Sự kiện phát trước khi đăng ký nhưng có Version > after vẫn được gửi, đúng thứ tự.
+	waitFor(t, "events after 1", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got) == 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if got[0] != 2 || got[1] != 3 || got[2] != 4 {
+		t.Fatalf("expected versions 2-4, got %v", got)
+	}
+}
+
+func TestGormPolicyChangeNotifier_WaitsForLateCommits(t *testing.T) {
+	db := newTestDB(t)
+	notifier, err := NewGormPolicyChangeNotifier(db, "", WithWatchInterval(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewGormPolicyChangeNotifier failed: %v", err)
+	}
+	insert := func(version uint64) {
+		rec := policyChangeRecord{Version: version, Source: "other", Type: string(PolicyChangeClear), Payload: "{}", CreatedAt: time.Now()}
+		if err := db.Table(DefaultPolicyChangeTable).Create(&rec).Error; err != nil {
+			t.Fatalf("insert change %d failed: %v", version, err)
+		}
+	}
+
+	var mu sync.Mutex
+	var got []uint64
+	unsubscribe, err := notifier.Subscribe(0, func(event PolicyChangeEvent) {
+		mu.Lock()
+		got = append(got, event.Version)
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	defer unsubscribe()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got)
+	}
+
+	insert(1)
+	waitFor(t, "first change", func() bool { return count() == 1 })
+	// Version 2 được commit sau version 3 (giao dịch chậm): notifier phải đợi và gửi đúng thứ tự
+	// thay vì để subscriber thấy khoảng trống rồi nạp lại toàn bộ.
+	insert(3)
+	time.Sleep(150 * time.Millisecond)
+	if n := count(); n != 1 {
+		t.Fatalf("expected change 3 to be held back while 2 is missing, got %d changes", n)
+	}
+	insert(2)
+	waitFor(t, "late change", func() bool { return count() == 3 })
+	mu.Lock()
+	defer mu.Unlock()
+	if got[1] != 2 || got[2] != 3 {
+		t.Fatalf("expected versions 1-3 in order, got %v", got)
+	}
+}
+
+func TestGormPolicyChangeNotifier_ResyncsOnGap(t *testing.T) {
+	db := newTestDB(t)
+	_, writer, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	_, reader, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+
+	notifier, err := NewGormPolicyChangeNotifier(db, "", WithWatchInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewGormPolicyChangeNotifier failed: %v", err)
+	}
+	ws, err := writer.UseChangeNotifier(notifier)
+	if err != nil {
+		t.Fatalf("UseChangeNotifier failed: %v", err)
+	}
+	defer ws.Stop()
+
+	// Reader bỏ lỡ sự kiện 2 (bị xóa khỏi bảng): sự kiện 3 phải kích hoạt nạp lại toàn bộ,
+	// nếu chỉ áp dụng sự kiện 3 thì reader sẽ thiếu policy allow_write.
+	if _, err := writer.AddPolicy([]string{"*", "Action == 'read'", "allow", "allow_read"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	// Notifier của reader đọc chậm hơn để khoảng trống chắc chắn xuất hiện trước lần đọc đầu tiên.
+	readerNotifier, err := NewGormPolicyChangeNotifier(db, "", WithWatchInterval(300*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewGormPolicyChangeNotifier failed: %v", err)
+	}
+	rs, err := reader.UseChangeNotifier(readerNotifier)
+	if err != nil {
+		t.Fatalf("UseChangeNotifier failed: %v", err)
+	}
+	defer rs.Stop()
+	if _, err := writer.AddPolicy([]string{"*", "Action == 'write'", "allow", "allow_write"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	if _, err := writer.AddPolicy([]string{"*", "Action == 'list'", "allow", "allow_list"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	if err := db.Table(DefaultPolicyChangeTable).Where("version = ?", 2).Delete(&policyChangeRecord{}).Error; err != nil {
+		t.Fatalf("delete change failed: %v", err)
+	}
+
+	waitFor(t, "resync", func() bool { return rs.Version() == 3 })
+	if rows, _ := reader.GetPolicies(); len(rows) != 3 {
+		t.Fatalf("expected the full reload to pick up all 3 policies, got %v", rows)
+	}
+	if latest, err := notifier.LatestVersion(context.Background()); err != nil || latest != 3 {
+		t.Fatalf("expected latest version 3, got %d (%v)", latest, err)
+	}
+
+	if err := notifier.Prune(context.Background(), -time.Minute); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if latest, _ := notifier.LatestVersion(context.Background()); latest != 3 {
+		t.Fatalf("expected Prune to keep the latest event, got %d", latest)
+	}
+}
+
+func TestPolicyChangeNotifier_PropagatesPolicySets(t *testing.T) {
+	db := newTestDB(t)
+	_, writer, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil, WithAutoMigrate())
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	readerAuth, reader, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	notifier := NewMemoryPolicyChangeNotifier()
+	ws, err := writer.UseChangeNotifier(notifier)
+	if err != nil {
+		t.Fatalf("UseChangeNotifier failed: %v", err)
+	}
+	defer ws.Stop()
+	rs, err := reader.UseChangeNotifier(notifier)
+	if err != nil {
+		t.Fatalf("UseChangeNotifier failed: %v", err)
+	}
+	defer rs.Stop()
+
+	ctx := context.Background()
+	check := func() bool {
+		ok, err := readerAuth.Check(&ctx, "t1", "u1", "r1", "read", nil)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		return ok
+	}
+	if _, err := writer.AddPolicy([]string{"*", "Action == 'read'", "allow", "allow_read"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	waitFor(t, "add", func() bool { return rs.Version() == 1 })
+	if !check() {
+		t.Fatalf("expected the added policy on the reader")
+	}
+
+	// Target của policy set không khớp nên policy bên trong bị bỏ qua trên cả reader.
+	if _, err := writer.CreatePolicySet(PolicySet{ID: "hidden", TenantID: "*", Target: "Action == 'none'", PolicyIDs: []string{"allow_read"}}); err != nil {
+		t.Fatalf("CreatePolicySet failed: %v", err)
+	}
+	waitFor(t, "create policy set", func() bool { return rs.Version() == 2 })
+	if check() {
+		t.Fatalf("expected the policy set to be applied on the reader")
+	}
+
+	if _, err := writer.DeletePolicySet("hidden"); err != nil {
+		t.Fatalf("DeletePolicySet failed: %v", err)
+	}
+	waitFor(t, "delete policy set", func() bool { return rs.Version() == 3 })
+	if !check() {
+		t.Fatalf("expected the policy set removal on the reader")
+	}
+}
@@ -0,0 +1,701 @@
+package abac
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PolicySet là một nhóm policy có tên, với target, thuật toán kết hợp và priority riêng.
+// Policy set được đánh giá như một policy: khi target khớp, các policy và policy set con
+// bên trong được kết hợp bằng Algorithm và kết quả (permit/deny) tham gia vào cấp cha;
+// khi target không khớp, cả nhóm bị bỏ qua mà không đánh giá rule nào bên trong.
+type PolicySet struct {
+	ID       string `json:"id"`
+	TenantID string `json:"tenant_id"`
+	// ParentID là policy set cha, rỗng nếu là policy set cấp cao nhất.
+	ParentID string `json:"parent_id,omitempty"`
+	// Target là biểu thức cùng cú pháp với rule, ví dụ "Resource.type == 'leave_request'".
+	// Rỗng: luôn áp dụng.
+	Target string `json:"target,omitempty"`
+	// Algorithm rỗng: dùng thuật toán của cấp cha (thuật toán của tenant ở cấp cao nhất).
+	Algorithm CombiningAlgorithm `json:"algorithm,omitempty"`
+	// Priority có cùng ý nghĩa với Policy.Priority, so với các policy/policy set cùng cấp.
+	Priority int `json:"priority"`
+	// PolicyIDs là các policy thuộc nhóm; mỗi policy thuộc nhiều nhất một policy set.
+	PolicyIDs   []string  `json:"policy_ids"`
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (s PolicySet) clone() PolicySet {
+	s.PolicyIDs = append([]string(nil), s.PolicyIDs...)
+	return s
+}
+
+// PolicySetStore lưu các policy set, khóa theo PolicySet.ID.
+type PolicySetStore interface {
+	// GetPolicySet trả về nil, nil nếu không tồn tại.
+	GetPolicySet(id string) (*PolicySet, error)
+	// ListPolicySets trả về mọi policy set theo thứ tự tạo.
+	ListPolicySets() ([]PolicySet, error)
+	SavePolicySet(set PolicySet) error
+	DeletePolicySet(id string) error
+}
+
+// =========================================================================
+// == In-memory store (mặc định cho hệ thống tạo từ file/chuỗi)
+// =========================================================================
+
+type memoryPolicySetStore struct {
+	mu    sync.RWMutex
+	items map[string]PolicySet
+	order []string
+}
+
+// NewMemoryPolicySetStore tạo store lưu policy set trong bộ nhớ.
+func NewMemoryPolicySetStore() PolicySetStore {
+	return &memoryPolicySetStore{items: make(map[string]PolicySet)}
+}
+
+func (s *memoryPolicySetStore) GetPolicySet(id string) (*PolicySet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set, ok := s.items[id]
+	if !ok {
+		return nil, nil
+	}
+	set = set.clone()
+	return &set, nil
+}
+
+func (s *memoryPolicySetStore) ListPolicySets() ([]PolicySet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]PolicySet, 0, len(s.order))
+	for _, id := range s.order {
+		out = append(out, s.items[id].clone())
+	}
+	return out, nil
+}
+
+func (s *memoryPolicySetStore) SavePolicySet(set PolicySet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[set.ID]; !ok {
+		s.order = append(s.order, set.ID)
+	}
+	s.items[set.ID] = set.clone()
+	return nil
+}
+
+func (s *memoryPolicySetStore) DeletePolicySet(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.items[id]; !ok {
+		return nil
+	}
+	delete(s.items, id)
+	for i, existing := range s.order {
+		if existing == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// =========================================================================
+// == GORM store (mặc định cho hệ thống tạo từ DB)
+// =========================================================================
+
+// DefaultPolicySetTable là tên bảng policy set mặc định.
+const DefaultPolicySetTable = "abac_policy_sets"
+
+type policySetRecord struct {
+	ID          string `gorm:"primaryKey;size:64"`
+	TenantID    string `gorm:"size:255"`
+	ParentID    string `gorm:"size:64"`
+	Target      string `gorm:"type:text"`
+	Algorithm   string `gorm:"size:32"`
+	Priority    int
+	PolicyIDs   string `gorm:"type:text"`
+	Description string `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type gormPolicySetStore struct {
+	db    *gorm.DB
+	table string
+}
+
+// NewGormPolicySetStore tạo store lưu policy set trong bảng tableName
+// (mặc định DefaultPolicySetTable) và tự tạo bảng nếu chưa có.
+func NewGormPolicySetStore(db *gorm.DB, tableName string) (PolicySetStore, error) {
+	return newGormPolicySetStore(db, tableName, true)
+}
+
+func newGormPolicySetStore(db *gorm.DB, tableName string, migrate bool) (PolicySetStore, error) {
+	if tableName == "" {
+		tableName = DefaultPolicySetTable
+	}
+	s := &gormPolicySetStore{db: db, table: tableName}
+	if !migrate {
+		return s, nil
+	}
+	if err := s.query().AutoMigrate(&policySetRecord{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate policy set table %s: %w", tableName, err)
+	}
+	return s, nil
+}
+
+func (s *gormPolicySetStore) query() *gorm.DB {
+	return s.db.Table(s.table)
+}
+
+func (s *gormPolicySetStore) GetPolicySet(id string) (*PolicySet, error) {
+	var rec policySetRecord
+	err := s.query().Where("id = ?", id).Take(&rec).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	set := rec.toPolicySet()
+	return &set, nil
+}
+
+func (s *gormPolicySetStore) ListPolicySets() ([]PolicySet, error) {
+	var recs []policySetRecord
+	if err := s.query().Order("created_at, id").Find(&recs).Error; err != nil {
+		return nil, err
+	}
+	out := make([]PolicySet, 0, len(recs))
+	for _, rec := range recs {
+		out = append(out, rec.toPolicySet())
+	}
+	return out, nil
+}
+
+func (s *gormPolicySetStore) SavePolicySet(set PolicySet) error {
+	ids, err := json.Marshal(set.PolicyIDs)
+	if err != nil {
+		return err
+	}
+	rec := policySetRecord{
+		ID:          set.ID,
+		TenantID:    set.TenantID,
+		ParentID:    set.ParentID,
+		Target:      set.Target,
+		Algorithm:   string(set.Algorithm),
+		Priority:    set.Priority,
+		PolicyIDs:   string(ids),
+		Description: set.Description,
+		CreatedAt:   set.CreatedAt,
+		UpdatedAt:   set.UpdatedAt,
+	}
+	return s.query().Save(&rec).Error
+}
+
+func (s *gormPolicySetStore) DeletePolicySet(id string) error {
+	return s.query().Where("id = ?", id).Delete(&policySetRecord{}).Error
+}
+
+func (rec policySetRecord) toPolicySet() PolicySet {
+	set := PolicySet{
+		ID:          rec.ID,
+		TenantID:    rec.TenantID,
+		ParentID:    rec.ParentID,
+		Target:      rec.Target,
+		Algorithm:   CombiningAlgorithm(rec.Algorithm),
+		Priority:    rec.Priority,
+		Description: rec.Description,
+		CreatedAt:   rec.CreatedAt,
+		UpdatedAt:   rec.UpdatedAt,
+	}
+	if rec.PolicyIDs != "" {
+		_ = json.Unmarshal([]byte(rec.PolicyIDs), &set.PolicyIDs)
+	}
+	return set
+}
+
+// WithPolicySetStore chỉ định nơi lưu policy set.
+// Mặc định: bảng DefaultPolicySetTable với hệ thống tạo từ DB nếu bảng đã có (hoặc với
+// WithAutoMigrate), bộ nhớ với các trường hợp còn lại.
+func WithPolicySetStore(store PolicySetStore) SystemOption {
+	return systemOptFunc(func(c *systemConfig) {
+		if store != nil {
+			c.policySetStore = store
+		}
+	})
+}
+
+// newPolicySetID sinh ID ngẫu nhiên cho policy set mới.
+func newPolicySetID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "set_" + strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return "set_" + hex.EncodeToString(b)
+}
+
+// =========================================================================
+// == Quản lý policy set (PolicyManager)
+// =========================================================================
+
+// CreatePolicySet thêm một policy set. ID được sinh tự động nếu để trống.
+// Các policy trong PolicyIDs phải tồn tại và chưa thuộc policy set khác.
+func (pm *PolicyManager) CreatePolicySet(s PolicySet) (*PolicySet, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	sets, err := pm.sets.ListPolicySets()
+	if err != nil {
+		return nil, err
+	}
+	if s.ID == "" {
+		s.ID = newPolicySetID()
+	} else if findPolicySet(sets, s.ID) != nil {
+		return nil, fmt.Errorf("%w: %s", ErrPolicySetExists, s.ID)
+	}
+	now := time.Now().UTC()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	s.UpdatedAt = now
+	return pm.savePolicySet(s, append(sets, s))
+}
+
+// GetPolicySet trả về policy set theo ID.
+func (pm *PolicyManager) GetPolicySet(id string) (*PolicySet, error) {
+	s, err := pm.sets.GetPolicySet(id)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPolicySetNotFound, id)
+	}
+	return s, nil
+}
+
+// ListPolicySets trả về các policy set của một tenant theo thứ tự tạo.
+// tenantID rỗng sẽ trả về policy set của mọi tenant.
+func (pm *PolicyManager) ListPolicySets(tenantID string) ([]PolicySet, error) {
+	sets, err := pm.sets.ListPolicySets()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]PolicySet, 0, len(sets))
+	for _, s := range sets {
+		if tenantID == "" || s.TenantID == tenantID {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// UpdatePolicySet thay thế nội dung của policy set có ID cho trước.
+// ID và thời điểm tạo được giữ nguyên.
+func (pm *PolicyManager) UpdatePolicySet(id string, s PolicySet) (*PolicySet, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	sets, err := pm.sets.ListPolicySets()
+	if err != nil {
+		return nil, err
+	}
+	old := findPolicySet(sets, id)
+	if old == nil {
+		return nil, fmt.Errorf("%w: %s", ErrPolicySetNotFound, id)
+	}
+	s.ID = id
+	s.CreatedAt = old.CreatedAt
+	s.UpdatedAt = time.Now().UTC()
+	*old = s
+	return pm.savePolicySet(s, sets)
+}
+
+// DeletePolicySet xóa policy set; các policy bên trong trở về cấp chứa policy set đó.
+// Không xóa được policy set còn policy set con. Trả về false nếu không tìm thấy.
+func (pm *PolicyManager) DeletePolicySet(id string) (bool, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	sets, err := pm.sets.ListPolicySets()
+	if err != nil {
+		return false, err
+	}
+	if findPolicySet(sets, id) == nil {
+		return false, nil
+	}
+	for _, s := range sets {
+		if s.ParentID == id {
+			return false, fmt.Errorf("%w: policy set %s còn policy set con %s", ErrInvalidPolicy, id, s.ID)
+		}
+	}
+	if err := pm.sets.DeletePolicySet(id); err != nil {
+		return false, fmt.Errorf("failed to delete policy set: %w", err)
+	}
+	if err := pm.reloadPolicySets(); err != nil {
+		return false, err
+	}
+	pm.publish(PolicyChangePolicySets, nil, nil)
+	return true, nil
+}
+
+// savePolicySet kiểm tra policy set với danh sách sets (đã gồm thay đổi) rồi lưu, cập nhật
+// engine và phát thay đổi cho các instance khác.
+func (pm *PolicyManager) savePolicySet(s PolicySet, sets []PolicySet) (*PolicySet, error) {
+	s.PolicyIDs = uniqueStrings(s.PolicyIDs)
+	if err := pm.validatePolicySet(s, sets); err != nil {
+		return nil, err
+	}
+	if err := pm.sets.SavePolicySet(s); err != nil {
+		return nil, fmt.Errorf("failed to save policy set: %w", err)
+	}
+	if err := pm.reloadPolicySets(); err != nil {
+		return nil, err
+	}
+	pm.publish(PolicyChangePolicySets, nil, nil)
+	return &s, nil
+}
+
+// removedIDs trả về map ID -> "" của các dòng policy đã bị xóa, dùng cho relinkPolicySets.
+func (pm *PolicyManager) removedIDs(rows [][]string) map[string]string {
+	l := layoutOf(pm.enforcer)
+	ids := make(map[string]string, len(rows))
+	for _, row := range rows {
+		ids[l.toPolicy(row).ID] = ""
+	}
+	return ids
+}
+
+// relinkPolicySets cập nhật PolicyIDs của các policy set sau khi policy bị xóa hoặc đổi ID:
+// ID có trong renamed được thay bằng ID mới, hoặc bị bỏ khỏi nhóm nếu ID mới rỗng.
+// Người gọi phải giữ pm.mu.
+func (pm *PolicyManager) relinkPolicySets(renamed map[string]string) error {
+	if pm.sets == nil || len(renamed) == 0 {
+		return nil
+	}
+	sets, err := pm.sets.ListPolicySets()
+	if err != nil {
+		return fmt.Errorf("failed to load policy sets: %w", err)
+	}
+	changed := false
+	for _, s := range sets {
+		ids := make([]string, 0, len(s.PolicyIDs))
+		for _, id := range s.PolicyIDs {
+			next, ok := renamed[id]
+			if !ok {
+				ids = append(ids, id)
+			} else if next != "" {
+				ids = append(ids, next)
+			}
+		}
+		if slices.Equal(ids, s.PolicyIDs) {
+			continue
+		}
+		s.PolicyIDs = ids
+		s.UpdatedAt = time.Now().UTC()
+		if err := pm.sets.SavePolicySet(s); err != nil {
+			return fmt.Errorf("failed to save policy set: %w", err)
+		}
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if err := pm.reloadPolicySets(); err != nil {
+		return err
+	}
+	pm.publish(PolicyChangePolicySets, nil, nil)
+	return nil
+}
+
+// reloadPolicySets nạp lại policy set từ store vào engine.
+func (pm *PolicyManager) reloadPolicySets() error {
+	sets, err := pm.sets.ListPolicySets()
+	if err != nil {
+		return fmt.Errorf("failed to load policy sets: %w", err)
+	}
+	pm.engine.setPolicySets(sets)
+	return nil
+}
+
+func (pm *PolicyManager) validatePolicySet(s PolicySet, sets []PolicySet) error {
+	if s.TenantID == "" {
+		return fmt.Errorf("%w: tenant của policy set là bắt buộc", ErrInvalidPolicy)
+	}
+	if s.Algorithm != "" {
+		if err := checkCombiningAlgorithm(s.Algorithm); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(s.Target) != "" {
+		target := Policy{ID: s.ID, Rule: s.Target}
+		if err := newValidationError(target, pm.engine.evaluator.policyIssues(target, false)); err != nil {
+			return err
+		}
+	}
+
+	if s.ParentID != "" {
+		parent := findPolicySet(sets, s.ParentID)
+		if parent == nil {
+			return fmt.Errorf("%w: %s", ErrPolicySetNotFound, s.ParentID)
+		}
+		if parent.TenantID != "*" && parent.TenantID != s.TenantID {
+			return fmt.Errorf("%w: policy set %s của tenant %s không thể nằm trong policy set %s của tenant %s", ErrInvalidPolicy, s.ID, s.TenantID, parent.ID, parent.TenantID)
+		}
+		for id, depth := s.ParentID, 0; id != "" && depth <= len(sets); depth++ {
+			if id == s.ID {
+				return fmt.Errorf("%w: policy set %s không thể là con của chính nó", ErrInvalidPolicy, s.ID)
+			}
+			next := findPolicySet(sets, id)
+			if next == nil {
+				break
+			}
+			id = next.ParentID
+		}
+	}
+
+	for _, policyID := range s.PolicyIDs {
+		if _, found := pm.findRow(policyID); !found {
+			return fmt.Errorf("%w: %s", ErrPolicyNotFound, policyID)
+		}
+		for _, other := range sets {
+			if other.ID != s.ID && slices.Contains(other.PolicyIDs, policyID) {
+				return fmt.Errorf("%w: policy %s đã thuộc policy set %s", ErrInvalidPolicy, policyID, other.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func findPolicySet(sets []PolicySet, id string) *PolicySet {
+	for i := range sets {
+		if sets[i].ID == id {
+			return &sets[i]
+		}
+	}
+	return nil
+}
+
+func uniqueStrings(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if item != "" && !slices.Contains(out, item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// =========================================================================
+// == Cây policy trong snapshot
+// =========================================================================
+
+// setEntry là một policy set đã biên dịch trong snapshot.
+type setEntry struct {
+	PolicySet
+	compiled   *compiledRule // nil nếu target rỗng
+	compileErr error
+	members    []policyNode // theo priority giảm dần
+	index      *targetIndex // target index của members, nil nếu không có ràng buộc
+
+	astOnce sync.Once
+	ast     *ruleAST
+	astErr  error
+}
+
+// policyNode là một phần tử được kết hợp ở một cấp: một policy hoặc một policy set.
+type policyNode struct {
+	policy *policyEntry
+	set    *setEntry
+	setID  string // policy set chứa node, rỗng ở cấp cao nhất
+}
+
+func (n policyNode) priority() int {
+	if n.set != nil {
+		return n.set.Priority
+	}
+	return n.policy.Priority
+}
+
+func (n policyNode) appliesTo(tenantID string) bool {
+	if n.set != nil {
+		return n.set.TenantID == tenantID || n.set.TenantID == "*"
+	}
+	return n.policy.appliesTo(tenantID)
+}
+
+// skip ghi node vào trace như bị bỏ qua; với policy set, mọi policy bên trong được ghi lại.
+func (n policyNode) skip(tracer PolicyTraceObserver, req *AuthorizationRequest, reason string) {
+	if tracer == nil {
+		return
+	}
+	if n.policy != nil {
+		tracer.OnPolicyEvaluated(n.record(req, reason))
+		return
+	}
+	for _, m := range n.set.members {
+		m.skip(tracer, req, reason)
+	}
+}
+
+func (n policyNode) record(req *AuthorizationRequest, skipReason string) PolicyEvaluation {
+	record := n.policy.traceRecord(req, skipReason)
+	record.SetID = n.setID
+	return record
+}
+
+// algorithm trả về thuật toán của policy set, hoặc thuật toán của cấp cha nếu không đặt.
+func (s *setEntry) algorithm(parent CombiningAlgorithm) CombiningAlgorithm {
+	if s.Algorithm != "" {
+		return s.Algorithm
+	}
+	return parent
+}
+
+// matches đánh giá target của policy set với request; target rỗng luôn khớp.
+func (s *setEntry) matches(req *AuthorizationRequest) (bool, error) {
+	if s.compileErr != nil {
+		return false, s.compileErr
+	}
+	if s.compiled == nil {
+		return true, nil
+	}
+	result, err := s.compiled.evaluate(requestParameters(req), nil)
+	if err != nil {
+		return false, fmt.Errorf("evaluate: lỗi khi đánh giá target của policy set %s: %w", s.ID, err)
+	}
+	matched, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("evaluate: target của policy set %s phải trả về bool, nhận được %T", s.ID, result)
+	}
+	return matched, nil
+}
+
+// syntax trả về cây biểu thức của target, dựng một lần cho mỗi policy set trong snapshot.
+func (s *setEntry) syntax(functions CustomFunctionMap) (*ruleAST, error) {
+	s.astOnce.Do(func() {
+		if s.compileErr != nil {
+			s.astErr = s.compileErr
+			return
+		}
+		s.ast, s.astErr = parseRuleAST(s.Target, functions)
+	})
+	return s.ast, s.astErr
+}
+
+// buildPolicyTree xếp các policy (theo priority giảm dần) vào các policy set. Policy không
+// thuộc policy set nào, policy set không có cha (hoặc cha không tồn tại, tạo vòng) nằm ở cấp
+// cao nhất. Cùng priority, policy đứng trước policy set; policy set theo thứ tự tạo.
+// Trả về cả target index của cấp cao nhất; index của mỗi policy set nằm trong setEntry.
+func (en *policyEngine) buildPolicyTree(policies []*policyEntry, defs []PolicySet) ([]policyNode, *targetIndex) {
+	if len(defs) == 0 {
+		root := make([]policyNode, 0, len(policies))
+		for _, p := range policies {
+			root = append(root, policyNode{policy: p})
+		}
+		return root, newTargetIndex(root)
+	}
+
+	sets := make(map[string]*setEntry, len(defs))
+	ordered := make([]*setEntry, 0, len(defs))
+	memberOf := make(map[string]string)
+	for _, def := range defs {
+		if _, dup := sets[def.ID]; dup {
+			continue
+		}
+		s := &setEntry{PolicySet: def.clone()}
+		if strings.TrimSpace(def.Target) != "" {
+			s.compiled, s.compileErr = en.evaluator.rules.get(def.Target)
+		}
+		sets[def.ID] = s
+		ordered = append(ordered, s)
+		for _, id := range def.PolicyIDs {
+			if _, taken := memberOf[id]; !taken {
+				memberOf[id] = def.ID
+			}
+		}
+	}
+
+	var root []policyNode
+	for _, p := range policies {
+		if s, ok := sets[memberOf[p.ID]]; ok {
+			s.members = append(s.members, policyNode{policy: p, setID: s.ID})
+		} else {
+			root = append(root, policyNode{policy: p})
+		}
+	}
+	cyclic := func(s *setEntry) bool {
+		id := s.ParentID
+		for depth := 0; id != "" && depth <= len(ordered); depth++ {
+			if id == s.ID {
+				return true
+			}
+			parent, ok := sets[id]
+			if !ok {
+				return false
+			}
+			id = parent.ParentID
+		}
+		return id != ""
+	}
+	for _, s := range ordered {
+		if parent, ok := sets[s.ParentID]; ok && !cyclic(s) {
+			parent.members = append(parent.members, policyNode{set: s, setID: parent.ID})
+		} else {
+			root = append(root, policyNode{set: s})
+		}
+	}
+
+	byPriority := func(nodes []policyNode) {
+		sort.SliceStable(nodes, func(i, j int) bool {
+			return nodes[i].priority() > nodes[j].priority()
+		})
+	}
+	byPriority(root)
+	for _, s := range ordered {
+		byPriority(s.members)
+		s.index = newTargetIndex(s.members)
+	}
+	return root, newTargetIndex(root)
+}
+
+// setPolicySets thay tập policy set bằng một snapshot mới (cùng tập policy, version mới).
+func (en *policyEngine) setPolicySets(defs []PolicySet) {
+	for _, def := range defs {
+		if strings.TrimSpace(def.Target) != "" {
+			_, _ = en.evaluator.rules.get(def.Target)
+		}
+	}
+	next := *en.current()
+	next.version = en.versions.Add(1)
+	next.sets = defs
+	next.root, next.rootIndex = en.buildPolicyTree(next.policies, defs)
+	en.snapshot.Store(&next)
+	en.decisions.flush(next.version)
+}
+
+// targets trả về các target khác rỗng của policy set trong snapshot, để giữ bản biên dịch
+// của chúng trong cache rule khi policy thay đổi.
+func (snap *policySnapshot) targets() []string {
+	var out []string
+	for _, s := range snap.sets {
+		if strings.TrimSpace(s.Target) != "" {
+			out = append(out, s.Target)
+		}
+	}
+	return out
+}
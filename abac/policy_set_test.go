@@ -0,0 +1,250 @@
+package abac_test
+
+import (
+	"context"
+	"testing"
+
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newPolicySetTestSystem(t *testing.T, policies string) (*abac.Authorizer, *abac.PolicyManager) {
+	t.Helper()
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, pm, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	return authorizer, pm
+}
+
+func TestPolicySets_TargetAndAlgorithm(t *testing.T) {
+	authorizer, pm := newPolicySetTestSystem(t, `
+p, *, "Action == 'approve_level_2'", deny, generic_deny
+p, tenant1, "Action == 'approve_level_2'", allow, eng_allow
+p, tenant1, "Subject.id == 't1_hr_manager'", deny, eng_deny
+p, *, "Resource.department > 5", deny, broken_hr`)
+	ctx := context.Background()
+
+	// Không có policy set: rule lỗi broken_hr được đánh giá với mọi request (deny khớp
+	// vẫn thắng lỗi với DenyOverrides, lỗi được ghi trong Errors).
+	d := authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	require.Equal(t, abac.Deny, d.Effect)
+	require.Len(t, d.Errors, 1)
+
+	_, err := pm.CreatePolicySet(abac.PolicySet{
+		ID: "engineering", TenantID: "tenant1", Target: "Resource.department == 'engineering'",
+		Algorithm: abac.PermitOverrides, Priority: 10, PolicyIDs: []string{"eng_allow", "eng_deny"},
+	})
+	require.NoError(t, err)
+	_, err = pm.CreatePolicySet(abac.PolicySet{
+		ID: "hr", TenantID: "*", Target: "Resource.department == 'hr'", Priority: 10, PolicyIDs: []string{"broken_hr"},
+	})
+	require.NoError(t, err)
+
+	d = authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	assert.Equal(t, abac.Permit, d.Effect)
+	assert.Equal(t, []string{"eng_allow"}, d.PolicyIDs)
+	assert.Empty(t, d.Errors)
+
+	_, trace, err := authorizer.CheckWithTrace(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	require.NoError(t, err)
+	byID := make(map[string]abac.PolicyEvaluation)
+	for _, ev := range trace.Policies {
+		byID[ev.PolicyID] = ev
+	}
+	assert.Equal(t, "engineering", byID["eng_allow"].SetID)
+	assert.True(t, byID["eng_deny"].Matched)
+	assert.Equal(t, "policy set hr target not matched", byID["broken_hr"].SkipReason)
+	assert.Equal(t, "hr", byID["broken_hr"].SetID)
+	assert.Equal(t, "lower priority", byID["generic_deny"].SkipReason)
+
+	// Target của "hr" khớp nên rule lỗi bên trong được đánh giá.
+	d = authorizer.Decide(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", "approve_level_2", nil)
+	assert.Equal(t, abac.Indeterminate, d.Effect)
+	assert.Equal(t, []string{"broken_hr"}, d.PolicyIDs)
+
+	d = authorizer.Decide(&ctx, "tenant2", "t2_hr_manager", "t2_sales_request", "approve_level_2", nil)
+	assert.Equal(t, abac.Deny, d.Effect)
+	assert.Equal(t, []string{"generic_deny"}, d.PolicyIDs)
+}
+
+func TestPolicySets_Nested(t *testing.T) {
+	authorizer, pm := newPolicySetTestSystem(t, `
+p, tenant1, "Action == 'approve_level_2'", allow, eng_allow
+p, tenant1, "Action == 'delete' && Subject.id == 'root_user'", allow, eng_delete_root`)
+	ctx := context.Background()
+
+	_, err := pm.CreatePolicySet(abac.PolicySet{
+		ID: "engineering", TenantID: "tenant1", Target: "Resource.department == 'engineering'",
+		PolicyIDs: []string{"eng_allow"},
+	})
+	require.NoError(t, err)
+	_, err = pm.CreatePolicySet(abac.PolicySet{
+		ID: "eng_delete", TenantID: "tenant1", ParentID: "engineering", Target: "Action == 'delete'",
+		Algorithm: abac.DenyUnlessPermit, PolicyIDs: []string{"eng_delete_root"},
+	})
+	require.NoError(t, err)
+
+	d := authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "approve_level_2", nil)
+	assert.Equal(t, abac.Permit, d.Effect)
+
+	// Policy set con với DenyUnlessPermit luôn quyết định: deny mặc định được ghi bằng ID của nó.
+	d = authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "delete", nil)
+	assert.Equal(t, abac.Deny, d.Effect)
+	assert.Equal(t, []string{"eng_delete"}, d.PolicyIDs)
+
+	// Xóa policy set con: policy bên trong trở về policy set cha.
+	_, err = pm.DeletePolicySet("engineering")
+	assert.ErrorIs(t, err, abac.ErrInvalidPolicy)
+	ok, err := pm.DeletePolicySet("eng_delete")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	d = authorizer.Decide(&ctx, "tenant1", "t1_hr_manager", "t1_eng_request", "delete", nil)
+	assert.Equal(t, abac.NotApplicable, d.Effect)
+
+	ok, err = pm.DeletePolicySet("eng_delete")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestPolicyManager_PolicySetValidation(t *testing.T) {
+	_, pm := newPolicySetTestSystem(t, `
+p, tenant1, "Action == 'read'", allow, read_allow
+p, tenant1, "Action == 'write'", allow, write_allow`)
+
+	created, err := pm.CreatePolicySet(abac.PolicySet{TenantID: "tenant1", PolicyIDs: []string{"read_allow", "read_allow"}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, []string{"read_allow"}, created.PolicyIDs)
+
+	_, err = pm.CreatePolicySet(abac.PolicySet{ID: created.ID, TenantID: "tenant1"})
+	assert.ErrorIs(t, err, abac.ErrPolicySetExists)
+	_, err = pm.CreatePolicySet(abac.PolicySet{ID: "s1", TenantID: "tenant1", PolicyIDs: []string{"missing"}})
+	assert.ErrorIs(t, err, abac.ErrPolicyNotFound)
+	_, err = pm.CreatePolicySet(abac.PolicySet{ID: "s1", TenantID: "tenant1", PolicyIDs: []string{"read_allow"}})
+	assert.ErrorIs(t, err, abac.ErrInvalidPolicy)
+	_, err = pm.CreatePolicySet(abac.PolicySet{ID: "s1", TenantID: "tenant1", ParentID: "missing"})
+	assert.ErrorIs(t, err, abac.ErrPolicySetNotFound)
+	_, err = pm.CreatePolicySet(abac.PolicySet{ID: "s1", TenantID: "tenant1", Algorithm: "majority"})
+	assert.ErrorIs(t, err, abac.ErrUnknownCombiningAlgorithm)
+	_, err = pm.CreatePolicySet(abac.PolicySet{ID: "s1", TenantID: "tenant1", Target: "User.type == 'x'"})
+	var verr *abac.PolicyValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, abac.ValidationUnknownIdentifier, verr.Issues[0].Code)
+	_, err = pm.CreatePolicySet(abac.PolicySet{ID: "s1", TenantID: "tenant2", ParentID: created.ID})
+	assert.ErrorIs(t, err, abac.ErrInvalidPolicy)
+
+	child, err := pm.CreatePolicySet(abac.PolicySet{ID: "s1", TenantID: "tenant1", ParentID: created.ID})
+	require.NoError(t, err)
+	parent, err := pm.GetPolicySet(created.ID)
+	require.NoError(t, err)
+	parent.ParentID = child.ID
+	_, err = pm.UpdatePolicySet(parent.ID, *parent)
+	assert.ErrorIs(t, err, abac.ErrInvalidPolicy)
+
+	updated, err := pm.UpdatePolicySet(child.ID, abac.PolicySet{TenantID: "tenant1", ParentID: created.ID, PolicyIDs: []string{"write_allow"}})
+	require.NoError(t, err)
+	assert.Equal(t, child.CreatedAt, updated.CreatedAt)
+	_, err = pm.UpdatePolicySet("missing", abac.PolicySet{TenantID: "tenant1"})
+	assert.ErrorIs(t, err, abac.ErrPolicySetNotFound)
+	_, err = pm.GetPolicySet("missing")
+	assert.ErrorIs(t, err, abac.ErrPolicySetNotFound)
+
+	sets, err := pm.ListPolicySets("tenant1")
+	require.NoError(t, err)
+	require.Len(t, sets, 2)
+	assert.Equal(t, []string{created.ID, "s1"}, []string{sets[0].ID, sets[1].ID})
+	sets, err = pm.ListPolicySets("tenant2")
+	require.NoError(t, err)
+	assert.Empty(t, sets)
+}
+
+func TestPolicyManager_DeletedPoliciesLeavePolicySets(t *testing.T) {
+	_, pm := newPolicySetTestSystem(t, `
+p, tenant1, "Action == 'read'", allow, read_allow
+p, tenant1, "Action == 'write'", allow, write_allow
+p, tenant1, "Action == 'list'", allow, list_allow`)
+
+	set, err := pm.CreatePolicySet(abac.PolicySet{ID: "s1", TenantID: "tenant1", PolicyIDs: []string{"read_allow", "write_allow", "list_allow"}})
+	require.NoError(t, err)
+
+	ok, err := pm.DeletePolicyByID("read_allow")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = pm.RemovePolicy([]string{"tenant1", "Action == 'list'", "allow", "list_allow"})
+	require.NoError(t, err)
+	require.True(t, ok)
+	got, err := pm.GetPolicySet("s1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"write_allow"}, got.PolicyIDs)
+
+	// Policy set vẫn cập nhật được sau khi policy bên trong bị xóa.
+	set.Description = "writers"
+	set.PolicyIDs = got.PolicyIDs
+	updated, err := pm.UpdatePolicySet("s1", *set)
+	require.NoError(t, err)
+	assert.Equal(t, "writers", updated.Description)
+}
+
+func TestAuthorizer_PartialEvaluate_PolicySets(t *testing.T) {
+	authorizer, pm := newPolicySetTestSystem(t, `
+p, *, "Action == 'approve_level_2'", allow, allow_all
+p, *, "Resource.amount > 1000", deny, deny_hr_big
+p, *, "Resource.amount < 0", allow, allow_sales_refund`)
+	_, err := pm.CreatePolicySet(abac.PolicySet{
+		ID: "hr", TenantID: "*", Target: "Resource.department == 'hr'", Priority: 10,
+		PolicyIDs: []string{"deny_hr_big"},
+	})
+	require.NoError(t, err)
+	_, err = pm.CreatePolicySet(abac.PolicySet{
+		ID: "sales", TenantID: "*", Target: "Resource.department == 'sales'", Priority: 10,
+		Algorithm: abac.DenyUnlessPermit, PolicyIDs: []string{"allow_sales_refund"},
+	})
+	require.NoError(t, err)
+	_, err = pm.CreatePolicySet(abac.PolicySet{
+		ID: "finance", TenantID: "*", Target: "Action == 'delete'", Priority: 10,
+		Algorithm: abac.DenyUnlessPermit,
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	cond, err := authorizer.PartialEvaluate(&ctx, "tenant2", "t2_hr_manager", "approve_level_2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"finance", "hr_small"}, allowedIDs(t, newLeaveRequestDB(t), cond))
+}
+
+func TestNewABACSystemFromDB_PersistsPolicySets(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&gormadapter.CasbinRule{}))
+	mockFetcher := &mocks.MockFetcher{}
+
+	_, pm, err := abac.NewABACSystemFromDB("../casbin_config/abac_model.conf", db, mockFetcher, mockFetcher, nil, abac.WithAutoMigrate())
+	require.NoError(t, err)
+	_, err = pm.CreatePolicy(abac.Policy{ID: "read_all", TenantID: "*", Rule: "Action == 'read'", Effect: "allow"})
+	require.NoError(t, err)
+	_, err = pm.CreatePolicySet(abac.PolicySet{
+		ID: "sales", TenantID: "*", Target: "Resource.department == 'sales'", PolicyIDs: []string{"read_all"},
+	})
+	require.NoError(t, err)
+
+	// Một hệ thống khác trên cùng database nạp policy set khi khởi tạo.
+	authorizer, other, err := abac.NewABACSystemFromDB("../casbin_config/abac_model.conf", db, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	set, err := other.GetPolicySet("sales")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"read_all"}, set.PolicyIDs)
+
+	ctx := context.Background()
+	d := authorizer.Decide(&ctx, "tenant2", "t2_hr_manager", "t2_sales_request", "read", nil)
+	assert.Equal(t, abac.Permit, d.Effect)
+	d = authorizer.Decide(&ctx, "tenant2", "t2_hr_manager", "t2_hr_request", "read", nil)
+	assert.Equal(t, abac.NotApplicable, d.Effect)
+}
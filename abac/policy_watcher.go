@@ -0,0 +1,343 @@
+package abac
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2"
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"gorm.io/gorm"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// watcherConfig chứa tùy chọn của PolicyWatcher.
+type watcherConfig struct {
+	interval      time.Duration
+	versionSource PolicyVersionSource
+	onReload      func()
+	onError       func(error)
+}
+
+// WatcherOption là tùy chọn của PolicyWatcher (WatchDB, WatchFiles) và của việc đồng bộ qua
+// PolicyChangeNotifier (UseChangeNotifier, NewGormPolicyChangeNotifier).
+type WatcherOption interface{ apply(*watcherConfig) }
+
+type watcherOptFunc func(*watcherConfig)
+
+func (f watcherOptFunc) apply(c *watcherConfig) { f(c) }
+
+// WithWatchInterval đặt chu kỳ kiểm tra thay đổi (mặc định: 5 giây).
+func WithWatchInterval(d time.Duration) WatcherOption {
+	return watcherOptFunc(func(c *watcherConfig) {
+		if d > 0 {
+			c.interval = d
+		}
+	})
+}
+
+// WithPolicyVersionSource chỉ định nguồn "phiên bản" của policy cho WatchDB (mặc định: checksum
+// toàn bộ bảng policy, xem NewTableChecksumVersionSource, và các policy set). Nguồn tùy chỉnh
+// cần phản ánh cả thay đổi policy set nếu muốn chúng được nạp lại.
+func WithPolicyVersionSource(src PolicyVersionSource) WatcherOption {
+	return watcherOptFunc(func(c *watcherConfig) {
+		if src != nil {
+			c.versionSource = src
+		}
+	})
+}
+
+// WithOnReload đăng ký callback được gọi sau mỗi lần nạp lại policy thành công.
+func WithOnReload(fn func()) WatcherOption {
+	return watcherOptFunc(func(c *watcherConfig) { c.onReload = fn })
+}
+
+// WithOnReloadError đăng ký callback được gọi khi kiểm tra hoặc nạp lại policy thất bại.
+// Tập policy cũ vẫn được giữ nguyên và watcher thử lại ở chu kỳ sau.
+func WithOnReloadError(fn func(error)) WatcherOption {
+	return watcherOptFunc(func(c *watcherConfig) { c.onError = fn })
+}
+
+func newWatcherConfig(opts []WatcherOption) watcherConfig {
+	cfg := watcherConfig{interval: defaultWatchInterval}
+	for _, o := range opts {
+		if o != nil {
+			o.apply(&cfg)
+		}
+	}
+	return cfg
+}
+
+// =========================================================================
+// == PolicyWatcher
+// =========================================================================
+
+// PolicyWatcher định kỳ kiểm tra storage và nạp lại policy khi có thay đổi.
+// Snapshot policy mới được hoán đổi nguyên tử nên các Check đang chạy không bị chặn.
+type PolicyWatcher struct {
+	cfg watcherConfig
+	// poll kiểm tra thay đổi và nạp lại nếu cần; reloaded = true nếu đã nạp lại.
+	poll func(ctx context.Context) (reloaded bool, err error)
+
+	mu     sync.Mutex // tuần tự hóa các lần poll
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func startPolicyWatcher(cfg watcherConfig, poll func(ctx context.Context) (bool, error)) *PolicyWatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &PolicyWatcher{cfg: cfg, poll: poll, cancel: cancel, done: make(chan struct{})}
+	go w.run(ctx)
+	return w
+}
+
+func (w *PolicyWatcher) run(ctx context.Context) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_ = w.Poll(ctx)
+		}
+	}
+}
+
+// Poll kiểm tra thay đổi ngay lập tức (không đợi chu kỳ) và gọi các callback tương ứng.
+func (w *PolicyWatcher) Poll(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	reloaded, err := w.poll(ctx)
+	if err != nil {
+		if w.cfg.onError != nil {
+			w.cfg.onError(err)
+		}
+		return err
+	}
+	if reloaded && w.cfg.onReload != nil {
+		w.cfg.onReload()
+	}
+	return nil
+}
+
+// Stop dừng watcher và đợi lần kiểm tra đang chạy (nếu có) kết thúc.
+func (w *PolicyWatcher) Stop() {
+	w.once.Do(func() {
+		w.cancel()
+		<-w.done
+	})
+}
+
+// =========================================================================
+// == Watcher cho hệ thống tạo từ DB
+// =========================================================================
+
+// PolicyVersionSource trả về một "dấu phiên bản" của policy trong storage;
+// watcher nạp lại policy mỗi khi giá trị này thay đổi.
+type PolicyVersionSource interface {
+	PolicyVersion(ctx context.Context) (string, error)
+}
+
+// PolicyVersionFunc cho phép dùng một hàm làm PolicyVersionSource.
+type PolicyVersionFunc func(ctx context.Context) (string, error)
+
+func (f PolicyVersionFunc) PolicyVersion(ctx context.Context) (string, error) { return f(ctx) }
+
+// NewTableChecksumVersionSource dùng checksum của toàn bộ dòng trong bảng policy làm phiên bản.
+// Phát hiện mọi thay đổi (thêm, sửa, xóa) mà không cần cột version, đổi lại phải đọc cả bảng
+// mỗi chu kỳ (nhưng không dựng lại enforcer).
+func NewTableChecksumVersionSource(db *gorm.DB, tableName string) PolicyVersionSource {
+	return PolicyVersionFunc(func(ctx context.Context) (string, error) {
+		var rows []gormadapter.CasbinRule
+		if err := db.WithContext(ctx).Table(tableName).Order("id").Find(&rows).Error; err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		for _, r := range rows {
+			for _, v := range []string{r.Ptype, r.V0, r.V1, r.V2, r.V3, r.V4, r.V5} {
+				h.Write([]byte(v))
+				h.Write([]byte{0})
+			}
+			h.Write([]byte{'\n'})
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	})
+}
+
+// NewColumnVersionSource dùng MAX(column) của một bảng làm phiên bản, ví dụ cột updated_at
+// của bảng policy, hoặc cột version của một bảng change-log được ghi mỗi khi policy thay đổi.
+func NewColumnVersionSource(db *gorm.DB, tableName, column string) PolicyVersionSource {
+	return PolicyVersionFunc(func(ctx context.Context) (string, error) {
+		var version sql.NullString
+		row := db.WithContext(ctx).Table(tableName).Select(fmt.Sprintf("MAX(%s)", db.Statement.Quote(column))).Row()
+		if err := row.Scan(&version); err != nil {
+			return "", err
+		}
+		return version.String, nil
+	})
+}
+
+// storageVersionSource là nguồn phiên bản mặc định của WatchDB: checksum bảng policy cộng checksum
+// các policy set, để thay đổi policy set do instance khác ghi cũng được nạp lại.
+func (pm *PolicyManager) storageVersionSource() PolicyVersionSource {
+	table := NewTableChecksumVersionSource(pm.db, pm.policyTable)
+	return PolicyVersionFunc(func(ctx context.Context) (string, error) {
+		version, err := table.PolicyVersion(ctx)
+		if err != nil {
+			return "", err
+		}
+		sets, err := pm.sets.ListPolicySets()
+		if err != nil {
+			return "", err
+		}
+		data, err := json.Marshal(sets)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(data)
+		return version + ":" + hex.EncodeToString(sum[:]), nil
+	})
+}
+
+// WatchDB bắt đầu theo dõi bảng policy của hệ thống tạo bởi NewABACSystemFromDB hoặc
+// NewABACSystemFromDBUseTableName và tự động nạp lại policy (và policy set) khi bảng policy
+// hoặc các policy set thay đổi.
+// Trả về ErrWatchNotSupported nếu hệ thống không được tạo từ database.
+func (pm *PolicyManager) WatchDB(opts ...WatcherOption) (*PolicyWatcher, error) {
+	if pm.db == nil {
+		return nil, ErrWatchNotSupported
+	}
+	cfg := newWatcherConfig(opts)
+	if cfg.versionSource == nil {
+		cfg.versionSource = pm.storageVersionSource()
+	}
+	last, err := cfg.versionSource.PolicyVersion(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy version: %w", err)
+	}
+
+	return startPolicyWatcher(cfg, func(ctx context.Context) (bool, error) {
+		version, err := cfg.versionSource.PolicyVersion(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to read policy version: %w", err)
+		}
+		if version == last {
+			return false, nil
+		}
+		if err := pm.LoadPoliciesFromStorage(); err != nil {
+			return false, fmt.Errorf("failed to reload policy: %w", err)
+		}
+		last = version
+		return true, nil
+	}), nil
+}
+
+// =========================================================================
+// == Watcher cho hệ thống tạo từ file
+// =========================================================================
+
+// filesVersion trả về checksum nội dung các file. File được mở lại theo đường dẫn mỗi lần
+// nên cả cập nhật kiểu ghi file mới rồi đổi tên (ConfigMap của Kubernetes) cũng được phát hiện.
+func filesVersion(paths ...string) (string, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(data)
+		h.Write(sum[:])
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WatchFiles bắt đầu theo dõi file model và file policy của hệ thống tạo bởi
+// NewABACSystemFromFile. Khi một trong hai file thay đổi, nội dung mới được nạp vào một
+// enforcer tạm và mọi policy được kiểm tra (xem ValidatePolicy); tập policy chỉ được thay
+// thế khi toàn bộ hợp lệ, ngược lại tập cũ được giữ nguyên và lỗi (bọc ErrInvalidPolicy)
+// được báo qua WithOnReloadError. Nội dung lỗi không được thử lại cho tới khi file thay đổi tiếp.
+// Thay đổi chỉ nằm trong bộ nhớ (PolicyManager.AddPolicy... chưa lưu) sẽ bị ghi đè.
+// Trả về ErrWatchNotSupported nếu hệ thống không được tạo từ file.
+func (pm *PolicyManager) WatchFiles(opts ...WatcherOption) (*PolicyWatcher, error) {
+	if pm.modelPath == "" || pm.policyPath == "" {
+		return nil, ErrWatchNotSupported
+	}
+	cfg := newWatcherConfig(opts)
+	last, err := filesVersion(pm.modelPath, pm.policyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy files: %w", err)
+	}
+	var rejected string
+
+	return startPolicyWatcher(cfg, func(ctx context.Context) (bool, error) {
+		version, err := filesVersion(pm.modelPath, pm.policyPath)
+		if err != nil {
+			return false, fmt.Errorf("failed to read policy files: %w", err)
+		}
+		if version == last || version == rejected {
+			return false, nil
+		}
+		if err := pm.reloadFiles(); err != nil {
+			if errors.Is(err, ErrInvalidPolicy) || errors.Is(err, ErrUnsupportedModel) {
+				rejected = version
+			}
+			return false, err
+		}
+		last, rejected = version, ""
+		return true, nil
+	}), nil
+}
+
+// reloadFiles đọc lại file model và file policy, kiểm tra toàn bộ rule rồi mới thay thế
+// model (kèm policy) của enforcer hiện tại.
+func (pm *PolicyManager) reloadFiles() error {
+	next, err := casbin.NewEnforcer(pm.modelPath, newFilePolicyAdapter(pm.policyPath))
+	if err != nil {
+		return fmt.Errorf("failed to load policy files: %w", err)
+	}
+	if err := checkModel(next); err != nil {
+		return err
+	}
+	if err := pm.engine.evaluator.validateRules(next); err != nil {
+		return err
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.enforcer.SetModel(next.GetModel())
+	// SetModel đặt lại bảng hàm của enforcer nên phải đăng ký lại evaluate.
+	pm.enforcer.AddFunction("evaluate", pm.engine.evaluator.Evaluate)
+	pm.engine.reload(pm.enforcer)
+	return nil
+}
+
+// validateRules kiểm tra mọi policy trong enforcer như khi ghi qua PolicyManager
+// và trả về lỗi (các *PolicyValidationError) liệt kê tất cả policy không hợp lệ.
+func (ev *expressionEvaluator) validateRules(e *casbin.Enforcer) error {
+	l := layoutOf(e)
+	if l.rule < 0 {
+		return fmt.Errorf("%w: model has no rule field in [policy_definition]", ErrInvalidPolicy)
+	}
+	assertion, ok := e.GetModel()["p"]["p"]
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, row := range assertion.Policy {
+		if err := ev.validateRow(l, row); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,275 @@
+package abac
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchDB_ReloadsChangesFromOtherInstance(t *testing.T) {
+	db := newTestDB(t)
+	_, writer, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	readerAuth, reader, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+
+	var reloads atomic.Int32
+	watcher, err := reader.WatchDB(WithWatchInterval(time.Hour), WithOnReload(func() { reloads.Add(1) }))
+	if err != nil {
+		t.Fatalf("WatchDB failed: %v", err)
+	}
+	defer watcher.Stop()
+
+	ctx := context.Background()
+	check := func() bool {
+		ok, err := readerAuth.Check(&ctx, "t1", "u1", "r1", "read", nil)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		return ok
+	}
+	if check() {
+		t.Fatalf("expected deny before the policy exists")
+	}
+
+	// Không có thay đổi: không nạp lại.
+	if err := watcher.Poll(ctx); err != nil || reloads.Load() != 0 {
+		t.Fatalf("expected no reload, got %d (%v)", reloads.Load(), err)
+	}
+
+	if _, err := writer.AddPolicy([]string{"*", "Action == 'read'", "allow", "allow_read"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	if err := watcher.Poll(ctx); err != nil || reloads.Load() != 1 {
+		t.Fatalf("expected one reload, got %d (%v)", reloads.Load(), err)
+	}
+	if !check() {
+		t.Fatalf("expected allow after reload")
+	}
+
+	// Sửa policy tại chỗ (id không đổi) cũng được phát hiện.
+	if _, err := writer.UpdatePolicy([]string{"*", "Action == 'read'", "allow", "allow_read"}, []string{"*", "Action == 'write'", "allow", "allow_read"}); err != nil {
+		t.Fatalf("UpdatePolicy failed: %v", err)
+	}
+	_ = watcher.Poll(ctx)
+	if reloads.Load() != 2 || check() {
+		t.Fatalf("expected update to be reloaded, reloads=%d", reloads.Load())
+	}
+}
+
+func TestWatchDB_ReloadsPolicySetChanges(t *testing.T) {
+	db := newTestDB(t)
+	_, writer, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil, WithAutoMigrate())
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	if _, err := writer.AddPolicy([]string{"*", "Action == 'read'", "allow", "allow_read"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	readerAuth, reader, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	var reloads atomic.Int32
+	watcher, err := reader.WatchDB(WithWatchInterval(time.Hour), WithOnReload(func() { reloads.Add(1) }))
+	if err != nil {
+		t.Fatalf("WatchDB failed: %v", err)
+	}
+	defer watcher.Stop()
+
+	ctx := context.Background()
+	if ok, _ := readerAuth.Check(&ctx, "t1", "u1", "r1", "read", nil); !ok {
+		t.Fatalf("expected allow before the policy set exists")
+	}
+
+	// Bảng policy không đổi, chỉ bảng policy set thay đổi.
+	if _, err := writer.CreatePolicySet(PolicySet{ID: "hidden", TenantID: "*", Target: "Action == 'none'", PolicyIDs: []string{"allow_read"}}); err != nil {
+		t.Fatalf("CreatePolicySet failed: %v", err)
+	}
+	if err := watcher.Poll(ctx); err != nil || reloads.Load() != 1 {
+		t.Fatalf("expected one reload, got %d (%v)", reloads.Load(), err)
+	}
+	if ok, _ := readerAuth.Check(&ctx, "t1", "u1", "r1", "read", nil); ok {
+		t.Fatalf("expected the policy set to be reloaded")
+	}
+}
+
+func TestWatchDB_IntervalAndErrors(t *testing.T) {
+	db := newTestDB(t)
+	_, pm, err := NewABACSystemFromDB("../casbin_config/abac_model.conf", db, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromDB failed: %v", err)
+	}
+	if err := db.Exec("CREATE TABLE policy_changelog (version INTEGER)").Error; err != nil {
+		t.Fatalf("create changelog failed: %v", err)
+	}
+
+	reloaded := make(chan struct{}, 1)
+	var failing atomic.Bool
+	source := NewColumnVersionSource(db, "policy_changelog", "version")
+	watcher, err := pm.WatchDB(
+		WithWatchInterval(10*time.Millisecond),
+		WithPolicyVersionSource(PolicyVersionFunc(func(ctx context.Context) (string, error) {
+			if failing.Load() {
+				return "", errors.New("db unavailable")
+			}
+			return source.PolicyVersion(ctx)
+		})),
+		WithOnReload(func() {
+			select {
+			case reloaded <- struct{}{}:
+			default:
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("WatchDB failed: %v", err)
+	}
+	defer watcher.Stop()
+
+	if err := db.Exec("INSERT INTO policy_changelog (version) VALUES (1)").Error; err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	select {
+	case <-reloaded:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("watcher did not reload after the version changed")
+	}
+
+	failing.Store(true)
+	var gotErr error
+	w2, err := pm.WatchDB(WithPolicyVersionSource(source), WithOnReloadError(func(err error) { gotErr = err }))
+	if err != nil {
+		t.Fatalf("WatchDB failed: %v", err)
+	}
+	defer w2.Stop()
+	if err := db.Exec("DROP TABLE policy_changelog").Error; err != nil {
+		t.Fatalf("drop failed: %v", err)
+	}
+	if err := w2.Poll(context.Background()); err == nil || gotErr == nil {
+		t.Fatalf("expected version read error to be reported")
+	}
+}
+
+func TestWatchDB_NotSupportedForFileSystems(t *testing.T) {
+	_, pm, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromStrings failed: %v", err)
+	}
+	if _, err := pm.WatchDB(); !errors.Is(err, ErrWatchNotSupported) {
+		t.Fatalf("expected ErrWatchNotSupported, got %v", err)
+	}
+}
+
+func TestWatchFiles_ReloadsValidChangesOnly(t *testing.T) {
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "abac_model.conf")
+	policyPath := filepath.Join(dir, "abac_policy.csv")
+	modelConf, err := os.ReadFile("../casbin_config/abac_model.conf")
+	if err != nil {
+		t.Fatalf("read model failed: %v", err)
+	}
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s failed: %v", path, err)
+		}
+	}
+	writeFile(modelPath, string(modelConf))
+	writeFile(policyPath, "p, *, \"Action == 'read'\", allow, allow_read, 0\n")
+
+	authz, pm, err := NewABACSystemFromFile(modelPath, policyPath, &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromFile failed: %v", err)
+	}
+	var reloads atomic.Int32
+	var lastErr error
+	watcher, err := pm.WatchFiles(
+		WithWatchInterval(time.Hour),
+		WithOnReload(func() { reloads.Add(1) }),
+		WithOnReloadError(func(err error) { lastErr = err }),
+	)
+	if err != nil {
+		t.Fatalf("WatchFiles failed: %v", err)
+	}
+	defer watcher.Stop()
+
+	ctx := context.Background()
+	check := func(action string) bool {
+		ok, err := authz.Check(&ctx, "t1", "u1", "r1", action, nil)
+		if err != nil {
+			t.Fatalf("Check failed: %v", err)
+		}
+		return ok
+	}
+
+	// Cập nhật kiểu ConfigMap: ghi file mới rồi đổi tên đè lên file cũ.
+	tmp := filepath.Join(dir, "abac_policy.csv.tmp")
+	writeFile(tmp, "p, *, \"Action == 'write'\", allow, allow_write, 0\n")
+	if err := os.Rename(tmp, policyPath); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if err := watcher.Poll(ctx); err != nil || reloads.Load() != 1 {
+		t.Fatalf("expected one reload, got %d (%v)", reloads.Load(), err)
+	}
+	if check("read") || !check("write") {
+		t.Fatalf("expected the renamed policy file to replace the old set")
+	}
+
+	// Một rule lỗi làm hỏng cả tập: giữ nguyên tập cũ và báo lỗi một lần.
+	writeFile(policyPath, "p, *, \"Action == 'read'\", allow, allow_read, 0\np, *, \"Action == \", allow, broken, 0\n")
+	err = watcher.Poll(ctx)
+	if !errors.Is(err, ErrInvalidPolicy) || !errors.Is(lastErr, ErrInvalidPolicy) {
+		t.Fatalf("expected ErrInvalidPolicy, got %v", err)
+	}
+	if reloads.Load() != 1 || check("read") || !check("write") {
+		t.Fatalf("expected the previous policy set to be kept")
+	}
+	if err := watcher.Poll(ctx); err != nil {
+		t.Fatalf("expected rejected content not to be retried, got %v", err)
+	}
+
+	// Thay đổi model cũng được phát hiện.
+	writeFile(policyPath, "p, *, \"Action == 'read'\", allow, allow_read, 0\n")
+	writeFile(modelPath, string(modelConf)+"\n# reloaded\n")
+	if err := watcher.Poll(ctx); err != nil || reloads.Load() != 2 {
+		t.Fatalf("expected reload after fixing the files, got %d (%v)", reloads.Load(), err)
+	}
+	if !check("read") || check("write") {
+		t.Fatalf("expected the fixed policy set to be active")
+	}
+	if _, err := pm.AddPolicy([]string{"*", "Action == 'write'", "allow", "allow_write"}); err != nil {
+		t.Fatalf("AddPolicy after reload failed: %v", err)
+	}
+	if !check("write") {
+		t.Fatalf("expected PolicyManager writes to work after reload")
+	}
+
+	// Model có matcher mà engine không cài đặt bị từ chối, model cũ được giữ nguyên.
+	writeFile(modelPath, strings.Replace(string(modelConf), "p.tenant == '*'", "p.tenant == 'global'", 1))
+	if err := watcher.Poll(ctx); !errors.Is(err, ErrUnsupportedModel) {
+		t.Fatalf("expected ErrUnsupportedModel, got %v", err)
+	}
+	if !check("read") {
+		t.Fatalf("expected the previous model to be kept")
+	}
+}
+
+func TestWatchFiles_NotSupportedForStringSystems(t *testing.T) {
+	_, pm, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromStrings failed: %v", err)
+	}
+	if _, err := pm.WatchFiles(); !errors.Is(err, ErrWatchNotSupported) {
+		t.Fatalf("expected ErrWatchNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package abac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const defaultReverseQueryConcurrency = 8
+
+// reverseQueryConfig chứa tùy chọn của SubjectsAllowed.
+type reverseQueryConfig struct {
+	concurrency int
+}
+
+// ReverseQueryOption là tùy chọn của SubjectsAllowed.
+type ReverseQueryOption interface{ apply(*reverseQueryConfig) }
+
+type reverseQueryOptFunc func(*reverseQueryConfig)
+
+func (f reverseQueryOptFunc) apply(c *reverseQueryConfig) { f(c) }
+
+// WithConcurrency giới hạn số subject được đánh giá song song (mặc định: 8).
+func WithConcurrency(n int) ReverseQueryOption {
+	return reverseQueryOptFunc(func(c *reverseQueryConfig) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	})
+}
+
+// SubjectsAllowed trả về các subject (do enumerator liệt kê) được phép thực hiện action trên resource,
+// theo đúng thứ tự liệt kê. Thuộc tính resource chỉ được lấy một lần và dùng chung cho mọi subject;
+// thuộc tính của từng subject được lấy qua SubjectFetcher và đánh giá song song có giới hạn.
+// Như Check, subject có Permit kèm obligation bắt buộc không được liệt kê.
+//
+// Lỗi của resource, enumerator hoặc context bị hủy dừng truy vấn (kết quả nil). Lỗi của một
+// subject (SubjectFetcher hoặc rule) không làm hỏng các subject khác: subject đó không được liệt kê,
+// các subject còn lại vẫn được trả về cùng errors.Join của các lỗi này (mỗi lỗi có dạng
+// "subject <id>: ...", theo thứ tự liệt kê), giống AllowedActions.
+func (a *Authorizer) SubjectsAllowed(ctx *context.Context, tenantID string, enumerator SubjectEnumerator, resource interface{}, action string, envAttrsInput *Attributes, opts ...ReverseQueryOption) ([]interface{}, error) {
+	if enumerator == nil {
+		return nil, errors.New("reverse query: SubjectEnumerator không được nil")
+	}
+	cfg := &reverseQueryConfig{concurrency: defaultReverseQueryConcurrency}
+	for _, o := range opts {
+		if o != nil {
+			o.apply(cfg)
+		}
+	}
+	if ctx == nil {
+		background := context.Background()
+		ctx = &background
+	}
+
+	envAttrs := make(Attributes)
+	if envAttrsInput != nil {
+		envAttrs = *envAttrsInput
+	}
+	listResAttrs, err := a.resourceFetcher.GetResourceAttributes(ctx, resource)
+	if err != nil {
+		return nil, fmt.Errorf("resource attributes error: %w", err)
+	}
+	if len(listResAttrs) == 0 {
+		listResAttrs = []Attributes{{}}
+	}
+
+	type result struct {
+		subject interface{}
+		allowed bool
+		err     error
+	}
+	var (
+		mu       sync.Mutex
+		results  []result
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+	}
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+
+	sem := make(chan struct{}, cfg.concurrency)
+	enumErr := enumerator.EnumerateSubjects(ctx, tenantID, func(subject interface{}) bool {
+		if failed() {
+			return false
+		}
+		if err := (*ctx).Err(); err != nil {
+			fail(err)
+			return false
+		}
+		mu.Lock()
+		index := len(results)
+		results = append(results, result{subject: subject})
+		mu.Unlock()
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			allowed, err := a.checkSubject(ctx, tenantID, subject, listResAttrs, action, envAttrs)
+			mu.Lock()
+			results[index].allowed = allowed
+			if err != nil {
+				results[index].err = fmt.Errorf("subject %v: %w", subject, err)
+			}
+			mu.Unlock()
+		}()
+		return true
+	})
+	wg.Wait()
+	if err := (*ctx).Err(); err != nil {
+		fail(err)
+	}
+
+	if enumErr != nil {
+		return nil, fmt.Errorf("subject enumerator error: %w", enumErr)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	allowed := make([]interface{}, 0)
+	var errs []error
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+		} else if r.allowed {
+			allowed = append(allowed, r.subject)
+		}
+	}
+	return allowed, errors.Join(errs...)
+}
+
+// checkSubject đánh giá một subject với các thuộc tính resource đã lấy sẵn (giống Check).
+func (a *Authorizer) checkSubject(ctx *context.Context, tenantID string, subject interface{}, listResAttrs []Attributes, action string, envAttrs Attributes) (bool, error) {
+	subAttrs, err := a.subjectFetcher.GetSubjectAttributes(ctx, subject)
+	if err != nil {
+		return false, fmt.Errorf("subject attributes error: %w", err)
+	}
+	for i, resAttrs := range listResAttrs {
+		req := &AuthorizationRequest{
+			Subject:  subAttrs,
+			Resource: resAttrs,
+			Action:   action,
+			Env:      envAttrs,
+
+			resourceIndex: i,
+		}
+		allowed, err := a.engine.enforce(tenantID, req)
+		if err != nil || !allowed {
+			return false, err
+		}
+	}
+	return true, nil
+}
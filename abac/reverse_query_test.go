@@ -0,0 +1,129 @@
+package abac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/internal/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sliceEnumerator []string
+
+func (s sliceEnumerator) EnumerateSubjects(ctx *context.Context, tenantID string, yield func(subject interface{}) bool) error {
+	for _, id := range s {
+		if !yield(id) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// countingFetcher đếm số lần gọi và số subject được lấy đồng thời.
+type countingFetcher struct {
+	mocks.MockFetcher
+	resourceCalls atomic.Int32
+	inFlight      atomic.Int32
+	mu            sync.Mutex
+	maxInFlight   int32
+}
+
+func (f *countingFetcher) GetSubjectAttributes(ctx *context.Context, subject interface{}) (abac.Attributes, error) {
+	n := f.inFlight.Add(1)
+	defer f.inFlight.Add(-1)
+	f.mu.Lock()
+	if n > f.maxInFlight {
+		f.maxInFlight = n
+	}
+	f.mu.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	if id, ok := subject.(string); ok && len(id) > 5 && id[:5] == "user_" {
+		return abac.Attributes{"id": id}, nil
+	}
+	return f.MockFetcher.GetSubjectAttributes(ctx, subject)
+}
+
+func (f *countingFetcher) GetResourceAttributes(ctx *context.Context, resource interface{}) ([]abac.Attributes, error) {
+	f.resourceCalls.Add(1)
+	return f.MockFetcher.GetResourceAttributes(ctx, resource)
+}
+
+func TestAuthorizer_SubjectsAllowed(t *testing.T) {
+	fetcher := &countingFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromFile(
+		"../casbin_config/abac_model.conf", "../casbin_config/abac_policy.csv", fetcher, fetcher, nil,
+	)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	candidates := sliceEnumerator{"t1_hr_manager", "t2_hr_manager", "root_user"}
+	for i := 0; i < 20; i++ {
+		candidates = append(candidates, fmt.Sprintf("user_%d", i))
+	}
+
+	subjects, err := authorizer.SubjectsAllowed(&ctx, "tenant2", candidates, "t2_hr_request", "approve_level_2", nil, abac.WithConcurrency(3))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"t2_hr_manager", "root_user"}, subjects)
+	assert.Equal(t, int32(1), fetcher.resourceCalls.Load(), "resource attributes are fetched once")
+	assert.LessOrEqual(t, fetcher.maxInFlight, int32(3))
+
+	subjects, err = authorizer.SubjectsAllowed(&ctx, "tenant2", candidates, "t2_sales_request", "approve_level_2", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"root_user"}, subjects)
+}
+
+func TestAuthorizer_SubjectsAllowed_Errors(t *testing.T) {
+	authorizer := setupAuthorizer(t)
+	ctx := context.Background()
+
+	// Lỗi của một subject không làm hỏng các subject khác.
+	subjects, err := authorizer.SubjectsAllowed(&ctx, "tenant2", sliceEnumerator{"ghost", "root_user"}, "t2_hr_request", "approve_level_2", nil)
+	assert.ErrorIs(t, err, abac.ErrSubjectNotFound)
+	assert.ErrorContains(t, err, "subject ghost:")
+	assert.Equal(t, []interface{}{"root_user"}, subjects)
+
+	_, err = authorizer.SubjectsAllowed(&ctx, "tenant2", sliceEnumerator{"root_user"}, "missing_request", "approve_level_2", nil)
+	assert.ErrorIs(t, err, abac.ErrResourceNotFound)
+
+	failing := enumeratorFunc(func(yield func(interface{}) bool) error {
+		yield("root_user")
+		return errors.New("user store unavailable")
+	})
+	_, err = authorizer.SubjectsAllowed(&ctx, "tenant2", failing, "t2_hr_request", "approve_level_2", nil)
+	assert.ErrorContains(t, err, "user store unavailable")
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = authorizer.SubjectsAllowed(&cancelled, "tenant2", sliceEnumerator{"root_user"}, "t2_hr_request", "approve_level_2", nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestAuthorizer_SubjectsAllowed_RuleErrors(t *testing.T) {
+	policies := `
+p, *, "Action == 'approve' && Subject.level > 3", allow, level_approve
+p, *, "Action == 'approve' && hasGlobalRole(Subject, 'root')", allow, root_approve`
+	mockFetcher := &mocks.MockFetcher{}
+	authorizer, _, err := abac.NewABACSystemFromStrings(traceTestModel, policies, mockFetcher, mockFetcher, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Rule lỗi (thiếu Subject.level) được trả về theo từng subject như AllowedActions.
+	subjects, err := authorizer.SubjectsAllowed(&ctx, "tenant2", sliceEnumerator{"t2_hr_manager", "root_user"}, "t2_hr_request", "approve", nil)
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "subject t2_hr_manager:")
+	assert.ErrorContains(t, err, "subject root_user:")
+	assert.Empty(t, subjects)
+}
+
+type enumeratorFunc func(yield func(interface{}) bool) error
+
+func (f enumeratorFunc) EnumerateSubjects(ctx *context.Context, tenantID string, yield func(subject interface{}) bool) error {
+	return f(yield)
+}
@@ -0,0 +1,268 @@
+package abac
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/govaluate"
+)
+
+// compiledRule là một rule đã được biên dịch sẵn thành biểu thức govaluate.
+// Bản "plain" được dùng cho request thường; bản traced (các hàm được wrap để báo
+// về observer) được biên dịch một lần khi cần và dùng chung cho mọi request trace.
+type compiledRule struct {
+	source     string
+	expr       *govaluate.EvaluableExpression
+	tracedOnce sync.Once
+	traced     *govaluate.EvaluableExpression
+	newTraced  func() *govaluate.EvaluableExpression
+	target     ruleTarget // ràng buộc trên Action và Resource.type, dùng cho target index
+}
+
+// traceObserverParam là tham số ẩn chứa observer của lần đánh giá, được truyền thêm
+// vào cuối mỗi lời gọi hàm trong bản traced.
+const traceObserverParam = "__abac_trace_observer"
+
+// tracedParameters thêm observer của lần đánh giá vào bộ tham số của rule.
+type tracedParameters struct {
+	params   govaluate.MapParameters
+	observer TraceObserver
+}
+
+func (p tracedParameters) Get(name string) (interface{}, error) {
+	if name == traceObserverParam {
+		return p.observer, nil
+	}
+	return p.params.Get(name)
+}
+
+// evaluate đánh giá rule với bộ tham số cho trước. Nếu observer khác nil,
+// lời gọi các hàm tùy chỉnh sẽ được báo về observer mà không cần biên dịch lại rule.
+func (r *compiledRule) evaluate(parameters map[string]interface{}, observer TraceObserver) (interface{}, error) {
+	if observer == nil {
+		return r.expr.Evaluate(parameters)
+	}
+	r.tracedOnce.Do(func() {
+		if r.newTraced != nil {
+			r.traced = r.newTraced()
+		}
+	})
+	if r.traced == nil {
+		// Không thể dựng bản traced (không xảy ra nếu bản plain biên dịch được),
+		// vẫn đánh giá bình thường để không ảnh hưởng đến quyết định.
+		return r.expr.Evaluate(parameters)
+	}
+	return r.traced.Eval(tracedParameters{params: parameters, observer: observer})
+}
+
+// ruleCache lưu các rule đã biên dịch, khóa theo nội dung rule + bộ hàm đã đăng ký.
+type ruleCache struct {
+	mu          sync.RWMutex
+	functions   CustomFunctionMap
+	fingerprint string
+	entries     map[string]*compiledRule
+}
+
+func newRuleCache(functions CustomFunctionMap) *ruleCache {
+	if functions == nil {
+		functions = make(CustomFunctionMap)
+	}
+	return &ruleCache{
+		functions:   functions,
+		fingerprint: functionSetFingerprint(functions),
+		entries:     make(map[string]*compiledRule),
+	}
+}
+
+// functionSetFingerprint tạo chuỗi định danh cho bộ hàm (tên + địa chỉ hàm),
+// để hai bộ hàm khác nhau không dùng chung bản biên dịch của cùng một rule.
+func functionSetFingerprint(functions CustomFunctionMap) string {
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s@%x;", name, reflect.ValueOf(functions[name]).Pointer())
+	}
+	return b.String()
+}
+
+func (c *ruleCache) key(rule string) string {
+	return c.fingerprint + "\x00" + rule
+}
+
+// get trả về bản biên dịch của rule, biên dịch và lưu lại nếu chưa có
+// (ví dụ rule được thêm thẳng vào enforcer mà không qua PolicyManager).
+func (c *ruleCache) get(rule string) (*compiledRule, error) {
+	key := c.key(rule)
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok {
+		return entry, nil
+	}
+
+	entry, err := c.compile(rule)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if existing, ok := c.entries[key]; ok {
+		entry = existing
+	} else {
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+	return entry, nil
+}
+
+// compile biên dịch rule với bộ hàm hiện tại; bản traced được biên dịch khi cần lần đầu.
+func (c *ruleCache) compile(rule string) (*compiledRule, error) {
+	expr, err := govaluate.NewEvaluableExpressionWithFunctions(rule, c.functions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule syntax '%s': %w", rule, err)
+	}
+	entry := &compiledRule{source: rule, expr: expr}
+	if ast, err := parseRuleAST(rule, c.functions); err == nil {
+		entry.target = extractTarget(ast)
+	}
+	entry.newTraced = func() *govaluate.EvaluableExpression {
+		return c.newTracedExpression(rule)
+	}
+	return entry, nil
+}
+
+// newTracedExpression biên dịch rule với các hàm được wrap; observer được đọc từ tham số
+// traceObserverParam mà lời gọi hàm nhận thêm ở cuối, nên một bản biên dịch phục vụ được
+// nhiều lần đánh giá đồng thời. Thêm tham số ở cuối giữ nguyên cách govaluate gom đối số.
+func (c *ruleCache) newTracedExpression(rule string) *govaluate.EvaluableExpression {
+	wrapped := make(CustomFunctionMap, len(c.functions))
+	for name, fn := range c.functions {
+		n := name
+		orig := fn
+		wrapped[n] = func(fnArgs ...interface{}) (interface{}, error) {
+			var observer TraceObserver
+			if len(fnArgs) > 0 {
+				observer, _ = fnArgs[len(fnArgs)-1].(TraceObserver)
+				fnArgs = fnArgs[:len(fnArgs)-1]
+			}
+			res, err := orig(fnArgs...)
+			if observer != nil {
+				// best effort cast
+				boolRes := false
+				if b, ok := res.(bool); ok {
+					boolRes = b
+				}
+				observer.OnPredicate(n, fnArgs, boolRes)
+			}
+			return res, err
+		}
+	}
+	expr, err := govaluate.NewEvaluableExpressionWithFunctions(rule, wrapped)
+	if err != nil {
+		return nil
+	}
+	tokens := expr.Tokens()
+	out := make([]govaluate.ExpressionToken, 0, len(tokens)+8)
+	var open []bool // với mỗi ngoặc đang mở: có phải ngoặc của lời gọi hàm không
+	for i, token := range tokens {
+		switch token.Kind {
+		case govaluate.CLAUSE:
+			open = append(open, i > 0 && tokens[i-1].Kind == govaluate.FUNCTION)
+		case govaluate.CLAUSE_CLOSE:
+			if n := len(open); n > 0 {
+				if open[n-1] {
+					if tokens[i-1].Kind != govaluate.CLAUSE {
+						out = append(out, govaluate.ExpressionToken{Kind: govaluate.SEPARATOR, Value: ","})
+					}
+					out = append(out, govaluate.ExpressionToken{Kind: govaluate.VARIABLE, Value: traceObserverParam})
+				}
+				open = open[:n-1]
+			}
+		}
+		out = append(out, token)
+	}
+	traced, err := govaluate.NewEvaluableExpressionFromTokens(out)
+	if err != nil {
+		return nil
+	}
+	return traced
+}
+
+// sync đồng bộ cache với tập rule hiện có: biên dịch rule mới, loại bỏ rule
+// không còn được policy nào sử dụng. Rule sai cú pháp được bỏ qua ở đây,
+// lỗi sẽ được trả về khi rule đó được đánh giá.
+func (c *ruleCache) sync(rules []string) {
+	wanted := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		wanted[c.key(rule)] = rule
+	}
+
+	c.mu.RLock()
+	missing := make(map[string]string)
+	for key, rule := range wanted {
+		if _, ok := c.entries[key]; !ok {
+			missing[key] = rule
+		}
+	}
+	c.mu.RUnlock()
+
+	compiled := make(map[string]*compiledRule, len(missing))
+	for key, rule := range missing {
+		if entry, err := c.compile(rule); err == nil {
+			compiled[key] = entry
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if _, ok := wanted[key]; !ok {
+			delete(c.entries, key)
+		}
+	}
+	for key, entry := range compiled {
+		if _, ok := c.entries[key]; !ok {
+			c.entries[key] = entry
+		}
+	}
+}
+
+// size trả về số rule đang được cache.
+func (c *ruleCache) size() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// policyRules trả về chuỗi rule của mọi policy trong enforcer.
+// Trả về nil nếu model không có trường "rule" (ví dụ model RBAC thuần).
+func policyRules(e *casbin.Enforcer) []string {
+	assertion, ok := e.GetModel()["p"]["p"]
+	if !ok {
+		return nil
+	}
+	ruleIndex := -1
+	for i, token := range assertion.Tokens {
+		if token == "p_rule" {
+			ruleIndex = i
+			break
+		}
+	}
+	if ruleIndex < 0 {
+		return nil
+	}
+	rules := make([]string, 0, len(assertion.Policy))
+	for _, policy := range assertion.Policy {
+		if ruleIndex < len(policy) {
+			rules = append(rules, policy[ruleIndex])
+		}
+	}
+	return rules
+}
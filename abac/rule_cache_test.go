@@ -0,0 +1,176 @@
+package abac
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+type staticFetcher struct {
+	subject  Attributes
+	resource Attributes
+}
+
+func (f *staticFetcher) GetSubjectAttributes(ctx *context.Context, subject interface{}) (Attributes, error) {
+	return f.subject, nil
+}
+
+func (f *staticFetcher) GetResourceAttributes(ctx *context.Context, resource interface{}) ([]Attributes, error) {
+	return []Attributes{f.resource}, nil
+}
+
+type countingObserver struct {
+	mu         sync.Mutex
+	predicates int
+}
+
+func (o *countingObserver) OnPredicate(name string, args []interface{}, result bool) {
+	o.mu.Lock()
+	o.predicates++
+	o.mu.Unlock()
+}
+func (o *countingObserver) OnRuleEvaluated(policyID, ruleID string, matched bool) {}
+func (o *countingObserver) OnAttributeRead(scope, path string, value interface{}) {}
+
+func TestRuleCache_CompiledOnLoadAndInvalidated(t *testing.T) {
+	_, pm, err := NewABACSystemFromFile(
+		"../casbin_config/abac_model.conf",
+		"../casbin_config/abac_policy.csv",
+		&staticFetcher{}, &staticFetcher{},
+		CustomFunctionMap{"hasGlobalRole": HasGlobalRoleFunc, "hasTenantRole": HasTenantRoleFunc},
+	)
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+	if got := pm.engine.evaluator.rules.size(); got != 3 {
+		t.Fatalf("expected 3 compiled rules after load, got %d", got)
+	}
+
+	if _, err := pm.AddPolicy([]string{"tenant1", "Action == 'write'", "allow"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	if got := pm.engine.evaluator.rules.size(); got != 4 {
+		t.Fatalf("expected 4 compiled rules after AddPolicy, got %d", got)
+	}
+
+	if _, err := pm.UpdatePolicy(
+		[]string{"tenant1", "Action == 'write'", "allow"},
+		[]string{"tenant1", "Action == 'delete'", "allow"},
+	); err != nil {
+		t.Fatalf("UpdatePolicy failed: %v", err)
+	}
+	if _, err := pm.engine.evaluator.rules.get("Action == 'delete'"); err != nil {
+		t.Fatalf("updated rule should be cached: %v", err)
+	}
+	if got := pm.engine.evaluator.rules.size(); got != 4 {
+		t.Fatalf("old rule should be evicted on update, got %d entries", got)
+	}
+
+	if _, err := pm.RemovePolicy([]string{"tenant1", "Action == 'delete'", "allow"}); err != nil {
+		t.Fatalf("RemovePolicy failed: %v", err)
+	}
+	if got := pm.engine.evaluator.rules.size(); got != 3 {
+		t.Fatalf("expected 3 compiled rules after RemovePolicy, got %d", got)
+	}
+}
+
+func TestRuleCache_KeyIncludesFunctionSet(t *testing.T) {
+	a := newRuleCache(CustomFunctionMap{"has": HasFunc})
+	b := newRuleCache(CustomFunctionMap{"has": IntersectsFunc})
+	if a.key("has(Subject.roles, 'x')") == b.key("has(Subject.roles, 'x')") {
+		t.Fatal("different function sets must produce different cache keys")
+	}
+}
+
+func TestRuleCache_TracedEvaluationReusesCompiledRule(t *testing.T) {
+	cache := newRuleCache(CustomFunctionMap{"hasGlobalRole": HasGlobalRoleFunc})
+	compiled, err := cache.get("hasGlobalRole(Subject, 'admin')")
+	if err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	params := map[string]interface{}{
+		"Subject":  Attributes{"global_roles": []interface{}{"admin"}},
+		"Resource": Attributes{},
+		"Action":   "read",
+		"Env":      Attributes{},
+	}
+
+	observer := &countingObserver{}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := compiled.evaluate(params, observer)
+			if err != nil || res != true {
+				t.Errorf("traced evaluate failed: %v, %v", res, err)
+			}
+			res, err = compiled.evaluate(params, nil)
+			if err != nil || res != true {
+				t.Errorf("plain evaluate failed: %v, %v", res, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if observer.predicates != 50 {
+		t.Fatalf("expected 50 traced predicate calls, got %d", observer.predicates)
+	}
+	if again, _ := cache.get("hasGlobalRole(Subject, 'admin')"); again != compiled {
+		t.Fatal("rule should be served from cache")
+	}
+}
+
+func TestRuleCache_TracedExpressionMatchesPlainAndSurvivesGC(t *testing.T) {
+	functions := CustomFunctionMap{
+		"hasGlobalRole": HasGlobalRoleFunc,
+		"intersects":    IntersectsFunc,
+		"alwaysTrue":    func(args ...interface{}) (interface{}, error) { return len(args) == 0, nil },
+		"count":         func(args ...interface{}) (interface{}, error) { return float64(len(args)), nil },
+	}
+	cache := newRuleCache(functions)
+	params := map[string]interface{}{
+		"Subject":  Attributes{"global_roles": []interface{}{"admin"}, "tags": []interface{}{"a", "b"}},
+		"Resource": Attributes{"tags": []interface{}{"b"}},
+		"Action":   "read",
+		"Env":      Attributes{},
+	}
+	// govaluate trải slice ở đối số đầu thành nhiều đối số (intersects nhận 3 tham số);
+	// bản traced phải giữ nguyên hành vi đó, kể cả lỗi.
+	rules := []string{
+		"hasGlobalRole(Subject, 'admin') && Action in ('read', 'list')",
+		"alwaysTrue() && (alwaysTrue() || false)",
+		"count(Subject.tags) == 2 && count(Action, (1 + 2)) == 2",
+		"hasGlobalRole(Subject, 'admin') && intersects(Subject.tags, Resource.tags)",
+	}
+	for _, rule := range rules {
+		compiled, err := cache.get(rule)
+		if err != nil {
+			t.Fatalf("compile %q failed: %v", rule, err)
+		}
+		want, wantErr := compiled.evaluate(params, nil)
+		observer := &countingObserver{}
+		got, gotErr := compiled.evaluate(params, observer)
+		if got != want || (gotErr == nil) != (wantErr == nil) {
+			t.Fatalf("%q: traced result %v/%v differs from plain %v/%v", rule, got, gotErr, want, wantErr)
+		}
+		if wantErr == nil && want != true {
+			t.Fatalf("%q: expected true, got %v", rule, want)
+		}
+		if observer.predicates == 0 {
+			t.Fatalf("%q: predicates were not traced", rule)
+		}
+	}
+
+	compiled, _ := cache.get(rules[0])
+	traced := compiled.traced
+	runtime.GC()
+	runtime.GC()
+	if _, err := compiled.evaluate(params, &countingObserver{}); err != nil {
+		t.Fatal(err)
+	}
+	if compiled.traced != traced {
+		t.Fatal("traced expression must be compiled once and reused")
+	}
+}
@@ -0,0 +1,264 @@
+package abac
+
+import (
+	"fmt"
+	"slices"
+)
+
+// =========================================================================
+// == Target index
+// =========================================================================
+
+// Target index cho phép Check chỉ đánh giá các rule có thể khớp với request. Khi nạp policy,
+// điều kiện bằng trên Action và Resource.type được trích tĩnh từ mỗi rule (và target của
+// policy set); rule chắc chắn không khớp được coi như đã đánh giá và trả về false, nên
+// quyết định, lý do và lỗi giống hệt khi đánh giá đầy đủ.
+//
+// Chỉ các vế đứng đầu chuỗi && ở cấp cao nhất được dùng: govaluate dừng ở vế false đầu tiên,
+// nên các vế phía sau (có thể lỗi) không bao giờ được đánh giá khi một vế đầu không khớp.
+// Các dạng được nhận diện:
+//
+//	Action == 'read'              'read' == Action
+//	Action in ('read', 'list')    Action == 'read' || Action == 'list'
+//
+// và tương tự với Resource.type. Vì Resource.type làm rule lỗi khi resource không có thuộc
+// tính type, index chỉ lọc theo type khi request có type dạng chuỗi, và điều kiện trên Action
+// đứng sau một điều kiện trên Resource.type không được dùng.
+
+const (
+	targetFieldAction = "Action"
+	targetFieldType   = "Resource.type"
+)
+
+// ruleTarget là các giá trị Action và Resource.type mà rule có thể khớp; nil là không ràng buộc.
+type ruleTarget struct {
+	actions map[string]bool
+	types   map[string]bool
+}
+
+// extractTarget trích ràng buộc trên Action và Resource.type từ các vế đứng đầu của rule.
+func extractTarget(ast *ruleAST) ruleTarget {
+	var t ruleTarget
+	for _, c := range ast.root.conjuncts() {
+		field, values, ok := targetCondition(c)
+		if !ok {
+			break
+		}
+		switch field {
+		case targetFieldAction:
+			if t.types == nil {
+				t.actions = intersectTarget(t.actions, values)
+			}
+		case targetFieldType:
+			t.types = intersectTarget(t.types, values)
+		}
+	}
+	return t
+}
+
+// targetCondition nhận diện một vế so sánh bằng (hoặc in, hoặc || của các so sánh trên cùng
+// trường) giữa Action/Resource.type và hằng chuỗi.
+func targetCondition(n *exprNode) (field string, values []string, ok bool) {
+	switch {
+	case n.kind == exprLogical && n.op == "||":
+		lf, lv, lok := targetCondition(n.children[0])
+		rf, rv, rok := targetCondition(n.children[1])
+		if !lok || !rok || lf != rf {
+			return "", nil, false
+		}
+		return lf, append(lv, rv...), true
+	case n.kind == exprComparison && n.op == "==":
+		left, right := n.children[0], n.children[1]
+		if left.kind == exprLiteral {
+			left, right = right, left
+		}
+		value, isString := right.value.(string)
+		if field = targetField(left); field == "" || right.kind != exprLiteral || !isString {
+			return "", nil, false
+		}
+		return field, []string{value}, true
+	case n.kind == exprComparison && n.op == "in":
+		left, right := n.children[0], n.children[1]
+		if field = targetField(left); field == "" || right.kind != exprList {
+			return "", nil, false
+		}
+		for _, item := range right.children {
+			value, isString := item.value.(string)
+			if item.kind != exprLiteral || !isString {
+				return "", nil, false
+			}
+			values = append(values, value)
+		}
+		return field, values, true
+	}
+	return "", nil, false
+}
+
+func targetField(n *exprNode) string {
+	if n.kind != exprVariable {
+		return ""
+	}
+	switch {
+	case slices.Equal(n.path, []string{"Action"}):
+		return targetFieldAction
+	case slices.Equal(n.path, []string{"Resource", "type"}):
+		return targetFieldType
+	}
+	return ""
+}
+
+// intersectTarget giao tập giá trị hiện có (nil: không ràng buộc) với values.
+func intersectTarget(current map[string]bool, values []string) map[string]bool {
+	next := make(map[string]bool, len(values))
+	for _, v := range values {
+		if current == nil || current[v] {
+			next[v] = true
+		}
+	}
+	return next
+}
+
+// targetOf trả về ràng buộc của node; rule lỗi biên dịch không bị ràng buộc để lỗi vẫn được báo.
+func (n policyNode) targetOf() ruleTarget {
+	if n.set != nil {
+		if n.set.compileErr != nil || n.set.compiled == nil {
+			return ruleTarget{}
+		}
+		return n.set.compiled.target
+	}
+	if n.policy.compileErr != nil || n.policy.compiled == nil {
+		return ruleTarget{}
+	}
+	return n.policy.compiled.target
+}
+
+// bitset đánh dấu vị trí các node trong một danh sách node.
+type bitset []uint64
+
+func newBitset(size int) bitset {
+	return make(bitset, (size+63)/64)
+}
+
+func (b bitset) set(i int)      { b[i/64] |= 1 << (i % 64) }
+func (b bitset) has(i int) bool { return b[i/64]&(1<<(i%64)) != 0 }
+
+// targetIndex là index của một danh sách node cùng cấp (cấp cao nhất hoặc thành viên của
+// một policy set) theo Action và Resource.type.
+type targetIndex struct {
+	size      int
+	byAction  map[string]bitset
+	anyAction bitset // node không ràng buộc Action
+	byType    map[string]bitset
+	anyType   bitset // node không ràng buộc Resource.type
+}
+
+// newTargetIndex dựng index cho danh sách node; nil nếu không node nào có ràng buộc.
+func newTargetIndex(nodes []policyNode) *targetIndex {
+	x := &targetIndex{
+		size:      len(nodes),
+		byAction:  make(map[string]bitset),
+		anyAction: newBitset(len(nodes)),
+		byType:    make(map[string]bitset),
+		anyType:   newBitset(len(nodes)),
+	}
+	constrained := false
+	add := func(index map[string]bitset, unconstrained bitset, values map[string]bool, i int) {
+		if values == nil {
+			unconstrained.set(i)
+			return
+		}
+		constrained = true
+		for v := range values {
+			if index[v] == nil {
+				index[v] = newBitset(x.size)
+			}
+			index[v].set(i)
+		}
+	}
+	for i, n := range nodes {
+		t := n.targetOf()
+		add(x.byAction, x.anyAction, t.actions, i)
+		add(x.byType, x.anyType, t.types, i)
+	}
+	if !constrained {
+		return nil
+	}
+	return x
+}
+
+// candidates trả về các node có thể khớp với request; node ngoài tập chắc chắn không khớp.
+func (x *targetIndex) candidates(req *AuthorizationRequest) bitset {
+	out := newBitset(x.size)
+	byAction := x.byAction[req.Action]
+	for i := range out {
+		out[i] = x.anyAction[i]
+		if byAction != nil {
+			out[i] |= byAction[i]
+		}
+	}
+	// Thiếu Resource.type thì rule có điều kiện trên type sẽ lỗi chứ không phải false,
+	// còn giá trị không phải chuỗi thì không lọc để tránh khác biệt khi so sánh.
+	typ, ok := req.Resource["type"].(string)
+	if !ok {
+		return out
+	}
+	byType := x.byType[typ]
+	for i := range out {
+		mask := x.anyType[i]
+		if byType != nil {
+			mask |= byType[i]
+		}
+		out[i] &= mask
+	}
+	return out
+}
+
+// =========================================================================
+// == Cross-check
+// =========================================================================
+
+// TargetIndexMismatch mô tả một request mà quyết định dùng target index khác với đánh giá đầy đủ.
+type TargetIndexMismatch struct {
+	TenantID string
+	Request  *AuthorizationRequest
+	Indexed  Decision
+	Full     Decision
+}
+
+func (m TargetIndexMismatch) String() string {
+	return fmt.Sprintf("target index mismatch for tenant %s, action %s: indexed %s (%s), full evaluation %s (%s)",
+		m.TenantID, m.Request.Action, m.Indexed.Effect, m.Indexed.Reason, m.Full.Effect, m.Full.Reason)
+}
+
+// WithoutTargetIndex tắt target index, mọi rule áp dụng cho tenant đều được đánh giá.
+func WithoutTargetIndex() SystemOption {
+	return systemOptFunc(func(c *systemConfig) { c.disableTargetIndex = true })
+}
+
+// WithTargetIndexCrossCheck đánh giá mỗi request hai lần, có và không có target index, và gọi
+// onMismatch khi hai quyết định khác nhau (nil: panic); quyết định đầy đủ được trả về.
+// Dùng trong test suite để kiểm chứng index, không dùng trong production.
+func WithTargetIndexCrossCheck(onMismatch func(TargetIndexMismatch)) SystemOption {
+	return systemOptFunc(func(c *systemConfig) {
+		if onMismatch == nil {
+			onMismatch = func(m TargetIndexMismatch) { panic(m.String()) }
+		}
+		c.indexCrossCheck = onMismatch
+	})
+}
+
+// sameDecision so sánh hai quyết định theo mọi trường mà người gọi thấy được.
+func sameDecision(a, b Decision) bool {
+	if a.Effect != b.Effect || a.Algorithm != b.Algorithm || a.Reason != b.Reason ||
+		!slices.Equal(a.PolicyIDs, b.PolicyIDs) ||
+		!slices.Equal(a.Obligations, b.Obligations) || !slices.Equal(a.Advice, b.Advice) ||
+		len(a.Errors) != len(b.Errors) || (a.err == nil) != (b.err == nil) {
+		return false
+	}
+	for i := range a.Errors {
+		if a.Errors[i].Error() != b.Errors[i].Error() {
+			return false
+		}
+	}
+	return true
+}
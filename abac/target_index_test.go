@@ -0,0 +1,206 @@
+package abac
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestExtractTarget(t *testing.T) {
+	cases := []struct {
+		rule    string
+		actions []string // nil: không ràng buộc
+		types   []string
+	}{
+		{rule: "Action == 'read'", actions: []string{"read"}},
+		{rule: "'read' == Action && Subject.level > 3", actions: []string{"read"}},
+		{rule: "Action in ('read', 'list') && Resource.type == 'doc'", actions: []string{"list", "read"}, types: []string{"doc"}},
+		{rule: "(Action == 'read' || Action == 'list') && Resource.type in ('doc', 'sheet')", actions: []string{"list", "read"}, types: []string{"doc", "sheet"}},
+		{rule: "Action in ('read', 'list') && Action == 'read'", actions: []string{"read"}},
+		{rule: "Action == 'read' && Action == 'write'", actions: []string{}},
+		// Điều kiện trên Action sau Resource.type không được dùng: thiếu type thì rule lỗi.
+		{rule: "Resource.type == 'doc' && Action == 'read'", types: []string{"doc"}},
+		// Chỉ các vế đứng đầu được dùng.
+		{rule: "Subject.level > 3 && Action == 'read'"},
+		{rule: "Action == 'read' || Subject.admin == true"},
+		{rule: "Action == 'read' || Resource.type == 'doc'"},
+		{rule: "Action != 'read'"},
+		{rule: "Action == Subject.action"},
+		{rule: "Resource.kind == 'doc'"},
+	}
+	for _, tc := range cases {
+		ast, err := parseRuleAST(tc.rule, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.rule, err)
+		}
+		got := extractTarget(ast)
+		if !sameTargetValues(got.actions, tc.actions) || !sameTargetValues(got.types, tc.types) {
+			t.Errorf("%s: got actions %v, types %v; want %v, %v", tc.rule, got.actions, got.types, tc.actions, tc.types)
+		}
+	}
+}
+
+func sameTargetValues(got map[string]bool, want []string) bool {
+	if (got == nil) != (want == nil) || len(got) != len(want) {
+		return false
+	}
+	for _, v := range want {
+		if !got[v] {
+			return false
+		}
+	}
+	return true
+}
+
+const targetIndexTestModel = `
+[request_definition]
+r = tenant, req
+
+[policy_definition]
+p = tenant, rule, eft, id, priority
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)`
+
+const targetIndexTestPolicies = `
+p, *, "Action == 'read'", allow, read_all, 0
+p, tenant1, "Action in ('write', 'delete') && Subject.level > 3", allow, write_senior, 0
+p, tenant1, "Action == 'delete' && Resource.owner == 'root'", deny, delete_root, 0
+p, *, "Resource.type == 'doc' && Action == 'share'", allow, share_doc, 0
+p, *, "(Resource.type == 'secret' || Resource.type == 'key') && Action in ('read', 'share')", deny, secret_deny, 5
+p, *, "Action == 'export' && Resource.size > 'big'", allow, export_broken, 0
+p, tenant2, "Subject.level > 1", allow, tenant2_any, 0
+p, *, "Action == 'audit' && Subject.level >", allow, audit_invalid, 0
+p, tenant1, "Action == 'archive'", allow, archive, 1
+p, tenant1, "Action == 'archive' && Resource.type == 'doc'", deny, archive_doc, 1`
+
+func TestTargetIndex_MatchesFullEvaluation(t *testing.T) {
+	subject := Attributes{"id": "u1", "level": 5}
+	resources := []Attributes{
+		{},
+		{"type": "doc", "owner": "root", "size": 10},
+		{"type": "secret"},
+		{"type": "key", "owner": "u1"},
+		{"type": 42},
+		{"type": "sheet", "size": "big"},
+	}
+	actions := []string{"read", "write", "delete", "share", "export", "audit", "archive", "unknown"}
+
+	for _, alg := range []CombiningAlgorithm{DenyOverrides, PermitOverrides, FirstApplicable, DenyUnlessPermit, PermitUnlessDeny} {
+		fetcher := &staticFetcher{subject: subject}
+		var mismatches []TargetIndexMismatch
+		authorizer, pm, err := NewABACSystemFromStrings(targetIndexTestModel, targetIndexTestPolicies, fetcher, fetcher, nil,
+			WithCombiningAlgorithm(alg),
+			WithTargetIndexCrossCheck(func(m TargetIndexMismatch) { mismatches = append(mismatches, m) }))
+		if err != nil {
+			t.Fatalf("failed to create system: %v", err)
+		}
+		full, fullPM, err := NewABACSystemFromStrings(targetIndexTestModel, targetIndexTestPolicies, fetcher, fetcher, nil,
+			WithCombiningAlgorithm(alg), WithoutTargetIndex())
+		if err != nil {
+			t.Fatalf("failed to create system: %v", err)
+		}
+
+		run := func(stage string) {
+			ctx := context.Background()
+			for _, tenant := range []string{"tenant1", "tenant2"} {
+				for _, res := range resources {
+					fetcher.resource = res
+					for _, action := range actions {
+						got := authorizer.Decide(&ctx, tenant, "u1", "r1", action, nil)
+						want := full.Decide(&ctx, tenant, "u1", "r1", action, nil)
+						if !sameDecision(got, want) {
+							t.Errorf("%s/%s %s %s %v: indexed %s (%s), full %s (%s)",
+								alg, stage, tenant, action, res, got.Effect, got.Reason, want.Effect, want.Reason)
+						}
+					}
+				}
+			}
+		}
+		run("policies")
+
+		// Policy set có target và thuật toán riêng cũng được đánh chỉ mục.
+		for _, s := range []PolicySet{
+			{ID: "docs", TenantID: "*", Target: "Resource.type == 'doc'", Algorithm: PermitOverrides, PolicyIDs: []string{"share_doc", "delete_root"}},
+			{ID: "exports", TenantID: "tenant1", Target: "Action in ('export', 'audit')", Priority: 2, PolicyIDs: []string{"export_broken", "audit_invalid"}},
+			{ID: "archive", TenantID: "tenant1", ParentID: "exports", Target: "Action == 'archive'", PolicyIDs: []string{"archive", "archive_doc"}},
+		} {
+			for _, m := range []*PolicyManager{pm, fullPM} {
+				if _, err := m.CreatePolicySet(s); err != nil {
+					t.Fatalf("CreatePolicySet %s: %v", s.ID, err)
+				}
+			}
+		}
+		run("sets")
+
+		for _, m := range mismatches {
+			t.Errorf("%s: %s", alg, m)
+		}
+	}
+}
+
+func TestTargetIndex_Candidates(t *testing.T) {
+	fetcher := &staticFetcher{}
+	_, pm, err := NewABACSystemFromStrings(targetIndexTestModel, targetIndexTestPolicies, fetcher, fetcher, nil)
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+	snap := pm.engine.current()
+	candidates := func(action string, resource Attributes) []string {
+		set := snap.rootIndex.candidates(&AuthorizationRequest{Action: action, Resource: resource})
+		var ids []string
+		for i, n := range snap.root {
+			if set.has(i) {
+				ids = append(ids, n.policy.ID)
+			}
+		}
+		return ids
+	}
+
+	tests := []struct {
+		action   string
+		resource Attributes
+		want     []string
+	}{
+		// audit_invalid sai cú pháp nên luôn là ứng viên; tenant2_any không có ràng buộc.
+		// share_doc và secret_deny chỉ ràng buộc type vì điều kiện trên Action đứng sau.
+		{"read", Attributes{}, []string{"secret_deny", "read_all", "share_doc", "tenant2_any", "audit_invalid"}},
+		{"read", Attributes{"type": "doc"}, []string{"read_all", "share_doc", "tenant2_any", "audit_invalid"}},
+		{"share", Attributes{"type": "doc"}, []string{"share_doc", "tenant2_any", "audit_invalid"}},
+		{"archive", Attributes{"type": "sheet"}, []string{"archive", "tenant2_any", "audit_invalid"}},
+		{"archive", Attributes{"type": 7}, []string{"secret_deny", "archive", "archive_doc", "share_doc", "tenant2_any", "audit_invalid"}},
+	}
+	for _, tc := range tests {
+		got := candidates(tc.action, tc.resource)
+		slices.Sort(got)
+		slices.Sort(tc.want)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s %v: got %v, want %v", tc.action, tc.resource, got, tc.want)
+		}
+	}
+}
+
+func TestTargetIndex_CrossCheckReportsMismatch(t *testing.T) {
+	fetcher := &staticFetcher{resource: Attributes{}}
+	var mismatches []TargetIndexMismatch
+	authorizer, pm, err := NewABACSystemFromStrings(targetIndexTestModel, `p, *, "Action == 'read'", allow, read_all, 0`, fetcher, fetcher, nil,
+		WithTargetIndexCrossCheck(func(m TargetIndexMismatch) { mismatches = append(mismatches, m) }))
+	if err != nil {
+		t.Fatalf("failed to create system: %v", err)
+	}
+	ctx := context.Background()
+
+	// Làm hỏng index để index loại policy khớp duy nhất.
+	snap := pm.engine.current()
+	snap.rootIndex.byAction["read"] = newBitset(1)
+	allowed, err := authorizer.Check(&ctx, "tenant1", "u1", "r1", "read", nil)
+	if err != nil || !allowed {
+		t.Fatalf("cross-check should return the full decision, got %v, %v", allowed, err)
+	}
+	if len(mismatches) != 1 || mismatches[0].Indexed.Effect != NotApplicable || mismatches[0].Full.Effect != Permit {
+		t.Fatalf("expected one mismatch, got %v", mismatches)
+	}
+}
@@ -0,0 +1,151 @@
+package abac
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationCode phân loại lỗi khi kiểm tra một policy.
+type ValidationCode string
+
+const (
+	ValidationSyntax            ValidationCode = "syntax"
+	ValidationUnknownFunction   ValidationCode = "unknown_function"
+	ValidationArity             ValidationCode = "arity"
+	ValidationUnknownIdentifier ValidationCode = "unknown_identifier"
+	ValidationEffect            ValidationCode = "effect"
+	ValidationPriority          ValidationCode = "priority"
+	ValidationObligation        ValidationCode = "obligation"
+)
+
+// ValidationIssue là một lỗi cụ thể trong policy.
+type ValidationIssue struct {
+	Code    ValidationCode `json:"code"`
+	Message string         `json:"message"`
+	// Position là vị trí byte (tính từ 0) trong rule, -1 nếu không xác định được.
+	Position int `json:"position"`
+}
+
+// PolicyValidationError được trả về khi ghi một policy không hợp lệ qua PolicyManager.
+// errors.Is(err, ErrInvalidPolicy) luôn đúng với lỗi này.
+type PolicyValidationError struct {
+	PolicyID string            `json:"policy_id"`
+	Rule     string            `json:"rule"`
+	Issues   []ValidationIssue `json:"issues"`
+}
+
+func (e *PolicyValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		if issue.Position >= 0 {
+			msgs = append(msgs, fmt.Sprintf("%s (vị trí %d)", issue.Message, issue.Position))
+		} else {
+			msgs = append(msgs, issue.Message)
+		}
+	}
+	return fmt.Sprintf("%v: policy %s: %s", ErrInvalidPolicy, e.PolicyID, strings.Join(msgs, "; "))
+}
+
+// Is cho phép so khớp bằng errors.Is(err, ErrInvalidPolicy).
+func (e *PolicyValidationError) Is(target error) bool {
+	return target == ErrInvalidPolicy
+}
+
+// requestRoots là các định danh cấp cao nhất mà rule được phép tham chiếu.
+var requestRoots = map[string]bool{"Subject": true, "Resource": true, "Action": true, "Env": true}
+
+// validateRow kiểm tra một dòng policy theo layout của model: priority phải là số nguyên,
+// effect và rule được kiểm tra bởi policyIssues.
+func (ev *expressionEvaluator) validateRow(l policyLayout, row []string) error {
+	var issues []ValidationIssue
+	if value := l.field(row, l.priority); value != "" {
+		if _, err := parsePriority(value); err != nil {
+			issues = append(issues, ValidationIssue{
+				Code:     ValidationPriority,
+				Message:  fmt.Sprintf("priority phải là số nguyên, nhận được '%s'", value),
+				Position: -1,
+			})
+		}
+	}
+	p := l.toPolicy(row)
+	return newValidationError(p, append(issues, ev.policyIssues(p, l.effect >= 0)...))
+}
+
+// policyIssues kiểm tra effect và rule của policy với bộ hàm đã đăng ký:
+// cú pháp, hàm không tồn tại, sai số tham số và định danh ngoài Subject/Resource/Action/Env.
+// checkEffect = false với model không khai báo trường eft.
+func (ev *expressionEvaluator) policyIssues(p Policy, checkEffect bool) []ValidationIssue {
+	var issues []ValidationIssue
+	add := func(code ValidationCode, pos int, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{Code: code, Message: fmt.Sprintf(format, args...), Position: pos})
+	}
+
+	if checkEffect && p.Effect != "allow" && p.Effect != "deny" {
+		add(ValidationEffect, -1, "effect phải là 'allow' hoặc 'deny', nhận được '%s'", p.Effect)
+	}
+	if _, _, err := parseObligations(p.Obligations); err != nil {
+		add(ValidationObligation, -1, "%v", err)
+	}
+
+	if strings.TrimSpace(p.Rule) == "" {
+		add(ValidationSyntax, -1, "rule rỗng")
+		return issues
+	}
+	identIssues := len(issues)
+	for _, ident := range scanRuleIdents(p.Rule) {
+		root, _, _ := strings.Cut(ident.name, ".")
+		switch {
+		case ident.call && root == ident.name:
+			if _, ok := ev.functions[ident.name]; !ok {
+				add(ValidationUnknownFunction, ident.pos, "hàm '%s' chưa được đăng ký", ident.name)
+			}
+		case isRuleKeyword(ident.name):
+		case !requestRoots[root]:
+			add(ValidationUnknownIdentifier, ident.pos, "định danh '%s' không hợp lệ, chỉ được dùng Subject, Resource, Action, Env", root)
+		}
+	}
+	if len(issues) > identIssues {
+		// govaluate chỉ báo lỗi chung chung cho hàm/định danh lạ nên bỏ qua bước biên dịch.
+		return issues
+	}
+
+	if _, err := ev.rules.compile(p.Rule); err != nil {
+		add(ValidationSyntax, -1, "cú pháp không hợp lệ: %v", err)
+		return issues
+	}
+	// Rule dùng cú pháp mà cây biểu thức chưa hỗ trợ vẫn hợp lệ, chỉ bỏ qua kiểm tra số tham số.
+	if ast, err := parseRuleAST(p.Rule, ev.functions); err == nil {
+		ast.root.walk(func(n *exprNode) {
+			if n.kind != exprFunction {
+				return
+			}
+			info, ok := ev.functionInfos[n.name]
+			if ok && info.Arity >= 0 && len(n.children) != info.Arity {
+				add(ValidationArity, ast.position(n), "hàm '%s' cần %d tham số, nhận được %d", n.name, info.Arity, len(n.children))
+			}
+		})
+	}
+	return issues
+}
+
+func newValidationError(p Policy, issues []ValidationIssue) error {
+	if len(issues) == 0 {
+		return nil
+	}
+	return &PolicyValidationError{PolicyID: p.ID, Rule: p.Rule, Issues: issues}
+}
+
+// ValidatePolicy kiểm tra một dòng policy như khi ghi qua AddPolicy/UpdatePolicy mà không
+// thay đổi gì. Trả về *PolicyValidationError nếu không hợp lệ.
+func (pm *PolicyManager) ValidatePolicy(rule []string) error {
+	return pm.validateRow(pm.completeRule(rule))
+}
+
+// validateRow kiểm tra dòng policy theo layout của model hiện tại.
+func (pm *PolicyManager) validateRow(row []string) error {
+	l := layoutOf(pm.enforcer)
+	if l.rule < 0 {
+		return nil
+	}
+	return pm.engine.evaluator.validateRow(l, row)
+}
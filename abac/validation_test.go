@@ -0,0 +1,92 @@
+package abac
+
+import (
+	"errors"
+	"testing"
+)
+
+func newValidationTestManager(t *testing.T) *PolicyManager {
+	t.Helper()
+	_, pm, err := NewABACSystemFromStrings(testABACModel, "", &staticFetcher{}, &staticFetcher{}, nil)
+	if err != nil {
+		t.Fatalf("NewABACSystemFromStrings failed: %v", err)
+	}
+	return pm
+}
+
+func TestValidatePolicy_Issues(t *testing.T) {
+	pm := newValidationTestManager(t)
+
+	cases := []struct {
+		name     string
+		rule     []string
+		code     ValidationCode
+		position int
+	}{
+		{"effect", []string{"*", "Action == 'read'", "permit", "p1"}, ValidationEffect, -1},
+		{"unknown function", []string{"*", "Action == 'read' && hasRol(Subject, 'admin')", "allow", "p1"}, ValidationUnknownFunction, 20},
+		{"arity", []string{"*", "Action == 'read' && hasGlobalRole(Subject)", "allow", "p1"}, ValidationArity, 20},
+		{"unknown identifier", []string{"*", "Action == 'read' && User.id == 'u1'", "allow", "p1"}, ValidationUnknownIdentifier, 20},
+		{"syntax", []string{"*", "Action == ", "allow", "p1"}, ValidationSyntax, -1},
+		{"empty", []string{"*", "  ", "allow", "p1"}, ValidationSyntax, -1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := pm.ValidatePolicy(tc.rule)
+			var verr *PolicyValidationError
+			if !errors.As(err, &verr) || !errors.Is(err, ErrInvalidPolicy) {
+				t.Fatalf("expected PolicyValidationError, got %v", err)
+			}
+			if len(verr.Issues) != 1 || verr.Issues[0].Code != tc.code || verr.Issues[0].Position != tc.position {
+				t.Fatalf("expected one %s issue at %d, got %+v", tc.code, tc.position, verr.Issues)
+			}
+			if verr.PolicyID != "p1" {
+				t.Fatalf("expected policy id p1, got %q", verr.PolicyID)
+			}
+		})
+	}
+
+	valid := []string{"*", "Action in ('read', 'list') && hasTenantRole(Subject, 'tenant1', 'viewer') && Resource.owner == Subject.id && Env.ip != ''", "deny", "p2"}
+	if err := pm.ValidatePolicy(valid); err != nil {
+		t.Fatalf("expected valid policy, got %v", err)
+	}
+	// Chuỗi ký tự chứa tên giống định danh không bị kiểm tra.
+	if err := pm.ValidatePolicy([]string{"*", "Action == 'User.read(x)'", "allow"}); err != nil {
+		t.Fatalf("expected string literal to be ignored, got %v", err)
+	}
+}
+
+func TestPolicyManager_RejectsInvalidWrites(t *testing.T) {
+	pm := newValidationTestManager(t)
+
+	if _, err := pm.AddPolicy([]string{"*", "Action == 'read' && hasRol(Subject, 'admin')", "allow", "p1"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("AddPolicy: expected ErrInvalidPolicy, got %v", err)
+	}
+	// AddPolicies là nguyên tử: một policy lỗi thì không policy nào được thêm.
+	_, err := pm.AddPolicies([][]string{
+		{"*", "Action == 'read'", "allow", "p1"},
+		{"*", "Action == 'write'", "maybe", "p2"},
+	})
+	if !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("AddPolicies: expected ErrInvalidPolicy, got %v", err)
+	}
+	if rows, _ := pm.GetPolicies(); len(rows) != 0 {
+		t.Fatalf("expected no policy to be added, got %v", rows)
+	}
+
+	if _, err := pm.AddPolicy([]string{"*", "Action == 'read'", "allow", "p1"}); err != nil {
+		t.Fatalf("AddPolicy failed: %v", err)
+	}
+	if _, err := pm.UpdatePolicy([]string{"*", "Action == 'read'", "allow", "p1"}, []string{"*", "Action == 'read' && Tenant.id == 'x'", "allow"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("UpdatePolicy: expected ErrInvalidPolicy, got %v", err)
+	}
+	if _, err := pm.CreatePolicy(Policy{TenantID: "*", Rule: "matches(Subject.email)", Effect: "allow"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("CreatePolicy: expected ErrInvalidPolicy, got %v", err)
+	}
+	if _, err := pm.UpdatePolicyByID("p1", Policy{TenantID: "*", Rule: "Action == 'read'", Effect: "Allow"}); !errors.Is(err, ErrInvalidPolicy) {
+		t.Fatalf("UpdatePolicyByID: expected ErrInvalidPolicy, got %v", err)
+	}
+	if rows, _ := pm.GetPolicies(); len(rows) != 1 || rows[0][1] != "Action == 'read'" {
+		t.Fatalf("expected the original policy to be unchanged, got %v", rows)
+	}
+}
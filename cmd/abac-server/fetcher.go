@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/duclek15/go-abac-library/abac"
+)
+
+var (
+	// errInlineRequired được trả về khi không cấu hình fetcher mà request không gửi thuộc tính inline.
+	errInlineRequired = errors.New("attributes must be passed inline (no fetcher configured)")
+	// errInlineNotAllowed được trả về khi request gửi thuộc tính inline cho subject/resource đã có
+	// fetcher (trừ khi bật -trust-inline-attributes).
+	errInlineNotAllowed = errors.New("inline attributes are not accepted when a fetcher url is configured")
+)
+
+// remoteFetcher lấy thuộc tính qua HTTP GET theo một URL mẫu chứa "{id}", ví dụ
+// "http://users.internal/attributes/{id}". Response 404 được hiểu là không tìm thấy.
+type remoteFetcher struct {
+	template string
+	client   *http.Client
+}
+
+func newRemoteFetcher(template string, timeout time.Duration) (*remoteFetcher, error) {
+	if !strings.Contains(template, "{id}") {
+		return nil, fmt.Errorf("fetcher url %q must contain {id}", template)
+	}
+	return &remoteFetcher{template: template, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// fetch trả về body JSON đã decode, notFound nếu server trả về 404.
+func (f *remoteFetcher) fetch(ctx *context.Context, id interface{}, notFound error) (interface{}, error) {
+	var key string
+	switch v := id.(type) {
+	case string:
+		key = v
+	case float64:
+		key = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return nil, fmt.Errorf("%w: unsupported id %v", notFound, id)
+	}
+	c := context.Background()
+	if ctx != nil && *ctx != nil {
+		c = *ctx
+	}
+	req, err := http.NewRequestWithContext(c, http.MethodGet, strings.ReplaceAll(f.template, "{id}", url.PathEscape(key)), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attributes: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, notFound
+	case resp.StatusCode != http.StatusOK:
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("failed to fetch attributes: %s returned %s", req.URL.Redacted(), resp.Status)
+	}
+	var body interface{}
+	if err := decodeJSON(resp.Body, &body); err != nil {
+		return nil, fmt.Errorf("failed to decode attributes: %w", err)
+	}
+	return body, nil
+}
+
+// attributeFetcher là SubjectFetcher/ResourceFetcher của server: giá trị ID được lấy qua
+// remoteFetcher nếu có cấu hình; object JSON được dùng trực tiếp làm thuộc tính chỉ khi không có
+// remoteFetcher tương ứng (hoặc trustInline), để client không thể tự gửi thuộc tính thay cho PIP.
+type attributeFetcher struct {
+	subjects    *remoteFetcher
+	resources   *remoteFetcher
+	trustInline bool
+}
+
+func (f *attributeFetcher) GetSubjectAttributes(ctx *context.Context, subject interface{}) (abac.Attributes, error) {
+	if attrs, ok := subject.(map[string]interface{}); ok {
+		if f.subjects != nil && !f.trustInline {
+			return nil, fmt.Errorf("subject: %w", errInlineNotAllowed)
+		}
+		return attrs, nil
+	}
+	if f.subjects == nil {
+		return nil, fmt.Errorf("%w: subject %s", abac.ErrSubjectNotFound, errInlineRequired)
+	}
+	body, err := f.subjects.fetch(ctx, subject, abac.ErrSubjectNotFound)
+	if err != nil {
+		return nil, err
+	}
+	attrs, ok := body.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("failed to decode attributes: subject %v is not an object", subject)
+	}
+	return attrs, nil
+}
+
+func (f *attributeFetcher) GetResourceAttributes(ctx *context.Context, resource interface{}) ([]abac.Attributes, error) {
+	switch v := resource.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}, []interface{}:
+		if f.resources != nil && !f.trustInline {
+			return nil, fmt.Errorf("resource: %w", errInlineNotAllowed)
+		}
+		return resourceList(v)
+	}
+	if f.resources == nil {
+		return nil, fmt.Errorf("%w: resource %s", abac.ErrResourceNotFound, errInlineRequired)
+	}
+	body, err := f.resources.fetch(ctx, resource, abac.ErrResourceNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return resourceList(body)
+}
+
+// resourceList chấp nhận một object hoặc một mảng object (nhiều resource).
+func resourceList(v interface{}) ([]abac.Attributes, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return []abac.Attributes{v}, nil
+	case []interface{}:
+		list := make([]abac.Attributes, 0, len(v))
+		for i, item := range v {
+			attrs, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%w: resource %d is not an object", abac.ErrResourceNotFound, i)
+			}
+			list = append(list, attrs)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("failed to decode attributes: resource %v is not an object", v)
+}
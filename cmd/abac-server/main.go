@@ -0,0 +1,269 @@
+// Command abac-server chạy thư viện như một PDP độc lập (ví dụ sidecar) với API JSON:
+//
+//	POST /v1/decision          quyết định cho một request (kèm trace/explanation nếu yêu cầu, cần
+//	                           admin token hoặc -allow-trace)
+//	POST /v1/decisions         quyết định cho nhiều request
+//	GET|POST /v1/policies      liệt kê / tạo policy (cần -admin-token)
+//	GET|PUT|DELETE /v1/policies/{id}
+//	POST /access/v1/evaluation, /access/v1/evaluations   API AuthZEN (xem abac/authzen)
+//	GET /.well-known/authzen-configuration
+//	GET /healthz
+//
+// Policy được nạp từ file (-policy) hoặc database (-db-driver, -db-dsn). Thuộc tính subject và
+// resource được gửi inline trong request, hoặc lấy qua HTTP khi cấu hình -subject-url/-resource-url;
+// khi đó thuộc tính inline bị từ chối và properties của request AuthZEN bị bỏ qua (trừ khi bật
+// -trust-inline-attributes / -authzen-trust-properties).
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	gormadapter "github.com/casbin/gorm-adapter/v3"
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/abac/authzen"
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type options struct {
+	addr                string
+	modelPath           string
+	policyPath          string
+	dbDriver            string
+	dbDSN               string
+	dbTable             string
+	migrate             bool
+	algorithm           string
+	subjectURL          string
+	resourceURL         string
+	fetchTimeout        time.Duration
+	adminToken          string
+	allowTrace          bool
+	watch               time.Duration
+	decisionCache       bool
+	maxBatch            int
+	maxBody             int64
+	concurrency         int
+	authzenTenantHeader string
+	authzenProperties   bool
+	trustInline         bool
+}
+
+func parseFlags(args []string) (*options, error) {
+	o := &options{}
+	fs := flag.NewFlagSet("abac-server", flag.ContinueOnError)
+	fs.StringVar(&o.addr, "addr", ":8080", "listen address")
+	fs.StringVar(&o.modelPath, "model", "", "path to the Casbin model file (required)")
+	fs.StringVar(&o.policyPath, "policy", "", "path to the policy CSV file (file backend)")
+	fs.StringVar(&o.dbDriver, "db-driver", "", "database driver for the DB backend: sqlite, mysql, postgres or sqlserver")
+	fs.StringVar(&o.dbDSN, "db-dsn", "", "database DSN (DB backend)")
+	fs.StringVar(&o.dbTable, "db-table", "", "policy table name (default casbin_rule)")
+	fs.BoolVar(&o.migrate, "db-migrate", false, "create the policy, policy metadata and policy set tables if they do not exist")
+	fs.StringVar(&o.algorithm, "algorithm", "", "default combining algorithm (default deny-overrides)")
+	fs.StringVar(&o.subjectURL, "subject-url", "", "URL template for fetching subject attributes, e.g. http://users/attributes/{id}")
+	fs.StringVar(&o.resourceURL, "resource-url", "", "URL template for fetching resource attributes")
+	fs.BoolVar(&o.trustInline, "trust-inline-attributes", false, "accept inline subject/resource attributes in /v1/decision even when -subject-url/-resource-url is set; INSECURE: clients can grant themselves attributes")
+	fs.DurationVar(&o.fetchTimeout, "fetch-timeout", 5*time.Second, "timeout of attribute fetch requests")
+	fs.StringVar(&o.adminToken, "admin-token", os.Getenv("ABAC_ADMIN_TOKEN"), "bearer token of the admin API; empty disables it (env ABAC_ADMIN_TOKEN)")
+	fs.BoolVar(&o.allowTrace, "allow-trace", false, "return trace/explain to any caller of the decision API; by default only requests with the admin token get them")
+	fs.DurationVar(&o.watch, "watch", 0, "reload policies when the files or the table change, checked at this interval (0 disables)")
+	fs.BoolVar(&o.decisionCache, "decision-cache", false, "enable the decision cache")
+	fs.IntVar(&o.maxBatch, "max-batch", 100, "maximum number of requests in /v1/decisions")
+	fs.Int64Var(&o.maxBody, "max-body", 1<<20, "maximum request body size in bytes")
+	fs.IntVar(&o.concurrency, "concurrency", 8, "concurrent evaluations per batch")
+	fs.StringVar(&o.authzenTenantHeader, "authzen-tenant-header", "", "read the tenant of AuthZEN requests from this header instead of context.tenant_id")
+	fs.BoolVar(&o.authzenProperties, "authzen-trust-properties", false, "let AuthZEN properties replace the attributes from -subject-url/-resource-url; INSECURE: clients can grant themselves attributes, use only when every client is trusted")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	switch {
+	case o.modelPath == "":
+		return nil, errors.New("-model is required")
+	case (o.policyPath == "") == (o.dbDriver == ""):
+		return nil, errors.New("exactly one of -policy or -db-driver is required")
+	case o.dbDriver != "" && o.dbDSN == "":
+		return nil, errors.New("-db-dsn is required with -db-driver")
+	case o.maxBatch < 1 || o.maxBody < 1 || o.concurrency < 1:
+		return nil, errors.New("-max-batch, -max-body and -concurrency must be positive")
+	}
+	return o, nil
+}
+
+func openDB(driver, dsn string) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch driver {
+	case "sqlite":
+		dialector = sqlite.Open(dsn)
+	case "mysql":
+		dialector = mysql.Open(dsn)
+	case "postgres":
+		dialector = postgres.Open(dsn)
+	case "sqlserver":
+		dialector = sqlserver.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return db, nil
+}
+
+// newServer tạo hệ thống ABAC bằng các factory function theo backend đã chọn.
+// Hàm stop dừng watcher (nếu có).
+func newServer(o *options) (*server, func(), error) {
+	fetcher := &attributeFetcher{trustInline: o.trustInline}
+	var err error
+	if o.subjectURL != "" {
+		if fetcher.subjects, err = newRemoteFetcher(o.subjectURL, o.fetchTimeout); err != nil {
+			return nil, nil, err
+		}
+	}
+	if o.resourceURL != "" {
+		if fetcher.resources, err = newRemoteFetcher(o.resourceURL, o.fetchTimeout); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Fetcher được bọc để nhận thêm subject/resource AuthZEN (xem abac/authzen).
+	sf := authzen.NewSubjectFetcher(fetcher, authzen.WithAttributeSource(authzenSource(o.subjectURL, o.authzenProperties)))
+	rf := authzen.NewResourceFetcher(fetcher, authzen.WithAttributeSource(authzenSource(o.resourceURL, o.authzenProperties)))
+
+	var opts []abac.SystemOption
+	if o.algorithm != "" {
+		opts = append(opts, abac.WithCombiningAlgorithm(abac.CombiningAlgorithm(o.algorithm)))
+	}
+	if o.decisionCache {
+		opts = append(opts, abac.WithDecisionCache())
+	}
+
+	var (
+		authorizer *abac.Authorizer
+		pm         *abac.PolicyManager
+		persist    func() error
+	)
+	if o.policyPath != "" {
+		authorizer, pm, err = abac.NewABACSystemFromFile(o.modelPath, o.policyPath, sf, rf, nil, opts...)
+		persist = func() error { return writePolicyFile(o.policyPath, pm) }
+	} else {
+		var db *gorm.DB
+		if db, err = openDB(o.dbDriver, o.dbDSN); err != nil {
+			return nil, nil, err
+		}
+		if o.migrate {
+			table := o.dbTable
+			if table == "" {
+				table = "casbin_rule"
+			}
+			if err := db.Table(table).AutoMigrate(&gormadapter.CasbinRule{}); err != nil {
+				return nil, nil, fmt.Errorf("failed to migrate policy table: %w", err)
+			}
+			opts = append(opts, abac.WithAutoMigrate())
+		}
+		if o.dbTable != "" {
+			authorizer, pm, err = abac.NewABACSystemFromDBUseTableName(o.modelPath, db, "", o.dbTable, sf, rf, nil, opts...)
+		} else {
+			authorizer, pm, err = abac.NewABACSystemFromDB(o.modelPath, db, sf, rf, nil, opts...)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stop := func() {}
+	if o.watch > 0 {
+		watchOpts := []abac.WatcherOption{
+			abac.WithWatchInterval(o.watch),
+			abac.WithOnReload(func() { log.Print("policies reloaded") }),
+			abac.WithOnReloadError(func(err error) { log.Printf("policy reload failed: %v", err) }),
+		}
+		var watcher *abac.PolicyWatcher
+		if o.policyPath != "" {
+			watcher, err = pm.WatchFiles(watchOpts...)
+		} else {
+			watcher, err = pm.WatchDB(watchOpts...)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		stop = watcher.Stop
+	}
+
+	authzenOpts := []authzen.Option{authzen.WithDecisionContext()}
+	if o.authzenTenantHeader != "" {
+		authzenOpts = append(authzenOpts, authzen.WithTenant(authzen.TenantFromHeader(o.authzenTenantHeader)))
+	}
+
+	return &server{
+		authorizer:  authorizer,
+		authzen:     authzen.New(authorizer, authzenOpts...).Handler(),
+		policies:    pm,
+		adminToken:  o.adminToken,
+		allowTrace:  o.allowTrace,
+		persist:     persist,
+		maxBatch:    o.maxBatch,
+		maxBody:     o.maxBody,
+		concurrency: o.concurrency,
+	}, stop, nil
+}
+
+// authzenSource chọn nguồn thuộc tính AuthZEN: có URL fetcher thì chỉ lấy qua fetcher (properties
+// do client gửi bị bỏ qua), trừ khi bật -authzen-trust-properties; không có URL thì properties là
+// nguồn duy nhất.
+func authzenSource(fetchURL string, trustProperties bool) authzen.AttributeSource {
+	switch {
+	case fetchURL == "":
+		return authzen.PropertiesOnly
+	case trustProperties:
+		return authzen.PropertiesOrFetch
+	}
+	return authzen.FetchOnly
+}
+
+func main() {
+	o, err := parseFlags(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("abac-server: %v", err)
+	}
+	s, stop, err := newServer(o)
+	if err != nil {
+		log.Fatalf("abac-server: %v", err)
+	}
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              o.addr,
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, done := context.WithTimeout(context.Background(), 10*time.Second)
+		defer done()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("abac-server listening on %s", o.addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("abac-server: %v", err)
+	}
+}
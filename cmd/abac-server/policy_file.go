@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/duclek15/go-abac-library/abac"
+)
+
+// writePolicyFile ghi các dòng "p" hiện tại của pm xuống file policy. Khác với file adapter của
+// Casbin (nối các trường bằng ", " không bọc nháy), mỗi dòng được ghi theo CSV nên rule chứa dấu
+// phẩy vẫn đọc lại được. Các dòng khác "p" (comment, "g", ...) của file cũ được giữ nguyên.
+// File được thay bằng rename để WatchFiles không đọc phải nội dung ghi dở.
+func writePolicyFile(path string, pm *abac.PolicyManager) error {
+	rows, err := pm.GetPolicies()
+	if err != nil {
+		return err
+	}
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var buf bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(old))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if ptype, _, _ := strings.Cut(strings.TrimSpace(line), ","); strings.TrimSpace(ptype) == "p" {
+			continue
+		}
+		if strings.TrimSpace(line) != "" {
+			buf.WriteString(line + "\n")
+		}
+	}
+	w := csv.NewWriter(&buf)
+	for _, row := range rows {
+		if err := w.Write(append([]string{"p"}, row...)); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace policy file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/abac/authzen"
+	"golang.org/x/sync/errgroup"
+)
+
+// server phục vụ API quyết định (/v1/decision, /v1/decisions, AuthZEN) và API quản trị policy
+// (/v1/policies).
+type server struct {
+	authorizer *abac.Authorizer
+	policies   *abac.PolicyManager
+	// authzen phục vụ các endpoint AuthZEN (abac/authzen).
+	authzen http.Handler
+	// adminToken là bearer token của API quản trị; rỗng thì API quản trị bị tắt.
+	adminToken string
+	// allowTrace cho mọi client yêu cầu trace/explain; mặc định chỉ request có admin token.
+	allowTrace bool
+	// persist lưu tập policy sau mỗi lần ghi (backend file, xem writePolicyFile); nil với backend
+	// DB (adapter tự lưu).
+	persist     func() error
+	persistMu   sync.Mutex
+	maxBatch    int
+	maxBody     int64
+	concurrency int
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("POST /v1/decision", s.handleDecision)
+	mux.HandleFunc("POST /v1/decisions", s.handleDecisions)
+	if s.authzen != nil {
+		mux.Handle(authzen.EvaluationPath, s.authzen)
+		mux.Handle(authzen.EvaluationsPath, s.authzen)
+		mux.Handle(authzen.WellKnownPath, s.authzen)
+	}
+	if s.adminToken != "" {
+		mux.Handle("GET /v1/policies", s.admin(s.handleListPolicies))
+		mux.Handle("POST /v1/policies", s.admin(s.handleCreatePolicy))
+		mux.Handle("GET /v1/policies/{id}", s.admin(s.handleGetPolicy))
+		mux.Handle("PUT /v1/policies/{id}", s.admin(s.handleUpdatePolicy))
+		mux.Handle("DELETE /v1/policies/{id}", s.admin(s.handleDeletePolicy))
+	}
+	return mux
+}
+
+// decisionRequest là body của /v1/decision. Subject/resource là object JSON (thuộc tính inline)
+// hoặc ID được truyền cho fetcher; resource có thể là mảng object (nhiều resource).
+type decisionRequest struct {
+	TenantID string          `json:"tenant_id"`
+	Subject  interface{}     `json:"subject"`
+	Resource interface{}     `json:"resource,omitempty"`
+	Action   string          `json:"action"`
+	Env      abac.Attributes `json:"env,omitempty"`
+	// Trace trả về DecisionTrace; Explain trả về Explanation. Cả hai lộ nội dung policy và thuộc
+	// tính nên cần admin token (hoặc -allow-trace).
+	Trace   bool `json:"trace,omitempty"`
+	Explain bool `json:"explain,omitempty"`
+}
+
+func (req *decisionRequest) validate() error {
+	switch {
+	case req.TenantID == "":
+		return errors.New("tenant_id is required")
+	case req.Subject == nil:
+		return errors.New("subject is required")
+	case req.Action == "":
+		return errors.New("action is required")
+	}
+	return nil
+}
+
+type decisionResponse struct {
+	abac.Decision
+	Allowed     bool                `json:"allowed"`
+	ErrorDetail []string            `json:"errors,omitempty"`
+	Trace       *abac.DecisionTrace `json:"trace,omitempty"`
+	Explanation *abac.Explanation   `json:"explanation,omitempty"`
+}
+
+type batchRequest struct {
+	Requests []decisionRequest `json:"requests"`
+}
+
+type batchResponse struct {
+	Decisions []decisionResponse `json:"decisions"`
+}
+
+func (s *server) handleDecision(w http.ResponseWriter, r *http.Request) {
+	var req decisionRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+	if err := req.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if (req.Trace || req.Explain) && !s.traceAllowed(r) {
+		writeError(w, http.StatusForbidden, errTraceForbidden)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.decide(r, &req))
+}
+
+// handleDecisions đánh giá song song (tối đa s.concurrency) các request; thứ tự kết quả giữ
+// nguyên thứ tự request. Một request không hợp lệ làm cả batch bị từ chối.
+func (s *server) handleDecisions(w http.ResponseWriter, r *http.Request) {
+	var batch batchRequest
+	if !s.decode(w, r, &batch) {
+		return
+	}
+	if len(batch.Requests) > s.maxBatch {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("batch has %d requests, limit is %d", len(batch.Requests), s.maxBatch))
+		return
+	}
+	for i := range batch.Requests {
+		if err := batch.Requests[i].validate(); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("requests[%d]: %w", i, err))
+			return
+		}
+		if (batch.Requests[i].Trace || batch.Requests[i].Explain) && !s.traceAllowed(r) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("requests[%d]: %w", i, errTraceForbidden))
+			return
+		}
+	}
+	resp := batchResponse{Decisions: make([]decisionResponse, len(batch.Requests))}
+	var g errgroup.Group
+	g.SetLimit(s.concurrency)
+	for i := range batch.Requests {
+		g.Go(func() error {
+			resp.Decisions[i] = s.decide(r, &batch.Requests[i])
+			return nil
+		})
+	}
+	_ = g.Wait()
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// errTraceForbidden được trả về (403) khi client không có quyền yêu cầu trace/explain.
+var errTraceForbidden = errors.New("trace and explain require the admin token")
+
+// decide đánh giá request một lần; trace (nếu được yêu cầu) là trace của chính lần đánh giá đó.
+func (s *server) decide(r *http.Request, req *decisionRequest) decisionResponse {
+	ctx := r.Context()
+	var env *abac.Attributes
+	if req.Env != nil {
+		env = &req.Env
+	}
+	var (
+		d     abac.Decision
+		trace *abac.DecisionTrace
+	)
+	if req.Trace || req.Explain {
+		d, trace = s.authorizer.DecideWithTrace(&ctx, req.TenantID, req.Subject, req.Resource, req.Action, env)
+	} else {
+		d = s.authorizer.Decide(&ctx, req.TenantID, req.Subject, req.Resource, req.Action, env)
+	}
+	resp := decisionResponse{Decision: d, Allowed: d.Allowed()}
+	for _, err := range d.Errors {
+		resp.ErrorDetail = append(resp.ErrorDetail, err.Error())
+	}
+	if req.Trace {
+		resp.Trace = trace
+	}
+	if req.Explain && trace != nil {
+		resp.Explanation, _ = s.authorizer.Explain(trace)
+	}
+	return resp
+}
+
+// traceAllowed cho biết request được nhận trace/explain: server bật -allow-trace hoặc request
+// có admin token.
+func (s *server) traceAllowed(r *http.Request) bool {
+	return s.allowTrace || s.isAdmin(r)
+}
+
+// isAdmin kiểm tra header "Authorization: Bearer <admin token>"; luôn false khi không có admin token.
+func (s *server) isAdmin(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && s.adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// admin yêu cầu header "Authorization: Bearer <admin token>".
+func (s *server) admin(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="abac-admin"`)
+			writeError(w, http.StatusUnauthorized, errors.New("invalid admin token"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+func (s *server) handleListPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := s.policies.ListPolicies(r.URL.Query().Get("tenant_id"))
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]abac.Policy{"policies": policies})
+}
+
+func (s *server) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	p, err := s.policies.GetPolicyByID(r.PathValue("id"))
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (s *server) handleCreatePolicy(w http.ResponseWriter, r *http.Request) {
+	var p abac.Policy
+	if !s.decode(w, r, &p) {
+		return
+	}
+	created, err := s.policies.CreatePolicy(p)
+	if err == nil {
+		err = s.save()
+	}
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/v1/policies/"+created.ID)
+	writeJSON(w, http.StatusCreated, created)
+}
+
+func (s *server) handleUpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	var p abac.Policy
+	if !s.decode(w, r, &p) {
+		return
+	}
+	updated, err := s.policies.UpdatePolicyByID(r.PathValue("id"), p)
+	if err == nil {
+		err = s.save()
+	}
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (s *server) handleDeletePolicy(w http.ResponseWriter, r *http.Request) {
+	removed, err := s.policies.DeletePolicyByID(r.PathValue("id"))
+	if err == nil && !removed {
+		err = abac.ErrPolicyNotFound
+	}
+	if err == nil {
+		err = s.save()
+	}
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) save() error {
+	if s.persist == nil {
+		return nil
+	}
+	s.persistMu.Lock()
+	defer s.persistMu.Unlock()
+	if err := s.persist(); err != nil {
+		return fmt.Errorf("failed to save policies: %w", err)
+	}
+	return nil
+}
+
+// decode đọc body JSON (giới hạn s.maxBody byte); trả về false và viết lỗi 400/413 nếu thất bại.
+func (s *server) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := decodeJSON(http.MaxBytesReader(w, r.Body, s.maxBody), v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+	} else {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %w", err))
+	}
+	return false
+}
+
+func decodeJSON(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+type errorResponse struct {
+	Error  string                 `json:"error"`
+	Issues []abac.ValidationIssue `json:"issues,omitempty"`
+}
+
+func writePolicyError(w http.ResponseWriter, err error) {
+	var invalid *abac.PolicyValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error(), Issues: invalid.Issues})
+	case errors.Is(err, abac.ErrInvalidPolicy), errors.Is(err, abac.ErrPolicyIDNotSupported),
+		errors.Is(err, abac.ErrPriorityNotSupported), errors.Is(err, abac.ErrObligationsNotSupported):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, abac.ErrPolicyNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, abac.ErrPolicyExists):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
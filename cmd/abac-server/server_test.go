@@ -0,0 +1,453 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/duclek15/go-abac-library/abac"
+	"github.com/duclek15/go-abac-library/abac/authzen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testModel = `
+[request_definition]
+r = tenant, req
+
+[policy_definition]
+p = tenant, rule, eft, id
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = (r.tenant == p.tenant || p.tenant == '*') && evaluate(p.rule, r.req, p.id)`
+
+const testPolicies = `# policy của tenant1
+p, tenant1, "Action == 'read' && Resource.owner in ('alice', 'bob')", allow, read_owned
+p, tenant1, "Action == 'delete' && Subject.role == 'admin'", allow, admin_delete
+`
+
+const adminToken = "secret"
+
+func newTestServer(t *testing.T, args ...string) (http.Handler, string) {
+	t.Helper()
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "model.conf")
+	policyPath := filepath.Join(dir, "policy.csv")
+	require.NoError(t, os.WriteFile(modelPath, []byte(testModel), 0o600))
+	require.NoError(t, os.WriteFile(policyPath, []byte(testPolicies), 0o600))
+
+	o, err := parseFlags(append([]string{"-model", modelPath, "-policy", policyPath, "-admin-token", adminToken}, args...))
+	require.NoError(t, err)
+	s, stop, err := newServer(o)
+	require.NoError(t, err)
+	t.Cleanup(stop)
+	return s.routes(), policyPath
+}
+
+func do(t *testing.T, h http.Handler, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if s, ok := body.(string); ok {
+		buf.WriteString(s)
+	} else if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	r := httptest.NewRequest(method, path, &buf)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func decodeBody[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v), w.Body.String())
+	return v
+}
+
+type decisionResult struct {
+	Effect      abac.DecisionEffect `json:"effect"`
+	Allowed     bool                `json:"allowed"`
+	PolicyIDs   []string            `json:"policy_ids"`
+	Errors      []string            `json:"errors"`
+	Trace       *abac.DecisionTrace `json:"trace"`
+	Explanation *abac.Explanation   `json:"explanation"`
+}
+
+func TestDecision_InlineAttributes(t *testing.T) {
+	h, _ := newTestServer(t)
+
+	w := do(t, h, "POST", "/v1/decision", "", map[string]interface{}{
+		"tenant_id": "tenant1",
+		"subject":   map[string]interface{}{"id": "alice"},
+		"resource":  map[string]interface{}{"owner": "alice"},
+		"action":    "read",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	d := decodeBody[decisionResult](t, w)
+	assert.Equal(t, abac.Permit, d.Effect)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, []string{"read_owned"}, d.PolicyIDs)
+	assert.Nil(t, d.Trace)
+
+	w = do(t, h, "POST", "/v1/decision", adminToken, map[string]interface{}{
+		"tenant_id": "tenant1",
+		"subject":   map[string]interface{}{"id": "carol"},
+		"resource":  map[string]interface{}{"owner": "dave"},
+		"action":    "read",
+		"trace":     true,
+		"explain":   true,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	d = decodeBody[decisionResult](t, w)
+	assert.Equal(t, abac.NotApplicable, d.Effect)
+	assert.False(t, d.Allowed)
+	require.NotNil(t, d.Trace)
+	assert.NotEmpty(t, d.Trace.Policies)
+	require.NotNil(t, d.Explanation)
+	require.NotEmpty(t, d.Explanation.ClosestAllowRules)
+	assert.Equal(t, "read_owned", d.Explanation.ClosestAllowRules[0].PolicyID)
+
+	// Không có fetcher: subject dạng ID không thể giải quyết.
+	w = do(t, h, "POST", "/v1/decision", "", map[string]interface{}{
+		"tenant_id": "tenant1", "subject": "alice", "action": "read",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	d = decodeBody[decisionResult](t, w)
+	assert.Equal(t, abac.Indeterminate, d.Effect)
+	require.Len(t, d.Errors, 1)
+	assert.Contains(t, d.Errors[0], "inline")
+}
+
+func TestDecision_TraceRequiresAdminToken(t *testing.T) {
+	traced := map[string]interface{}{
+		"tenant_id": "tenant1",
+		"subject":   map[string]interface{}{"id": "carol"},
+		"resource":  map[string]interface{}{"owner": "dave"},
+		"action":    "read",
+		"explain":   true,
+	}
+	h, _ := newTestServer(t)
+	for _, token := range []string{"", "wrong"} {
+		w := do(t, h, "POST", "/v1/decision", token, traced)
+		assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+		w = do(t, h, "POST", "/v1/decisions", token, map[string]interface{}{"requests": []interface{}{traced}})
+		assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	}
+
+	// Không có admin token thì trace chỉ mở được bằng -allow-trace.
+	h, _ = newTestServer(t, "-admin-token", "")
+	assert.Equal(t, http.StatusForbidden, do(t, h, "POST", "/v1/decision", "", traced).Code)
+	h, _ = newTestServer(t, "-admin-token", "", "-allow-trace")
+	w := do(t, h, "POST", "/v1/decision", "", traced)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	d := decodeBody[decisionResult](t, w)
+	assert.Nil(t, d.Trace)
+	require.NotNil(t, d.Explanation)
+	assert.Equal(t, "read_owned", d.Explanation.ClosestAllowRules[0].PolicyID)
+}
+
+func TestDecision_TraceEvaluatesOnce(t *testing.T) {
+	var fetches int
+	attrs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		_, _ = w.Write([]byte(`{"id": "alice"}`))
+	}))
+	defer attrs.Close()
+	h, _ := newTestServer(t, "-subject-url", attrs.URL+"/subjects/{id}")
+
+	w := do(t, h, "POST", "/v1/decision", adminToken, map[string]interface{}{
+		"tenant_id": "tenant1", "subject": "alice", "resource": map[string]interface{}{"owner": "bob"},
+		"action": "read", "trace": true, "explain": true,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	d := decodeBody[decisionResult](t, w)
+	assert.Equal(t, abac.Permit, d.Effect)
+	require.NotNil(t, d.Trace)
+	assert.Equal(t, abac.Permit, d.Trace.Effect)
+	assert.Equal(t, 1, fetches)
+}
+
+func TestDecision_InvalidRequest(t *testing.T) {
+	h, _ := newTestServer(t, "-max-body", "256")
+
+	tests := []struct {
+		name string
+		body interface{}
+		code int
+	}{
+		{"missing tenant", map[string]interface{}{"subject": map[string]interface{}{}, "action": "read"}, http.StatusBadRequest},
+		{"missing subject", map[string]interface{}{"tenant_id": "tenant1", "action": "read"}, http.StatusBadRequest},
+		{"missing action", map[string]interface{}{"tenant_id": "tenant1", "subject": map[string]interface{}{}}, http.StatusBadRequest},
+		{"malformed JSON", `{"tenant_id":`, http.StatusBadRequest},
+		{"trailing data", `{"tenant_id":"tenant1","subject":{},"action":"read"} {}`, http.StatusBadRequest},
+		{"body too large", `{"tenant_id":"` + strings.Repeat("x", 512) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(t, h, "POST", "/v1/decision", "", tc.body)
+			assert.Equal(t, tc.code, w.Code, w.Body.String())
+			assert.NotEmpty(t, decodeBody[errorResponse](t, w).Error)
+		})
+	}
+}
+
+func TestDecisions_Batch(t *testing.T) {
+	h, _ := newTestServer(t, "-max-batch", "3", "-concurrency", "2")
+
+	request := func(owner, action string) map[string]interface{} {
+		return map[string]interface{}{
+			"tenant_id": "tenant1",
+			"subject":   map[string]interface{}{"id": "alice", "role": "admin"},
+			"resource":  map[string]interface{}{"owner": owner},
+			"action":    action,
+		}
+	}
+	w := do(t, h, "POST", "/v1/decisions", "", map[string]interface{}{
+		"requests": []interface{}{request("bob", "read"), request("dave", "read"), request("dave", "delete")},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resp := decodeBody[struct {
+		Decisions []decisionResult `json:"decisions"`
+	}](t, w)
+	require.Len(t, resp.Decisions, 3)
+	assert.Equal(t, abac.Permit, resp.Decisions[0].Effect)
+	assert.Equal(t, abac.NotApplicable, resp.Decisions[1].Effect)
+	assert.Equal(t, []string{"admin_delete"}, resp.Decisions[2].PolicyIDs)
+
+	w = do(t, h, "POST", "/v1/decisions", "", map[string]interface{}{
+		"requests": []interface{}{request("a", "read"), request("b", "read"), request("c", "read"), request("d", "read")},
+	})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = do(t, h, "POST", "/v1/decisions", "", map[string]interface{}{
+		"requests": []interface{}{request("a", "read"), map[string]interface{}{"tenant_id": "tenant1"}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, decodeBody[errorResponse](t, w).Error, "requests[1]")
+}
+
+func TestDecision_RemoteFetcher(t *testing.T) {
+	attrs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/subjects/alice":
+			_, _ = w.Write([]byte(`{"id": "alice", "role": "admin"}`))
+		case "/resources/42":
+			_, _ = w.Write([]byte(`[{"owner": "alice"}, {"owner": "bob"}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer attrs.Close()
+	h, _ := newTestServer(t, "-subject-url", attrs.URL+"/subjects/{id}", "-resource-url", attrs.URL+"/resources/{id}")
+
+	tests := []struct {
+		name     string
+		subject  interface{}
+		resource interface{}
+		effect   abac.DecisionEffect
+		errText  string
+	}{
+		{"fetched subject and resources", "alice", 42, abac.Permit, ""},
+		{"inline resource rejected with fetcher", "alice", map[string]interface{}{"owner": "bob"}, abac.Indeterminate, errInlineNotAllowed.Error()},
+		{"inline subject rejected with fetcher", map[string]interface{}{"id": "mallory", "role": "admin"}, 42, abac.Indeterminate, errInlineNotAllowed.Error()},
+		{"unknown subject", "mallory", 42, abac.Indeterminate, abac.ErrSubjectNotFound.Error()},
+		{"unknown resource", "alice", "missing", abac.Indeterminate, abac.ErrResourceNotFound.Error()},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(t, h, "POST", "/v1/decision", "", map[string]interface{}{
+				"tenant_id": "tenant1", "subject": tc.subject, "resource": tc.resource, "action": "read",
+			})
+			require.Equal(t, http.StatusOK, w.Code)
+			d := decodeBody[decisionResult](t, w)
+			assert.Equal(t, tc.effect, d.Effect)
+			if tc.errText != "" {
+				require.NotEmpty(t, d.Errors)
+				assert.Contains(t, d.Errors[0], tc.errText)
+			}
+		})
+	}
+
+	// -trust-inline-attributes cho object inline thay fetcher.
+	h, _ = newTestServer(t, "-subject-url", attrs.URL+"/subjects/{id}", "-resource-url", attrs.URL+"/resources/{id}", "-trust-inline-attributes")
+	w := do(t, h, "POST", "/v1/decision", "", map[string]interface{}{
+		"tenant_id": "tenant1", "subject": "alice", "resource": map[string]interface{}{"owner": "dave"}, "action": "read",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, abac.NotApplicable, decodeBody[decisionResult](t, w).Effect)
+
+	_, err := newRemoteFetcher("http://attrs/subjects", 0)
+	assert.Error(t, err)
+}
+
+func TestAuthZEN(t *testing.T) {
+	h, _ := newTestServer(t, "-authzen-tenant-header", "X-Tenant-ID")
+
+	r := httptest.NewRequest("POST", "/access/v1/evaluation", strings.NewReader(`{
+		"subject": {"type": "user", "id": "alice", "properties": {"department": "sales"}},
+		"resource": {"type": "document", "id": "42", "properties": {"owner": "bob"}},
+		"action": {"name": "read"}
+	}`))
+	r.Header.Set("X-Tenant-ID", "tenant1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	resp := decodeBody[authzen.EvaluationResponse](t, w)
+	assert.True(t, resp.Decision)
+	assert.Equal(t, "permit", resp.Context["effect"])
+
+	// Subject chỉ có id: không có fetcher nên không quyết định được.
+	r = httptest.NewRequest("POST", "/access/v1/evaluation", strings.NewReader(`{
+		"subject": {"type": "user", "id": "alice"},
+		"resource": {"type": "document", "id": "42"},
+		"action": {"name": "read"}
+	}`))
+	r.Header.Set("X-Tenant-ID", "tenant1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	resp = decodeBody[authzen.EvaluationResponse](t, w)
+	assert.False(t, resp.Decision)
+	assert.Equal(t, "indeterminate", resp.Context["effect"])
+
+	w = do(t, h, "GET", "/.well-known/authzen-configuration", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/access/v1/evaluations")
+}
+
+func TestAuthZEN_FetchedAttributesWinOverProperties(t *testing.T) {
+	attrs := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id": "alice", "role": "viewer"}`))
+	}))
+	defer attrs.Close()
+	// Client tự gửi role "admin" cho một subject có fetcher.
+	evaluate := func(h http.Handler) authzen.EvaluationResponse {
+		r := httptest.NewRequest("POST", "/access/v1/evaluation", strings.NewReader(`{
+			"subject": {"type": "user", "id": "alice", "properties": {"role": "admin"}},
+			"resource": {"type": "document", "id": "42"},
+			"action": {"name": "delete"},
+			"context": {"tenant_id": "tenant1"}
+		}`))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return decodeBody[authzen.EvaluationResponse](t, w)
+	}
+
+	h, _ := newTestServer(t, "-subject-url", attrs.URL+"/subjects/{id}")
+	resp := evaluate(h)
+	assert.False(t, resp.Decision)
+	assert.Equal(t, "not_applicable", resp.Context["effect"])
+
+	h, _ = newTestServer(t, "-subject-url", attrs.URL+"/subjects/{id}", "-authzen-trust-properties")
+	assert.True(t, evaluate(h).Decision)
+}
+
+func TestAdminPolicies(t *testing.T) {
+	h, policyPath := newTestServer(t)
+
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, "GET", "/v1/policies", "", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(t, h, "GET", "/v1/policies", "wrong", nil).Code)
+
+	w := do(t, h, "GET", "/v1/policies?tenant_id=tenant1", adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, decodeBody[map[string][]abac.Policy](t, w)["policies"], 2)
+
+	// Tạo policy mới: quyết định thay đổi ngay và file policy được ghi lại.
+	w = do(t, h, "POST", "/v1/policies", adminToken, abac.Policy{
+		ID: "write_own", TenantID: "tenant1", Effect: "allow",
+		Rule: "Action in ('update', 'write') && Resource.owner == Subject.id",
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, "/v1/policies/write_own", w.Header().Get("Location"))
+	decision := map[string]interface{}{
+		"tenant_id": "tenant1",
+		"subject":   map[string]interface{}{"id": "alice"},
+		"resource":  map[string]interface{}{"owner": "alice"},
+		"action":    "write",
+	}
+	assert.Equal(t, abac.Permit, decodeBody[decisionResult](t, do(t, h, "POST", "/v1/decision", "", decision)).Effect)
+
+	content, err := os.ReadFile(policyPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "# policy của tenant1")
+	fetcher := &attributeFetcher{}
+	_, pm, err := abac.NewABACSystemFromFile(filepath.Join(filepath.Dir(policyPath), "model.conf"), policyPath, fetcher, fetcher, nil)
+	require.NoError(t, err)
+	reloaded, err := pm.GetPolicyByID("write_own")
+	require.NoError(t, err)
+	assert.Equal(t, "Action in ('update', 'write') && Resource.owner == Subject.id", reloaded.Rule)
+	reloaded, err = pm.GetPolicyByID("read_owned")
+	require.NoError(t, err)
+	assert.Equal(t, "Action == 'read' && Resource.owner in ('alice', 'bob')", reloaded.Rule)
+	policies, err := pm.ListPolicies("")
+	require.NoError(t, err)
+	assert.Len(t, policies, 3)
+
+	w = do(t, h, "POST", "/v1/policies", adminToken, abac.Policy{ID: "write_own", TenantID: "tenant1", Effect: "allow", Rule: "true"})
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = do(t, h, "POST", "/v1/policies", adminToken, abac.Policy{TenantID: "tenant1", Effect: "allow", Rule: "Action == 'read' &&"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.NotEmpty(t, decodeBody[errorResponse](t, w).Issues)
+
+	w = do(t, h, "GET", "/v1/policies/write_own", adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "tenant1", decodeBody[abac.Policy](t, w).TenantID)
+
+	w = do(t, h, "PUT", "/v1/policies/write_own", adminToken, abac.Policy{
+		TenantID: "tenant1", Effect: "allow", Rule: "Action == 'update' && Resource.owner == Subject.id",
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, abac.NotApplicable, decodeBody[decisionResult](t, do(t, h, "POST", "/v1/decision", "", decision)).Effect)
+
+	assert.Equal(t, http.StatusNoContent, do(t, h, "DELETE", "/v1/policies/write_own", adminToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, h, "DELETE", "/v1/policies/write_own", adminToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, h, "GET", "/v1/policies/write_own", adminToken, nil).Code)
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	h, _ := newTestServer(t, "-admin-token", "")
+	assert.Equal(t, http.StatusNotFound, do(t, h, "GET", "/v1/policies", "", nil).Code)
+	assert.Equal(t, http.StatusOK, do(t, h, "GET", "/healthz", "", nil).Code)
+}
+
+func TestParseFlags(t *testing.T) {
+	_, err := parseFlags([]string{"-policy", "p.csv"})
+	assert.ErrorContains(t, err, "-model")
+	_, err = parseFlags([]string{"-model", "m.conf"})
+	assert.ErrorContains(t, err, "-policy or -db-driver")
+	_, err = parseFlags([]string{"-model", "m.conf", "-policy", "p.csv", "-db-driver", "sqlite"})
+	assert.ErrorContains(t, err, "-policy or -db-driver")
+	_, err = parseFlags([]string{"-model", "m.conf", "-db-driver", "sqlite"})
+	assert.ErrorContains(t, err, "-db-dsn")
+
+	// Backend DB: bảng policy được tạo với -db-migrate.
+	dir := t.TempDir()
+	modelPath := filepath.Join(dir, "model.conf")
+	require.NoError(t, os.WriteFile(modelPath, []byte(testModel), 0o600))
+	o, err := parseFlags([]string{"-model", modelPath, "-db-driver", "sqlite", "-db-dsn", filepath.Join(dir, "abac.db"), "-db-migrate", "-admin-token", adminToken})
+	require.NoError(t, err)
+	s, stop, err := newServer(o)
+	require.NoError(t, err)
+	defer stop()
+	assert.Nil(t, s.persist)
+	_, err = s.policies.CreatePolicy(abac.Policy{ID: "db_read", TenantID: "tenant1", Effect: "allow", Rule: "Action == 'read'"})
+	require.NoError(t, err)
+	ctx := context.Background()
+	ok, err := s.authorizer.Check(&ctx, "tenant1", map[string]interface{}{}, nil, "read", nil)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}